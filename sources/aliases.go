@@ -0,0 +1,406 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// aliasActionsBatch - maximum number of actions sent in a single POST /_aliases request
+// Actions for the same alias are never split between requests, so no alias is ever partially updated
+const aliasActionsBatch int = 1000
+
+var (
+	// NoDropPattern - aliases and indices matching this pattern are never dropped as unused (they are maintained outside of fixtures aliases)
+	// Foundation-f aliases are not included, their names depend on configuration (see FAliasesConfig.FAliasPattern)
+	NoDropPattern = regexp.MustCompile(`^(.+-earned_media|.+-dads-.+|.+-slack|.+-da-ds-gha-.+|.+-social_media|.+-last-action-date-cache|.+-flat-.+|.+-flat)$`)
+	// NotMissingPattern - aliases and indices matching this pattern are not reported as missing
+	NotMissingPattern = regexp.MustCompile(`^.+-github-pull_request.*$`)
+)
+
+// AliasState - single alias pointing to an index, Filter is canonical JSON of alias filter (empty when not filtered)
+type AliasState struct {
+	Index  string
+	Alias  string
+	Filter string
+}
+
+// AliasPlan - changes needed to get from the current to the desired aliases state
+// Missing contains 'from' indices (or patterns) from fixtures that have no matching index in ES
+// Desired is the whole desired state the plan was made for (set by ReconcileAliases)
+type AliasPlan struct {
+	Add     []AliasState
+	Remove  []AliasState
+	Missing []string
+	Desired []AliasState
+}
+
+// NormalizeAliases - converts fixture's aliases slugs into ES index and alias names
+// 'from' gets "sds-" prefix (unless it is an external, postprocessed or pattern source), 'to' and views get "sds-" prefix, '/' is replaced with '-'
+func NormalizeAliases(fixture *Fixture) {
+	for ai, alias := range fixture.Aliases {
+		var idxSlug string
+		if IsExternalIndex(alias.From) || strings.HasPrefix(alias.From, "pattern:") || strings.HasPrefix(alias.From, "postprocess-") {
+			idxSlug = alias.From
+		} else {
+			idxSlug = "sds-" + alias.From
+		}
+		if !strings.HasPrefix(alias.From, "pattern:") {
+			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
+		}
+		fixture.Aliases[ai].From = idxSlug
+		for ti, to := range alias.To {
+			idxSlug := ""
+			if strings.HasPrefix(to, "postprocess") {
+				idxSlug = "postprocess-sds-" + strings.TrimPrefix(to, "postprocess/")
+			} else {
+				idxSlug = "sds-" + to
+			}
+			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
+			fixture.Aliases[ai].To[ti] = idxSlug
+
+		}
+		for vi, v := range alias.Views {
+			idxSlug := "sds-" + v.Name
+			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
+			fixture.Aliases[ai].Views[vi].Name = idxSlug
+		}
+	}
+}
+
+// canonicalJSON - marshals alias filter with sorted keys, works for YAML (map[interface{}]interface{}) and JSON decoded data
+// so the same filter coming from fixture and from ES gives the same string
+func canonicalJSON(v interface{}) string {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, k := range keys {
+			items = append(items, `"`+jsonEscape(k)+`":`+canonicalJSON(value[k]))
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, item := range value {
+			m[fmt.Sprintf("%v", k)] = item
+		}
+		return canonicalJSON(m)
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			items = append(items, canonicalJSON(item))
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	data, err := jsoniter.Marshal(v)
+	if err != nil {
+		Fatalf("json marshall error: %+v, data: %+v", err, v)
+	}
+	return string(data)
+}
+
+// indexPatternRE - converts ES index pattern (comma separated list with '*' wildcards) into a regexp
+func indexPatternRE(pattern string) *regexp.Regexp {
+	parts := []string{}
+	for _, part := range strings.Split(pattern, ",") {
+		parts = append(parts, strings.Replace(regexp.QuoteMeta(strings.TrimSpace(part)), `\*`, ".*", -1))
+	}
+	return regexp.MustCompile("^(" + strings.Join(parts, "|") + ")$")
+}
+
+// DesiredAliases - computes aliases that should exist for all fixtures, indices is the list of existing ES indices
+// 'pattern:' sources are expanded to all matching indices, views give filtered aliases
+// Dedup lists only select indices external index is deduplicated against, they don't define any aliases
+func DesiredAliases(fixtures []Fixture, indices []string) (desired []AliasState, missing []string) {
+	exists := make(map[string]struct{})
+	for _, index := range indices {
+		exists[index] = struct{}{}
+	}
+	resolved := make(map[string][]string)
+	resolve := func(from string) []string {
+		matched, ok := resolved[from]
+		if ok {
+			return matched
+		}
+		if strings.HasPrefix(from, "pattern:") {
+			re := indexPatternRE(from[8:])
+			for _, index := range indices {
+				if re.MatchString(index) {
+					matched = append(matched, index)
+				}
+			}
+		} else {
+			_, ok = exists[from]
+			if ok {
+				matched = []string{from}
+			}
+		}
+		if len(matched) == 0 {
+			missing = append(missing, strings.TrimPrefix(from, "pattern:"))
+		}
+		resolved[from] = matched
+		return matched
+	}
+	seen := make(map[[2]string]struct{})
+	add := func(index, alias, filter string) {
+		alias = strings.Replace(alias, "/", "-", -1)
+		key := [2]string{index, alias}
+		_, ok := seen[key]
+		if ok {
+			return
+		}
+		seen[key] = struct{}{}
+		desired = append(desired, AliasState{Index: index, Alias: alias, Filter: filter})
+	}
+	for _, fixture := range fixtures {
+		for _, alias := range fixture.Aliases {
+			if len(alias.To) == 0 && len(alias.Views) == 0 {
+				continue
+			}
+			for _, index := range resolve(alias.From) {
+				for _, to := range alias.To {
+					add(index, to, "")
+				}
+				for _, view := range alias.Views {
+					add(index, view.Name, canonicalJSON(view.Filter))
+				}
+			}
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+// PlanAliases - diffs desired and current aliases state
+// Aliases are added when missing or when their filter differs, with cleanup aliases from desired state that point to other indices are removed
+func PlanAliases(desired, current []AliasState, cleanup bool) (plan AliasPlan) {
+	got := make(map[[2]string]string)
+	for _, state := range current {
+		got[[2]string{state.Index, state.Alias}] = state.Filter
+	}
+	should := make(map[[2]string]struct{})
+	names := make(map[string]struct{})
+	for _, state := range desired {
+		key := [2]string{state.Index, state.Alias}
+		should[key] = struct{}{}
+		names[state.Alias] = struct{}{}
+		filter, ok := got[key]
+		if !ok || filter != state.Filter {
+			plan.Add = append(plan.Add, state)
+		}
+	}
+	if cleanup {
+		for _, state := range current {
+			_, ok := names[state.Alias]
+			if !ok {
+				continue
+			}
+			_, ok = should[[2]string{state.Index, state.Alias}]
+			if !ok {
+				plan.Remove = append(plan.Remove, state)
+			}
+		}
+	}
+	less := func(states []AliasState) func(i, j int) bool {
+		return func(i, j int) bool {
+			if states[i].Alias == states[j].Alias {
+				return states[i].Index < states[j].Index
+			}
+			return states[i].Alias < states[j].Alias
+		}
+	}
+	sort.Slice(plan.Add, less(plan.Add))
+	sort.Slice(plan.Remove, less(plan.Remove))
+	return
+}
+
+// Empty - true when plan has no changes
+func (plan *AliasPlan) Empty() bool {
+	return len(plan.Add) == 0 && len(plan.Remove) == 0
+}
+
+// Summary - human readable list of alias changes
+func (plan *AliasPlan) Summary() string {
+	s := fmt.Sprintf("Aliases: %d to add, %d to remove", len(plan.Add), len(plan.Remove))
+	if len(plan.Missing) > 0 {
+		s += fmt.Sprintf(", %d sources without index: %s", len(plan.Missing), strings.Join(plan.Missing, ", "))
+	}
+	s += "\n"
+	for _, state := range plan.Remove {
+		s += fmt.Sprintf("  - %s -> %s\n", state.Alias, state.Index)
+	}
+	for _, state := range plan.Add {
+		if state.Filter != "" {
+			s += fmt.Sprintf("  + %s -> %s filter %s\n", state.Alias, state.Index, state.Filter)
+			continue
+		}
+		s += fmt.Sprintf("  + %s -> %s\n", state.Alias, state.Index)
+	}
+	return s
+}
+
+// Batches - returns POST /_aliases payloads, all actions for a given alias are in the same payload
+func (plan *AliasPlan) Batches() (payloads []string) {
+	byAlias := make(map[string][]string)
+	aliases := []string{}
+	action := func(typ string, state AliasState) {
+		act := `{"` + typ + `":{"index":"` + jsonEscape(state.Index) + `","alias":"` + jsonEscape(state.Alias) + `"`
+		if state.Filter != "" {
+			act += `,"filter":` + state.Filter
+		}
+		act += `}}`
+		_, ok := byAlias[state.Alias]
+		if !ok {
+			aliases = append(aliases, state.Alias)
+		}
+		byAlias[state.Alias] = append(byAlias[state.Alias], act)
+	}
+	for _, state := range plan.Remove {
+		action("remove", state)
+	}
+	for _, state := range plan.Add {
+		action("add", state)
+	}
+	sort.Strings(aliases)
+	actions := []string{}
+	flush := func() {
+		if len(actions) > 0 {
+			payloads = append(payloads, `{"actions":[`+strings.Join(actions, ",")+`]}`)
+			actions = []string{}
+		}
+	}
+	for _, alias := range aliases {
+		if len(actions) > 0 && len(actions)+len(byAlias[alias]) > aliasActionsBatch {
+			flush()
+		}
+		actions = append(actions, byAlias[alias]...)
+	}
+	flush()
+	return
+}
+
+// EsIndices - returns names of all ES indices
+func EsIndices(ctx *Ctx) (indices []string, err error) {
+	path := "/_cat/indices?format=json&h=index"
+	status, body, err := esRequest(ctx, Printf, Get, path, "")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, path, status, body)
+		return
+	}
+	var result []struct {
+		Index string `json:"index"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		return
+	}
+	for _, item := range result {
+		indices = append(indices, item.Index)
+	}
+	sort.Strings(indices)
+	return
+}
+
+// EsAliases - returns current aliases state with filters
+// Same data as _cat/aliases, but _cat API only reports if alias has a filter, not the filter itself
+func EsAliases(ctx *Ctx) (current []AliasState, err error) {
+	path := "/_alias"
+	status, body, err := esRequest(ctx, Printf, Get, path, "")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, path, status, body)
+		return
+	}
+	var result map[string]struct {
+		Aliases map[string]struct {
+			Filter interface{} `json:"filter"`
+		} `json:"aliases"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		return
+	}
+	for index, data := range result {
+		for alias, def := range data.Aliases {
+			state := AliasState{Index: index, Alias: alias}
+			if def.Filter != nil {
+				state.Filter = canonicalJSON(def.Filter)
+			}
+			current = append(current, state)
+		}
+	}
+	return
+}
+
+// ApplyAliasPlan - applies plan using POST /_aliases, each batch is applied atomically by ES
+func ApplyAliasPlan(ctx *Ctx, plan *AliasPlan) (err error) {
+	for i, payload := range plan.Batches() {
+		status, body, e := esRequest(ctx, Printf, Post, "/_aliases", payload)
+		if e != nil {
+			err = e
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:/_aliases batch:%d status:%d\n%s", Post, i+1, status, body)
+			return
+		}
+	}
+	for _, state := range plan.Remove {
+		RecordChange(ReportChangeAlias, "remove", state.Alias, state.Index)
+	}
+	for _, state := range plan.Add {
+		if state.Filter != "" {
+			RecordChange(ReportChangeAlias, "view", state.Alias, state.Index)
+			continue
+		}
+		RecordChange(ReportChangeAlias, "add", state.Alias, state.Index)
+	}
+	return
+}
+
+// ReconcileAliases - computes desired aliases for all fixtures, diffs them against ES and applies the difference
+// With cleanup aliases configured in fixtures are also removed from indices they should no longer point to
+// Aliases pointing to external indices deduplicated via alias policy get filters excluding shared origins
+// With SDS_SHARED_ENDPOINTS=alias consumers' aliases also point to owners' indices filtered by shared origins
+func ReconcileAliases(ctx *Ctx, fixtures []Fixture, cleanup bool) (plan AliasPlan, err error) {
+	indices, err := EsIndices(ctx)
+	if err != nil {
+		return
+	}
+	current, err := EsAliases(ctx)
+	if err != nil {
+		return
+	}
+	dedup, err := ExternalDedupStates(ctx)
+	if err != nil {
+		return
+	}
+	desired, missing := DesiredAliases(fixtures, indices)
+	desired = SharedEndpointsAliases(ctx, desired, fixtures, indices)
+	desired = FilterExternalAliases(desired, dedup)
+	plan = PlanAliases(desired, current, cleanup)
+	plan.Missing = missing
+	plan.Desired = desired
+	Printf("%s", plan.Summary())
+	if plan.Empty() {
+		return
+	}
+	if ctx.DryRun {
+		Printf("DryRun: not applying %d alias batches\n", len(plan.Batches()))
+		return
+	}
+	err = ApplyAliasPlan(ctx, &plan)
+	return
+}
@@ -0,0 +1,164 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestPlanAliases(t *testing.T) {
+	filter := map[interface{}]interface{}{"term": map[interface{}]interface{}{"project": "CLI"}}
+	fixtures := []lib.Fixture{
+		{
+			Aliases: []lib.Alias{
+				{From: "sds-a-git", To: []string{"sds-a", "sds-all"}},
+				{From: "pattern:sds-b-*", To: []string{"sds-all"}, Views: []lib.AliasView{{Name: "sds-b-cli", Filter: filter}}},
+				{From: "bitergia-c", To: []string{"sds-all"}, Dedup: []string{"sds-c-git"}},
+			},
+		},
+		{
+			Aliases: []lib.Alias{
+				{From: "sds-a-git", To: []string{"sds-all"}},
+			},
+		},
+	}
+	indices := []string{"sds-a-git", "sds-b-git", "sds-b-jira", "sds-old-git"}
+	desired, missing := lib.DesiredAliases(fixtures, indices)
+	expected := []lib.AliasState{
+		{Index: "sds-a-git", Alias: "sds-a"},
+		{Index: "sds-a-git", Alias: "sds-all"},
+		{Index: "sds-b-git", Alias: "sds-all"},
+		{Index: "sds-b-git", Alias: "sds-b-cli", Filter: `{"term":{"project":"CLI"}}`},
+		{Index: "sds-b-jira", Alias: "sds-all"},
+		{Index: "sds-b-jira", Alias: "sds-b-cli", Filter: `{"term":{"project":"CLI"}}`},
+	}
+	if !reflect.DeepEqual(desired, expected) || !reflect.DeepEqual(missing, []string{"bitergia-c"}) {
+		t.Fatalf("expected desired %+v and missing [bitergia-c], got %+v, %+v", expected, desired, missing)
+	}
+	current := []lib.AliasState{
+		{Index: "sds-a-git", Alias: "sds-a"},
+		{Index: "sds-old-git", Alias: "sds-all"},
+		{Index: "sds-old-git", Alias: "sds-unknown"},
+		{Index: "sds-b-git", Alias: "sds-b-cli", Filter: `{"term":{"project":"CLI"}}`},
+		{Index: "sds-b-jira", Alias: "sds-b-cli", Filter: `{"term":{"project":"Old"}}`},
+	}
+
+	// Test cases
+	var testCases = []struct {
+		cleanup bool
+		add     int
+		remove  []lib.AliasState
+	}{
+		{cleanup: false, add: 4, remove: nil},
+		{cleanup: true, add: 4, remove: []lib.AliasState{{Index: "sds-old-git", Alias: "sds-all"}}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		plan := lib.PlanAliases(desired, current, test.cleanup)
+		if len(plan.Add) != test.add || !reflect.DeepEqual(plan.Remove, test.remove) {
+			t.Errorf("test number %d, expected %d adds and removes %+v, got %+v", index+1, test.add, test.remove, plan)
+		}
+		if plan.Add[3].Index != "sds-b-jira" || plan.Add[3].Alias != "sds-b-cli" {
+			t.Errorf("test number %d, expected changed view filter to be re-added, got %+v", index+1, plan.Add)
+		}
+	}
+	plan := lib.PlanAliases(desired, desired, true)
+	if !plan.Empty() || len(plan.Batches()) != 0 {
+		t.Errorf("expected empty plan, got %+v", plan)
+	}
+}
+
+func TestAliasPlanBatches(t *testing.T) {
+	plan := lib.AliasPlan{
+		Remove: []lib.AliasState{{Index: "sds-old", Alias: "sds-a"}},
+		Add:    []lib.AliasState{{Index: "sds-new", Alias: "sds-a"}, {Index: "sds-x", Alias: "sds-v", Filter: `{"term":{"p":"x"}}`}},
+	}
+	batches := plan.Batches()
+	expected := `{"actions":[{"remove":{"index":"sds-old","alias":"sds-a"}},{"add":{"index":"sds-new","alias":"sds-a"}},{"add":{"index":"sds-x","alias":"sds-v","filter":{"term":{"p":"x"}}}}]}`
+	if len(batches) != 1 || batches[0] != expected {
+		t.Errorf("expected single batch %s, got %+v", expected, batches)
+	}
+	summary := plan.Summary()
+	if !strings.Contains(summary, "1 to remove") || !strings.Contains(summary, "  - sds-a -> sds-old\n") || !strings.Contains(summary, `  + sds-v -> sds-x filter {"term":{"p":"x"}}`) {
+		t.Errorf("unexpected summary:\n%s", summary)
+	}
+
+	// Large plans are split, but never in the middle of a single alias
+	plan = lib.AliasPlan{}
+	for i := 0; i < 1500; i++ {
+		plan.Add = append(plan.Add, lib.AliasState{Index: fmt.Sprintf("sds-i%d", i), Alias: fmt.Sprintf("sds-a%d", i%3)})
+	}
+	batches = plan.Batches()
+	if len(batches) != 2 || strings.Count(batches[0], `"add"`) != 1000 || strings.Count(batches[1], `"add"`) != 500 {
+		t.Errorf("expected 2 batches with 1000 and 500 actions, got %d", len(batches))
+	}
+	for i, batch := range batches {
+		for j := 0; j < 3; j++ {
+			alias := fmt.Sprintf(`"alias":"sds-a%d"`, j)
+			if strings.Contains(batch, alias) && strings.Count(batch, alias) != 500 {
+				t.Errorf("batch %d splits alias sds-a%d", i+1, j)
+			}
+		}
+	}
+}
+
+func TestReconcileAliases(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	lib.AddRedacted("aliases-s3cr3t", true)
+	posted := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case req.URL.Path == "/_cat/indices":
+			fmt.Fprintf(w, `[{"index":"sds-a-git"},{"index":"sds-b-git"}]`)
+		case req.URL.Path == "/_alias" && req.Method == lib.Get:
+			fmt.Fprintf(w, `{"sds-a-git":{"aliases":{"sds-all":{},"sds-v":{"filter":{"term":{"project":"X"}}}}},"sds-b-git":{"aliases":{"sds-a":{}}}}`)
+		case req.URL.Path == "/_aliases" && req.Method == lib.Post:
+			posted = append(posted, string(body))
+			fmt.Fprintf(w, `{"acknowledged":true}`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	filter := map[interface{}]interface{}{"term": map[interface{}]interface{}{"project": "X"}}
+	fixtures := []lib.Fixture{
+		{
+			Aliases: []lib.Alias{
+				{From: "sds-a-git", To: []string{"sds-a", "sds-all"}, Views: []lib.AliasView{{Name: "sds-v", Filter: filter}}},
+			},
+		},
+	}
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+
+	// Test cases
+	var testCases = []struct {
+		dryRun   bool
+		cleanup  bool
+		expected []string
+	}{
+		{dryRun: true, cleanup: true, expected: []string{}},
+		{dryRun: false, cleanup: false, expected: []string{`{"actions":[{"add":{"index":"sds-a-git","alias":"sds-a"}}]}`}},
+		{
+			dryRun:   false,
+			cleanup:  true,
+			expected: []string{`{"actions":[{"remove":{"index":"sds-b-git","alias":"sds-a"}},{"add":{"index":"sds-a-git","alias":"sds-a"}}]}`},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		posted = []string{}
+		ctx.DryRun = test.dryRun
+		plan, err := lib.ReconcileAliases(&ctx, fixtures, test.cleanup)
+		if err != nil || len(plan.Add) != 1 || !reflect.DeepEqual(posted, test.expected) {
+			t.Errorf("test number %d, expected posted %+v, got %+v (plan %+v): %+v", index+1, test.expected, posted, plan, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// exitOK - no drift detected
+const exitOK int = 0
+
+// exitDrift - at least one alias drifted
+const exitDrift int = 1
+
+// exitError - drift could not be checked
+const exitError int = 2
+
+func usage() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("  %s [format [fixtures_path]]: report aliases and views drift between fixtures and ElasticSearch (read-only)\n", os.Args[0])
+	fmt.Printf("Format is one of: %s (default), %s, fixtures path defaults to 'data/', ElasticSearch is taken from SDS_ES_URL\n", lib.DriftText, lib.DriftJSON)
+	fmt.Printf("Checks fixtures aliases and views, foundation-f aliases (configured by SDS_FALIASES_CONFIG) and unused aliases that would be dropped\n")
+	fmt.Printf("Exit codes: %d - no drift, %d - drift detected, %d - error\n", exitOK, exitDrift, exitError)
+	fmt.Printf("Example: %s %s data/\n", os.Args[0], lib.DriftJSON)
+}
+
+// prepareFixture - sets what aliases computation needs and is normally set by fixture postprocessing
+// Endpoints are not expanded (regexp endpoints are not resolved), only their presence, projects, groups and ownership matter here
+func prepareFixture(fixture *lib.Fixture) (err error) {
+	for i, ds := range fixture.DataSources {
+		fixture.DataSources[i].FullSlug = strings.Replace(ds.Slug+ds.IndexSuffix, "/", "-", -1)
+		for _, rawEndpoint := range ds.RawEndpoints {
+			fixture.DataSources[i].Endpoints = append(
+				fixture.DataSources[i].Endpoints,
+				lib.Endpoint{Name: rawEndpoint.Name, Project: rawEndpoint.Project, Projects: rawEndpoint.Projects, Groups: rawEndpoint.Groups, Owner: rawEndpoint.Owner},
+			)
+		}
+		for _, project := range ds.Projects {
+			for _, rawEndpoint := range project.RawEndpoints {
+				fixture.DataSources[i].Endpoints = append(fixture.DataSources[i].Endpoints, lib.Endpoint{Name: rawEndpoint.Name, Project: project.Name, Groups: rawEndpoint.Groups, Owner: rawEndpoint.Owner})
+			}
+		}
+	}
+	err = lib.ExpandAliasViews(fixture)
+	if err != nil {
+		return
+	}
+	lib.NormalizeAliases(fixture)
+	return
+}
+
+func readFixtures(ctx *lib.Ctx, path string) (fixtures []lib.Fixture, err error) {
+	// Needed to recognize external indices in fixtures aliases
+	_, err = lib.LoadExternalConfig(ctx)
+	if err != nil {
+		return
+	}
+	for _, fixtureFile := range lib.GetFixtures(ctx, path) {
+		if fixtureFile == "" {
+			continue
+		}
+		var data []byte
+		data, err = ioutil.ReadFile(fixtureFile)
+		if err != nil {
+			return
+		}
+		var fixture lib.Fixture
+		err = yaml.Unmarshal(data, &fixture)
+		if err != nil {
+			err = fmt.Errorf("%s: %+v", fixtureFile, err)
+			return
+		}
+		slug := fixture.Native.Slug
+		if slug == "" || fixture.Disabled {
+			continue
+		}
+		if (ctx.FixturesRE != nil && !ctx.FixturesRE.MatchString(slug)) || (ctx.FixturesSkipRE != nil && ctx.FixturesSkipRE.MatchString(slug)) {
+			continue
+		}
+		fixture.Fn = fixtureFile
+		fixture.Slug = slug
+		err = prepareFixture(&fixture)
+		if err != nil {
+			return
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	// Consumers of shared endpoints get aliases to owners' indices (SDS_SHARED_ENDPOINTS=alias)
+	lib.AssignSharedEndpoints(ctx, fixtures, lib.FindSharedEndpoints(fixtures))
+	return
+}
+
+func checkDrift(ctx *lib.Ctx, format, path string, out *os.File) (drift bool, err error) {
+	fixtures, err := readFixtures(ctx, path)
+	if err != nil {
+		return
+	}
+	if len(fixtures) == 0 {
+		err = fmt.Errorf("no fixtures found in '%s'", path)
+		return
+	}
+	indices, err := lib.EsIndices(ctx)
+	if err != nil {
+		return
+	}
+	current, err := lib.EsAliases(ctx)
+	if err != nil {
+		return
+	}
+	dedup, err := lib.ExternalDedupStates(ctx)
+	if err != nil {
+		return
+	}
+	cfg, err := lib.LoadFAliasesConfig(ctx)
+	if err != nil {
+		return
+	}
+	drifts, checked := lib.AliasesDrift(ctx, &cfg, fixtures, indices, current, dedup)
+	data, err := lib.FormatAliasDrift(drifts, checked, format, time.Now())
+	if err != nil {
+		return
+	}
+	_, err = out.Write(data)
+	drift = len(drifts) > 0
+	return
+}
+
+func main() {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	args := []string{lib.DriftText, ""}
+	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+		usage()
+		return
+	}
+	if len(os.Args) > 3 {
+		usage()
+		os.Exit(exitError)
+	}
+	copy(args, os.Args[1:])
+	// Library progress messages go to stderr, so stdout only has the report
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	drift, err := checkDrift(&ctx, args[0], args[1], stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sds-alias-drift: %+v\n", err)
+		os.Exit(exitError)
+	}
+	if drift {
+		os.Exit(exitDrift)
+	}
+}
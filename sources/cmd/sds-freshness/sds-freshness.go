@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func usage() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("  %s [format [fixtures_path [output_file]]]: list endpoints whose last successful sync is older than their SLA\n", os.Args[0])
+	fmt.Printf("Format is one of: %s (default), %s, %s (all endpoints, for node_exporter textfile collector)\n", lib.FreshnessText, lib.FreshnessJSON, lib.FreshnessPrometheus)
+	fmt.Printf("Fixtures path defaults to 'data/', output file is written atomically, default is stdout\n")
+	fmt.Printf("SLA is taken from SDS_FRESHNESS_SLA, then from data source's max_frequency, then from SDS_FRESHNESS_DEFAULT\n")
+	fmt.Printf("Example: %s %s data/ /var/lib/node_exporter/sds_freshness.prom\n", os.Args[0], lib.FreshnessPrometheus)
+}
+
+func readFixtures(ctx *lib.Ctx, path string) (fixtures []lib.Fixture, err error) {
+	for _, fixtureFile := range lib.GetFixtures(ctx, path) {
+		if fixtureFile == "" {
+			continue
+		}
+		var data []byte
+		data, err = ioutil.ReadFile(fixtureFile)
+		if err != nil {
+			return
+		}
+		var fixture lib.Fixture
+		err = yaml.Unmarshal(data, &fixture)
+		if err != nil {
+			err = fmt.Errorf("%s: %+v", fixtureFile, err)
+			return
+		}
+		slug := fixture.Native.Slug
+		if slug == "" {
+			continue
+		}
+		if (ctx.FixturesRE != nil && !ctx.FixturesRE.MatchString(slug)) || (ctx.FixturesSkipRE != nil && ctx.FixturesSkipRE.MatchString(slug)) {
+			continue
+		}
+		fixture.Fn = fixtureFile
+		fixture.Slug = slug
+		fixtures = append(fixtures, fixture)
+	}
+	return
+}
+
+func writeOutput(fn string, data []byte) (err error) {
+	if fn == "" {
+		_, err = os.Stdout.Write(data)
+		return
+	}
+	// Write to a temporary file first, so readers (like node_exporter) never see partial file
+	tmp := fn + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp, fn)
+}
+
+func checkFreshness(ctx *lib.Ctx, format, path, output string) error {
+	fixtures, err := readFixtures(ctx, path)
+	if err != nil {
+		return err
+	}
+	endpoints, err := lib.FreshnessEndpoints(ctx, fixtures)
+	if err != nil {
+		return err
+	}
+	infos, err := lib.GetSyncInfos(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	items := lib.CheckFreshness(endpoints, infos, now)
+	data, err := lib.FormatFreshness(items, format, now)
+	if err != nil {
+		return err
+	}
+	return writeOutput(output, data)
+}
+
+func main() {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	args := []string{lib.FreshnessText, "", ""}
+	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+		usage()
+		return
+	}
+	if len(os.Args) > 4 {
+		usage()
+		os.Exit(1)
+	}
+	copy(args, os.Args[1:])
+	err := checkFreshness(&ctx, args[0], args[1], args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sds-freshness: %+v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func usage() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("  %s: built-in git data source, clones/fetches repository and writes raw and rich commit documents\n", os.Args[0])
+	fmt.Printf("Configuration is taken from environment (syncdatasources sets it for fixture data sources with '%s' config flag):\n", lib.NativeGit)
+	fmt.Printf("  SDS_GIT_URL (required), SDS_GIT_RAW_INDEX, SDS_GIT_RICH_INDEX (required), SDS_GIT_ES_URL (default SDS_ES_URL)\n")
+	fmt.Printf("  SDS_GIT_PROJECT, SDS_GIT_PROJECT_SLUG, SDS_GIT_NO_RAW, SDS_GIT_FORCE_FULL, SDS_GIT_ES_BULK_SIZE, SDS_GIT_DEBUG\n")
+	fmt.Printf("  SDS_GIT_AFFILIATION_API_URL with AUTH0_DATA - resolve authors and committers via SortingHat (identities have no affiliations otherwise)\n")
+	fmt.Printf("Local clones are kept in SDS_VERIFY_GIT_PATH (default $HOME/.perceval/repositories), when %s is set that mirror is used as is\n", lib.GitMirrorEnv)
+	fmt.Printf("Example: SDS_GIT_URL=https://github.com/cncf/devstats SDS_GIT_RAW_INDEX=sds-cncf-devstats-git-raw SDS_GIT_RICH_INDEX=sds-cncf-devstats-git %s\n", os.Args[0])
+}
+
+func gitConfig(ctx *lib.Ctx) (cfg lib.GitCollectConfig, err error) {
+	cfg = lib.GitCollectConfig{
+		URL:         os.Getenv("SDS_GIT_URL"),
+		Mirror:      os.Getenv(lib.GitMirrorEnv),
+		RawIndex:    os.Getenv("SDS_GIT_RAW_INDEX"),
+		RichIndex:   os.Getenv("SDS_GIT_RICH_INDEX"),
+		Project:     os.Getenv("SDS_GIT_PROJECT"),
+		ProjectSlug: os.Getenv("SDS_GIT_PROJECT_SLUG"),
+		NoRaw:       os.Getenv("SDS_GIT_NO_RAW") != "",
+		ForceFull:   os.Getenv("SDS_GIT_FORCE_FULL") != "",
+	}
+	if cfg.URL == "" || cfg.RichIndex == "" || (cfg.RawIndex == "" && !cfg.NoRaw) {
+		err = fmt.Errorf("SDS_GIT_URL, SDS_GIT_RICH_INDEX and SDS_GIT_RAW_INDEX (unless SDS_GIT_NO_RAW is set) must be set")
+		return
+	}
+	if os.Getenv("SDS_GIT_ES_URL") != "" {
+		ctx.ElasticURL = os.Getenv("SDS_GIT_ES_URL")
+		lib.AddRedacted(ctx.ElasticURL, false)
+	}
+	if os.Getenv("SDS_GIT_ES_BULK_SIZE") != "" {
+		cfg.BulkSize, err = strconv.Atoi(os.Getenv("SDS_GIT_ES_BULK_SIZE"))
+		if err != nil {
+			return
+		}
+	}
+	if os.Getenv("SDS_GIT_DEBUG") != "" {
+		ctx.Debug, err = strconv.Atoi(os.Getenv("SDS_GIT_DEBUG"))
+		if err != nil {
+			return
+		}
+	}
+	if os.Getenv("SDS_GIT_AFFILIATION_API_URL") != "" {
+		cfg.Affiliations, err = lib.NewAffiliationsClient(os.Getenv("SDS_GIT_AFFILIATION_API_URL"), cfg.ProjectSlug)
+	}
+	return
+}
+
+func main() {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	if len(os.Args) > 1 {
+		usage()
+		if os.Args[1] == "-h" || os.Args[1] == "--help" {
+			return
+		}
+		os.Exit(1)
+	}
+	cfg, err := gitConfig(&ctx)
+	if err != nil {
+		usage()
+		fmt.Fprintf(os.Stderr, "sds-git: %+v\n", err)
+		os.Exit(1)
+	}
+	dtStart := time.Now()
+	n, err := lib.GitCollect(&ctx, &cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sds-git: %s: %s\n", cfg.URL, lib.FilterRedacted(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d commits processed in %v\n", cfg.URL, n, time.Now().Sub(dtStart))
+}
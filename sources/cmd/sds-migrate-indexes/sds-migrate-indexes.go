@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func usage() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("  %s [index ...]: install index templates and reindex SDS-owned indexes into their explicit mappings\n", os.Args[0])
+	fmt.Printf("Known indexes: %v (default is all of them)\n", lib.SDSIndexes())
+	fmt.Printf("Should be run when SDS is not running, use SDS_DRY_RUN=1 to only report mapping mismatches\n")
+}
+
+func main() {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	indexes := lib.SDSIndexes()
+	if len(os.Args) > 1 {
+		if os.Args[1] == "-h" || os.Args[1] == "--help" {
+			usage()
+			return
+		}
+		indexes = os.Args[1:]
+	}
+	failed := false
+	for _, index := range indexes {
+		if !ctx.DryRun && !lib.PutIndexTemplate(&ctx, lib.Printf, index) {
+			fmt.Printf("sds-migrate-indexes %s: cannot install index template\n", index)
+			failed = true
+			continue
+		}
+		_, err := lib.MigrateIndex(&ctx, index)
+		if err != nil {
+			fmt.Printf("sds-migrate-indexes %s: %+v\n", index, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
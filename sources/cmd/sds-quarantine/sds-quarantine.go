@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func usage() {
+	fmt.Printf("Usage:\n")
+	fmt.Printf("  %s [list]: list quarantined endpoints with their last error\n", os.Args[0])
+	fmt.Printf("  %s release index [endpoint]: release endpoint (or all endpoints of the index when no endpoint is given) from quarantine\n", os.Args[0])
+	fmt.Printf("Example: %s release sds-onap-gerrit https://gerrit.onap.org\n", os.Args[0])
+}
+
+func listQuarantined(ctx *lib.Ctx) error {
+	items, err := lib.GetQuarantined(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	nActive := 0
+	for _, item := range items {
+		if item.Active(now) {
+			nActive++
+		}
+	}
+	if nActive == 0 {
+		fmt.Printf("No quarantined endpoints\n")
+		return nil
+	}
+	lib.PrintQuarantineReport(items, now)
+	return nil
+}
+
+func releaseQuarantined(ctx *lib.Ctx, index, endpoint string) error {
+	if ctx.DryRun {
+		fmt.Printf("Would release %s '%s' from quarantine (dry run)\n", index, endpoint)
+		return nil
+	}
+	released, err := lib.ReleaseQuarantine(ctx, index, endpoint)
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return fmt.Errorf("no quarantine records found for %s '%s'", index, endpoint)
+	}
+	fmt.Printf("Released %d endpoint(s) of %s from quarantine\n", released, index)
+	return nil
+}
+
+func main() {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	cmd := "list"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+	var err error
+	switch cmd {
+	case "list":
+		err = listQuarantined(&ctx)
+	case "release":
+		if len(os.Args) < 3 {
+			usage()
+			os.Exit(1)
+		}
+		endpoint := ""
+		if len(os.Args) > 3 {
+			endpoint = os.Args[3]
+		}
+		err = releaseQuarantined(&ctx, os.Args[2], endpoint)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("sds-quarantine %s: %+v\n", cmd, err)
+		os.Exit(1)
+	}
+}
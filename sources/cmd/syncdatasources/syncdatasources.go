@@ -31,17 +31,18 @@ import (
 )
 
 var (
-	randInitOnce      sync.Once
-	gInfoExternal     func()
-	gAliasesFunc      func()
-	gAliasesMtx       *sync.Mutex
-	gCSVMtx           *sync.Mutex
-	gRateMtx          *sync.Mutex
-	gToken            string
-	gHint             int
-	noDropPattern     = regexp.MustCompile(`^(.+-f-.+|.+-earned_media|.+-dads-.+|.+-slack|.+-da-ds-gha-.+|.+-social_media|.+-last-action-date-cache|.+-flat-.+|.+-flat)$`)
-	notMissingPattern = regexp.MustCompile(`^.+-github-pull_request.*$`)
-	emailRegex        = regexp.MustCompile("^[][a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	randInitOnce  sync.Once
+	gInfoExternal func()
+	gExternal     lib.ExternalConfig
+	gAliasesFunc  func()
+	gAliasesMtx   *sync.Mutex
+	gDedupOnce    sync.Once
+	gReportFunc   func(string)
+	gRateMtx      *sync.Mutex
+	gToken        string
+	gHint         int
+	gQuarantined  map[[2]string]lib.QuarantineInfo
+	emailRegex    = regexp.MustCompile("^[][a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	// if a given source is not in dadsTasks - it only supports legacy p2o then
 	// if entry is true - all endpoints using this DS will use the new dads command
 	// if entry is false only items marked via 'dads: true' fixture option will use the new dads command
@@ -574,6 +575,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 						Only:              rawEndpoint.Only,
 						Timeout:           rawEndpoint.Timeout,
 						CopyFrom:          rawEndpoint.CopyFrom,
+						Owner:             rawEndpoint.Owner,
 						AffiliationSource: rawEndpoint.AffiliationSource,
 						PairProgramming:   rawEndpoint.PairProgramming,
 						Groups:            rawEndpoint.Groups[:],
@@ -618,6 +620,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 						Projects:          rawEndpoint.Projects,
 						Timeout:           tmout,
 						CopyFrom:          rawEndpoint.CopyFrom,
+						Owner:             rawEndpoint.Owner,
 						AffiliationSource: rawEndpoint.AffiliationSource,
 						PairProgramming:   rawEndpoint.PairProgramming,
 						Groups:            rawEndpoint.Groups[:],
@@ -745,6 +748,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -798,6 +802,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -845,6 +850,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -906,6 +912,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -1021,6 +1028,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -1132,6 +1140,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 							Projects:          rawEndpoint.Projects,
 							Timeout:           tmout,
 							CopyFrom:          rawEndpoint.CopyFrom,
+							Owner:             rawEndpoint.Owner,
 							AffiliationSource: rawEndpoint.AffiliationSource,
 							PairProgramming:   rawEndpoint.PairProgramming,
 							Groups:            rawEndpoint.Groups[:],
@@ -1157,6 +1166,7 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 						Projects:          rawEndpoint.Projects,
 						Timeout:           tmout,
 						CopyFrom:          rawEndpoint.CopyFrom,
+						Owner:             rawEndpoint.Owner,
 						AffiliationSource: rawEndpoint.AffiliationSource,
 						PairProgramming:   rawEndpoint.PairProgramming,
 						Groups:            rawEndpoint.Groups[:],
@@ -1166,34 +1176,11 @@ func postprocessFixture(igctx context.Context, igc []*github.Client, ctx *lib.Ct
 			}
 		}
 	}
-	for ai, alias := range fixture.Aliases {
-		var idxSlug string
-		if strings.HasPrefix(alias.From, "bitergia-") || strings.HasPrefix(alias.From, "pattern:") || strings.HasPrefix(alias.From, "postprocess-") {
-			idxSlug = alias.From
-		} else {
-			idxSlug = "sds-" + alias.From
-		}
-		if !strings.HasPrefix(alias.From, "pattern:") {
-			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
-		}
-		fixture.Aliases[ai].From = idxSlug
-		for ti, to := range alias.To {
-			idxSlug := ""
-			if strings.HasPrefix(to, "postprocess") {
-				idxSlug = "postprocess-sds-" + strings.TrimPrefix(to, "postprocess/")
-			} else {
-				idxSlug = "sds-" + to
-			}
-			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
-			fixture.Aliases[ai].To[ti] = idxSlug
-
-		}
-		for vi, v := range alias.Views {
-			idxSlug := "sds-" + v.Name
-			idxSlug = strings.Replace(idxSlug, "/", "-", -1)
-			fixture.Aliases[ai].Views[vi].Name = idxSlug
-		}
+	err := lib.ExpandAliasViews(fixture)
+	if err != nil {
+		lib.Fatalf("%+v\n", err)
 	}
+	lib.NormalizeAliases(fixture)
 }
 
 func processFixtureFile(gctx context.Context, gc []*github.Client, ch chan lib.Fixture, ctx *lib.Ctx, fixtureFile string) (fixture lib.Fixture) {
@@ -1269,170 +1256,24 @@ func generateFoundationFAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 		lib.Printf("Skipping f-aliases generation\n")
 		return
 	}
-	fixtures := *pfixtures
-	// The Linux Foundation foundation slug
-	lff := "lf"
-	// DockerHub postprocessed index prefix (possibly others in the future)
-	ppPrefix := "postprocess-"
-	// Foundation-f aliases will look like aliasprefix-founation-f-datasource
-	aliasPrefix := "sds-"
-	// aliasPrefix := "sds-"
-	// It will ook for data in dataprefix-foundation-project-datasurce-index-prefix
-	dataPrefix := "sds-"
-	maxThreads := 12
-	// m[foundation][project][ds] = [full_ds]
-	m := map[string]map[string]map[string]string{}
-	adsm := map[string]struct{}{}
-	var (
-		f    string
-		p    string
-		fpds string
-	)
-	for _, fixture := range fixtures {
-		slug := fixture.Slug
-		ary := strings.Split(slug, "/")
-		if len(ary) < 2 {
-			f = lff
-			p = strings.TrimSpace(ary[0])
-		} else {
-			f = strings.TrimSpace(ary[0])
-			p = strings.TrimSpace(ary[1])
-		}
-		_, ok := m[f]
-		if !ok {
-			m[f] = map[string]map[string]string{}
-		}
-		_, ok = m[f][p]
-		if !ok {
-			m[f][p] = map[string]string{}
-		}
-		for _, ds := range fixture.DataSources {
-			s := strings.Replace(ds.Slug, "/", "-", -1)
-			fs := ds.FullSlug
-			if s == "github-pull_request" {
-				s = "github-issue"
-				fs = strings.Replace(fs, "github-pull_request", "github-issue", -1)
-			}
-			if len(ds.Endpoints) > 0 {
-				m[f][p][s] = fs
-				adsm[strings.Replace(s, "/", "-", -1)] = struct{}{}
-			}
-		}
-	}
-	ads := []string{}
-	for ds := range adsm {
-		ads = append(ads, ds)
-	}
-	sort.Slice(ads, func(i, j int) bool {
-		return len(ads[i]) > len(ads[j])
-	})
-	lib.Printf("Foundation-f all data source types: %+v\n", ads)
-	for _, fixture := range fixtures {
-		slug := fixture.Slug
-		ary := strings.Split(slug, "/")
-		if len(ary) < 2 {
-			f = lff
-			p = strings.TrimSpace(ary[0])
-		} else {
-			f = strings.TrimSpace(ary[0])
-			p = strings.TrimSpace(ary[1])
-		}
-		for _, alias := range fixture.Aliases {
-			for _, to := range alias.To {
-				if to == "" || strings.HasSuffix(to, "-raw") {
-					continue
-				}
-				an := strings.Replace(to, "/", "-", -1)
-				found := false
-				for _, ds := range ads {
-					if strings.Contains(an, ds) && (f == lff || strings.Contains(an, f)) {
-						m[f][p][ds] = "!" + an
-						if ctx.Debug > 0 {
-							lib.Printf("Foundation-f deduced %s,%s,%s -> %s from %s\n", f, p, ds, an, to)
-						}
-						found = true
-						break
-					}
-				}
-				if !found {
-					lib.Printf("Foundation-f cannot deduce data source type from alias name %s in %s/%s, skipping\n", to, f, p)
-				}
-			}
-		}
+	cfg, err := lib.LoadFAliasesConfig(ctx)
+	if err != nil {
+		lib.Printf("ERROR: cannot load foundation-f aliases configuration, skipping f-aliases generation: %+v\n", err)
+		return
 	}
+	ppPrefix := cfg.PostprocessPrefix
+	aliasPrefix := cfg.AliasPrefix
+	dataPrefix := cfg.DataPrefix
+	maxThreads := cfg.MaxThreads
+	config := lib.FoundationFAliases(ctx, &cfg, *pfixtures)
 	ks := []string{}
-	config := map[string][]string{}
 	dst := map[string]struct{}{}
 	src := map[string]struct{}{}
-	for f, ps := range m {
-		if len(ps) == 0 {
-			lib.Printf("foundation: %s has no projects\n", f)
-			continue
-		}
-		dss := map[string]struct{}{}
-		for _, d := range ps {
-			for s := range d {
-				dss[s] = struct{}{}
-			}
-		}
-		if len(dss) == 0 {
-			lib.Printf("foundation: %s has no data sources\n", f)
-			continue
-		}
-		for ds := range dss {
-			aliases := []string{}
-			ppAliases := []string{}
-			for p, d := range ps {
-				fs, ok := d[ds]
-				if !ok {
-					continue
-				}
-				if strings.HasPrefix(fs, "!") {
-					fs = fs[1:]
-					if strings.HasPrefix(fs, dataPrefix) {
-						fpds = fs
-					} else {
-						fpds = dataPrefix + fs
-					}
-				} else {
-					if f == lff {
-						fpds = dataPrefix + p + "-" + fs
-					} else {
-						fpds = dataPrefix + f + "-" + p + "-" + fs
-					}
-				}
-				aliases = append(aliases, fpds)
-				src[fpds] = struct{}{}
-				if ds == "dockerhub" {
-					fpds = "postprocess-" + fpds
-					ppAliases = append(ppAliases, fpds)
-					src[fpds] = struct{}{}
-				}
-			}
-			nAliases := len(aliases)
-			if nAliases == 0 {
-				lib.Printf("foundation: %s, data source: %s has no data sources\n", f, ds)
-				continue
-			}
-			if nAliases > 1 {
-				sort.Strings(aliases)
-			}
-			k := aliasPrefix + f + "-f-" + ds
-			ks = append(ks, k)
-			config[k] = aliases
-			dst[k] = struct{}{}
-			// postprocess- aliases only for dockerhub)
-			nPPAliases := len(ppAliases)
-			if nPPAliases == 0 {
-				continue
-			}
-			if nPPAliases > 1 {
-				sort.Strings(ppAliases)
-			}
-			k = ppPrefix + aliasPrefix + f + "-f-" + ds
-			ks = append(ks, k)
-			config[k] = ppAliases
-			dst[k] = struct{}{}
+	for k, aliases := range config {
+		ks = append(ks, k)
+		dst[k] = struct{}{}
+		for _, alias := range aliases {
+			src[alias] = struct{}{}
 		}
 	}
 	nKs := len(ks)
@@ -1546,13 +1387,14 @@ func generateFoundationFAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 			_, ok := gotA[alias]
 			if !ok {
 				// Note: Skip PRs
-				if !notMissingPattern.MatchString(alias) {
+				if !lib.NotMissingPattern.MatchString(alias) {
 					missing = append(missing, alias)
 				}
 			}
 		}
+		fPattern := cfg.FAliasPattern()
 		for alias := range gotA {
-			if !strings.Contains(alias, "-f-") || !strings.HasPrefix(alias, aliasPrefix) {
+			if !fPattern.MatchString(alias) {
 				continue
 			}
 			_, ok := dst[alias]
@@ -1572,7 +1414,7 @@ func generateFoundationFAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 		lib.Printf("Foundation-f aliases that should probably be dropped (%d): %s\n", len(extra), strings.Join(extra, ", "))
 		return
 	}
-	err := checkIndicesAndAliases()
+	err = checkIndicesAndAliases()
 	if err != nil {
 		lib.Printf("WARNING: maintain foundation-f indices retrned error: %+v, continuying anyway\n", err)
 	}
@@ -1739,6 +1581,13 @@ func generateFoundationFAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 				return
 			}
 			lib.Printf("Method:%s url:%s payload:%s status:%d\n%s\n", method, rurl, payload, resp.StatusCode, body)
+			return
+		}
+		for _, index := range extra {
+			lib.RecordChange(lib.ReportChangeAlias, "remove", alias, index)
+		}
+		for _, index := range missing {
+			lib.RecordChange(lib.ReportChangeAlias, "add", alias, index)
 		}
 		if ctx.Debug > 0 {
 			lib.Printf("Foundation-f: alias configuration changed: %s\n", payload)
@@ -1882,9 +1731,14 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 		}
 		st[slug] = fixture
 	}
-	// Check for duplicated endpoints, they may be moved to a shared.yaml file
-	checkForSharedEndpoints(&fixtures)
+	// Check for duplicated endpoints, they are fetched once by owner fixture when SDS_SHARED_ENDPOINTS is set
+	shared := checkForSharedEndpoints(&fixtures)
+	if ctx.SharedEndpoints != "" {
+		n := lib.AssignSharedEndpoints(ctx, fixtures, shared)
+		lib.Printf("%d shared endpoints, %d consumers' endpoints get data from owners' indices (%s)\n", len(shared), n, ctx.SharedEndpoints)
+	}
 	// Foundation-f aliases
+	lib.SetPhase(ctx, lib.PhaseFAliases)
 	generateFoundationFAliases(ctx, &fixtures)
 	// IMPL
 	/*
@@ -1895,6 +1749,7 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 	// Drop unused indexes, rename indexes if needed, drop unused aliases
 	didRenames := false
 	if !ctx.SkipDropUnused && !ctx.OnlyP2O {
+		lib.SetPhase(ctx, lib.PhaseIndexes)
 		if ctx.NodeNum > 1 {
 			// sdsmtx is an ES wide mutex-like index for blocking between concurrent nodes
 			lib.EnsureIndex(ctx, lib.SDSMtx, false)
@@ -1925,15 +1780,25 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 	if !ctx.SkipSyncInfo && (!ctx.DryRun || ctx.DryRunAllowSyncInfo) {
 		lib.EnsureIndex(ctx, "sdssyncinfo", false)
 	}
+	// SDS indexes retention (lifecycle policies, rollover, pruning), done by the 1st node only
+	if (len(ctx.Retention) > 0 || ctx.LogRollover) && ctx.NodeIdx == 0 && !ctx.DryRun {
+		lib.ApplyRetention(ctx)
+	}
 	// Tasks
 	tasks := []lib.Task{}
 	nodeIdx := ctx.NodeIdx
 	nodeNum := ctx.NodeNum
 	knownDsTypes := make(map[string]struct{})
+	sharedSkipped := 0
 	for _, fixture := range fixtures {
 		for _, dataSource := range fixture.DataSources {
 			knownDsTypes[dataSource.Slug] = struct{}{}
 			for _, endpoint := range dataSource.Endpoints {
+				// Owner fixture fetches shared endpoint, consumers see its data via aliases
+				if endpoint.SharedFrom != "" && ctx.SharedEndpoints == lib.SharedEndpointsAlias {
+					sharedSkipped++
+					continue
+				}
 				if ctx.NodeHash {
 					str := fixture.Slug + dataSource.Slug + endpoint.Name
 					_, run := lib.Hash(str, nodeIdx, nodeNum)
@@ -2027,6 +1892,9 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 	sort.Strings(dss)
 	dssStr := strings.Join(dss, ", ")
 	lib.Printf("%d Tasks, %d data source types: %+v\n", len(tasks), len(dss), dssStr)
+	if sharedSkipped > 0 {
+		lib.Printf("%d shared endpoints tasks skipped, they are fetched by owner fixtures\n", sharedSkipped)
+	}
 	if ctx.Debug > 1 {
 		lib.Printf("Tasks: %+v\n", tasks)
 	}
@@ -2046,7 +1914,6 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 		ctx.ExecOutputStderr = false
 	}()
 	gAliasesMtx = &sync.Mutex{}
-	gCSVMtx = &sync.Mutex{}
 	gAliasesFunc = func() {
 		if !ctx.SkipAliases && !ctx.OnlyP2O {
 			lib.Printf("Processing aliases\n")
@@ -2054,13 +1921,14 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 			defer func() {
 				gAliasesMtx.Unlock()
 			}()
-			if ctx.CleanupAliases {
-				processAliases(ctx, &fixtures, lib.Delete)
-			}
-			processAliases(ctx, &fixtures, lib.Put)
+			gDedupOnce.Do(func() {
+				syncExternalDedupAliases(ctx, fixtures)
+			})
+			processAliases(ctx, &fixtures)
 		}
 	}
 	if !ctx.OnlyP2O && didRenames {
+		lib.SetPhase(ctx, lib.PhaseAliases)
 		gAliasesFunc()
 	}
 	// We *try* to enrich external indexes, but we don't care if that actually suceeded
@@ -2072,10 +1940,14 @@ func processFixtureFiles(ctx *lib.Ctx, fixtureFiles []string) {
 		}(ch)
 	}
 	// Most important work
+	lib.SetPhase(ctx, lib.PhaseTasks)
 	rslt := processTasks(ctx, &tasks, dss)
 	if !ctx.OnlyP2O {
+		lib.SetPhase(ctx, lib.PhaseAliases)
 		gAliasesFunc()
+		lib.SetPhase(ctx, lib.PhaseFAliases)
 		generateFoundationFAliases(ctx, &fixtures)
+		lib.SetPhase(ctx, lib.PhaseMetadata)
 		processFixturesMetadata(ctx, &fixtures)
 		<-ch
 	}
@@ -2197,73 +2069,6 @@ func setLastDuration(ctx *lib.Ctx, task *lib.Task) {
 	return
 }
 
-func dedupOrigins(first, second []string) (shared, onlyFirst []string) {
-	sharedMap := make(map[string]struct{})
-	for _, f := range first {
-		hit := false
-		for _, s := range second {
-			if strings.Contains(f, s) || strings.Contains(s, f) {
-				sharedMap[f] = struct{}{}
-				sharedMap[s] = struct{}{}
-				hit = true
-			}
-		}
-		if !hit {
-			onlyFirst = append(onlyFirst, f)
-		}
-	}
-	for s := range sharedMap {
-		shared = append(shared, s)
-	}
-	return
-}
-
-func dropOriginsInternal(ctx *lib.Ctx, index string, origins []string) (ok bool) {
-	nOrigins := len(origins)
-	if nOrigins < 1 {
-		return
-	}
-	if nOrigins > 500 {
-		lib.Printf("Too many origins to delete, maximum is 500: %+v\n", origins)
-		return
-	}
-	query := "origin:("
-	lastI := nOrigins - 1
-	for i, origin := range origins {
-		query += "\"" + origin + "\""
-		if i < lastI {
-			query += " OR "
-		} else {
-			query += ")"
-		}
-	}
-	if ctx.DryRun {
-		if !ctx.DryRunAllowDedup {
-			lib.Printf("Would dedup bitergia index %s via delete: %s\n", index, query)
-			return
-		}
-		lib.Printf("Dry run allowed dedup bitergia index %s via delete: %s\n", index, query)
-	}
-	trials := 0
-	for {
-		deleted := deleteByQuery(ctx, index, query)
-		if deleted {
-			if trials > 0 {
-				lib.Printf("Deleted from %s:%s after %d/%d trials\n", index, query, trials, ctx.MaxDeleteTrials)
-			}
-			break
-		}
-		trials++
-		if trials == ctx.MaxDeleteTrials {
-			lib.Printf("ERROR: Failed to delete from %s:%s, tried %d times\n", index, query, ctx.MaxDeleteTrials)
-			return
-		}
-		time.Sleep(time.Duration(10*trials) * time.Millisecond)
-	}
-	ok = true
-	return
-}
-
 func isTimeoutError(err error) bool {
 	if err == nil {
 		return false
@@ -2278,55 +2083,11 @@ func checkProjectSlug(task *lib.Task) {
 	}
 }
 
-func dropOrigins(ctx *lib.Ctx, index string, origins []string) (ok bool) {
-	nOrigins := len(origins)
-	bucketSize := 500
-	failed := false
-	nBuckets := (nOrigins / bucketSize) + 1
-	for i := 0; i < nBuckets; i++ {
-		from := i * bucketSize
-		to := from + bucketSize
-		if to > nOrigins {
-			to = nOrigins
-		}
-		deleted := dropOriginsInternal(ctx, index, origins[from:to])
-		if !deleted {
-			failed = true
-			lib.Printf("dropOrigins: bucket #%d/%d failed (%d origins), continuying\n", i+1, nBuckets, nOrigins)
-		}
-	}
-	ok = !failed
-	return
-}
-
-func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptasks *[]lib.Task) {
-	if ctx.SkipExternal {
-		lib.Printf("Skip External is set, skipping enriching external indices\n")
-		return
-	}
-	st := time.Now()
-	lib.Printf("Enrich external indices: check node\n")
-	// If possible run on random non-master node, but if there is only one node then run on that node (master)
-	if ctx.NodeNum > 1 {
-		_, _, day := time.Now().Date()
-		nodeIndex := (day % (ctx.NodeNum - 1)) + 1
-		if ctx.NodeIdx != nodeIndex {
-			lib.Printf("This will only run on #%d node on %d day of month\n", nodeIndex, day)
-			return
-		}
-	}
-	if !ctx.SkipEsData && !ctx.SkipCheckFreq {
-		lib.Printf("Enrich external indices: check last run\n")
-		freqOK := checkSyncFreq(ctx, nil, lib.Bitergia, lib.External, ctx.EnrichExternalFreq)
-		if !freqOK {
-			return
-		}
-	}
-	lib.Printf("Enrich external indices: running\n")
-	fixtures := *pfixtures
-	tasks := *ptasks
-	manualEnrich := make(map[string][]string)
-	noEnrich := make(map[string]struct{})
+// externalIndices - returns external indices (alias 'from') for SDS indices they are deduplicated against (alias 'dedup' or 'to')
+// and external indices with enrichment disabled
+func externalIndices(fixtures []lib.Fixture) (manualEnrich map[string][]string, noEnrich map[string]struct{}) {
+	manualEnrich = make(map[string][]string)
+	noEnrich = make(map[string]struct{})
 	rename := func(arg string) string {
 		arg = strings.Replace(arg, "/", "-", -1)
 		if !strings.HasPrefix(arg, "sds-") {
@@ -2336,24 +2097,19 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 	}
 	for _, fixture := range fixtures {
 		for _, aliasFrom := range fixture.Aliases {
-			if !strings.HasPrefix(aliasFrom.From, "bitergia-") {
+			src := gExternal.Source(aliasFrom.From)
+			if src == nil {
 				continue
 			}
-			lib.Printf("Enrich external indices: candidate: %s\n", aliasFrom.From)
-			if aliasFrom.NoEnrich {
+			lib.Printf("Enrich external indices: candidate: %s (%s)\n", aliasFrom.From, src.Name)
+			if aliasFrom.NoEnrich || src.Enrich == lib.ExternalEnrichNone {
 				noEnrich[aliasFrom.From] = struct{}{}
 			}
 			if len(aliasFrom.Dedup) > 0 {
 				for _, dedup := range aliasFrom.Dedup {
 					if !strings.HasSuffix(dedup, "-raw") {
 						dedup = rename(dedup)
-						ary, ok := manualEnrich[dedup]
-						if !ok {
-							manualEnrich[dedup] = []string{aliasFrom.From}
-						} else {
-							ary = append(ary, aliasFrom.From)
-							manualEnrich[dedup] = ary
-						}
+						manualEnrich[dedup] = append(manualEnrich[dedup], aliasFrom.From)
 					}
 				}
 				continue
@@ -2361,17 +2117,84 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 			for _, aliasTo := range aliasFrom.To {
 				if !strings.HasSuffix(aliasTo, "-raw") {
 					aliasTo = rename(aliasTo)
-					ary, ok := manualEnrich[aliasTo]
-					if !ok {
-						manualEnrich[aliasTo] = []string{aliasFrom.From}
-					} else {
-						ary = append(ary, aliasFrom.From)
-						manualEnrich[aliasTo] = ary
-					}
+					manualEnrich[aliasTo] = append(manualEnrich[aliasTo], aliasFrom.From)
 				}
 			}
 		}
 	}
+	return
+}
+
+// syncExternalDedupAliases - stores shared origins of external indices deduplicated via alias policy, their aliases exclude them via filters
+// Nothing is deleted from external indices, this runs once per run before aliases are reconciled (independently of external indices
+// enrichment frequency), so filters follow origins of SDS indices
+func syncExternalDedupAliases(ctx *lib.Ctx, fixtures []lib.Fixture) {
+	if ctx.SkipExternal || ctx.SkipDedup || ctx.ExternalReportOnly || ctx.NodeIdx > 0 || (ctx.DryRun && !ctx.DryRunAllowOrigins) {
+		return
+	}
+	manualEnrich, _ := externalIndices(fixtures)
+	sdsIndices := []string{}
+	for sdsIndex := range manualEnrich {
+		sdsIndices = append(sdsIndices, sdsIndex)
+	}
+	sort.Strings(sdsIndices)
+	overlaps := []lib.ExternalOverlap{}
+	aliased := []string{}
+	for _, sdsIndex := range sdsIndices {
+		for _, externalIndex := range manualEnrich[sdsIndex] {
+			src := gExternal.Source(externalIndex)
+			if src.DedupPolicy(ctx) != lib.ExternalDedupAlias {
+				continue
+			}
+			aliased = append(aliased, externalIndex)
+			overlap, err := lib.ExternalIndexOverlap(ctx, src, externalIndex, sdsIndex)
+			if err != nil {
+				lib.Printf("ERROR(not fatal): cannot check overlap of external index %s with %s: %+v\n", externalIndex, sdsIndex, err)
+				continue
+			}
+			overlaps = append(overlaps, overlap)
+		}
+	}
+	current, err := lib.ExternalDedupStates(ctx)
+	if err != nil {
+		lib.Printf("Cannot get external indices dedup states: %+v\n", err)
+		return
+	}
+	changed, err := lib.SyncExternalDedupStates(ctx, lib.DesiredExternalDedupStates(overlaps), current, aliased, !partialRun(ctx))
+	if err != nil {
+		lib.Printf("Failed to store external indices dedup states: %+v\n", err)
+	}
+	if changed > 0 {
+		lib.Printf("External indices dedup filters changed for %d indices\n", changed)
+	}
+}
+
+func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptasks *[]lib.Task) {
+	if ctx.SkipExternal {
+		lib.Printf("Skip External is set, skipping enriching external indices\n")
+		return
+	}
+	st := time.Now()
+	lib.Printf("Enrich external indices: check node\n")
+	// If possible run on random non-master node, but if there is only one node then run on that node (master)
+	if ctx.NodeNum > 1 {
+		_, _, day := time.Now().Date()
+		nodeIndex := (day % (ctx.NodeNum - 1)) + 1
+		if ctx.NodeIdx != nodeIndex {
+			lib.Printf("This will only run on #%d node on %d day of month\n", nodeIndex, day)
+			return
+		}
+	}
+	if !ctx.SkipEsData && !ctx.SkipCheckFreq {
+		lib.Printf("Enrich external indices: check last run\n")
+		freqOK := checkSyncFreq(ctx, nil, lib.Bitergia, lib.External, ctx.EnrichExternalFreq)
+		if !freqOK {
+			return
+		}
+	}
+	lib.Printf("Enrich external indices: running\n")
+	tasks := *ptasks
+	manualEnrich, noEnrich := externalIndices(*pfixtures)
 	if ctx.Debug > 0 {
 		lib.Printf("Enrich external indices: list: %+v\n", manualEnrich)
 	}
@@ -2413,9 +2236,43 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 	if ctx.Debug > 1 {
 		lib.Printf("Enrich external indices: indexToTask: %+v\n", indexToTask)
 	}
+	sdsIndices := []string{}
+	for sdsIndex := range manualEnrich {
+		sdsIndices = append(sdsIndices, sdsIndex)
+	}
+	sort.Strings(sdsIndices)
+	// Overlap of all external indices with SDS indices is reported before anything is deduplicated
+	overlaps := make(map[[2]string]lib.ExternalOverlap)
+	if (!ctx.SkipDedup || ctx.ExternalReportOnly) && (!ctx.DryRun || ctx.DryRunAllowOrigins) {
+		report := []lib.ExternalOverlap{}
+		for _, sdsIndex := range sdsIndices {
+			_, ok := indexToTask[sdsIndex]
+			if !ok {
+				continue
+			}
+			for _, externalIndex := range manualEnrich[sdsIndex] {
+				overlap, err := lib.ExternalIndexOverlap(ctx, gExternal.Source(externalIndex), externalIndex, sdsIndex)
+				if err != nil {
+					lib.Printf("ERROR(not fatal): cannot check overlap of external index %s with %s: %+v\n", externalIndex, sdsIndex, err)
+					continue
+				}
+				if ctx.Debug > 0 {
+					lib.Printf("=========> %s vs. %s\nEXT  %+v\nSDS  %+v\nSHAR %+v\nONLY %+v\n", externalIndex, sdsIndex, overlap.External, overlap.SDS, overlap.Shared, overlap.Only)
+				}
+				report = append(report, overlap)
+				overlaps[[2]string{externalIndex, sdsIndex}] = overlap
+			}
+		}
+		lib.Printf("%s", lib.ExternalOverlapReport(report))
+		if ctx.ExternalReportOnly {
+			lib.Printf("External report only is set, skipping external indices deduplication and enrichment\n")
+			return
+		}
+	}
 	newTasks := []lib.Task{}
 	processedIndices := make(map[string]struct{})
-	for sdsIndex, bitergiaIndices := range manualEnrich {
+	for _, sdsIndex := range sdsIndices {
+		bitergiaIndices := manualEnrich[sdsIndex]
 		sdsTask, ok := indexToTask[sdsIndex]
 		if ctx.Debug > 0 {
 			lib.Printf("Enrich external indices: %s -> %+v -> %v\n", sdsIndex, bitergiaIndices, ok)
@@ -2436,7 +2293,8 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 					lib.Printf("Enrich external indices: '%s' was already processed\n", bitergiaIndex)
 					continue
 				}
-				dsSlug := figureOutDatasourceFromIndexName(bitergiaIndex)
+				src := gExternal.Source(bitergiaIndex)
+				dsSlug := src.DataSourceFor(bitergiaIndex)
 				if dsSlug == "" {
 					lib.Printf("ERROR(not fatal): External index %s: cannot guess data source type from index name\n", bitergiaIndex)
 					continue
@@ -2455,7 +2313,7 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 						lib.Printf("ERROR(not fatal): External index %s: guessed data source type %s from index name: cannot find any SDS index of that type\n", bitergiaIndex, ds)
 						continue
 					}
-					endpoints, _ := figureOutEndpoints(ctx, bitergiaIndex, ds)
+					endpoints, _ := figureOutEndpoints(ctx, bitergiaIndex, src.OriginField, ds)
 					if ctx.Debug > 0 {
 						lib.Printf("Enrich external indices: %s/%s: adding %d artificial tasks (random task %+v, endpoints %+v)\n", bitergiaIndex, ds, len(endpoints), randomSdsTask, endpoints)
 					}
@@ -2485,34 +2343,23 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 			continue
 		}
 		for _, bitergiaIndex := range bitergiaIndices {
-			bitergiaEndpoints, bitergiaOrigins := figureOutEndpoints(ctx, bitergiaIndex, sdsTask.DsSlug)
-			endpoints := []string{}
-			if ctx.SkipDedup {
-				endpoints = bitergiaEndpoints
-			} else {
-				sdsIndex := "sds-" + sdsTask.FxSlug + "-" + sdsTask.DsFullSlug
-				sdsIndex = strings.Replace(sdsIndex, "/", "-", -1)
-				_, sdsOrigins := figureOutEndpoints(ctx, sdsIndex, sdsTask.DsSlug)
-				originsShared, originsOnlyBitergia := dedupOrigins(bitergiaOrigins, sdsOrigins)
-				if ctx.Debug > 0 {
-					lib.Printf("=========> %s vs. %s\nBITE %+v\nSDS  %+v\nSHAR %+v\nONLY %+v\n", bitergiaIndex, sdsIndex, bitergiaOrigins, sdsOrigins, originsShared, originsOnlyBitergia)
-				}
-				if len(originsShared) > 0 {
-					lib.Printf("Bitergia origins %s:%+v share at least one origin with SDS origins: %s:%+v\n", bitergiaIndex, bitergiaOrigins, sdsIndex, sdsOrigins)
-					lib.Printf("Deleting Bitergia/SDS shared origins %s:%+v, bitergia index will only contain origins not present in %s SDS index: %+v\n", bitergiaIndex, originsShared, sdsIndex, originsOnlyBitergia)
-					if len(originsOnlyBitergia) == 0 {
-						lib.Printf("NOTICE: bitergia index %s is fully duplicated in SDS, so it basically can be removed from config fixtures\n", bitergiaIndex)
-					}
-					// We don't do this in multiple threads because deleting data from ES is a very heavy operation and doing that in multiple threads
-					// will not make it any faster. It will only result in more parallel timeouts.
-					if !dropOrigins(ctx, bitergiaIndex, originsShared) {
-						lib.Printf("Failed to delete %+v origins from %s\n", originsShared, bitergiaIndex)
-					}
-					endpoints, _ = figureOutEndpoints(ctx, bitergiaIndex, sdsTask.DsSlug)
-				} else {
-					endpoints = bitergiaEndpoints
+			src := gExternal.Source(bitergiaIndex)
+			overlap, checked := overlaps[[2]string{bitergiaIndex, sdsIndex}]
+			if checked {
+				affected, err := lib.DedupExternalIndex(ctx, src, &overlap)
+				if err != nil {
+					lib.Printf("Failed to dedup %s external index %s via %s: %+v\n", src.Name, bitergiaIndex, overlap.Policy, err)
+				} else if affected > 0 {
+					lib.Printf("Deduplicated %s external index %s via %s: %d documents\n", src.Name, bitergiaIndex, overlap.Policy, affected)
 				}
 			}
+			var endpoints []string
+			if checked && (overlap.Policy != lib.ExternalDedupDelete || len(overlap.Shared) == 0) {
+				endpoints = originsToEndpoints(sdsTask.DsSlug, overlap.External)
+			} else {
+				// Deleting shared origins changes external index, so its endpoints must be fetched again
+				endpoints, _ = figureOutEndpoints(ctx, bitergiaIndex, src.OriginField, sdsTask.DsSlug)
+			}
 			if ctx.SkipSH || ctx.SkipAffs {
 				continue
 			}
@@ -2523,7 +2370,7 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 			}
 			_, ok := processedIndices[bitergiaIndex]
 			if ok {
-				lib.Printf("Enrich external indices: '%s' was already processed (skipping enrichment and deduplication)\n", bitergiaIndex)
+				lib.Printf("Enrich external indices: '%s' was already processed (skipping enrichment)\n", bitergiaIndex)
 				continue
 			}
 			if ctx.Debug > 0 {
@@ -2645,6 +2492,12 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 			}
 		}()
 		dads := isDADS(&tsk)
+		switch gExternal.Source(tsk.ExternalIndex).Enrich {
+		case lib.ExternalEnrichP2O:
+			dads = false
+		case lib.ExternalEnrichDADS:
+			dads = true
+		}
 		result[0] = tsk.ExternalIndex
 		result[1] = tsk.DsSlug
 		result[2] = tsk.Endpoint
@@ -3010,88 +2863,27 @@ func enrichAndDedupExternalIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture, ptask
 	lib.Printf("Processed %d external indices (%d endpoints) took: %v\n", allIndices, allEndpoints, en.Sub(st))
 }
 
-func figureOutEndpoints(ctx *lib.Ctx, index, dataSource string) (endpoints, origins []string) {
+func figureOutEndpoints(ctx *lib.Ctx, index, originField, dataSource string) (endpoints, origins []string) {
 	if ctx.DryRun && !ctx.DryRunAllowOrigins {
 		return
 	}
-	//lib.Printf("figureOutEndpoints(%s, %s)\n", index, dataSource)
-	//defer func() { lib.Printf("figureOutEndpoints(%s, %s) -> (%v,%v)\n", index, dataSource, endpoints, origins) }()
-	//curl -H "Content-Type: application/json" URL/idx/_search -d'{"size":0,"aggs":{"origin":{"terms":{"field":"origin"}}}}'
-	data := `{"size":0,"aggs":{"origin":{"terms":{"field":"origin","size":2147483647}}}}`
-	payloadBytes := []byte(data)
-	payloadBody := bytes.NewReader(payloadBytes)
-	method := lib.Get
-	url := fmt.Sprintf("%s/%s/_search?size=1", ctx.ElasticURL, index)
-	rurl := fmt.Sprintf("/%s/_search?size=1", index)
-	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
+	origins, err := lib.IndexOrigins(ctx, index, originField)
 	if err != nil {
-		lib.Printf("new request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+		lib.Printf("Cannot get origins from %s: %+v\n", index, err)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		lib.Printf("do request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-		return
+	if len(origins) == 0 {
+		lib.Printf("WARNING: No origins found for %s\n", index)
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			lib.Printf("ReadAll request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-			return
-		}
-		lib.Printf("Method:%s url:%s status:%d data:%s\n%s\n", method, rurl, resp.StatusCode, data, body)
-		return
-	}
-	payload := lib.EsSearchResultPayload{}
-	err = jsoniter.NewDecoder(resp.Body).Decode(&payload)
-	if err != nil {
-		body, err := ioutil.ReadAll(resp.Body)
-		lib.Printf("JSON decode error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-		lib.Printf("Body:%s\n", body)
-		return
-	}
-	var m map[string]interface{}
-	m, ok := payload.Aggregations.(map[string]interface{})
-	if !ok {
-		lib.Printf("Cannot read aggregations from %+v\n", payload)
-		return
-	}
-	m, ok = m["origin"].(map[string]interface{})
-	if !ok {
-		lib.Printf("Cannot read origin from %+v\n", payload)
-		return
-	}
-	buckets, ok := m["buckets"].([]interface{})
-	if !ok {
-		lib.Printf("Cannot read buckets from %+v\n", payload)
-		return
-	}
-	for _, bucket := range buckets {
-		b, ok := bucket.(map[string]interface{})
-		if !ok {
-			lib.Printf("Cannot read bucket from %+v\n", bucket)
-			return
-		}
-		key, ok := b["key"]
-		if !ok {
-			lib.Printf("Origin %v do net have a key\n", b)
-		}
-		strKey, ok := key.(string)
-		if !ok {
-			lib.Printf("Origin key %v is not a string\n", key)
-		}
-		origins = append(origins, strKey)
-	}
-	if len(origins) == 0 {
-		lib.Printf("WARNING: No origins found for %s\n", index)
-	}
-	ary := strings.Split(dataSource, "/")
-	if len(ary) > 1 {
-		dataSource = ary[0]
+	endpoints = originsToEndpoints(dataSource, origins)
+	return
+}
+
+// originsToEndpoints - converts origins of a given data source into endpoints (as used in fixtures)
+func originsToEndpoints(dataSource string, origins []string) (endpoints []string) {
+	ary := strings.Split(dataSource, "/")
+	if len(ary) > 1 {
+		dataSource = ary[0]
 	}
 	switch dataSource {
 	case lib.Git, lib.Jira, lib.Bugzilla, lib.BugzillaRest, lib.Jenkins, lib.Gerrit, lib.Pipermail, lib.Confluence, lib.GitHub, lib.Discourse, lib.RocketChat:
@@ -3132,64 +2924,12 @@ func figureOutEndpoints(ctx *lib.Ctx, index, dataSource string) (endpoints, orig
 	return
 }
 
-func figureOutDatasourceFromIndexName(index string) (dataSource string) {
-	index = strings.ToLower(index)
-	known := []string{
-		lib.Git,
-		lib.GitHub,
-		lib.Confluence,
-		lib.Gerrit,
-		lib.Jira,
-		lib.Slack,
-		lib.GroupsIO,
-		lib.Pipermail,
-		lib.Discourse,
-		lib.Jenkins,
-		lib.DockerHub,
-		lib.Bugzilla,
-		lib.BugzillaRest,
-		lib.MeetUp,
-		lib.RocketChat,
-	}
-	sort.SliceStable(known, func(i, j int) bool {
-		return len(known[i]) > len(known[j])
-	})
-	for _, ds := range known {
-		if strings.Contains(index, strings.ToLower(ds)) {
-			return ds
-		}
-	}
-	return
-}
-
-func checkForSharedEndpoints(pfixtures *[]lib.Fixture) {
-	fixtures := *pfixtures
-	eps := make(map[[3]string][]string)
-	for _, fixture := range fixtures {
-		slug := fixture.Native.Slug
-		for _, ds := range fixture.DataSources {
-			cfgs := []string{}
-			for _, cfg := range ds.Config {
-				cfgs = append(cfgs, cfg.String())
-			}
-			sort.Strings(cfgs)
-			cfg := strings.Join(cfgs, ",")
-			cfg = strings.Replace(cfg, " ", "", -1)
-			cfg = strings.Replace(cfg, "\t", "", -1)
-			for _, ep := range ds.Endpoints {
-				key := [3]string{ds.Slug, ep.Name, cfg}
-				slugs := eps[key]
-				slugs = append(slugs, slug)
-				eps[key] = slugs
-			}
-		}
-	}
-	for ep, slugs := range eps {
-		if len(slugs) == 1 {
-			continue
-		}
-		lib.Printf("NOTICE: Endpoint (%s,%s) that can be split into shared, used in %+v\n", ep[0], ep[1], slugs)
+func checkForSharedEndpoints(pfixtures *[]lib.Fixture) []lib.SharedEndpoint {
+	shared := lib.FindSharedEndpoints(*pfixtures)
+	for _, ep := range shared {
+		lib.Printf("NOTICE: Endpoint (%s,%s) shared by %d fixtures, owner: %s, consumers: %+v\n", ep.DsFullSlug, ep.Endpoint, len(ep.Consumers)+1, ep.Owner, ep.Consumers)
 	}
+	return shared
 }
 
 func giantLock(ctx *lib.Ctx, mtx string) {
@@ -3295,6 +3035,10 @@ func giantWait(ctx *lib.Ctx, mtx, waitForState string) {
 	}
 	mtxIndex := lib.SDSMtx
 	esQuery := fmt.Sprintf("mtx:\"%s\"", mtx)
+	st := time.Now()
+	defer func() {
+		lib.MetricsObserveSince(lib.MetricLockWait, st, mtx)
+	}()
 	n := 0
 	for {
 		_, ok, found := searchByQuery(ctx, mtxIndex, esQuery)
@@ -3302,6 +3046,15 @@ func giantWait(ctx *lib.Ctx, mtx, waitForState string) {
 			lib.Fatalf("cannot wait for ES mtx: %s to be %s", mtx, waitForState)
 		}
 		if ctx.MaxMtxWait > 0 && n > ctx.MaxMtxWait {
+			lib.Notify(
+				ctx,
+				lib.Notification{
+					Event: lib.NotifyLockTimeout,
+					Level: lib.LogLevelError,
+					Title: fmt.Sprintf("waited %d seconds for %s to be %s", n, mtx, waitForState),
+					Text:  fmt.Sprintf("Waited %d seconds for ES mutex %s to be %s, exceeded %ds, fatal: %v", n, mtx, waitForState, ctx.MaxMtxWait, ctx.MaxMtxWaitFatal),
+				},
+			)
 			if ctx.MaxMtxWaitFatal {
 				lib.Fatalf("waited %d seconds for %s to be %s, exceeded %ds, this is fatal", n, mtx, waitForState, ctx.MaxMtxWait)
 			} else {
@@ -3460,6 +3213,17 @@ func renameIndex(ctx *lib.Ctx, from, to string) {
 		return
 	}
 	lib.Printf("Renamed %s to %s\n", from, to)
+	lib.RecordChange(lib.ReportChangeIndex, "rename", from, to)
+}
+
+// fAliasPattern - foundation-f aliases names pattern from SDS_FALIASES_CONFIG (default one when it cannot be loaded)
+func fAliasPattern(ctx *lib.Ctx) *regexp.Regexp {
+	cfg, err := lib.LoadFAliasesConfig(ctx)
+	if err != nil {
+		lib.Printf("WARNING: cannot load foundation-f aliases configuration, using default foundation-f aliases names: %+v\n", err)
+		cfg = lib.DefaultFAliasesConfig()
+	}
+	return cfg.FAliasPattern()
 }
 
 // processIndexes - dropping unused indexes, renaming indexes that require this ('index_suffix' option), info about missing indexes
@@ -3517,7 +3281,7 @@ func processIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture) (didRenames bool) {
 		}
 		for _, alias := range fixture.Aliases {
 			idxSlug := alias.From
-			if strings.HasPrefix(alias.From, "pattern:") || strings.HasPrefix(alias.From, "bitergia-") {
+			if strings.HasPrefix(alias.From, "pattern:") || lib.IsExternalIndex(alias.From) {
 				continue
 			}
 			if idxSlug == "sds-" {
@@ -3586,7 +3350,7 @@ func processIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture) (didRenames bool) {
 				rename[index] = fullIndex
 			} else {
 				// Note: Skip PRs
-				if !notMissingPattern.MatchString(fullIndex) {
+				if !lib.NotMissingPattern.MatchString(fullIndex) {
 					missing = append(missing, fullIndex)
 				}
 			}
@@ -3653,9 +3417,10 @@ func processIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture) (didRenames bool) {
 	} else {
 		lib.Printf("No indices to rename\n")
 	}
+	fPattern := fAliasPattern(ctx)
 	newExtra := []string{}
 	for _, idx := range extra {
-		if noDropPattern.MatchString(idx) {
+		if lib.NoDropPattern.MatchString(idx) || fPattern.MatchString(idx) {
 			continue
 		}
 		newExtra = append(newExtra, idx)
@@ -3722,6 +3487,9 @@ func processIndexes(ctx *lib.Ctx, pfixtures *[]lib.Fixture) (didRenames bool) {
 		}
 		_ = resp.Body.Close()
 		lib.Printf("%d indices dropped\n", len(strings.Split(indices, ",")))
+		for _, index := range strings.Split(indices, ",") {
+			lib.RecordChange(lib.ReportChangeIndex, "drop", index, "")
+		}
 	}
 	return
 }
@@ -3791,7 +3559,7 @@ func dropUnusedAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 		_, ok := got[alias]
 		if !ok {
 			// Note: Skip PRs
-			if !notMissingPattern.MatchString(alias) {
+			if !lib.NotMissingPattern.MatchString(alias) {
 				missing = append(missing, alias)
 			}
 		}
@@ -3807,9 +3575,10 @@ func dropUnusedAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 	if len(missing) > 0 {
 		lib.Printf("NOTICE: Missing aliases %d: %s\n", len(missing), strings.Join(missing, ", "))
 	}
+	fPattern := fAliasPattern(ctx)
 	newExtra := []string{}
 	for _, idx := range extra {
-		if noDropPattern.MatchString(idx) {
+		if lib.NoDropPattern.MatchString(idx) || fPattern.MatchString(idx) {
 			continue
 		}
 		newExtra = append(newExtra, idx)
@@ -3871,245 +3640,94 @@ func dropUnusedAliases(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 		}
 		_ = resp.Body.Close()
 		lib.Printf("%d aliases dropped\n", len(strings.Split(aliases, ",")))
+		for _, alias := range strings.Split(aliases, ",") {
+			lib.RecordChange(lib.ReportChangeAlias, "remove", alias, "")
+		}
 	}
 }
 
-func processAlias(ch chan struct{}, ctx *lib.Ctx, pair [2]string, method string) {
-	defer func() {
-		if ch != nil {
-			ch <- struct{}{}
-		}
-	}()
-	var (
-		url  string
-		rurl string
-	)
-	if method == lib.Delete {
-		if partialRun(ctx) {
-			return
-		}
-		url = fmt.Sprintf("%s/_all/_alias/%s", ctx.ElasticURL, pair[1])
-		rurl = fmt.Sprintf("/_all/_alias/%s", pair[1])
-	} else {
-		from := pair[0]
-		if strings.HasPrefix(from, "pattern:") {
-			from = from[8:]
-		}
-		url = fmt.Sprintf("%s/%s/_alias/%s", ctx.ElasticURL, from, pair[1])
-		rurl = fmt.Sprintf("/%s/_alias/%s", from, pair[1])
-	}
-	if ctx.DryRun {
-		lib.Printf("DryRun: Method:%s url:%s\n", method, rurl)
-		return
-	}
-	req, err := http.NewRequest(method, os.ExpandEnv(url), nil)
-	if err != nil {
-		lib.Printf("New request error: %+v for %s url: %s\n", err, method, rurl)
-		return
-	}
-	resp, err := http.DefaultClient.Do(req)
+func processAliases(ctx *lib.Ctx, pFixtures *[]lib.Fixture) {
+	st := time.Now()
+	// Removing aliases is only safe when we see all fixtures
+	cleanup := ctx.CleanupAliases && !partialRun(ctx)
+	plan, err := lib.ReconcileAliases(ctx, *pFixtures, cleanup)
 	if err != nil {
-		lib.Printf("Do request error: %+v for %s url: %s\n", err, method, rurl)
+		lib.Printf("Error reconciling aliases, failed batch and following ones were not applied: %+v\n", err)
 		return
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			lib.Printf("ReadAll request error: %+v for %s url: %s\n", err, method, rurl)
-			return
-		}
-		lib.Printf("Method:%s url:%s status:%d\n%s\n", method, rurl, resp.StatusCode, body)
-	}
-	if ctx.Debug > 0 {
-		lib.Printf("Success alias url: %s\n", rurl)
-	}
-}
-
-func processAliasView(ch chan struct{}, ctx *lib.Ctx, index string, view lib.AliasView) {
-	defer func() {
-		if ch != nil {
-			ch <- struct{}{}
-		}
-	}()
-	if strings.HasPrefix(index, "pattern:") {
-		index = index[8:]
+	if !ctx.DryRun {
+		lib.Printf("Reconciled aliases: %d added, %d removed, took: %v\n", len(plan.Add), len(plan.Remove), time.Now().Sub(st))
 	}
-	// API: POST /_aliases '{"actions":[{"add":{"index":"sds-lfn-onap-git-for-merge","alias":"test-lg","filter":{"term":{"project":"CLI"}}}}]}'
-	method := lib.Post
-	url := fmt.Sprintf("%s/_aliases", ctx.ElasticURL)
-	rurl := "/_aliases"
-	if ctx.DryRun {
-		lib.Printf("DryRun: Method:%s url:%s\n", method, rurl)
+	roles := lib.ViewRoles(*pFixtures, plan.Desired)
+	n, err := lib.PutViewRoles(ctx, roles)
+	if err != nil {
+		lib.Printf("Error creating views security roles: %+v\n", err)
 		return
 	}
-	lib.Printf("View '%s' -> '%s' filter %+v\n", index, view.Name, view.Filter)
-	payloadBytes, err := jsoniter.Marshal(view.Filter)
-	if err != nil {
-		lib.Fatalf("json marshall error: %+v, data: %+v", err, view.Filter)
+	if !ctx.DryRun && n > 0 {
+		lib.Printf("Created/updated %d views security roles\n", n)
 	}
-	data := fmt.Sprintf(`{"actions":[{"add":{"index":"%s","alias":"%s","filter":%s}}]}`, index, view.Name, string(payloadBytes))
-	payloadBytes = []byte(data)
-	payloadBody := bytes.NewReader(payloadBytes)
-	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
-	if err != nil {
-		lib.Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+	if !cleanup {
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	deleted, err := lib.DeleteStaleViewRoles(ctx, roles)
 	if err != nil {
-		lib.Printf("Do request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+		lib.Printf("Error deleting removed views security roles: %+v\n", err)
 		return
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			lib.Printf("ReadAll request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-			return
-		}
-		lib.Printf("Method:%s url:%s data:%s status:%d\n%s\n", method, rurl, data, resp.StatusCode, body)
-	}
-}
-
-func processAliases(ctx *lib.Ctx, pFixtures *[]lib.Fixture, method string) {
-	st := time.Now()
-	fixtures := *pFixtures
-	pairs := [][2]string{}
-	tom := make(map[string]struct{})
-	type view struct {
-		from string
-		view lib.AliasView
-	}
-	views := []view{}
-	for _, fixture := range fixtures {
-		for _, alias := range fixture.Aliases {
-			for _, to := range alias.To {
-				_, ok := tom[to]
-				if ok && method == lib.Delete {
-					continue
-				}
-				pairs = append(pairs, [2]string{alias.From, to})
-				tom[to] = struct{}{}
-			}
-			for _, v := range alias.Views {
-				if method == lib.Delete {
-					_, ok := tom[v.Name]
-					if ok {
-						continue
-					}
-					pairs = append(pairs, [2]string{alias.From, v.Name})
-					tom[v.Name] = struct{}{}
-					continue
-				}
-				views = append(views, view{from: alias.From, view: v})
-			}
-		}
-	}
-	if ctx.Debug > 0 {
-		lib.Printf("Aliases:\n%+v\n", pairs)
-	}
-	// Get number of CPUs available
-	thrN := lib.GetThreadsNum(ctx)
-	if thrN > 1 {
-		lib.Printf("Now processing %d aliases using method %s MT%d version\n", len(pairs), method, thrN)
-		ch := make(chan struct{})
-		nThreads := 0
-		for _, pair := range pairs {
-			go processAlias(ch, ctx, pair, method)
-			nThreads++
-			if nThreads == thrN {
-				<-ch
-				nThreads--
-			}
-		}
-		lib.Printf("Now processing %d aliases views using MT%d version\n", len(views), thrN)
-		for _, v := range views {
-			go processAliasView(ch, ctx, v.from, v.view)
-			nThreads++
-			if nThreads == thrN {
-				<-ch
-				nThreads--
-			}
-		}
-		for nThreads > 0 {
-			<-ch
-			nThreads--
-		}
-	} else {
-		lib.Printf("Now processing %d aliases using method %s ST version\n", len(pairs), method)
-		for _, pair := range pairs {
-			processAlias(nil, ctx, pair, method)
-		}
-		lib.Printf("Now processing %d aliases views using ST version\n", len(views))
-		for _, v := range views {
-			processAliasView(nil, ctx, v.from, v.view)
-		}
+	if len(deleted) > 0 {
+		lib.Printf("Deleted %d removed views security roles: %s\n", len(deleted), strings.Join(deleted, ", "))
 	}
-	en := time.Now()
-	lib.Printf("Processed %d aliases using method %s took: %v\n", len(pairs), method, en.Sub(st))
 }
 
-func saveCSVInternal(ctx *lib.Ctx, tasks []lib.Task, when string, redacted bool) {
-	var writer *csv.Writer
-	csvFile := fmt.Sprintf("%s_%s_%d_%d.csv", ctx.CSVPrefix, when, ctx.NodeIdx, ctx.NodeNum)
-	oFile, err := os.Create(csvFile)
-	if err != nil {
-		lib.Printf("CSV create error: %+v\n", err)
-		return
-	}
-	defer func() { _ = oFile.Close() }()
-	writer = csv.NewWriter(oFile)
-	defer writer.Flush()
-	hdr := lib.CSVHeader()
-	err = writer.Write(hdr)
-	if err != nil {
-		lib.Printf("CSV write header error: %+v\n", err)
-		return
+// nextTask - returns position (in pending list) of the first task that can be started now taking host limits into account
+// If no task can be started it returns -1 and the shortest time after which some task can be started due to spacing
+// (zero means that all pending tasks wait for running tasks on their hosts to finish)
+func nextTask(hostLimiter *lib.HostLimiter, tasks []lib.Task, pending []int) (int, time.Duration) {
+	if hostLimiter == nil {
+		return 0, 0
 	}
-	gCSVMtx.Lock()
-	sort.SliceStable(tasks, func(i, j int) bool {
-		if tasks[i].FxSlug == tasks[j].FxSlug {
-			if tasks[i].DsFullSlug == tasks[j].DsFullSlug {
-				return tasks[i].Endpoint < tasks[j].Endpoint
-			}
-			return tasks[i].DsFullSlug < tasks[j].DsFullSlug
-		}
-		return tasks[i].FxSlug < tasks[j].FxSlug
-	})
-	gCSVMtx.Unlock()
-	for _, task := range tasks {
-		f := task.ToCSV
-		if !redacted {
-			f = task.ToCSVNotRedacted
+	now := time.Now()
+	var minWait time.Duration
+	for i, idx := range pending {
+		ok, wait := hostLimiter.TryAcquire(lib.TaskHost(tasks[idx].Endpoint), now)
+		if ok {
+			return i, 0
 		}
-		err = writer.Write(f())
-		if err != nil {
-			lib.Printf("CSV write row (%+v) error: %+v\n", task, err)
-			return
+		if wait > 0 && (minWait == 0 || wait < minWait) {
+			minWait = wait
 		}
 	}
-	lib.Printf("CSV file %s written\n", csvFile)
+	return -1, minWait
 }
 
-func saveCSV(ctx *lib.Ctx, tasks []lib.Task, when string) {
-	ch := make(chan struct{})
-	go func() {
-		saveCSVInternal(ctx, tasks, "redacted_"+when, true)
-		ch <- struct{}{}
-	}()
-	saveCSVInternal(ctx, tasks, when, false)
-	<-ch
+// taskMetrics - records finished task in Prometheus metrics
+func taskMetrics(task *lib.Task, result *lib.TaskResult) {
+	phase := "data"
+	if result.Affs {
+		phase = "affs"
+	}
+	code := result.Code[1]
+	res := "ok"
+	if code > 0 {
+		res = "failed"
+		errClass := result.ErrorClass
+		if errClass == "" {
+			errClass = lib.ErrorClassUnknown
+		}
+		lib.MetricsInc(lib.MetricTasksFailed, task.DsSlug, task.FxSlug, phase, errClass)
+	} else if code < 0 {
+		res = "skipped"
+	}
+	lib.MetricsInc(lib.MetricTasksFinished, task.DsSlug, task.FxSlug, phase, res)
+	if code >= 0 {
+		lib.MetricsObserve(lib.MetricTaskDuration, task.Duration.Seconds(), task.DsSlug, phase)
+	}
+	lib.MetricsSet(lib.MetricLastTaskFinished, float64(time.Now().Unix()))
 }
 
 func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 	tasks := *ptasks
-	saveCSV(ctx, tasks, "init")
 	thrN := lib.GetThreadsNum(ctx)
 	tMtx := lib.TaskMtx{}
 	if thrN > 1 {
@@ -4136,6 +3754,7 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 	byDs := make(map[string][3]int)
 	byFx := make(map[string][3]int)
 	for _, task := range tasks {
+		lib.MetricsInc(lib.MetricTasks, task.DsSlug, task.FxSlug)
 		dsSlug := task.DsSlug
 		dataDs, ok := byDs[dsSlug]
 		if ok {
@@ -4158,6 +3777,15 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 		fxs = append(fxs, k)
 	}
 	sort.Strings(fxs)
+	// Run report (caller must hold mtx)
+	saveReport := func(when string) {
+		report := lib.NewRunReport(ctx, when, tasks, byDs, byFx, mul)
+		lib.SaveRunReport(ctx, report)
+		if when == "final" {
+			lib.NotifyRunReport(ctx, report)
+		}
+	}
+	saveReport("init")
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGUSR1, syscall.SIGALRM)
 	processing := make(map[int]struct{})
@@ -4259,7 +3887,14 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 		if out {
 			lib.Printf("Processed %d/%d (%.2f%%), failed: %d (%.2f%%)\n", processed, all, (float64(processed)*100.0)/float64(all), len(failed), (float64(len(failed))*100.0)/float64(all))
 		}
-		saveCSV(ctx, tasks, when)
+		saveReport(when)
+	}
+	gReportFunc = func(when string) {
+		mtx.RLock()
+		defer func() {
+			mtx.RUnlock()
+		}()
+		saveReport(when)
 	}
 	go func() {
 		for {
@@ -4270,12 +3905,14 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 			}
 			if sig == syscall.SIGINT {
 				lib.Printf("Exiting due to SIGINT\n")
+				lib.FlushLogs()
 				os.Exit(1)
 			} else if sig == syscall.SIGALRM {
 				lib.Printf("Timeout after %d seconds\n", ctx.TimeoutSeconds)
 				lib.Printf("Ensuring aliases are created\n")
 				gAliasesFunc()
 				lib.Printf("Aliases processed after timeout\n")
+				lib.FlushLogs()
 				os.Exit(2)
 			}
 		}
@@ -4312,9 +3949,161 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 			}
 		}
 	}
+	gQuarantined = make(map[[2]string]lib.QuarantineInfo)
+	if ctx.QuarantineAfter > 0 && !ctx.SkipSyncInfo {
+		items, err := lib.GetQuarantined(ctx)
+		if err == nil {
+			now := time.Now()
+			nActive := 0
+			for _, item := range items {
+				gQuarantined[item.Key()] = item
+				if item.Active(now) {
+					nActive++
+				}
+			}
+			if nActive > 0 {
+				lib.Printf("%d endpoints are quarantined and will be skipped\n", nActive)
+			}
+		} else {
+			lib.Printf("Error getting quarantined endpoints, assuming none: %+v\n", err)
+		}
+	}
+	pass := ""
+	taskStatus := func(idx int) lib.StatusTask {
+		task := tasks[idx]
+		return lib.StatusTask{
+			Idx:        idx,
+			Fixture:    task.FxSlug,
+			DataSource: task.DsFullSlug,
+			Project:    task.Project,
+			Endpoint:   task.Endpoint,
+			Retries:    task.Retries,
+			ErrorClass: task.ErrorClass,
+		}
+	}
+	longest := func(ary []lib.StatusTask) []lib.StatusTask {
+		sort.SliceStable(ary, func(i, j int) bool {
+			return ary[i].DurationSeconds > ary[j].DurationSeconds
+		})
+		if len(ary) > ctx.NLongest {
+			return ary[:ctx.NLongest]
+		}
+		return ary
+	}
+	lib.SetTasksStatusFunc(func() *lib.TasksStatus {
+		mtx.RLock()
+		defer func() {
+			mtx.RUnlock()
+		}()
+		now := time.Now()
+		status := &lib.TasksStatus{Pass: pass, All: all, Processed: processed, Failed: len(failed), Skipped: skippedTasks}
+		status.Running = []lib.StatusTask{}
+		for idx := range processing {
+			ts := taskStatus(idx)
+			since := startTimes[idx]
+			ts.StartedAt = &since
+			ts.DurationSeconds = now.Sub(since).Seconds()
+			ts.CommandLine = lib.TaskCommand(idx)
+			status.Running = append(status.Running, ts)
+		}
+		status.LongestRunning = longest(append([]lib.StatusTask{}, status.Running...))
+		finished := []lib.StatusTask{}
+		for idx, dur := range durations {
+			ts := taskStatus(idx)
+			ts.DurationSeconds = dur.Seconds()
+			ts.CommandLine = lib.FilterRedacted(tasks[idx].RedactedCommandLine)
+			finished = append(finished, ts)
+		}
+		status.LongestFinished = longest(finished)
+		status.FailedTasks = []lib.StatusTask{}
+		for _, res := range failed {
+			ts := taskStatus(res[0])
+			ts.DurationSeconds = durations[res[0]].Seconds()
+			ts.CommandLine = lib.FilterRedacted(tasks[res[0]].RedactedCommandLine)
+			ts.Error = lib.ErrorStrings[res[1]]
+			if tasks[res[0]].Err != nil {
+				ts.Error += ": " + lib.FilterRedacted(tasks[res[0]].Err.Error())
+			}
+			status.FailedTasks = append(status.FailedTasks, ts)
+		}
+		return status
+	})
+	hostLimiter := lib.NewHostLimiter(ctx.HostLimits)
+	if hostLimiter != nil {
+		lib.Printf("Using host limits: %+v\n", hostLimiter.Limits)
+	}
 	ch := make(chan lib.TaskResult)
+	processResult := func(result lib.TaskResult) {
+		res := result.Code
+		taffs := result.Affs
+		tIdx := res[0]
+		nThreads--
+		if hostLimiter != nil {
+			hostLimiter.Release(lib.TaskHost(tasks[tIdx].Endpoint))
+		}
+		ds := tasks[tIdx].DsSlug
+		fx := tasks[tIdx].FxSlug
+		mtx.Lock()
+		// status handler reads tasks under the same mutex
+		tasks[tIdx].CommandLine = result.CommandLine
+		tasks[tIdx].RedactedCommandLine = result.RedactedCommandLine
+		tasks[tIdx].Env = result.Env
+		tasks[tIdx].Retries = result.Retries
+		tasks[tIdx].Err = result.Err
+		tasks[tIdx].ErrorClass = result.ErrorClass
+		delete(processing, tIdx)
+		endTimes[tIdx] = time.Now()
+		durations[tIdx] = endTimes[tIdx].Sub(startTimes[tIdx])
+		tasks[tIdx].Duration = durations[tIdx]
+		dataDs := byDs[ds]
+		dataFx := byFx[fx]
+		if res[1] > 0 {
+			failed = append(failed, res)
+			dataDs[1]++
+			dataFx[1]++
+		}
+		dataDs[2]++
+		dataFx[2]++
+		byDs[ds] = dataDs
+		byFx[fx] = dataFx
+		processed++
+		mtx.Unlock()
+		taskMetrics(&tasks[tIdx], &result)
+		lib.RecordTaskResult(tIdx, &tasks[tIdx], taffs, res[1])
+		extraInf := tasks[tIdx].ShortString()
+		if skippedTasks > 0 {
+			extraInf += fmt.Sprintf(" (%d skipped)", skippedTasks)
+		}
+		lib.ProgressInfo(processed, all, dtStart, &lastTime, time.Duration(1)*time.Minute, extraInf)
+		if !taffs && tMtx.OrderMtx != nil {
+			tMtx.TaskOrderMtx.Lock()
+			tmtx, ok := tMtx.OrderMtx[tIdx]
+			if !ok {
+				tMtx.TaskOrderMtx.Unlock()
+				lib.Fatalf("per task mutex map is defined, but no mutex for tIdx: %d", tIdx)
+			}
+			tmtx.Unlock()
+			tMtx.OrderMtx[tIdx] = tmtx
+			// lib.Printf("mtx %d unlocked (data task finished)\n", tIdx)
+			tMtx.TaskOrderMtx.Unlock()
+		}
+		if res[1] < 0 {
+			return
+		}
+		setSyncInfo(ctx, &tMtx, &result, false)
+		if result.Err == nil && len(result.Projects) > 0 {
+			setProject(ctx, result.Index, result.Projects)
+		}
+		if result.Err == nil {
+			setGroups(ctx, &result)
+		}
+		addEnrichCall(&result)
+	}
 	for modeIdx, affs := range modes {
 		stTime := time.Now()
+		mtx.Lock()
+		pass = modesStr[modeIdx]
+		mtx.Unlock()
 		lib.Printf("Affiliations mode: %+v\n", affs)
 		if affs == false && ctx.SkipData {
 			lib.Printf("Incremental data sync skipped\n")
@@ -4329,80 +4118,57 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 			if ctx.Debug >= 0 {
 				lib.Printf("Processing %d tasks using MT%d version (affiliations mode: %+v)\n", len(tasks), thrN, affs)
 			}
+			pending := []int{}
 			for idx, task := range tasks {
 				if taskFilteredOut(ctx, &task) {
+					mtx.Lock()
 					skippedTasks++
 					processed++
+					mtx.Unlock()
 					continue
 				}
 				_, skipped := skipDS[task.DsSlug]
 				if affs && skipped {
+					mtx.Lock()
 					skippedTasks++
 					processed++
+					mtx.Unlock()
+					continue
+				}
+				pending = append(pending, idx)
+			}
+			for len(pending) > 0 {
+				pi, wait := nextTask(hostLimiter, tasks, pending)
+				if pi < 0 {
+					// All pending tasks are blocked by host limits, wait for a running task to finish or for spacing to pass
+					if nThreads == 0 {
+						if wait <= 0 {
+							wait = time.Second
+						}
+						time.Sleep(wait)
+						continue
+					}
+					if wait <= 0 {
+						processResult(<-ch)
+						continue
+					}
+					select {
+					case result := <-ch:
+						processResult(result)
+					case <-time.After(wait):
+					}
 					continue
 				}
+				idx := pending[pi]
+				pending = append(pending[:pi], pending[pi+1:]...)
 				mtx.Lock()
 				processing[idx] = struct{}{}
 				startTimes[idx] = time.Now()
 				mtx.Unlock()
-				go processTask(ch, ctx, idx, task, affs, &tMtx)
+				go processTask(ch, ctx, idx, tasks[idx], affs, &tMtx)
 				nThreads++
 				if nThreads == thrN {
-					result := <-ch
-					res := result.Code
-					taffs := result.Affs
-					tIdx := res[0]
-					tasks[tIdx].CommandLine = result.CommandLine
-					tasks[tIdx].RedactedCommandLine = result.RedactedCommandLine
-					tasks[tIdx].Env = result.Env
-					tasks[tIdx].Retries = result.Retries
-					tasks[tIdx].Err = result.Err
-					nThreads--
-					ds := tasks[tIdx].DsSlug
-					fx := tasks[tIdx].FxSlug
-					mtx.Lock()
-					delete(processing, tIdx)
-					endTimes[tIdx] = time.Now()
-					durations[tIdx] = endTimes[tIdx].Sub(startTimes[tIdx])
-					tasks[tIdx].Duration = durations[tIdx]
-					dataDs := byDs[ds]
-					dataFx := byFx[fx]
-					if res[1] > 0 {
-						failed = append(failed, res)
-						dataDs[1]++
-						dataFx[1]++
-					}
-					dataDs[2]++
-					dataFx[2]++
-					byDs[ds] = dataDs
-					byFx[fx] = dataFx
-					processed++
-					mtx.Unlock()
-					extraInf := tasks[tIdx].ShortString()
-					if skippedTasks > 0 {
-						extraInf += fmt.Sprintf(" (%d skipped)", skippedTasks)
-					}
-					lib.ProgressInfo(processed, all, dtStart, &lastTime, time.Duration(1)*time.Minute, extraInf)
-					if !taffs && tMtx.OrderMtx != nil {
-						tMtx.TaskOrderMtx.Lock()
-						tmtx, ok := tMtx.OrderMtx[tIdx]
-						if !ok {
-							tMtx.TaskOrderMtx.Unlock()
-							lib.Fatalf("per task mutex map is defined, but no mutex for tIdx: %d", tIdx)
-						}
-						tmtx.Unlock()
-						tMtx.OrderMtx[tIdx] = tmtx
-						// lib.Printf("mtx %d unlocked (data task finished)\n", tIdx)
-						tMtx.TaskOrderMtx.Unlock()
-					}
-					if res[1] < 0 {
-						continue
-					}
-					setSyncInfo(ctx, &tMtx, &result, false)
-					if result.Err == nil && len(result.Projects) > 0 {
-						setProject(ctx, result.Index, result.Projects)
-					}
-					addEnrichCall(&result)
+					processResult(<-ch)
 				}
 			}
 		} else {
@@ -4411,28 +4177,51 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 			}
 			for idx, task := range tasks {
 				if taskFilteredOut(ctx, &task) {
+					mtx.Lock()
 					skippedTasks++
 					processed++
+					mtx.Unlock()
 					continue
 				}
 				_, skipped := skipDS[task.DsSlug]
 				if affs && skipped {
+					mtx.Lock()
 					skippedTasks++
 					processed++
+					mtx.Unlock()
 					continue
 				}
+				host := lib.TaskHost(task.Endpoint)
+				if hostLimiter != nil {
+					// In ST mode only one task runs at a time, so only minimum spacing between tasks can apply
+					for {
+						ok, wait := hostLimiter.TryAcquire(host, time.Now())
+						if ok {
+							break
+						}
+						time.Sleep(wait)
+					}
+				}
+				mtx.Lock()
 				processing[idx] = struct{}{}
+				startTimes[idx] = time.Now()
+				mtx.Unlock()
 				result := processTask(nil, ctx, idx, task, affs, &tMtx)
+				if hostLimiter != nil {
+					hostLimiter.Release(host)
+				}
 				res := result.Code
 				tIdx := res[0]
+				ds := tasks[tIdx].DsSlug
+				fx := tasks[tIdx].FxSlug
+				mtx.Lock()
+				// status handler reads tasks under the same mutex
 				tasks[tIdx].CommandLine = result.CommandLine
 				tasks[tIdx].RedactedCommandLine = result.RedactedCommandLine
 				tasks[tIdx].Env = result.Env
 				tasks[tIdx].Retries = result.Retries
 				tasks[tIdx].Err = result.Err
-				ds := tasks[tIdx].DsSlug
-				fx := tasks[tIdx].FxSlug
-				mtx.Lock()
+				tasks[tIdx].ErrorClass = result.ErrorClass
 				delete(processing, tIdx)
 				endTimes[tIdx] = time.Now()
 				durations[tIdx] = endTimes[tIdx].Sub(startTimes[tIdx])
@@ -4450,6 +4239,8 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 				byFx[fx] = dataFx
 				processed++
 				mtx.Unlock()
+				taskMetrics(&tasks[tIdx], &result)
+				lib.RecordTaskResult(tIdx, &tasks[tIdx], affs, res[1])
 				extraInf := tasks[tIdx].ShortString()
 				if skippedTasks > 0 {
 					extraInf += fmt.Sprintf(" (%d skipped)", skippedTasks)
@@ -4462,6 +4253,9 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 				if result.Err == nil && len(result.Projects) > 0 {
 					setProject(ctx, result.Index, result.Projects)
 				}
+				if result.Err == nil {
+					setGroups(ctx, &result)
+				}
 				addEnrichCall(&result)
 			}
 		}
@@ -4478,61 +4272,7 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 				gAliasesFunc()
 				earlyAliasesProcessed = true
 			}
-			result := <-ch
-			res := result.Code
-			taffs := result.Affs
-			tIdx := res[0]
-			tasks[tIdx].CommandLine = result.CommandLine
-			tasks[tIdx].RedactedCommandLine = result.RedactedCommandLine
-			tasks[tIdx].Env = result.Env
-			tasks[tIdx].Retries = result.Retries
-			tasks[tIdx].Err = result.Err
-			nThreads--
-			ds := tasks[tIdx].DsSlug
-			fx := tasks[tIdx].FxSlug
-			mtx.Lock()
-			delete(processing, tIdx)
-			endTimes[tIdx] = time.Now()
-			durations[tIdx] = endTimes[tIdx].Sub(startTimes[tIdx])
-			tasks[tIdx].Duration = durations[tIdx]
-			dataDs := byDs[ds]
-			dataFx := byFx[fx]
-			if res[1] > 0 {
-				failed = append(failed, res)
-				dataDs[1]++
-				dataFx[1]++
-			}
-			dataDs[2]++
-			dataFx[2]++
-			byDs[ds] = dataDs
-			byFx[fx] = dataFx
-			processed++
-			mtx.Unlock()
-			extraInf := tasks[tIdx].ShortString()
-			if skippedTasks > 0 {
-				extraInf += fmt.Sprintf(" (%d skipped)", skippedTasks)
-			}
-			lib.ProgressInfo(processed, all, dtStart, &lastTime, time.Duration(1)*time.Minute, extraInf)
-			if !taffs && tMtx.OrderMtx != nil {
-				tMtx.TaskOrderMtx.Lock()
-				tmtx, ok := tMtx.OrderMtx[tIdx]
-				if !ok {
-					tMtx.TaskOrderMtx.Unlock()
-					lib.Fatalf("per task mutex map is defined, but no mutex for tIdx (final threads join): %d", tIdx)
-				}
-				tmtx.Unlock()
-				tMtx.OrderMtx[tIdx] = tmtx
-				//lib.Printf("mtx %d unlocked (data task finished in final join)\n", tIdx)
-				tMtx.TaskOrderMtx.Unlock()
-			}
-			if res[1] < 0 {
-				continue
-			}
-			setSyncInfo(ctx, &tMtx, &result, false)
-			if result.Err == nil && len(result.Projects) > 0 {
-				setProject(ctx, result.Index, result.Projects)
-			}
-			addEnrichCall(&result)
+			processResult(<-ch)
 		}
 		enTime := time.Now()
 		lib.Printf("Pass (threads join) finished in %v\n", enTime.Sub(stTime))
@@ -4574,8 +4314,14 @@ func processTasks(ctx *lib.Ctx, ptasks *[]lib.Task, dss []string) error {
 			}
 		}
 	}
-	info("final")
+	info("tasks")
 	lib.Printf("Skipped tasks: %d\n", skippedTasks)
+	if ctx.QuarantineAfter > 0 && !ctx.SkipSyncInfo {
+		items, err := lib.GetQuarantined(ctx)
+		if err == nil {
+			lib.PrintQuarantineReport(items, time.Now())
+		}
+	}
 	return nil
 }
 
@@ -5262,6 +5008,14 @@ func p2oConfig2dadsConfig(c []lib.MultiConfig, ds string) (oc []lib.MultiConfig,
 //}
 
 func searchByQueryFirstID(ctx *lib.Ctx, index, esQuery string) (id string) {
+	hit, found := searchByQueryFirstHit(ctx, index, esQuery)
+	if found {
+		id = hit.ID
+	}
+	return
+}
+
+func searchByQueryFirstHit(ctx *lib.Ctx, index, esQuery string) (hit lib.EsSearchResultHit, found bool) {
 	data := lib.EsSearchPayload{Query: lib.EsSearchQuery{QueryString: lib.EsSearchQueryString{Query: esQuery}}}
 	payloadBytes, err := jsoniter.Marshal(data)
 	if err != nil {
@@ -5303,9 +5057,9 @@ func searchByQueryFirstID(ctx *lib.Ctx, index, esQuery string) (id string) {
 		lib.Printf("Body:%s\n", body)
 		return
 	}
-	for _, hit := range payload.Hits.Hits {
-		id = hit.ID
-		break
+	if len(payload.Hits.Hits) > 0 {
+		hit = payload.Hits.Hits[0]
+		found = true
 	}
 	return
 }
@@ -5548,78 +5302,8 @@ func checkSyncFreq(ctx *lib.Ctx, tMtx *lib.TaskMtx, index, ep string, freq time.
 }
 
 func jsonEscape(str string) string {
-	b, _ := jsoniter.Marshal(str)
-	return string(b[1 : len(b)-1])
-}
-
-func lastProjectDate(ctx *lib.Ctx, index, origin, must, mustNot string, silent bool) (epoch int64) {
-	data := ""
-	mustPartial := ""
-	if must != "" {
-		mustPartial = "," + must
-	}
-	optionalMustNot := ""
-	if mustNot != "" {
-		optionalMustNot = `,"must_not":[` + mustNot + "]"
-	}
-	if origin == "" {
-		data = fmt.Sprintf(
-			`{"query":{"bool":{"must":[{"exists":{"field":"project"}}%s]%s}},"sort":{"project_ts":"desc"}}`,
-			mustPartial,
-			optionalMustNot,
-		)
-	} else {
-		data = fmt.Sprintf(
-			`{"query":{"bool":{"must":[{"exists":{"field":"project"}},{"term":{"origin":"%s"}}%s]%s}},"sort":{"project_ts":"desc"}}`,
-			jsonEscape(origin),
-			mustPartial,
-			optionalMustNot,
-		)
-	}
-	payloadBytes := []byte(data)
-	payloadBody := bytes.NewReader(payloadBytes)
-	method := lib.Post
-	url := fmt.Sprintf("%s/%s/_doc/_search?size=1", ctx.ElasticURL, index)
-	rurl := fmt.Sprintf("/%s/_doc/_search?size=1", index)
-	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
-	if err != nil {
-		lib.Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		lib.Printf("Do request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-		return
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		if silent {
-			return
-		}
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			lib.Printf("ReadAll request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-			return
-		}
-		lib.Printf("Method:%s url:%s status:%d data:%s\n%s\n", method, rurl, resp.StatusCode, data, body)
-		return
-	}
-	payload := lib.EsSearchResultPayload{}
-	err = jsoniter.NewDecoder(resp.Body).Decode(&payload)
-	if err != nil {
-		body, err := ioutil.ReadAll(resp.Body)
-		lib.Printf("JSON decode error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
-		lib.Printf("Body:%s\n", body)
-		return
-	}
-	if len(payload.Hits.Hits) == 0 {
-		return
-	}
-	epoch = payload.Hits.Hits[0].Source.ProjectTS
-	return
+	b, _ := jsoniter.Marshal(str)
+	return string(b[1 : len(b)-1])
 }
 
 func sortEnv(env map[string]string) (envStr string) {
@@ -5651,12 +5335,24 @@ func setSyncInfo(ctx *lib.Ctx, tMtx *lib.TaskMtx, result *lib.TaskResult, before
 	// Err      -> *error
 	// Index    -> index
 	// Endpoint -> endpoint
+	// Verify   -> data completeness verification result (successful data sync only)
+	// Consecutive failures are counted for data sync results (or enrich results when data sync is skipped)
 	affs := result.Affs
+	countFailures := !before && (!affs || ctx.SkipData)
+	var verify *lib.VerifyResult
+	if !before && !affs && result.Err == nil {
+		verify = result.Verify
+	}
 	esIndex := "sdssyncinfo"
 	now := time.Now()
 	errStr := ""
+	errClass := ""
 	if result.Err != nil {
 		errStr = lib.FilterRedacted(result.Err.Error())
+		errClass = result.ErrorClass
+		if errClass == "" {
+			errClass = lib.ErrorClassUnknown
+		}
 	}
 	rEnvStr := ""
 	envStr := ""
@@ -5672,8 +5368,28 @@ func setSyncInfo(ctx *lib.Ctx, tMtx *lib.TaskMtx, result *lib.TaskResult, before
 	}
 	cl := envStr + result.CommandLine
 	rcl := rEnvStr + result.RedactedCommandLine
+	quarantine := func(failures int) *time.Time {
+		period := lib.QuarantinePeriod(ctx, failures)
+		if period <= 0 {
+			return nil
+		}
+		until := now.Add(period)
+		lib.Printf("%s %s failed %d times in a row, quarantined for %v (until %s)\n", result.Index, result.Endpoint, failures, period, lib.ToYMDHMSDate(until))
+		lib.Notify(
+			ctx,
+			lib.Notification{
+				Event:      lib.NotifyQuarantine,
+				Level:      lib.LogLevelWarning,
+				Foundation: lib.Foundation(result.FxSlug),
+				Title:      fmt.Sprintf("%s %s quarantined until %s", result.Index, result.Endpoint, lib.ToYMDHMSDate(until)),
+				Text:       fmt.Sprintf("%s %s failed %d times in a row, quarantined for %v, last error: %s", result.Index, result.Endpoint, failures, period, errStr),
+			},
+		)
+		return &until
+	}
 	esQuery := fmt.Sprintf("index:\"%s\" AND endpoint:\"%s\"", result.Index, result.Endpoint)
-	id := searchByQueryFirstID(ctx, esIndex, esQuery)
+	hit, _ := searchByQueryFirstHit(ctx, esIndex, esQuery)
+	id := hit.ID
 	var (
 		err          error
 		payloadBytes []byte
@@ -5699,22 +5415,55 @@ func setSyncInfo(ctx *lib.Ctx, tMtx *lib.TaskMtx, result *lib.TaskResult, before
 			if affs {
 				if result.Err == nil {
 					data += `"enrich_error":null,`
+					data += `"enrich_error_class":null,`
 					data += `"enrich_error_dt":null,`
 					data += fmt.Sprintf(`"enrich_success_dt":"%s",`, now.Format(time.RFC3339Nano))
 				} else {
 					data += fmt.Sprintf(`"enrich_error":"%s",`, jsonEscape(errStr))
+					data += fmt.Sprintf(`"enrich_error_class":"%s",`, jsonEscape(errClass))
 					data += fmt.Sprintf(`"enrich_error_dt":"%s",`, now.Format(time.RFC3339Nano))
 				}
 			} else {
 				if result.Err == nil {
 					data += `"data_sync_error":null,`
+					data += `"data_sync_error_class":null,`
 					data += `"data_sync_error_dt":null,`
 					data += fmt.Sprintf(`"data_sync_success_dt":"%s",`, now.Format(time.RFC3339Nano))
 				} else {
 					data += fmt.Sprintf(`"data_sync_error":"%s",`, jsonEscape(errStr))
+					data += fmt.Sprintf(`"data_sync_error_class":"%s",`, jsonEscape(errClass))
 					data += fmt.Sprintf(`"data_sync_error_dt":"%s",`, now.Format(time.RFC3339Nano))
 				}
 			}
+			if countFailures {
+				if result.Err == nil {
+					data += `"consecutive_failures":0,`
+					data += `"quarantined_until":null,`
+				} else {
+					failures := hit.Source.ConsecutiveFailures + 1
+					data += fmt.Sprintf(`"consecutive_failures":%d,`, failures)
+					until := quarantine(failures)
+					if until != nil {
+						data += fmt.Sprintf(`"quarantined_until":"%s",`, until.Format(time.RFC3339Nano))
+					}
+				}
+			}
+			if verify != nil {
+				data += fmt.Sprintf(`"verify_dt":"%s",`, verify.Dt.Format(time.RFC3339Nano))
+				if verify.Error == "" {
+					data += fmt.Sprintf(`"verify_upstream":%d,`, verify.Upstream)
+					data += fmt.Sprintf(`"verify_indexed":%d,`, verify.Indexed)
+					data += fmt.Sprintf(`"verify_diff_pct":%f,`, verify.DiffPct)
+					data += fmt.Sprintf(`"verify_ok":%v,`, verify.OK)
+					data += `"verify_error":null,`
+				} else {
+					data += `"verify_upstream":null,`
+					data += `"verify_indexed":null,`
+					data += `"verify_diff_pct":null,`
+					data += `"verify_ok":null,`
+					data += fmt.Sprintf(`"verify_error":"%s",`, jsonEscape(verify.Error))
+				}
+			}
 		}
 		data = data[:len(data)-1] + "}}"
 		payloadBytes = []byte(data)
@@ -5740,6 +5489,7 @@ func setSyncInfo(ctx *lib.Ctx, tMtx *lib.TaskMtx, result *lib.TaskResult, before
 					data.EnrichSuccessDt = &now
 				} else {
 					data.EnrichError = &errStr
+					data.EnrichErrClass = &errClass
 					data.EnrichErrorDt = &now
 				}
 			} else {
@@ -5747,9 +5497,25 @@ func setSyncInfo(ctx *lib.Ctx, tMtx *lib.TaskMtx, result *lib.TaskResult, before
 					data.DataSyncSuccessDt = &now
 				} else {
 					data.DataSyncError = &errStr
+					data.DataSyncErrClass = &errClass
 					data.DataSyncErrorDt = &now
 				}
 			}
+			if countFailures && result.Err != nil {
+				data.ConsecutiveFailures = 1
+				data.QuarantinedUntil = quarantine(data.ConsecutiveFailures)
+			}
+			if verify != nil {
+				data.VerifyDt = &verify.Dt
+				if verify.Error == "" {
+					data.VerifyUpstream = &verify.Upstream
+					data.VerifyIndexed = &verify.Indexed
+					data.VerifyDiffPct = &verify.DiffPct
+					data.VerifyOK = &verify.OK
+				} else {
+					data.VerifyError = &verify.Error
+				}
+			}
 		}
 		payloadBytes, err = jsoniter.Marshal(data)
 		if err != nil {
@@ -5826,116 +5592,55 @@ func setProject(ctx *lib.Ctx, index string, projects []lib.EndpointProject) {
 	if len(projects) == 0 {
 		lib.Printf("No projects configuration specified for index %s\n", index)
 	}
+	updates := []lib.ProjectUpdate{}
 	for _, conf := range projects {
-		project := conf.Name
-		origin := conf.Origin
-		if project == "" || origin == "" {
+		if conf.Name == "" || conf.Origin == "" {
 			continue
 		}
 		if ctx.Debug > 0 {
 			lib.Printf("Setting project %+v origin (index '%s')\n", conf, index)
 		}
-		projectEpoch := time.Now().Unix()
-		var err error
-		data := ""
-		var projectVal string
-		if project == lib.Null {
-			projectVal = "null"
-		} else {
-			projectVal = `\"` + jsonEscape(project) + `\"`
-		}
-		lastEpoch := int64(0)
-		payloadBytes := []byte{}
-		if origin == lib.ProjectNoOrigin {
-			data = fmt.Sprintf(
-				`{"script":{"inline":"ctx._source.project=%s;ctx._source.project_ts=%d;"},"query":{"match_all":{}}}`,
-				projectVal,
-				projectEpoch,
-			)
-			payloadBytes = []byte(data)
-		} else {
-			must := getConditionJSON(conf.Must, origin, false)
-			mustPartial := ""
-			if must != "" {
-				mustPartial = "," + must
-			}
-			mustNot := getConditionJSON(conf.MustNot, origin, false)
-			optionalMustNot := ""
-			mustNotPartial := ""
-			if mustNot != "" {
-				optionalMustNot = `,"must_not":[` + mustNot + "]"
-				mustNotPartial = "," + mustNot
-			}
-			if !ctx.SkipProjectTS {
-				lastEpoch = lastProjectDate(ctx, index, origin, must, mustNot, true)
-			}
-			if lastEpoch == 0 {
-				data = fmt.Sprintf(
-					`{"script":{"inline":"ctx._source.project=%s;ctx._source.project_ts=%d;"},"query":{"bool":{"must":[{"term":{"origin":"%s"}}%s]%s}}}`,
-					projectVal,
-					projectEpoch,
-					jsonEscape(origin),
-					mustPartial,
-					optionalMustNot,
-				)
-				payloadBytes = []byte(data)
-			} else {
-				data = fmt.Sprintf(
-					`{"script":{"inline":"ctx._source.project=%s;ctx._source.project_ts=%d;"},"query":{"bool":{"must_not":[{"range":{"project_ts":{"lte":%d}}}%s],"must":[{"term":{"origin":"%s"}}%s]}}}`,
-					projectVal,
-					projectEpoch,
-					lastEpoch,
-					mustNotPartial,
-					jsonEscape(origin),
-					mustPartial,
-				)
-				payloadBytes = []byte(data)
-			}
-		}
-		payloadBody := bytes.NewReader(payloadBytes)
-		method := lib.Post
-		url := fmt.Sprintf("%s/%s/_update_by_query?conflicts=proceed&refresh=true&timeout=20m", ctx.ElasticURL, index)
-		rurl := fmt.Sprintf("/%s/_update_by_query?conflicts=proceed&refresh=true&timeout=20m", index)
-		req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
-		if err != nil {
-			lib.Printf("new request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-			return
-		}
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			lib.Printf("do request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-			return
-		}
-		defer func() {
-			_ = resp.Body.Close()
-		}()
-		if resp.StatusCode != 200 {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				lib.Printf("ReadAll request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-				return
-			}
-			lib.Printf("Method:%s url:%s status:%d data:%+v\n%s", method, rurl, resp.StatusCode, data, body)
-			return
-		}
-		payload := lib.EsUpdateByQueryPayload{}
-		err = jsoniter.NewDecoder(resp.Body).Decode(&payload)
-		if err != nil {
-			body, err2 := ioutil.ReadAll(resp.Body)
-			if err2 != nil {
-				lib.Printf("ReadAll request error when parsing response: %+v/%+v for %s url: %s, data: %+v", err, err2, method, rurl, data)
-				return
-			}
-			lib.Printf("Method:%s url:%s status:%d data:%+v err:%+v\n%s", method, rurl, resp.StatusCode, data, err, body)
-			return
+		update := lib.ProjectUpdate{Origin: conf.Origin, Project: conf.Name}
+		if conf.Origin != lib.ProjectNoOrigin {
+			update.Must = getConditionJSON(conf.Must, conf.Origin, false)
+			update.MustNot = getConditionJSON(conf.MustNot, conf.Origin, false)
 		}
+		updates = append(updates, update)
+	}
+	if len(updates) == 0 {
+		return
+	}
+	results, err := lib.SetProjects(ctx, index, updates, !ctx.SkipProjectTS)
+	for _, result := range results {
 		if ctx.DryRun || ctx.Debug > 0 {
-			lib.Printf("Set project '%s'/%d on '%s'/%d origin (index '%s', config %+v): updated: %d\n", project, projectEpoch, origin, lastEpoch, index, conf, payload.Updated)
+			lib.Printf("Set project '%s' on '%s' origin (index '%s'): updated: %d\n", result.Project, result.Origin, index, result.Updated)
 		} else {
-			lib.PrintLogf("Set project '%s'/%d on '%s'/%d origin (index '%s', config %+v): updated: %d\n", project, projectEpoch, origin, lastEpoch, index, conf, payload.Updated)
+			lib.PrintLogf("Set project '%s' on '%s' origin (index '%s'): updated: %d\n", result.Project, result.Origin, index, result.Updated)
 		}
 	}
+	if err != nil {
+		lib.Printf("Set project (index '%s') error: %+v\n", index, err)
+	}
+}
+
+func setGroups(ctx *lib.Ctx, result *lib.TaskResult) {
+	if ctx.SkipGroups || result.Affs || result.Origin == "" {
+		return
+	}
+	// Endpoints without groups only get their documents updated when they had groups before (to clear them)
+	updated, full, err := lib.SetGroups(ctx, result.Index, result.Origin, result.Groups, ctx.GroupsBackfill)
+	if err != nil {
+		lib.Printf("Set groups %+v on '%s' origin (index '%s') error: %+v\n", result.Groups, result.Origin, result.Index, err)
+		return
+	}
+	if len(result.Groups) == 0 && !full {
+		return
+	}
+	if ctx.DryRun || ctx.Debug > 0 {
+		lib.Printf("Set groups %+v on '%s' origin (index '%s', all documents: %v): updated: %d\n", result.Groups, result.Origin, result.Index, full, updated)
+	} else {
+		lib.PrintLogf("Set groups %+v on '%s' origin (index '%s', all documents: %v): updated: %d\n", result.Groups, result.Origin, result.Index, full, updated)
+	}
 }
 
 func lastDataDate(ctx *lib.Ctx, index, must, mustNot string, silent bool) (epoch time.Time) {
@@ -6195,6 +5900,9 @@ func copyMapping(ctx *lib.Ctx, pattern, index string) (err error) {
 			lib.Printf("copy_from: index %s already exists\n", index)
 		}
 	}
+	if resp.StatusCode == 200 {
+		lib.RecordChange(lib.ReportChangeIndex, "create", index, "")
+	}
 	_ = resp.Body.Close()
 	root, ok := result.(map[string]interface{})
 	if !ok {
@@ -6395,7 +6103,7 @@ func handleCopyFrom(ctx *lib.Ctx, index string, task *lib.Task) (err error) {
 	scrollTime := "45m"
 	bulkSize := 1000
 	conf := task.CopyFrom
-	origin := mapOrigin(task.Endpoint, task.DsSlug)
+	origin := lib.MapOrigin(task.Endpoint, task.DsSlug)
 	if ctx.Debug > 0 {
 		lib.Printf("%s:%s: copy config: %+v\n", index, origin, conf)
 	}
@@ -6430,6 +6138,7 @@ func handleCopyFrom(ctx *lib.Ctx, index string, task *lib.Task) (err error) {
 	_ = resp.Body.Close()
 	if resp.StatusCode == 200 {
 		lib.Printf("copy_from: dropped conflicting alias: %s\n", index)
+		lib.RecordChange(lib.ReportChangeAlias, "drop", index, "")
 	}
 	// Delete destination index if not incremental mode
 	if !conf.Incremental {
@@ -6449,6 +6158,7 @@ func handleCopyFrom(ctx *lib.Ctx, index string, task *lib.Task) (err error) {
 		_ = resp.Body.Close()
 		if resp.StatusCode == 200 {
 			lib.Printf("copy_from: dropped index: %s (no incremental mode set)\n", index)
+			lib.RecordChange(lib.ReportChangeIndex, "drop", index, "")
 		} else {
 			lib.Printf("WARNING: copy_from: failed to drop index: %s (will use incremental mode)\n", index)
 		}
@@ -6717,23 +6427,10 @@ func handleCopyFrom(ctx *lib.Ctx, index string, task *lib.Task) (err error) {
 }
 
 // mapOrigin maps fixture's origin to ES "origin" column, depending on data-source type
-func mapOrigin(origin, ds string) string {
-	switch ds {
-	case lib.RocketChat:
-		return strings.Replace(strings.Replace(strings.TrimSpace(origin), "  ", " ", -1), " ", "/", -1)
-	case lib.DockerHub:
-		return "https://hub.docker.com/" + strings.Replace(strings.Replace(strings.TrimSpace(origin), "  ", " ", -1), " ", "/", -1)
-	case lib.GroupsIO:
-		return "https://groups.io/g/" + origin
-	default:
-		return origin
-	}
-}
-
 func setTaskResultProjects(result *lib.TaskResult, task *lib.Task) {
 	if task.Project == "" {
 		for _, project := range task.Projects {
-			ep := lib.EndpointProject{Name: project.Name, Origin: mapOrigin(project.Origin, task.DsSlug)}
+			ep := lib.EndpointProject{Name: project.Name, Origin: lib.MapOrigin(project.Origin, task.DsSlug)}
 			for _, cond := range project.Must {
 				ep.Must = append(ep.Must, lib.ColumnCondition{Column: cond.Column, Value: cond.Value})
 			}
@@ -6756,7 +6453,7 @@ func setTaskResultProjects(result *lib.TaskResult, task *lib.Task) {
 				result.Projects,
 				lib.EndpointProject{
 					Name:   task.Project,
-					Origin: mapOrigin(task.Endpoint, task.DsSlug),
+					Origin: lib.MapOrigin(task.Endpoint, task.DsSlug),
 				},
 			)
 		}
@@ -6776,6 +6473,19 @@ func taskFilteredOut(ctx *lib.Ctx, tsk *lib.Task) bool {
 	return false
 }
 
+// isNativeGit - git data sources with 'native' config flag use built-in sds-git collector instead of dads/p2o.py
+func isNativeGit(task *lib.Task) bool {
+	if task.DsSlug != lib.Git {
+		return false
+	}
+	for _, cfg := range task.Config {
+		if cfg.Name == lib.NativeGit && cfg.Value != "" && cfg.Value != lib.Nil {
+			return true
+		}
+	}
+	return false
+}
+
 func isDADS(task *lib.Task) bool {
 	all, ok := dadsTasks[strings.Split(task.DsSlug, "/")[0]]
 	if !ok {
@@ -6808,6 +6518,7 @@ func makeTaskGroupsEnv(task *lib.Task) string {
 }
 
 func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, affs bool, tMtx *lib.TaskMtx) (result lib.TaskResult) {
+	tlog := lib.TaskLogger(idx, task.FxSlug, task.DsFullSlug, task.Endpoint)
 	// Ensure to unlock thread when finishing
 	defer func() {
 		// Synchronize go routine
@@ -6816,27 +6527,29 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		}
 	}()
 	if ctx.Debug > 1 {
-		lib.Printf("Processing (affs: %+v): %s\n", affs, task)
+		tlog.Debugf("Processing (affs: %+v): %s\n", affs, task)
 	}
 	result.Code[0] = idx
 	result.Affs = affs
 	if !affs && !task.ProjectP2O && (task.Project != "" || len(task.Projects) > 0) {
 		setTaskResultProjects(&result, &task)
 	}
+	if !affs {
+		result.Origin = lib.MapOrigin(task.Endpoint, task.DsSlug)
+		result.Groups = task.Groups
+	}
 	// Handle DS slug
-	dads := isDADS(&task)
+	native := isNativeGit(&task)
+	dads := !native && isDADS(&task)
 	ds := task.DsSlug
 	fds := task.DsFullSlug
-	idxSlug := "sds-" + task.FxSlug + "-" + fds
-	idxSlug = strings.Replace(idxSlug, "/", "-", -1)
-	origIdxSlug := idxSlug
-	if dads {
-		idxSlug = strings.Replace(idxSlug, "github-pull_request", "github-issue", -1)
-	}
+	origIdxSlug := lib.FixtureIndex(task.FxSlug, fds)
+	idxSlug := lib.TaskIndex(task.FxSlug, fds, dads)
 	result.Index = idxSlug
 	result.Endpoint = task.Endpoint
 	result.Ds = strings.Replace(task.DsSlug, "/", "-", -1)
 	result.Fx = strings.Replace(task.FxSlug, "/", "-", -1)
+	result.FxSlug = task.FxSlug
 	// Filter out by task / task skip RE
 	if taskFilteredOut(ctx, &task) {
 		result.Code[1] = -1
@@ -6846,6 +6559,19 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 	if task.Dummy {
 		return
 	}
+	// Skip endpoints that are still in quarantine
+	qi, quarantined := gQuarantined[[2]string{idxSlug, task.Endpoint}]
+	if quarantined && qi.Active(time.Now()) {
+		if ctx.Debug > 0 {
+			tlog.Debugf("%s %s is quarantined until %s\n", idxSlug, task.Endpoint, lib.ToYMDHMSDate(*qi.QuarantinedUntil))
+		}
+		result.Code[1] = -4
+		return
+	}
+	// sds-git resolves identities only via affiliations API, without it affiliations refresh would rewrite the same documents
+	if native && affs && (ctx.AffiliationAPIURL == "" || ctx.Auth0Data == "") {
+		return
+	}
 	// Handle copy from another index slug
 	if task.CopyFrom.Pattern != "" {
 		if affs {
@@ -6868,7 +6594,31 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		commandLine []string
 		envPrefix   string
 	)
-	if dads {
+	if native {
+		commandLine = []string{"sds-git"}
+		envPrefix = "SDS_GIT_"
+		mainEnv[envPrefix+"RAW_INDEX"] = idxSlug + "-raw"
+		mainEnv[envPrefix+"RICH_INDEX"] = idxSlug
+		mainEnv[envPrefix+"ES_URL"] = ctx.ElasticURL
+		if affs {
+			mainEnv[envPrefix+"NO_RAW"] = "1"
+			mainEnv[envPrefix+"FORCE_FULL"] = "1"
+		}
+		if ctx.EsBulkSize > 0 {
+			mainEnv[envPrefix+"ES_BULK_SIZE"] = strconv.Itoa(ctx.EsBulkSize)
+		}
+		if ctx.CmdDebug > 0 {
+			mainEnv[envPrefix+"DEBUG"] = strconv.Itoa(ctx.CmdDebug)
+		}
+		if task.Project != "" {
+			mainEnv[envPrefix+"PROJECT"] = task.Project
+		}
+		mainEnv[envPrefix+"PROJECT_SLUG"] = task.AffiliationSource
+		if ctx.AffiliationAPIURL != "" && ctx.Auth0Data != "" {
+			mainEnv[envPrefix+"AFFILIATION_API_URL"] = ctx.AffiliationAPIURL
+			mainEnv["AUTH0_DATA"] = ctx.Auth0Data
+		}
+	} else if dads {
 		commandLine = []string{"dads"}
 		// add dads arguments
 		if task.DsSlug == lib.Bugzilla || task.DsSlug == lib.BugzillaRest || task.DsSlug == lib.GoogleGroups || task.DsSlug == lib.Pipermail {
@@ -6943,14 +6693,15 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		if strings.Contains(ds, "/") {
 			ary := strings.Split(ds, "/")
 			if len(ary) != 2 {
-				lib.Printf("%s: %+v: %s\n", ds, task, lib.ErrorStrings[1])
+				tlog.Errorf("%s: %+v: %s\n", ds, task, lib.ErrorStrings[1])
 				result.Code[1] = 1
+				result.ErrorClass = lib.ErrorClassBadConfig
 				return
 			}
 			mainEnv[envPrefix+"CATEGORY"] = ary[1]
 			ds = ary[0]
 		}
-	} else {
+	} else if !native {
 		redactedCommandLine[len(redactedCommandLine)-1] = lib.Redacted
 		if affs {
 			refresh := []string{"--only-enrich", "--refresh-identities", "--no_incremental"}
@@ -7020,8 +6771,9 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		if strings.Contains(ds, "/") {
 			ary := strings.Split(ds, "/")
 			if len(ary) != 2 {
-				lib.Printf("%s: %+v: %s\n", ds, task, lib.ErrorStrings[1])
+				tlog.Errorf("%s: %+v: %s\n", ds, task, lib.ErrorStrings[1])
 				result.Code[1] = 1
+				result.ErrorClass = lib.ErrorClassBadConfig
 				return
 			}
 			commandLine = append(commandLine, ary[0])
@@ -7039,11 +6791,14 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 	// Handle DS endpoint
 	eps, epEnv := massageEndpoint(task.Endpoint, ds, dads, idxSlug, task.Project)
 	if len(eps) == 0 {
-		lib.Printf("%s: %+v: %s\n", task.Endpoint, task, lib.ErrorStrings[2])
+		tlog.Errorf("%s: %+v: %s\n", task.Endpoint, task, lib.ErrorStrings[2])
 		result.Code[1] = 2
+		result.ErrorClass = lib.ErrorClassBadConfig
 		return
 	}
-	if dads {
+	if native {
+		mainEnv[envPrefix+"URL"] = eps[0]
+	} else if dads {
 		for k, v := range epEnv {
 			mainEnv[k] = v
 		}
@@ -7080,8 +6835,9 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 	// Handle DS config options
 	multiConfig, cfgEnv, fail := massageConfig(ctx, &(task.Config), ds, idxSlug)
 	if fail == true {
-		lib.Printf("%+v: %s\n", task, lib.ErrorStrings[3])
+		tlog.Errorf("%+v: %s\n", task, lib.ErrorStrings[3])
 		result.Code[1] = 3
+		result.ErrorClass = lib.ErrorClassBadConfig
 		return
 	}
 	if dads {
@@ -7095,7 +6851,7 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		if task.ProjectP2O {
 			mainEnv[envPrefix+"PROJECT_FILTER"] = "1"
 		}
-	} else {
+	} else if !native {
 		for _, mcfg := range multiConfig {
 			if strings.HasPrefix(mcfg.Name, "-") {
 				commandLine = append(commandLine, mcfg.Name)
@@ -7119,6 +6875,23 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 			redactedCommandLine = append(redactedCommandLine, "--project", task.Project)
 		}
 	}
+	// Git tasks (sds-git and p2o.py, dads has no way to use it) use a view of shared local bare mirror, it cannot be evicted until this task finishes
+	// Affiliations refresh doesn't need fresh data, it only uses mirror if it is already there
+	if task.DsSlug == lib.Git && !dads && ctx.GitMirrorPath != "" && !ctx.DryRun && !ctx.SkipP2O {
+		view, unlock, err := lib.GitMirror(ctx, task.Endpoint, !affs)
+		if err != nil {
+			if !affs || !os.IsNotExist(err) {
+				tlog.Warnf("git mirror for %s not available, task will use its own clone: %+v\n", task.Endpoint, err)
+			}
+		} else {
+			defer unlock()
+			mainEnv[lib.GitMirrorEnv] = view
+			if !native && !affs {
+				commandLine = append(commandLine, "--git-path", view)
+				redactedCommandLine = append(redactedCommandLine, "--git-path", view)
+			}
+		}
+	}
 	mainEnv["PROJECT_SLUG"] = task.AffiliationSource
 	mainEnv[envPrefix+"PROJECT_SLUG"] = task.AffiliationSource
 	mainEnv["GROUPS"] = makeTaskGroupsEnv(&task)
@@ -7147,12 +6920,23 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 		tMtx.TaskOrderMtx.Lock()
 		tMtx.OrderMtx[idx] = tmtx
 		tMtx.TaskOrderMtx.Unlock()
+		lib.MetricsObserveSince(lib.MetricLockWait, st, "task_order")
 		en := time.Now()
 		took := en.Sub(st)
 		if took > time.Duration(10)*time.Minute {
-			lib.Printf("Waited for data sync on %d/%+v mutex: %v\n", idx, task, en.Sub(st))
+			tlog.Printf("Waited for data sync on %d/%+v mutex: %v\n", idx, task, en.Sub(st))
 		}
 	}
+	phase := "data"
+	if affs {
+		phase = "affs"
+	}
+	lib.MetricsInc(lib.MetricTasksRunning, task.DsSlug, task.FxSlug, phase)
+	lib.SetTaskCommand(idx, redactedEnv+" "+result.RedactedCommandLine)
+	defer func() {
+		lib.MetricsAdd(lib.MetricTasksRunning, -1, task.DsSlug, task.FxSlug, phase)
+		lib.SetTaskCommand(idx, "")
+	}()
 	retries := 0
 	dtStart := time.Now()
 	for {
@@ -7212,34 +6996,44 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 			err = fmt.Errorf("%s %s", redactedEnv, strippedStr)
 		}
 		if strings.Contains(str, lib.DadsWarning) {
-			lib.Printf("Command error for %s %+v: %s\n", redactedEnv, redactedCommandLine, strippedStr)
+			tlog.Warnf("Command error for %s %+v: %s\n", redactedEnv, redactedCommandLine, strippedStr)
 		}
 		if err == nil {
 			if ctx.Debug > 0 {
 				dtEnd := time.Now()
-				lib.Printf("%+v: finished in %v, retries: %d\n", task, dtEnd.Sub(dtStart), retries)
+				tlog.Debugf("%+v: finished in %v, retries: %d\n", task, dtEnd.Sub(dtStart), retries)
 			}
+			// Error class of failed attempts doesn't apply to a task that finally succeeded
+			result.ErrorClass = ""
 			break
 		}
+		errClass := lib.ClassifyError(str, err)
+		result.ErrorClass = errClass
 		if isTimeoutError(err) {
 			dtEnd := time.Now()
-			lib.Printf("Timeout error for %s %+v (took %v, tried %d times): %+v: %s\n", redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err, strippedStr)
+			tlog.Errorf("Timeout error for %s %+v (took %v, tried %d times): %+v: %s\n", redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err, strippedStr)
 			str += fmt.Sprintf(": %+v", err)
 			result.Code[1] = 6
+			result.ErrorClass = lib.ErrorClassTimeout
 			result.Err = fmt.Errorf("timeout: last retry took %v: %+v", dtEnd.Sub(dtStart), strippedStr)
 			result.Retries = retries
 			return
 		}
 		retries++
-		if retries <= ctx.MaxRetry {
-			time.Sleep(time.Duration(retries) * time.Second)
+		wait, retry := lib.RetryWait(ctx, errClass, str, retries, time.Now())
+		if retry {
+			lib.MetricsInc(lib.MetricTaskRetries, task.DsSlug, errClass)
+			if errClass != lib.ErrorClassUnknown {
+				tlog.Warnf("%s error for %s %+v, retry %d/%d in %v\n", errClass, redactedEnv, redactedCommandLine, retries, ctx.MaxRetry, wait)
+			}
+			time.Sleep(wait)
 			continue
 		}
 		dtEnd := time.Now()
 		if pyE {
-			lib.Printf("Command error for %s %+v (took %v, tried %d times): %+v\n", redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err)
+			tlog.Errorf("Command error (%s) for %s %+v (took %v, tried %d times): %+v\n", errClass, redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err)
 		} else {
-			lib.Printf("Error for %s %+v (took %v, tried %d times): %+v: %s\n", redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err, strippedStr)
+			tlog.Errorf("Error (%s) for %s %+v (took %v, tried %d times): %+v: %s\n", errClass, redactedEnv, redactedCommandLine, dtEnd.Sub(dtStart), retries, err, strippedStr)
 			str += fmt.Sprintf(": %+v", err)
 		}
 		result.Code[1] = 4
@@ -7250,13 +7044,33 @@ func processTask(ch chan lib.TaskResult, ctx *lib.Ctx, idx int, task lib.Task, a
 	if !ctx.SkipP2O && !ctx.SkipEsData && !affs {
 		updated := setLastRun(ctx, tMtx, origIdxSlug, sEp)
 		if !updated {
-			lib.Printf("failed to set last sync date for %s/%s/%s\n", origIdxSlug, idxSlug, sEp)
+			tlog.Warnf("failed to set last sync date for %s/%s/%s\n", origIdxSlug, idxSlug, sEp)
+		}
+		if ctx.Verify {
+			result.Verify = lib.VerifyTask(ctx, &task, idxSlug)
+			if result.Verify != nil && !result.Verify.OK {
+				tlog.Warnf("data completeness verification failed for %s %s: %s\n", idxSlug, task.Endpoint, result.Verify)
+			}
 		}
 	}
 	result.Retries = retries
 	return
 }
 
+// evictGitMirrors - removes expired and least recently used git mirrors (when git mirrors cache is enabled)
+func evictGitMirrors(ctx *lib.Ctx) {
+	if ctx.GitMirrorPath == "" || ctx.DryRun || (ctx.GitMirrorQuota == 0 && ctx.GitMirrorMaxAge == 0) {
+		return
+	}
+	evicted, err := lib.EvictGitMirrors(ctx, time.Now())
+	for _, mirror := range evicted {
+		lib.Printf("Evicted git mirror %s (%d bytes, last used %s)\n", mirror.Path, mirror.Size, lib.ToYMDHMSDate(mirror.LastUsed))
+	}
+	if err != nil {
+		lib.Printf("Git mirrors eviction error: %+v\n", err)
+	}
+}
+
 func finishAfterTimeout(ctx lib.Ctx) {
 	time.Sleep(time.Duration(ctx.TimeoutSeconds) * time.Second)
 	err := syscall.Kill(syscall.Getpid(), syscall.SIGALRM)
@@ -7482,242 +7296,20 @@ func metricsEnrich(ctx *lib.Ctx, slug, ds string) {
 	return
 }
 
-func getMetadataQueries(ctx *lib.Ctx, m *lib.Metadata) (result [][3]string) {
-	patt := make(map[string][2]string)
-	for _, ds := range m.DataSources {
-		hasIndices := false
-		hasPatterns := false
-		items := []string{}
-		var key [2]string
-		for _, item := range ds.Slugs {
-			if strings.HasPrefix(item, "pattern:") {
-				items = append(items, item[8:])
-				hasPatterns = true
-				continue
-			}
-			items = append(items, "sds-"+strings.Replace(item, "/", "-", -1))
-			hasIndices = true
-		}
-		if hasIndices && hasPatterns {
-			lib.Printf("WARNING: incorrect metadata datasources slugs '%s' section, you cannot have both index names and patterns: %+v\n", ds.Name, ds)
-			continue
-		}
-		key[0] = strings.Join(items, ",")
-		hasIndices = false
-		hasPatterns = false
-		items = []string{}
-		for _, item := range ds.Externals {
-			if strings.HasPrefix(item, "pattern:") {
-				items = append(items, item[8:])
-				hasPatterns = true
-				continue
-			}
-			items = append(items, strings.Replace(item, "/", "-", -1))
-			hasIndices = true
-		}
-		if hasIndices && hasPatterns {
-			lib.Printf("WARNING: incorrect metadata datasources externals '%s' section, you cannot have both index names and patterns: %+v\n", ds.Name, ds)
-			continue
-		}
-		key[1] = strings.Join(items, ",")
-		patt[ds.Name] = key
-	}
-	addQuery := func(dest [2]string, op, query string) {
-		if dest[0] != "" {
-			result = append(result, [3]string{op, dest[0], query})
-		}
-		if dest[1] != "" {
-			result = append(result, [3]string{op, dest[1], query})
-		}
-	}
-	updateOp := "_update_by_query"
-	deleteOp := "_delete_by_query"
-	for _, wg := range m.WorkingGroups {
-		if len(wg.DataSources) == 0 {
-			continue
-		}
-		noOverwrite := wg.NoOverwrite
-		apply := map[string]string{"workinggroup": wg.Name}
-		formed := ""
-		for k, v := range wg.Meta {
-			apply["meta_"+k] = v
-			if formed == "" && strings.ToLower(k) == "formed" {
-				formed = v
-			} else if formed == "" && strings.ToLower(k) == "contributed" {
-				formed = v
-			}
-		}
-		var dtFormed time.Time
-		if formed != "" {
-			var e error
-			dtFormed, e = time.Parse("2006-01-02", formed)
-			if e != nil {
-				lib.Printf("cannot parse formed/contributed date: '%s': %v, from %+v\n", formed, e, wg.Meta)
-			}
-		}
-		hasFormed := !dtFormed.IsZero()
-		// {"script":{"inline":"ctx._source.field1=%s;ctx._source.field2=%s;"},
-		queryRoot := `{"script":{"inline":"`
-		ks := []string{}
-		for k := range apply {
-			ks = append(ks, k)
-		}
-		sort.Strings(ks)
-		if noOverwrite {
-			for _, k := range ks {
-				v := apply[k]
-				if v == lib.Null {
-					queryRoot += `if(!ctx._source.containsKey(\"` + k + `\")){ctx._source.` + k + `=null;}`
-					continue
-				}
-				queryRoot += `if(!ctx._source.containsKey(\"` + k + `\")){ctx._source.` + k + `=\"` + jsonEscape(v) + `\";}`
-			}
-		} else {
-			for _, k := range ks {
-				v := apply[k]
-				if v == lib.Null {
-					queryRoot += `ctx._source.` + k + `=null;`
-					continue
-				}
-				queryRoot += `ctx._source.` + k + `=\"` + jsonEscape(v) + `\";`
-			}
-		}
-		queryRoot += `"},`
-		for _, ds := range wg.DataSources {
-			dest, ok := patt[ds.Name]
-			if !ok {
-				lib.Printf("WARNING: working group data source '%s' not found in metadata data sources: '%+v'\n", ds.Name, wg)
-				continue
-			}
-			if len(ds.Filter) == 0 {
-				if len(ds.Origins) == 0 {
-					lib.Printf("WARNING: working group data source '%s' has no origins and no filter, skipping: '%+v'\n", ds.Name, wg)
-					continue
-				}
-				query := queryRoot + `"query":{"bool":{"should":[`
-				for _, origin := range ds.Origins {
-					if ds.Name == "mbox" {
-						mboxGroupname := fmt.Sprintf("finos.org/%s", origin)
-						query += `{"term":{"group_name":"` + jsonEscape(mboxGroupname) + `"}},`
-					} else {
-						query += `{"term":{"origin":"` + jsonEscape(origin) + `"}},`
-					}
-
-				}
-				query = query[:len(query)-1] + `]}}}`
-				addQuery(dest, updateOp, query)
-				if hasFormed {
-					query := `{"query":{"bool":{"must":{"range":{"metadata__updated_on":{"lt":"` + formed + `"}}},"minimum_should_match":1,"should":[`
-					for _, origin := range ds.Origins {
-						if ds.Name == "mbox" {
-							mboxGroupname := fmt.Sprintf("finos.org/%s", origin)
-							query += `{"term":{"group_name":"` + jsonEscape(mboxGroupname) + `"}},`
-						} else {
-							query += `{"term":{"origin":"` + jsonEscape(origin) + `"}},`
-						}
-
-					}
-					query = query[:len(query)-1] + `]}}}`
-					addQuery(dest, deleteOp, query)
-				}
-				continue
-			}
-			b, err := jsoniter.Marshal(ds.Filter)
-			if err != nil {
-				lib.Printf("WARNING: working group data source '%s' filter '%v' is broken: '%+v'\n", ds.Name, ds.Filter, wg)
-				continue
-			}
-			if len(ds.Origins) == 0 {
-				query := queryRoot + `"query":{"bool":{"filter":` + string(b) + `}}}`
-				addQuery(dest, updateOp, query)
-				if hasFormed {
-					query := `{"query":{"bool":{"must":{"range":{"metadata__updated_on":{"lt":"` + formed + `"}}},"filter":` + string(b) + `}}}`
-					addQuery(dest, deleteOp, query)
-				}
-				continue
-			}
-			query := queryRoot + `"query":{"bool":{"should":[`
-			for _, origin := range ds.Origins {
-				query += `{"term":{"origin":"` + jsonEscape(origin) + `"}},`
-			}
-			query = query[:len(query)-1] + `],"filter":` + string(b) + `}}}`
-			addQuery(dest, updateOp, query)
-			if hasFormed {
-				query := `{"query":{"bool":{"must":{"range":{"metadata__updated_on":{"lt":"` + formed + `"}}},"minimum_should_match":1,"should":[`
-				for _, origin := range ds.Origins {
-					if ds.Name == "mbox" {
-						mboxGroupname := fmt.Sprintf("finos.org/%s", origin)
-						query += `{"term":{"group_name":"` + jsonEscape(mboxGroupname) + `"}},`
-					} else {
-						query += `{"term":{"origin":"` + jsonEscape(origin) + `"}},`
-					}
-
-				}
-				query = query[:len(query)-1] + `],"filter":` + string(b) + `}}}`
-				addQuery(dest, deleteOp, query)
-			}
-		}
-	}
-	return
-}
-
-func processMetadataItem(ch chan struct{}, ctx *lib.Ctx, cfg [3]string) {
+func processMetadataGroup(ch chan struct{}, ctx *lib.Ctx, group *lib.MetadataGroup, prev *lib.MetadataState, indices []string, aliases []lib.AliasState) {
 	if ch != nil {
 		defer func() {
 			ch <- struct{}{}
 		}()
 	}
-	if ctx.Debug > 0 {
-		lib.Printf("Processing %v\n", cfg)
-	}
-	op := cfg[0]
-	pattern := cfg[1]
-	data := cfg[2]
-	payloadBytes := []byte(data)
-	payloadBody := bytes.NewReader(payloadBytes)
-	method := lib.Post
-	url := fmt.Sprintf("%s/%s/%s?conflicts=proceed&refresh=true&timeout=20m", ctx.ElasticURL, pattern, op)
-	rurl := fmt.Sprintf("/%s/%s?conflicts=proceed&refresh=true&timeout=20m", pattern, op)
-	req, err := http.NewRequest(method, url, payloadBody)
-	if err != nil {
-		lib.Printf("new request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		lib.Printf("do request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-		return
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			lib.Printf("ReadAll request error: %+v for %s url: %s, data: %+v", err, method, rurl, data)
-			return
-		}
-		lib.Printf("Method:%s url:%s status:%d data:%+v\n%s", method, rurl, resp.StatusCode, data, body)
-		return
-	}
-	payload := lib.EsByQueryPayload{}
-	err = jsoniter.NewDecoder(resp.Body).Decode(&payload)
+	matched := lib.MatchIndices(group.Targets(), indices, aliases)
+	updated, deleted, incremental, err := lib.ApplyMetadataGroup(ctx, group, prev, matched, ctx.MetadataFull)
 	if err != nil {
-		body, err2 := ioutil.ReadAll(resp.Body)
-		if err2 != nil {
-			lib.Printf("ReadAll request error when parsing response: %+v/%+v for %s url: %s, data: %+v", err, err2, method, rurl, data)
-			return
-		}
-		lib.Printf("Method:%s url:%s status:%d data:%+v err:%+v\n%s", method, rurl, resp.StatusCode, data, err, body)
+		lib.Printf("Working group '%s' (fixture %s) metadata error: %+v\n", group.Name, group.Fixture, err)
 		return
 	}
-	if ctx.Debug > 0 {
-		lib.Printf("%s/%s updated: %d, deleted: %d\n", pattern, data, payload.Updated, payload.Deleted)
-	} else {
-		if payload.Updated > 0 || payload.Deleted > 0 {
-			lib.Printf("metadata updated: %d, deleted: %d\n", payload.Updated, payload.Deleted)
-		}
+	if ctx.Debug > 0 || updated > 0 || deleted > 0 {
+		lib.Printf("Working group '%s' (fixture %s) metadata (incremental: %v, %d indices) updated: %d, deleted: %d\n", group.Name, group.Fixture, incremental, len(matched), updated, deleted)
 	}
 }
 
@@ -7727,30 +7319,54 @@ func processFixturesMetadata(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 	}
 	fixtures := *pfixtures
 	lib.Printf("Processing %d fixtures metadata\n", len(fixtures))
-	md := make(map[[3]string]struct{})
-	for _, fixture := range fixtures {
-		m := fixture.Metadata
-		if len(m.DataSources) == 0 || len(m.WorkingGroups) == 0 {
+	groups := []lib.MetadataGroup{}
+	slugs := []string{}
+	for i := range fixtures {
+		groups = append(groups, lib.FixtureMetadataGroups(&fixtures[i])...)
+		slugs = append(slugs, fixtures[i].Slug)
+	}
+	states, err := lib.MetadataStates(ctx)
+	if err != nil {
+		lib.Printf("Cannot get working groups metadata state, applying all metadata: %+v\n", err)
+	}
+	stale := lib.StaleMetadataStates(states, groups, slugs, !partialRun(ctx))
+	if len(groups) == 0 && len(stale) == 0 {
+		return
+	}
+	indices, err := lib.EsIndices(ctx)
+	if err != nil {
+		lib.Printf("Cannot get indices, skipping metadata: %+v\n", err)
+		return
+	}
+	aliases, err := lib.EsAliases(ctx)
+	if err != nil {
+		lib.Printf("Cannot get aliases, skipping metadata: %+v\n", err)
+		return
+	}
+	for i := range stale {
+		state := &stale[i]
+		updated, err := lib.CleanupMetadataGroup(ctx, state)
+		if err != nil {
+			lib.Printf("Working group '%s' (fixture %s) metadata cleanup error: %+v\n", state.Endpoint, state.Index, err)
 			continue
 		}
-		data := getMetadataQueries(ctx, &m)
-		for _, item := range data {
-			md[item] = struct{}{}
-		}
+		lib.Printf("Working group '%s' (fixture %s) removed, cleaned up metadata from %d documents\n", state.Endpoint, state.Index, updated)
 	}
-	if len(md) == 0 {
-		return
+	prev := make(map[[2]string]*lib.MetadataState)
+	for i := range states {
+		prev[[2]string{states[i].Index, states[i].Endpoint}] = &states[i]
 	}
 	thrN := lib.GetThreadsNum(ctx)
 	if thrN > 8 {
 		thrN = int(math.Round(math.Sqrt(float64(thrN))))
 	}
-	lib.Printf("%d metadata objects to process using %d threads\n", len(md), thrN)
+	lib.Printf("%d working groups metadata to process using %d threads\n", len(groups), thrN)
 	if thrN > 1 {
 		ch := make(chan struct{})
 		nThreads := 0
-		for item := range md {
-			go processMetadataItem(ch, ctx, item)
+		for i := range groups {
+			group := &groups[i]
+			go processMetadataGroup(ch, ctx, group, prev[[2]string{group.Fixture, group.Name}], indices, aliases)
 			nThreads++
 			if nThreads == thrN {
 				<-ch
@@ -7762,8 +7378,9 @@ func processFixturesMetadata(ctx *lib.Ctx, pfixtures *[]lib.Fixture) {
 			nThreads--
 		}
 	} else {
-		for item := range md {
-			processMetadataItem(nil, ctx, item)
+		for i := range groups {
+			group := &groups[i]
+			processMetadataGroup(nil, ctx, group, prev[[2]string{group.Fixture, group.Name}], indices, aliases)
 		}
 	}
 	lib.Printf("Processing fixtures metadata finished\n")
@@ -7773,6 +7390,9 @@ func main() {
 	var ctx lib.Ctx
 	dtStart := time.Now()
 	ctx.Init()
+	defer func() {
+		lib.FlushLogs()
+	}()
 	// IMPL
 	/*
 		processFixtureFiles(&ctx, lib.GetFixtures(&ctx, ""))
@@ -7783,16 +7403,25 @@ func main() {
 	if ctx.DryRun {
 		lib.Printf("Running in dry-run mode\n")
 	}
+	var err error
+	gExternal, err = lib.LoadExternalConfig(&ctx)
+	if err != nil {
+		lib.Fatalf("external indices configuration: %+v\n", err)
+	}
+	lib.ServeMetrics(&ctx)
+	lib.ServeStatus(&ctx)
 	if ctx.OnlyValidate {
 		validateFixtureFiles(&ctx, lib.GetFixtures(&ctx, ""))
 	} else {
 		lib.Printf("da-ds configuration: %+v\n", dadsTasks)
-		err := ensureGrimoireStackAvail(&ctx)
+		err = ensureGrimoireStackAvail(&ctx)
 		if err != nil {
 			lib.Fatalf("Grimoire stack not available: %+v\n", err)
 		}
 		go finishAfterTimeout(ctx)
 		processFixtureFiles(&ctx, lib.GetFixtures(&ctx, ""))
+		evictGitMirrors(&ctx)
+		lib.SetPhase(&ctx, lib.PhaseDAAPI)
 		err = hideEmails(&ctx)
 		if err != nil {
 			lib.Printf("Hide emails result: %+v\n", err)
@@ -7813,6 +7442,10 @@ func main() {
 		if err != nil {
 			lib.Printf("Cache top contributors result: %+v\n", err)
 		}
+		lib.SetPhase(&ctx, lib.PhaseFinished)
+		if gReportFunc != nil {
+			gReportFunc("final")
+		}
 		dtEnd := time.Now()
 		lib.Printf("Sync time: %v\n", dtEnd.Sub(dtStart))
 	}
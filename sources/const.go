@@ -90,6 +90,18 @@ const Redacted string = "[redacted]"
 // SDSMtx - sdsmtx
 const SDSMtx string = "sdsmtx"
 
+// SDSLog - sdslog
+const SDSLog string = "sdslog"
+
+// SDSData - sdsdata
+const SDSData string = "sdsdata"
+
+// SDSSyncInfo - sdssyncinfo
+const SDSSyncInfo string = "sdssyncinfo"
+
+// SDSRuns - sdsruns
+const SDSRuns string = "sdsruns"
+
 // Locked - locked
 const Locked string = "locked"
 
@@ -138,8 +150,12 @@ const Null string = "(null)"
 // DADS - config flag in the fixture that allows selecting when to run dads instead of p2o
 const DADS string = "dads"
 
+// NativeGit - config flag in the fixture that allows selecting built-in sds-git collector instead of dads/p2o for git
+const NativeGit string = "native"
+
 // ErrorStrings - array of possible errors returned from enrich tasks
 var ErrorStrings = map[int]string{
+	-4: "task was not executed due to endpoint quarantine",
 	-3: "task was not executed due to frequency check",
 	-2: "task is configured as a copy from another index pattern",
 	-1: "task was skipped",
@@ -79,12 +79,15 @@ type Ctx struct {
 	SkipExternal                    bool           // From SDS_SKIP_EXTERNAL, will skip any external indices processing: enrichments, deduplication, affiliations etc.
 	SkipProject                     bool           // From SDS_SKIP_PROJECT, will skip adding column "project": "project name" on all documents where origin = endpoint name, will also add timestamp column "project_ts", so next run can start on documents newer than that
 	SkipProjectTS                   bool           // From SDS_SKIP_PROJECT_TS, will add project column as described above, without using "project_ts" column to determine from which document to start
+	SkipGroups                      bool           // From SDS_SKIP_GROUPS, will skip adding column "groups" (endpoint groups) on all documents where origin = endpoint name, "groups_ts" column is used to only update newer documents
+	GroupsBackfill                  bool           // From SDS_GROUPS_BACKFILL, will recompute "groups" column on all documents (not only newer ones), use after changing fixtures groups configuration
 	SkipSyncInfo                    bool           // From SDS_SKIP_SYNC_INFO, will skip adding sync info to sds-sync-info index
 	SkipValGitHubAPI                bool           // From SDS_SKIP_VALIDATE_GITHUB_API, will not process GitHub orgs/users in validate step (will not attempt to get org's/user's repo lists)
 	SkipSortDuration                bool           // From SDS_SKIP_SORT_DURATION, if set - it will skip tasks run order by last running time duration desc
 	SkipMerge                       bool           // From SDS_SKIP_MERGE, if set - it will skip calling DA-affiliation merge_all API after all tasks finished
 	SkipHideEmails                  bool           // From SDS_SKIP_HIDE_EMAILS, if set - it will skip calling DA-affiliation hide_emails API
 	SkipMetadata                    bool           // From SDS_SKIP_METADATA, if set - it will skip processing fixture metadata
+	MetadataFull                    bool           // From SDS_METADATA_FULL, if set - it will apply fixture metadata to all documents, even when working group config and matched indices did not change since the last run
 	SkipCacheTopContributors        bool           // From SDS_SKIP_CACHE_TOP_CONTRIBUTORS, if set - it will skip calling DA-affiliation cache_top_contributors API
 	SkipOrgMap                      bool           // From SDS_SKIP_ORG_MAP, if set - it will skip calling DA-affiliation map_org_name API
 	SkipEnrichDS                    bool           // From SDS_SKIP_ENRICH_DS, if set - it will skip calling DA-matrics enrich API
@@ -94,10 +97,10 @@ type Ctx struct {
 	StripErrorSize                  int            // From SDS_STRIP_ERROR_SIZE, default 16384, error messages longer that this value will be stripped by this value from beginning and from end, so for 16384 error 64000 bytes long will be 16384 bytes from the beginning \n(...)\n 16384 from the end
 	GitHubOAuth                     string         // From SDS_GITHUB_OAUTH, if not set it attempts to use public access, if contains "/" it will assume that it contains file name, if "," found then it will assume that this is a list of OAuth tokens instead of just one
 	LatestItems                     bool           // From SDS_LATEST_ITEMS, if set pass "latest items" or similar flag to the p2o.py backend (that should be handled by p2o.py using ES, so this is probably not a good ide, git backend, for example, can return no data then)
-	CSVPrefix                       string         // From SDS_CSV_PREFIX, CSV logs filename prefix, default "jobs", so files would be "/root/.perceval/jobs_I_N.csv"
+	CSVPrefix                       string         // From SDS_CSV_PREFIX, run report filename prefix, default "jobs", so files would be "/root/.perceval/jobs_report_final_I_N.json/html"
 	Silent                          bool           // From SDS_SILENT, skip p2o.py debug mode if set, else it will pass "-g" flag to 'p2o.py' call
 	NoMultiAliases                  bool           // From SDS_NO_MULTI_ALIASES, if set alias can only be defined for single index, so only one index maps to any alias, if not defined multiple input indexies can be accessed through a single alias (so it can have data from more than 1 p2o.py call)
-	CleanupAliases                  bool           // From SDS_CLEANUP_ALIASES, will delete all aliases before creating them (so it can delete old indexes that were pointed by given alias before adding new indexes to it (single or multiple))
+	CleanupAliases                  bool           // From SDS_CLEANUP_ALIASES, will also remove configured aliases from indexes they no longer should point to (in the same atomic _aliases request that adds new ones)
 	ScrollWait                      int            // From SDS_SCROLL_WAIT, will pass 'p2o.py' '--scroll-wait=N' if set - this is to specify time to wait for available scrolls (in seconds), default 2700 (45 minutes)
 	ScrollSize                      int            // From SDS_SCROLL_SIZE, ElasticSearch scroll size when enriching data, default 500
 	MaxDeleteTrials                 int            // From SDS_MAX_DELETE_TRIALS, default 10
@@ -133,6 +136,49 @@ type Ctx struct {
 	LeFromAddr                      string         // FROM LE_FROMADDR
 	LePassword                      string         // FROM LE_PASSWORD
 	LeToAddrs                       string         // FROM LE_TOADDRS
+	RetryBaseDelay                  time.Duration  // From SDS_RETRY_BASE_DELAY, base delay for exponential retry backoff (upstream 5xx, ES bulk rejections, OOM), default 10s
+	RetryMaxDelay                   time.Duration  // From SDS_RETRY_MAX_DELAY, maximum delay between retries for exponential retry backoff, default 15m
+	RateLimitMaxWait                time.Duration  // From SDS_RATE_LIMIT_MAX_WAIT, maximum time to wait for upstream rate limit reset before retrying, default 1h
+	HostLimits                      []HostLimit    // From SDS_HOST_LIMITS, per upstream host concurrency limits: 'host_regexp=max_running[:min_spacing];...', for example 'jira\.lfnetworking\.org=2:30s;^gerrit\.=4', default empty which means no limits
+	QuarantineAfter                 int            // From SDS_QUARANTINE_AFTER, put endpoint into quarantine after that many consecutive data sync failures, default 0 which means quarantine is disabled
+	QuarantineBase                  time.Duration  // From SDS_QUARANTINE_BASE, quarantine period after reaching SDS_QUARANTINE_AFTER failures, doubled on each next failure, default 24h
+	QuarantineMax                   time.Duration  // From SDS_QUARANTINE_MAX, maximum quarantine period, default 720h (30 days)
+	MetricsAddr                     string         // From SDS_METRICS_ADDR, address to serve Prometheus metrics on (for example ':9100'), default empty which means no metrics listener
+	StatusAddr                      string         // From SDS_STATUS_ADDR, address to serve read-only JSON status API on (for example ':9100', can be the same as SDS_METRICS_ADDR), default empty which means no status API
+	LogFormat                       string         // From SDS_LOG_FORMAT, stdout log format: 'text' or 'json' (one JSON object per line with structured fields), default 'text'
+	RunID                           string         // From SDS_RUN_ID, run ID added to all structured log entries, default is generated from start time, node index and PID
+	LogBufferSize                   int            // From SDS_LOG_BUFFER_SIZE, number of log entries buffered for shipping to "sdslog" index, logging blocks when buffer is full, default 10000
+	LogBatchSize                    int            // From SDS_LOG_BATCH_SIZE, number of log entries sent to "sdslog" index in a single bulk request, default 500
+	LogFlushInterval                time.Duration  // From SDS_LOG_FLUSH_INTERVAL, ship buffered log entries at least that often, default 5s
+	LogSpillFile                    string         // From SDS_LOG_SPILL_FILE, file to store log entries that cannot be shipped to ES (they're reshipped later), default is SDS_CSV_PREFIX_sdslog_NodeIdx_NodeNum.ndjson
+	Retention                       []Retention    // From SDS_RETENTION, per-index retention of "sdslog", "sdsdata", "sdssyncinfo" and "sdsruns": 'index=limit[,limit];...', limit is age or doc count, for example 'sdslog=30d,5000000;sdsdata=365d', default empty which means no retention
+	LogRollover                     bool           // From SDS_LOG_ROLLOVER, create "sdslog" as dated indexes behind "sdslog" write alias (rolled over by ILM/ISM when available, by SDS otherwise), default false
+	LogRolloverAge                  time.Duration  // From SDS_LOG_ROLLOVER_AGE, roll "sdslog" write alias over to a new dated index after that time, default 24h
+	EsRuns                          bool           // From SDS_ES_RUNS, store final run report in "sdsruns" index (it is always saved locally as SDS_CSV_PREFIX_report_final_NodeIdx_NodeNum.json/html), default false
+	NotifySinks                     []NotifySink   // From SDS_NOTIFY, notification sinks: '[foundation_regexp@]type[:target];...', type is slack, email, webhook or file, for example 'slack:https://hooks.slack.com/...;^lfn$@email:ops@lfnetworking.org', default empty which means no notifications
+	NotifyFailureRate               float64        // From SDS_NOTIFY_FAILURE_RATE, notify when run (or foundation) failure rate in percent exceeds this value, default 0 which means no failure rate notifications
+	NotifySMTP                      string         // From SDS_NOTIFY_SMTP, SMTP server 'host:port' for email notifications (sender is LE_FROMADDR authenticated with LE_PASSWORD, default recipients LE_TOADDRS), default "localhost:25"
+	FreshnessSLA                    []FreshnessSLA // From SDS_FRESHNESS_SLA, per data source freshness SLA for sds-freshness: 'data_source=duration;...', for example 'git=12h;github/issue=3d', default empty which means data source's max_frequency (or SDS_FRESHNESS_DEFAULT)
+	FreshnessDefault                time.Duration  // From SDS_FRESHNESS_DEFAULT, freshness SLA for data sources without SDS_FRESHNESS_SLA and max_frequency, default 24h
+	Verify                          bool           // From SDS_VERIFY, verify data completeness after successful data sync (git, github/issue, github/pull_request, gerrit, jira), results are stored in "sdssyncinfo"
+	VerifyThreshold                 float64        // From SDS_VERIFY_THRESHOLD, maximum allowed difference between upstream and indexed counts in percent of upstream count, default 1
+	VerifyGitPath                   string         // From SDS_VERIFY_GIT_PATH, directory with git bare clones (perceval layout) used to count commits and by built-in sds-git collector, default "" which means $HOME/.perceval/repositories
+	GitMirrorPath                   string         // From SDS_GIT_MIRROR_PATH, directory with bare mirrors shared by git tasks (path is passed to tasks in SDS_GIT_MIRROR, p2o.py gets --git-path), default "" which means no mirror cache
+	GitMirrorQuota                  int            // From SDS_GIT_MIRROR_QUOTA_MB, git mirrors cache disk quota in MB, least recently used mirrors are evicted after each run, default 0 which means no quota
+	GitMirrorMaxAge                 time.Duration  // From SDS_GIT_MIRROR_MAX_AGE, git mirrors not used for longer than this are evicted after each run, default 0 which means no age based eviction
+	GitMirrorLockTimeout            time.Duration  // From SDS_GIT_MIRROR_LOCK_TIMEOUT, maximum time to wait for a mirror being cloned or fetched by other task, task uses its own clone after that, default 15m
+	GitMirrorFetchInterval          time.Duration  // From SDS_GIT_MIRROR_FETCH_INTERVAL, mirror fetched more recently than this is used as it is, default 10m
+	FAliasesConfig                  string         // From SDS_FALIASES_CONFIG, YAML file with foundation-f aliases hierarchy, naming templates, data source remaps and prefixes, default "" which means built-in defaults (see DefaultFAliasesConfig)
+	ProjectBatch                    int            // From SDS_PROJECT_BATCH, maximum number of origins that get project set by a single update script, default 500
+	ProjectSlices                   string         // From SDS_PROJECT_SLICES, number of slices of set project update by query ("auto" or a positive number), default "auto"
+	ProjectRPS                      float64        // From SDS_PROJECT_RPS, throttle set project update by query to that many requests per second, default 0 which means no throttling
+	ProjectPoll                     time.Duration  // From SDS_PROJECT_POLL, how often to poll set project ES task for completion, default 5s
+	ProjectTimeout                  time.Duration  // From SDS_PROJECT_TIMEOUT, cancel set project ES task when not finished after that time, default 2h
+	ExternalConfig                  string         // From SDS_EXTERNAL_CONFIG, YAML file declaring external indices (prefix, origin field, data source, enrichment command and dedup policy), default "" which means built-in Bitergia defaults (see DefaultExternalConfig)
+	ExternalReportOnly              bool           // From SDS_EXTERNAL_REPORT_ONLY, only report overlap of external indices with SDS indices, do not dedup or enrich them
+	DedupNonDestructive             bool           // From SDS_DEDUP_NON_DESTRUCTIVE, never delete external data: external sources with delete dedup policy use alias policy instead (filters on aliases exclude shared origins)
+	DedupMaxDelete                  int            // From SDS_DEDUP_MAX_DELETE, delete dedup policy refuses to delete more shared origins than this from a single external index, default 500
+	SharedEndpoints                 string         // From SDS_SHARED_ENDPOINTS, how endpoints shared between fixtures are fetched: "copy_from" or "alias" (fetched once by owner fixture), default "" which means every fixture fetches them
 }
 
 // Init - get context from environment variables
@@ -536,6 +582,8 @@ func (ctx *Ctx) Init() {
 	// Skip project/TS settings
 	ctx.SkipProject = os.Getenv("SDS_SKIP_PROJECT") != ""
 	ctx.SkipProjectTS = os.Getenv("SDS_SKIP_PROJECT_TS") != ""
+	ctx.SkipGroups = os.Getenv("SDS_SKIP_GROUPS") != ""
+	ctx.GroupsBackfill = os.Getenv("SDS_GROUPS_BACKFILL") != ""
 
 	// Skip sync info
 	ctx.SkipSyncInfo = os.Getenv("SDS_SKIP_SYNC_INFO") != ""
@@ -569,6 +617,7 @@ func (ctx *Ctx) Init() {
 
 	// Skip processing fixture metadata
 	ctx.SkipMetadata = os.Getenv("SDS_SKIP_METADATA") != ""
+	ctx.MetadataFull = os.Getenv("SDS_METADATA_FULL") != ""
 
 	// Skip all p2o commands
 	ctx.SkipP2O = os.Getenv("SDS_SKIP_P2O") != ""
@@ -600,6 +649,173 @@ func (ctx *Ctx) Init() {
 	}
 	ctx.MaxMtxWaitFatal = os.Getenv("SDS_MAX_MTX_WAIT_FATAL") != ""
 
+	// Retry backoff settings
+	parseDuration := func(env string, def time.Duration) time.Duration {
+		if os.Getenv(env) == "" {
+			return def
+		}
+		dur, err := time.ParseDuration(os.Getenv(env))
+		FatalNoLog(err)
+		if dur <= 0 {
+			return def
+		}
+		return dur
+	}
+	ctx.RetryBaseDelay = parseDuration("SDS_RETRY_BASE_DELAY", time.Duration(10)*time.Second)
+	ctx.RetryMaxDelay = parseDuration("SDS_RETRY_MAX_DELAY", time.Duration(15)*time.Minute)
+	ctx.RateLimitMaxWait = parseDuration("SDS_RATE_LIMIT_MAX_WAIT", time.Duration(1)*time.Hour)
+
+	// Per upstream host concurrency limits
+	if os.Getenv("SDS_HOST_LIMITS") != "" {
+		hostLimits, err := ParseHostLimits(os.Getenv("SDS_HOST_LIMITS"))
+		FatalNoLog(err)
+		ctx.HostLimits = hostLimits
+	}
+
+	// Endpoint quarantine
+	if os.Getenv("SDS_QUARANTINE_AFTER") != "" {
+		quarantineAfter, err := strconv.Atoi(os.Getenv("SDS_QUARANTINE_AFTER"))
+		FatalNoLog(err)
+		if quarantineAfter > 0 {
+			ctx.QuarantineAfter = quarantineAfter
+		}
+	}
+	ctx.QuarantineBase = parseDuration("SDS_QUARANTINE_BASE", time.Duration(24)*time.Hour)
+	ctx.QuarantineMax = parseDuration("SDS_QUARANTINE_MAX", time.Duration(720)*time.Hour)
+
+	// Prometheus metrics
+	ctx.MetricsAddr = os.Getenv("SDS_METRICS_ADDR")
+
+	// Status API
+	ctx.StatusAddr = os.Getenv("SDS_STATUS_ADDR")
+
+	// Structured logging
+	ctx.LogFormat = os.Getenv("SDS_LOG_FORMAT")
+	if ctx.LogFormat == "" {
+		ctx.LogFormat = LogFormatText
+	}
+	if ctx.LogFormat != LogFormatText && ctx.LogFormat != LogFormatJSON {
+		FatalNoLog(fmt.Errorf("SDS_LOG_FORMAT must be '%s' or '%s', got '%s'", LogFormatText, LogFormatJSON, ctx.LogFormat))
+	}
+	ctx.RunID = os.Getenv("SDS_RUN_ID")
+	if ctx.RunID == "" && !ctx.TestMode {
+		// Export generated run ID, so all contexts created by this process (like the one used for logging) share it
+		ctx.RunID = fmt.Sprintf("%s-%d-%d", time.Now().UTC().Format("20060102150405"), ctx.NodeIdx, os.Getpid())
+		_ = os.Setenv("SDS_RUN_ID", ctx.RunID)
+	}
+
+	// Log shipping
+	parseInt := func(env string, def int) int {
+		if os.Getenv(env) == "" {
+			return def
+		}
+		val, err := strconv.Atoi(os.Getenv(env))
+		FatalNoLog(err)
+		if val <= 0 {
+			return def
+		}
+		return val
+	}
+	ctx.LogBufferSize = parseInt("SDS_LOG_BUFFER_SIZE", 10000)
+	ctx.LogBatchSize = parseInt("SDS_LOG_BATCH_SIZE", 500)
+	ctx.LogFlushInterval = parseDuration("SDS_LOG_FLUSH_INTERVAL", time.Duration(5)*time.Second)
+	ctx.LogSpillFile = os.Getenv("SDS_LOG_SPILL_FILE")
+
+	// SDS indexes retention and rollover
+	if os.Getenv("SDS_RETENTION") != "" {
+		retention, err := ParseRetention(os.Getenv("SDS_RETENTION"))
+		FatalNoLog(err)
+		ctx.Retention = retention
+	}
+	ctx.LogRollover = os.Getenv("SDS_LOG_ROLLOVER") != ""
+	ctx.LogRolloverAge = parseDuration("SDS_LOG_ROLLOVER_AGE", time.Duration(24)*time.Hour)
+
+	// Run report
+	ctx.EsRuns = os.Getenv("SDS_ES_RUNS") != ""
+
+	// Notifications
+	if os.Getenv("SDS_NOTIFY") != "" {
+		sinks, err := ParseNotifySinks(os.Getenv("SDS_NOTIFY"))
+		FatalNoLog(err)
+		ctx.NotifySinks = sinks
+	}
+	if os.Getenv("SDS_NOTIFY_FAILURE_RATE") != "" {
+		failureRate, err := strconv.ParseFloat(os.Getenv("SDS_NOTIFY_FAILURE_RATE"), 64)
+		FatalNoLog(err)
+		if failureRate > 0 {
+			ctx.NotifyFailureRate = failureRate
+		}
+	}
+	ctx.NotifySMTP = os.Getenv("SDS_NOTIFY_SMTP")
+	if ctx.NotifySMTP == "" {
+		ctx.NotifySMTP = "localhost:25"
+	}
+
+	// Freshness SLA
+	if os.Getenv("SDS_FRESHNESS_SLA") != "" {
+		slas, err := ParseFreshnessSLA(os.Getenv("SDS_FRESHNESS_SLA"))
+		FatalNoLog(err)
+		ctx.FreshnessSLA = slas
+	}
+	ctx.FreshnessDefault = parseDuration("SDS_FRESHNESS_DEFAULT", time.Duration(24)*time.Hour)
+
+	// Data completeness verification
+	ctx.Verify = os.Getenv("SDS_VERIFY") != ""
+	ctx.VerifyThreshold = 1.0
+	if os.Getenv("SDS_VERIFY_THRESHOLD") != "" {
+		threshold, err := strconv.ParseFloat(os.Getenv("SDS_VERIFY_THRESHOLD"), 64)
+		FatalNoLog(err)
+		if threshold >= 0 {
+			ctx.VerifyThreshold = threshold
+		}
+	}
+	ctx.VerifyGitPath = os.Getenv("SDS_VERIFY_GIT_PATH")
+
+	// Git mirrors cache
+	ctx.GitMirrorPath = os.Getenv("SDS_GIT_MIRROR_PATH")
+	ctx.GitMirrorQuota = parseInt("SDS_GIT_MIRROR_QUOTA_MB", 0)
+	ctx.GitMirrorMaxAge = parseDuration("SDS_GIT_MIRROR_MAX_AGE", 0)
+	ctx.GitMirrorLockTimeout = parseDuration("SDS_GIT_MIRROR_LOCK_TIMEOUT", time.Duration(15)*time.Minute)
+	ctx.GitMirrorFetchInterval = parseDuration("SDS_GIT_MIRROR_FETCH_INTERVAL", time.Duration(10)*time.Minute)
+
+	// Foundation-f aliases configuration
+	ctx.FAliasesConfig = os.Getenv("SDS_FALIASES_CONFIG")
+
+	// External indices
+	ctx.ExternalConfig = os.Getenv("SDS_EXTERNAL_CONFIG")
+	ctx.ExternalReportOnly = os.Getenv("SDS_EXTERNAL_REPORT_ONLY") != ""
+	ctx.DedupNonDestructive = os.Getenv("SDS_DEDUP_NON_DESTRUCTIVE") != ""
+	ctx.DedupMaxDelete = parseInt("SDS_DEDUP_MAX_DELETE", 500)
+
+	// Endpoints shared between fixtures
+	ctx.SharedEndpoints = os.Getenv("SDS_SHARED_ENDPOINTS")
+	if ctx.SharedEndpoints != "" && ctx.SharedEndpoints != SharedEndpointsCopyFrom && ctx.SharedEndpoints != SharedEndpointsAlias {
+		FatalNoLog(fmt.Errorf("SDS_SHARED_ENDPOINTS must be '%s' or '%s', got '%s'", SharedEndpointsCopyFrom, SharedEndpointsAlias, ctx.SharedEndpoints))
+	}
+
+	// Set project update by query tasks
+	ctx.ProjectBatch = parseInt("SDS_PROJECT_BATCH", 500)
+	ctx.ProjectSlices = os.Getenv("SDS_PROJECT_SLICES")
+	if ctx.ProjectSlices == "" {
+		ctx.ProjectSlices = "auto"
+	}
+	if ctx.ProjectSlices != "auto" {
+		slices, err := strconv.Atoi(ctx.ProjectSlices)
+		FatalNoLog(err)
+		if slices <= 0 {
+			FatalNoLog(fmt.Errorf("SDS_PROJECT_SLICES must be 'auto' or a positive number, got '%s'", ctx.ProjectSlices))
+		}
+	}
+	if os.Getenv("SDS_PROJECT_RPS") != "" {
+		rps, err := strconv.ParseFloat(os.Getenv("SDS_PROJECT_RPS"), 64)
+		FatalNoLog(err)
+		if rps > 0 {
+			ctx.ProjectRPS = rps
+		}
+	}
+	ctx.ProjectPoll = parseDuration("SDS_PROJECT_POLL", time.Duration(5)*time.Second)
+	ctx.ProjectTimeout = parseDuration("SDS_PROJECT_TIMEOUT", time.Duration(2)*time.Hour)
+
 	if os.Getenv("SDS_ENRICH_EXTERNAL_FREQ") == "" {
 		ctx.EnrichExternalFreq = time.Duration(168) * time.Hour
 	} else {
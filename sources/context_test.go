@@ -95,6 +95,8 @@ func copyContext(in *lib.Ctx) *lib.Ctx {
 		SkipExternal:                    in.SkipExternal,
 		SkipProject:                     in.SkipProject,
 		SkipProjectTS:                   in.SkipProjectTS,
+		SkipGroups:                      in.SkipGroups,
+		GroupsBackfill:                  in.GroupsBackfill,
 		SkipSyncInfo:                    in.SkipSyncInfo,
 		SkipValGitHubAPI:                in.SkipValGitHubAPI,
 		SkipSortDuration:                in.SkipSortDuration,
@@ -105,6 +107,7 @@ func copyContext(in *lib.Ctx) *lib.Ctx {
 		SkipEnrichDS:                    in.SkipEnrichDS,
 		SkipCopyFrom:                    in.SkipCopyFrom,
 		SkipMetadata:                    in.SkipMetadata,
+		MetadataFull:                    in.MetadataFull,
 		RunDetAffRange:                  in.RunDetAffRange,
 		SkipP2O:                         in.SkipP2O,
 		MaxDeleteTrials:                 in.MaxDeleteTrials,
@@ -124,6 +127,49 @@ func copyContext(in *lib.Ctx) *lib.Ctx {
 		AffiliationAPIURL:               in.AffiliationAPIURL,
 		Auth0Data:                       in.Auth0Data,
 		MetricsAPIURL:                   in.MetricsAPIURL,
+		RetryBaseDelay:                  in.RetryBaseDelay,
+		RetryMaxDelay:                   in.RetryMaxDelay,
+		RateLimitMaxWait:                in.RateLimitMaxWait,
+		HostLimits:                      in.HostLimits,
+		QuarantineAfter:                 in.QuarantineAfter,
+		QuarantineBase:                  in.QuarantineBase,
+		QuarantineMax:                   in.QuarantineMax,
+		MetricsAddr:                     in.MetricsAddr,
+		StatusAddr:                      in.StatusAddr,
+		LogFormat:                       in.LogFormat,
+		RunID:                           in.RunID,
+		LogBufferSize:                   in.LogBufferSize,
+		LogBatchSize:                    in.LogBatchSize,
+		LogFlushInterval:                in.LogFlushInterval,
+		LogSpillFile:                    in.LogSpillFile,
+		Retention:                       in.Retention,
+		LogRollover:                     in.LogRollover,
+		LogRolloverAge:                  in.LogRolloverAge,
+		EsRuns:                          in.EsRuns,
+		NotifySinks:                     in.NotifySinks,
+		NotifyFailureRate:               in.NotifyFailureRate,
+		NotifySMTP:                      in.NotifySMTP,
+		FreshnessSLA:                    in.FreshnessSLA,
+		FreshnessDefault:                in.FreshnessDefault,
+		Verify:                          in.Verify,
+		VerifyThreshold:                 in.VerifyThreshold,
+		VerifyGitPath:                   in.VerifyGitPath,
+		GitMirrorPath:                   in.GitMirrorPath,
+		GitMirrorQuota:                  in.GitMirrorQuota,
+		GitMirrorMaxAge:                 in.GitMirrorMaxAge,
+		GitMirrorLockTimeout:            in.GitMirrorLockTimeout,
+		GitMirrorFetchInterval:          in.GitMirrorFetchInterval,
+		FAliasesConfig:                  in.FAliasesConfig,
+		ProjectBatch:                    in.ProjectBatch,
+		ProjectSlices:                   in.ProjectSlices,
+		ProjectRPS:                      in.ProjectRPS,
+		ProjectPoll:                     in.ProjectPoll,
+		ProjectTimeout:                  in.ProjectTimeout,
+		ExternalConfig:                  in.ExternalConfig,
+		ExternalReportOnly:              in.ExternalReportOnly,
+		DedupNonDestructive:             in.DedupNonDestructive,
+		DedupMaxDelete:                  in.DedupMaxDelete,
+		SharedEndpoints:                 in.SharedEndpoints,
 	}
 	return &out
 }
@@ -337,6 +383,8 @@ func TestInit(t *testing.T) {
 		SkipExternal:                    false,
 		SkipProject:                     false,
 		SkipProjectTS:                   false,
+		SkipGroups:                      false,
+		GroupsBackfill:                  false,
 		SkipSyncInfo:                    false,
 		SkipValGitHubAPI:                false,
 		SkipSortDuration:                false,
@@ -347,6 +395,7 @@ func TestInit(t *testing.T) {
 		SkipEnrichDS:                    false,
 		SkipCopyFrom:                    false,
 		SkipMetadata:                    false,
+		MetadataFull:                    false,
 		RunDetAffRange:                  false,
 		SkipP2O:                         false,
 		MaxDeleteTrials:                 10,
@@ -366,6 +415,49 @@ func TestInit(t *testing.T) {
 		AffiliationAPIURL:               "",
 		Auth0Data:                       "",
 		MetricsAPIURL:                   "",
+		RetryBaseDelay:                  time.Duration(10) * time.Second,
+		RetryMaxDelay:                   time.Duration(15) * time.Minute,
+		RateLimitMaxWait:                time.Duration(1) * time.Hour,
+		HostLimits:                      nil,
+		QuarantineAfter:                 0,
+		QuarantineBase:                  time.Duration(24) * time.Hour,
+		QuarantineMax:                   time.Duration(720) * time.Hour,
+		MetricsAddr:                     "",
+		StatusAddr:                      "",
+		LogFormat:                       "text",
+		RunID:                           "",
+		LogBufferSize:                   10000,
+		LogBatchSize:                    500,
+		LogFlushInterval:                time.Duration(5) * time.Second,
+		LogSpillFile:                    "",
+		Retention:                       nil,
+		LogRollover:                     false,
+		LogRolloverAge:                  time.Duration(24) * time.Hour,
+		EsRuns:                          false,
+		NotifySinks:                     nil,
+		NotifyFailureRate:               0.0,
+		NotifySMTP:                      "localhost:25",
+		FreshnessSLA:                    nil,
+		FreshnessDefault:                time.Duration(24) * time.Hour,
+		Verify:                          false,
+		VerifyThreshold:                 1.0,
+		VerifyGitPath:                   "",
+		GitMirrorPath:                   "",
+		GitMirrorQuota:                  0,
+		GitMirrorMaxAge:                 0,
+		GitMirrorLockTimeout:            time.Duration(15) * time.Minute,
+		GitMirrorFetchInterval:          time.Duration(10) * time.Minute,
+		FAliasesConfig:                  "",
+		ProjectBatch:                    500,
+		ProjectSlices:                   "auto",
+		ProjectRPS:                      0,
+		ProjectPoll:                     time.Duration(5) * time.Second,
+		ProjectTimeout:                  time.Duration(2) * time.Hour,
+		ExternalConfig:                  "",
+		ExternalReportOnly:              false,
+		DedupNonDestructive:             false,
+		DedupMaxDelete:                  500,
+		SharedEndpoints:                 "",
 	}
 
 	// Test cases
@@ -959,6 +1051,21 @@ func TestInit(t *testing.T) {
 				},
 			),
 		},
+		{
+			"Set groups",
+			map[string]string{
+				"SDS_SKIP_GROUPS":     "1",
+				"SDS_GROUPS_BACKFILL": "y",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"SkipGroups":     true,
+					"GroupsBackfill": true,
+				},
+			),
+		},
 		{
 			"Set skip sync info",
 			map[string]string{
@@ -1054,12 +1161,14 @@ func TestInit(t *testing.T) {
 			"Set skip fixture metadata",
 			map[string]string{
 				"SDS_SKIP_METADATA": "1",
+				"SDS_METADATA_FULL": "1",
 			},
 			dynamicSetFields(
 				t,
 				copyContext(&defaultContext),
 				map[string]interface{}{
 					"SkipMetadata": true,
+					"MetadataFull": true,
 				},
 			),
 		},
@@ -1235,6 +1344,208 @@ func TestInit(t *testing.T) {
 				},
 			),
 		},
+		{
+			"Set retry backoff settings",
+			map[string]string{
+				"SDS_RETRY_BASE_DELAY":    "30s",
+				"SDS_RETRY_MAX_DELAY":     "1h",
+				"SDS_RATE_LIMIT_MAX_WAIT": "-1s",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"RetryBaseDelay":   time.Duration(30) * time.Second,
+					"RetryMaxDelay":    time.Duration(1) * time.Hour,
+					"RateLimitMaxWait": time.Duration(1) * time.Hour,
+				},
+			),
+		},
+		{
+			"Set endpoint quarantine settings",
+			map[string]string{
+				"SDS_QUARANTINE_AFTER": "5",
+				"SDS_QUARANTINE_BASE":  "12h",
+				"SDS_QUARANTINE_MAX":   "168h",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"QuarantineAfter": 5,
+					"QuarantineBase":  time.Duration(12) * time.Hour,
+					"QuarantineMax":   time.Duration(168) * time.Hour,
+				},
+			),
+		},
+		{
+			"Set notification settings",
+			map[string]string{
+				"SDS_NOTIFY_FAILURE_RATE": "12.5",
+				"SDS_NOTIFY_SMTP":         "smtp.example.com:587",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"NotifyFailureRate": 12.5,
+					"NotifySMTP":        "smtp.example.com:587",
+				},
+			),
+		},
+		{
+			"Set data completeness verification",
+			map[string]string{
+				"SDS_VERIFY":           "1",
+				"SDS_VERIFY_THRESHOLD": "2.5",
+				"SDS_VERIFY_GIT_PATH":  "/data/git",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"Verify":          true,
+					"VerifyThreshold": 2.5,
+					"VerifyGitPath":   "/data/git",
+				},
+			),
+		},
+		{
+			"Set git mirrors cache",
+			map[string]string{
+				"SDS_GIT_MIRROR_PATH":           "/data/mirrors",
+				"SDS_GIT_MIRROR_QUOTA_MB":       "20480",
+				"SDS_GIT_MIRROR_MAX_AGE":        "720h",
+				"SDS_GIT_MIRROR_LOCK_TIMEOUT":   "1h",
+				"SDS_GIT_MIRROR_FETCH_INTERVAL": "30m",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"GitMirrorPath":          "/data/mirrors",
+					"GitMirrorQuota":         20480,
+					"GitMirrorMaxAge":        time.Duration(720) * time.Hour,
+					"GitMirrorLockTimeout":   time.Duration(1) * time.Hour,
+					"GitMirrorFetchInterval": time.Duration(30) * time.Minute,
+				},
+			),
+		},
+		{
+			"Set foundation-f aliases config",
+			map[string]string{
+				"SDS_FALIASES_CONFIG": "data/faliases.yaml",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"FAliasesConfig": "data/faliases.yaml",
+				},
+			),
+		},
+		{
+			"Set project update by query tasks",
+			map[string]string{
+				"SDS_PROJECT_BATCH":   "100",
+				"SDS_PROJECT_SLICES":  "4",
+				"SDS_PROJECT_RPS":     "250.5",
+				"SDS_PROJECT_POLL":    "1s",
+				"SDS_PROJECT_TIMEOUT": "30m",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"ProjectBatch":   100,
+					"ProjectSlices":  "4",
+					"ProjectRPS":     250.5,
+					"ProjectPoll":    time.Duration(1) * time.Second,
+					"ProjectTimeout": time.Duration(30) * time.Minute,
+				},
+			),
+		},
+		{
+			"Set external indices",
+			map[string]string{
+				"SDS_EXTERNAL_CONFIG":       "data/external.yaml",
+				"SDS_EXTERNAL_REPORT_ONLY":  "1",
+				"SDS_DEDUP_NON_DESTRUCTIVE": "1",
+				"SDS_DEDUP_MAX_DELETE":      "2000",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"ExternalConfig":      "data/external.yaml",
+					"ExternalReportOnly":  true,
+					"DedupNonDestructive": true,
+					"DedupMaxDelete":      2000,
+				},
+			),
+		},
+		{
+			"Set shared endpoints mode",
+			map[string]string{
+				"SDS_SHARED_ENDPOINTS": "alias",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"SharedEndpoints": "alias",
+				},
+			),
+		},
+		{
+			"Set structured logging",
+			map[string]string{
+				"SDS_LOG_FORMAT": "json",
+				"SDS_RUN_ID":     "run-1",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"LogFormat": "json",
+					"RunID":     "run-1",
+				},
+			),
+		},
+		{
+			"Set log shipping settings",
+			map[string]string{
+				"SDS_LOG_BUFFER_SIZE":    "100",
+				"SDS_LOG_BATCH_SIZE":     "-1",
+				"SDS_LOG_FLUSH_INTERVAL": "1s",
+				"SDS_LOG_SPILL_FILE":     "/tmp/spill.ndjson",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"LogBufferSize":    100,
+					"LogBatchSize":     500,
+					"LogFlushInterval": time.Duration(1) * time.Second,
+					"LogSpillFile":     "/tmp/spill.ndjson",
+				},
+			),
+		},
+		{
+			"Set log rollover",
+			map[string]string{
+				"SDS_LOG_ROLLOVER":     "1",
+				"SDS_LOG_ROLLOVER_AGE": "168h",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"LogRollover":    true,
+					"LogRolloverAge": time.Duration(168) * time.Hour,
+				},
+			),
+		},
 	}
 
 	// Context Init() is verbose when called with CtxDebug
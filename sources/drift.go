@@ -0,0 +1,235 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DriftText - plain text alias drift report format
+const DriftText string = "text"
+
+// DriftJSON - JSON alias drift report format
+const DriftJSON string = "json"
+
+// AliasDriftMissing - alias that should exist does not exist
+const AliasDriftMissing string = "missing"
+
+// AliasDriftExtra - alias exists but nothing maintains it (it would be dropped as unused)
+const AliasDriftExtra string = "extra"
+
+// AliasDriftWrongIndex - alias exists but points to different indices than it should
+const AliasDriftWrongIndex string = "wrong_index"
+
+// AliasDriftFilter - view exists on a given index but its filter is different
+const AliasDriftFilter string = "filter"
+
+// AliasDriftFixtures - alias (or view) maintained from fixtures aliases configuration
+const AliasDriftFixtures string = "fixtures"
+
+// AliasDriftFoundationF - alias maintained by foundation-f aliases generation
+const AliasDriftFoundationF string = "foundation-f"
+
+// AliasDrift - single difference between aliases that should exist and aliases in ES
+// Expected and Got are indices (or "index: filter" for views filters)
+type AliasDrift struct {
+	Type     string   `json:"type"`
+	Alias    string   `json:"alias"`
+	Source   string   `json:"source"`
+	Expected []string `json:"expected,omitempty"`
+	Got      []string `json:"got,omitempty"`
+}
+
+// aliasDriftReport - JSON alias drift report
+type aliasDriftReport struct {
+	Dt      time.Time    `json:"dt"`
+	Checked int          `json:"checked"`
+	Drift   int          `json:"drift"`
+	Items   []AliasDrift `json:"items"`
+}
+
+// sortedKeys - sorted keys of a string set
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// AliasesDrift - compares aliases and views maintained from fixtures aliases, foundation-f aliases and unused aliases
+// cleanup against current ES state (indices and aliases), returns differences and number of aliases checked
+// Expects fixtures with normalized aliases names (see NormalizeAliases), dedup are external indices alias policy states
+func AliasesDrift(ctx *Ctx, cfg *FAliasesConfig, fixtures []Fixture, indices []string, current []AliasState, dedup []ExternalDedupState) (drifts []AliasDrift, checked int) {
+	got := make(map[string]map[string]string)
+	for _, state := range current {
+		_, ok := got[state.Alias]
+		if !ok {
+			got[state.Alias] = make(map[string]string)
+		}
+		got[state.Alias][state.Index] = state.Filter
+	}
+	expected := make(map[string]map[string]string)
+	for _, fixture := range fixtures {
+		for _, alias := range fixture.Aliases {
+			for _, to := range alias.To {
+				expected[strings.Replace(to, "/", "-", -1)] = make(map[string]string)
+			}
+			for _, view := range alias.Views {
+				expected[strings.Replace(view.Name, "/", "-", -1)] = make(map[string]string)
+			}
+		}
+	}
+	desired, _ := DesiredAliases(fixtures, indices)
+	desired = SharedEndpointsAliases(ctx, desired, fixtures, indices)
+	desired = FilterExternalAliases(desired, dedup)
+	for _, state := range desired {
+		expected[state.Alias][state.Index] = state.Filter
+	}
+	// is is nil when alias does not exist
+	compare := func(alias, source string, should, is map[string]string) {
+		checked++
+		if is == nil {
+			if !NotMissingPattern.MatchString(alias) {
+				drifts = append(drifts, AliasDrift{Type: AliasDriftMissing, Alias: alias, Source: source, Expected: sortedKeys(should)})
+			}
+			return
+		}
+		shouldIndices := sortedKeys(should)
+		isIndices := sortedKeys(is)
+		if strings.Join(shouldIndices, ",") != strings.Join(isIndices, ",") {
+			drifts = append(drifts, AliasDrift{Type: AliasDriftWrongIndex, Alias: alias, Source: source, Expected: shouldIndices, Got: isIndices})
+			return
+		}
+		for _, index := range shouldIndices {
+			if should[index] != is[index] {
+				drifts = append(
+					drifts,
+					AliasDrift{
+						Type:     AliasDriftFilter,
+						Alias:    alias,
+						Source:   source,
+						Expected: []string{index + ": " + should[index]},
+						Got:      []string{index + ": " + is[index]},
+					},
+				)
+			}
+		}
+	}
+	names := []string{}
+	for alias := range expected {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		compare(alias, AliasDriftFixtures, expected[alias], got[alias])
+	}
+	// Foundation-f items can be aliases, they are resolved to indices they point to
+	exists := make(map[string]struct{})
+	for _, index := range indices {
+		exists[index] = struct{}{}
+	}
+	config := FoundationFAliases(ctx, cfg, fixtures)
+	ffNames := []string{}
+	for alias := range config {
+		ffNames = append(ffNames, alias)
+	}
+	sort.Strings(ffNames)
+	for _, alias := range ffNames {
+		should := make(map[string]string)
+		for _, item := range config[alias] {
+			itemIndices, isAlias := got[item]
+			if isAlias {
+				for index := range itemIndices {
+					should[index] = ""
+				}
+				continue
+			}
+			_, isIndex := exists[item]
+			if isIndex {
+				should[item] = ""
+			}
+		}
+		// Filters are not maintained for foundation-f aliases
+		var is map[string]string
+		_, ok := got[alias]
+		if ok {
+			is = make(map[string]string)
+			for index := range got[alias] {
+				is[index] = ""
+			}
+		}
+		compare(alias, AliasDriftFoundationF, should, is)
+	}
+	fPattern := cfg.FAliasPattern()
+	extra := []AliasDrift{}
+	for alias := range got {
+		if !strings.HasPrefix(alias, "sds-") {
+			continue
+		}
+		_, ok := expected[alias]
+		if ok {
+			continue
+		}
+		_, ok = config[alias]
+		if ok {
+			continue
+		}
+		if fPattern.MatchString(alias) {
+			extra = append(extra, AliasDrift{Type: AliasDriftExtra, Alias: alias, Source: AliasDriftFoundationF, Got: sortedKeys(got[alias])})
+			continue
+		}
+		if NoDropPattern.MatchString(alias) {
+			continue
+		}
+		extra = append(extra, AliasDrift{Type: AliasDriftExtra, Alias: alias, Source: AliasDriftFixtures, Got: sortedKeys(got[alias])})
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		return extra[i].Alias < extra[j].Alias
+	})
+	drifts = append(drifts, extra...)
+	return
+}
+
+// FormatAliasDrift - formats alias drift report in text or JSON format
+func FormatAliasDrift(drifts []AliasDrift, checked int, format string, now time.Time) (out []byte, err error) {
+	switch format {
+	case DriftText:
+		var buf bytes.Buffer
+		counts := make(map[string]int)
+		for _, drift := range drifts {
+			counts[drift.Type]++
+			switch drift.Type {
+			case AliasDriftMissing:
+				fmt.Fprintf(&buf, "missing %s alias %s, should point to: %s\n", drift.Source, drift.Alias, strings.Join(drift.Expected, ", "))
+			case AliasDriftExtra:
+				fmt.Fprintf(&buf, "extra %s alias %s points to: %s\n", drift.Source, drift.Alias, strings.Join(drift.Got, ", "))
+			case AliasDriftWrongIndex:
+				fmt.Fprintf(&buf, "%s alias %s points to: %s, should point to: %s\n", drift.Source, drift.Alias, strings.Join(drift.Got, ", "), strings.Join(drift.Expected, ", "))
+			case AliasDriftFilter:
+				fmt.Fprintf(&buf, "view %s filter is %s, should be %s\n", drift.Alias, strings.Join(drift.Got, ", "), strings.Join(drift.Expected, ", "))
+			}
+		}
+		fmt.Fprintf(
+			&buf,
+			"%d maintained aliases checked, %d drift: %d missing, %d extra, %d wrong index, %d filter\n",
+			checked, len(drifts), counts[AliasDriftMissing], counts[AliasDriftExtra], counts[AliasDriftWrongIndex], counts[AliasDriftFilter],
+		)
+		out = buf.Bytes()
+	case DriftJSON:
+		if drifts == nil {
+			drifts = []AliasDrift{}
+		}
+		out, err = jsoniter.MarshalIndent(aliasDriftReport{Dt: now, Checked: checked, Drift: len(drifts), Items: drifts}, "", "  ")
+		if err == nil {
+			out = append(out, '\n')
+		}
+	default:
+		err = fmt.Errorf("unknown alias drift report format '%s', allowed: %s, %s", format, DriftText, DriftJSON)
+	}
+	return
+}
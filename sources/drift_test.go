@@ -0,0 +1,90 @@
+package syncdatasources
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestAliasesDrift(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	filter := map[interface{}]interface{}{"term": map[interface{}]interface{}{"project": "X"}}
+	fixtures := []lib.Fixture{
+		{
+			Slug:        "cncf/devstats",
+			DataSources: []lib.DataSource{{Slug: "git", FullSlug: "git", Endpoints: []lib.Endpoint{{Name: "https://github.com/a/b"}}}},
+			Aliases: []lib.Alias{
+				{From: "cncf/devstats-git", To: []string{"cncf/git", "cncf/missing"}, Views: []lib.AliasView{{Name: "cncf/x", Filter: filter}}},
+			},
+		},
+	}
+	lib.NormalizeAliases(&fixtures[0])
+	indices := []string{"sds-cncf-devstats-git", "sds-other-git"}
+	current := []lib.AliasState{
+		{Index: "sds-cncf-devstats-git", Alias: "sds-cncf-git"},
+		{Index: "sds-other-git", Alias: "sds-cncf-git"},
+		{Index: "sds-cncf-devstats-git", Alias: "sds-cncf-x", Filter: `{"term":{"project":"Y"}}`},
+		{Index: "sds-other-git", Alias: "sds-old"},
+		{Index: "sds-other-git", Alias: "sds-other-slack"},
+		{Index: "sds-other-git", Alias: "sds-old-f-git"},
+		{Index: "sds-other-git", Alias: "bitergia-old"},
+	}
+	cfg := lib.DefaultFAliasesConfig()
+	drifts, checked := lib.AliasesDrift(&lib.Ctx{}, &cfg, fixtures, indices, current, nil)
+
+	// Test cases
+	var testCases = []lib.AliasDrift{
+		{
+			Type: lib.AliasDriftWrongIndex, Alias: "sds-cncf-git", Source: lib.AliasDriftFixtures,
+			Expected: []string{"sds-cncf-devstats-git"}, Got: []string{"sds-cncf-devstats-git", "sds-other-git"},
+		},
+		{Type: lib.AliasDriftMissing, Alias: "sds-cncf-missing", Source: lib.AliasDriftFixtures, Expected: []string{"sds-cncf-devstats-git"}},
+		{
+			Type: lib.AliasDriftFilter, Alias: "sds-cncf-x", Source: lib.AliasDriftFixtures,
+			Expected: []string{`sds-cncf-devstats-git: {"term":{"project":"X"}}`}, Got: []string{`sds-cncf-devstats-git: {"term":{"project":"Y"}}`},
+		},
+		{Type: lib.AliasDriftMissing, Alias: "sds-cncf-f-git", Source: lib.AliasDriftFoundationF, Expected: []string{"sds-cncf-devstats-git", "sds-other-git"}},
+		{Type: lib.AliasDriftExtra, Alias: "sds-old", Source: lib.AliasDriftFixtures, Got: []string{"sds-other-git"}},
+		{Type: lib.AliasDriftExtra, Alias: "sds-old-f-git", Source: lib.AliasDriftFoundationF, Got: []string{"sds-other-git"}},
+	}
+	// Execute test cases
+	if len(drifts) != len(testCases) || checked != 4 {
+		t.Fatalf("expected %d drifts in 4 aliases, got %d in %d: %+v", len(testCases), len(drifts), checked, drifts)
+	}
+	for index, test := range testCases {
+		got := drifts[index]
+		if got.Type != test.Type || got.Alias != test.Alias || got.Source != test.Source ||
+			!reflect.DeepEqual(got.Expected, test.Expected) || !reflect.DeepEqual(got.Got, test.Got) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test, got)
+		}
+	}
+
+	// Reports
+	out, err := lib.FormatAliasDrift(drifts, checked, lib.DriftText, time.Now())
+	if err != nil || !strings.HasSuffix(string(out), "4 maintained aliases checked, 6 drift: 2 missing, 2 extra, 1 wrong index, 1 filter\n") ||
+		!strings.Contains(string(out), "fixtures alias sds-cncf-git points to: sds-cncf-devstats-git, sds-other-git, should point to: sds-cncf-devstats-git\n") {
+		t.Errorf("unexpected text report (%+v):\n%s", err, out)
+	}
+	out, err = lib.FormatAliasDrift(drifts, checked, lib.DriftJSON, time.Now())
+	var report struct {
+		Checked int              `json:"checked"`
+		Drift   int              `json:"drift"`
+		Items   []lib.AliasDrift `json:"items"`
+	}
+	if err != nil || jsoniter.Unmarshal(out, &report) != nil || report.Drift != 6 || report.Items[5].Alias != "sds-old-f-git" {
+		t.Errorf("unexpected JSON report (%+v):\n%s", err, out)
+	}
+	_, err = lib.FormatAliasDrift(drifts, checked, "xml", time.Now())
+	if err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	drifts, _ = lib.AliasesDrift(&lib.Ctx{}, &cfg, nil, indices, nil, nil)
+	if len(drifts) != 0 {
+		t.Errorf("expected no drift, got %+v", drifts)
+	}
+}
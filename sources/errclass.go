@@ -0,0 +1,230 @@
+package syncdatasources
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClassRateLimit - upstream API rate limit exceeded
+const ErrorClassRateLimit string = "rate_limit"
+
+// ErrorClassAuth - authentication/authorization failure (bad or revoked token, no access)
+const ErrorClassAuth string = "auth"
+
+// ErrorClassUpstream5xx - upstream server returned 5xx error
+const ErrorClassUpstream5xx string = "upstream_5xx"
+
+// ErrorClassESBulkRejection - ElasticSearch rejected bulk request (queue full, circuit breaker)
+const ErrorClassESBulkRejection string = "es_bulk_rejection"
+
+// ErrorClassOOM - subprocess run out of memory
+const ErrorClassOOM string = "oom"
+
+// ErrorClassTimeout - subprocess was killed by a task timeout
+const ErrorClassTimeout string = "timeout"
+
+// ErrorClassBadConfig - fixture/configuration error, retrying won't help
+const ErrorClassBadConfig string = "bad_config"
+
+// ErrorClassUnknown - error that cannot be classified
+const ErrorClassUnknown string = "unknown"
+
+// BackoffLinear - wait N seconds before N-th retry (this is the legacy SDS behavior)
+const BackoffLinear string = "linear"
+
+// BackoffExponential - wait base * 2^(N-1) before N-th retry (capped by SDS_RETRY_MAX_DELAY)
+const BackoffExponential string = "exponential"
+
+// BackoffReset - wait until rate limit reset time reported by the upstream (capped by SDS_RATE_LIMIT_MAX_WAIT)
+const BackoffReset string = "reset"
+
+// RetryPolicy - how to retry a task that failed with a given error class
+// Retry - if false, task is not retried at all
+// MaxRetries - maximum number of retries for this class (it is also limited by SDS_MAXRETRY), 0 means no additional limit
+type RetryPolicy struct {
+	Retry      bool
+	MaxRetries int
+	Backoff    string
+}
+
+// ErrorClassPolicies - retry policy for each error class
+var ErrorClassPolicies = map[string]RetryPolicy{
+	ErrorClassRateLimit:       {Retry: true, Backoff: BackoffReset},
+	ErrorClassAuth:            {Retry: false},
+	ErrorClassUpstream5xx:     {Retry: true, Backoff: BackoffExponential},
+	ErrorClassESBulkRejection: {Retry: true, Backoff: BackoffExponential},
+	ErrorClassOOM:             {Retry: true, MaxRetries: 1, Backoff: BackoffExponential},
+	ErrorClassTimeout:         {Retry: false},
+	ErrorClassBadConfig:       {Retry: false},
+	ErrorClassUnknown:         {Retry: true, Backoff: BackoffLinear},
+}
+
+// errorClassifiers - ordered list of error classes and regular expressions used to detect them, first match wins
+var errorClassifiers = []struct {
+	class string
+	res   []*regexp.Regexp
+}{
+	{
+		class: ErrorClassTimeout,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`killed by task timeout`),
+		},
+	},
+	{
+		class: ErrorClassOOM,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\bMemoryError\b`),
+			regexp.MustCompile(`(?i)out of memory`),
+			regexp.MustCompile(`(?i)cannot allocate memory`),
+			regexp.MustCompile(`(?i)\bOOMKilled\b`),
+			regexp.MustCompile(`signal: killed`),
+			regexp.MustCompile(`exit status 137`),
+		},
+	},
+	{
+		class: ErrorClassESBulkRejection,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`es_rejected_execution_exception`),
+			regexp.MustCompile(`circuit_breaking_exception`),
+			regexp.MustCompile(`cluster_block_exception`),
+			regexp.MustCompile(`(?i)bulk.{0,64}(rejected|429)`),
+		},
+	},
+	{
+		class: ErrorClassRateLimit,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)rate[ _-]?limit(ed)?\b.{0,32}(exceeded|reached|hit)`),
+			regexp.MustCompile(`(?i)(exceeded|reached|hit) .{0,32}rate[ _-]?limit`),
+			regexp.MustCompile(`(?i)too many requests`),
+			regexp.MustCompile(`(?i)abuse detection`),
+			regexp.MustCompile(`(?i)(status|status code|statuscode|http error)[: =]+429\b`),
+		},
+	},
+	{
+		class: ErrorClassAuth,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)401 unauthori[sz]ed`),
+			regexp.MustCompile(`(?i)(status|status code|statuscode|http error)[: =]+40[13]\b`),
+			regexp.MustCompile(`(?i)403 forbidden`),
+			regexp.MustCompile(`(?i)unauthori[sz]ed`),
+			regexp.MustCompile(`(?i)bad credentials`),
+			regexp.MustCompile(`(?i)authentication (failed|required|error)`),
+			regexp.MustCompile(`(?i)invalid (api )?token`),
+			regexp.MustCompile(`(?i)permission denied \(publickey`),
+			regexp.MustCompile(`(?i)invalid_auth`),
+		},
+	},
+	{
+		class: ErrorClassUpstream5xx,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\b5\d\d (internal server error|bad gateway|service unavailable|gateway time-?out)`),
+			regexp.MustCompile(`(?i)(status|status code|statuscode|http error)[: =]+5\d\d\b`),
+			regexp.MustCompile(`(?i)\b5\d\d server error`),
+		},
+	},
+	{
+		class: ErrorClassBadConfig,
+		res: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)unrecognized arguments`),
+			regexp.MustCompile(`(?i)invalid choice`),
+			regexp.MustCompile(`(?i)unknown (flag|option|backend)`),
+			regexp.MustCompile(`(?i)missing required`),
+			regexp.MustCompile(`(?i)\b404\b.{0,32}not found`),
+		},
+	},
+}
+
+var (
+	rateLimitResetEpochRE = regexp.MustCompile(`(?i)x-ratelimit-reset["']?\s*[:=]\s*["']?(\d{10})`)
+	rateLimitRetryAfterRE = regexp.MustCompile(`(?i)retry-after["']?\s*[:=]\s*["']?(\d+)`)
+	rateLimitResetInRE    = regexp.MustCompile(`(?i)(?:reset|retry|wait)\w*\s+(?:in|after|for)?\s*(\d+)\s*(s|sec|secs|seconds|m|min|mins|minutes)\b`)
+)
+
+// ClassifyError - sorts subprocess output and error into one of error classes
+// Returns an empty string when there was no error
+func ClassifyError(output string, err error) string {
+	if err == nil {
+		return ""
+	}
+	str := err.Error() + "\n" + output
+	for _, classifier := range errorClassifiers {
+		for _, re := range classifier.res {
+			if re.MatchString(str) {
+				return classifier.class
+			}
+		}
+	}
+	return ErrorClassUnknown
+}
+
+// RateLimitReset - tries to find rate limit reset time in the subprocess output
+func RateLimitReset(output string, now time.Time) (time.Time, bool) {
+	m := rateLimitResetEpochRE.FindStringSubmatch(output)
+	if len(m) > 1 {
+		epoch, err := strconv.ParseInt(m[1], 10, 64)
+		if err == nil {
+			return time.Unix(epoch, 0), true
+		}
+	}
+	m = rateLimitRetryAfterRE.FindStringSubmatch(output)
+	if len(m) > 1 {
+		secs, err := strconv.Atoi(m[1])
+		if err == nil {
+			return now.Add(time.Duration(secs) * time.Second), true
+		}
+	}
+	m = rateLimitResetInRE.FindStringSubmatch(output)
+	if len(m) > 2 {
+		n, err := strconv.Atoi(m[1])
+		if err == nil {
+			unit := time.Second
+			if strings.HasPrefix(strings.ToLower(m[2]), "m") {
+				unit = time.Minute
+			}
+			return now.Add(time.Duration(n) * unit), true
+		}
+	}
+	return now, false
+}
+
+// RetryWait - returns whatever task failed with a given error class should be retried (retry is 1-based retry number)
+// and how long to wait before that retry
+func RetryWait(ctx *Ctx, class, output string, retry int, now time.Time) (time.Duration, bool) {
+	policy, ok := ErrorClassPolicies[class]
+	if !ok {
+		policy = ErrorClassPolicies[ErrorClassUnknown]
+	}
+	if !policy.Retry || retry > ctx.MaxRetry || (policy.MaxRetries > 0 && retry > policy.MaxRetries) {
+		return 0, false
+	}
+	exponential := func() time.Duration {
+		wait := float64(ctx.RetryBaseDelay) * math.Pow(2.0, float64(retry-1))
+		if wait > float64(ctx.RetryMaxDelay) {
+			return ctx.RetryMaxDelay
+		}
+		return time.Duration(wait)
+	}
+	switch policy.Backoff {
+	case BackoffExponential:
+		return exponential(), true
+	case BackoffReset:
+		reset, found := RateLimitReset(output, now)
+		if !found {
+			return exponential(), true
+		}
+		// Add a small safety margin after reported reset time
+		wait := reset.Sub(now) + time.Duration(5)*time.Second
+		if wait < 0 {
+			wait = 0
+		}
+		if wait > ctx.RateLimitMaxWait {
+			wait = ctx.RateLimitMaxWait
+		}
+		return wait, true
+	default:
+		return time.Duration(retry) * time.Second, true
+	}
+}
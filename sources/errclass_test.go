@@ -0,0 +1,86 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestClassifyError(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		output   string
+		err      error
+		expected string
+	}{
+		{output: "all fine", err: nil, expected: ""},
+		{output: "", err: fmt.Errorf("killed by task timeout 10h0m0s"), expected: lib.ErrorClassTimeout},
+		{output: "Traceback (most recent call last):\nMemoryError", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassOOM},
+		{output: "", err: fmt.Errorf("signal: killed"), expected: lib.ErrorClassOOM},
+		{output: `{"type":"es_rejected_execution_exception","reason":"rejected execution"}`, err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassESBulkRejection},
+		{output: "403 API rate limit exceeded for user ID 123", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassRateLimit},
+		{output: "requests.exceptions.HTTPError: 429 Client Error: Too Many Requests", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassRateLimit},
+		{output: "X-RateLimit-Remaining: 4000\nrequests.exceptions.HTTPError: 401 Client Error: Unauthorized", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassAuth},
+		{output: "DA_DS_ERROR(time=...): status code: 403", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassAuth},
+		{output: "Permission denied (publickey).", err: fmt.Errorf("exit status 128"), expected: lib.ErrorClassAuth},
+		{output: "requests.exceptions.HTTPError: 502 Server Error: Bad Gateway", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassUpstream5xx},
+		{output: "HTTP Error 503 Service Unavailable", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassUpstream5xx},
+		{output: "p2o.py: error: unrecognized arguments: --foo", err: fmt.Errorf("exit status 2"), expected: lib.ErrorClassBadConfig},
+		{output: "something weird happened", err: fmt.Errorf("exit status 1"), expected: lib.ErrorClassUnknown},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.ClassifyError(test.output, test.err)
+		if got != test.expected {
+			t.Errorf("test number %d, expected class '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	ctx.MaxRetry = 3
+	now := time.Unix(1600000000, 0)
+	// Test cases
+	var testCases = []struct {
+		class    string
+		output   string
+		retry    int
+		expected time.Duration
+		ok       bool
+	}{
+		{class: lib.ErrorClassAuth, retry: 1, ok: false},
+		{class: lib.ErrorClassBadConfig, retry: 1, ok: false},
+		{class: lib.ErrorClassTimeout, retry: 1, ok: false},
+		{class: lib.ErrorClassUnknown, retry: 1, expected: time.Second, ok: true},
+		{class: lib.ErrorClassUnknown, retry: 3, expected: 3 * time.Second, ok: true},
+		{class: lib.ErrorClassUnknown, retry: 4, ok: false},
+		{class: "not-known", retry: 2, expected: 2 * time.Second, ok: true},
+		{class: lib.ErrorClassUpstream5xx, retry: 1, expected: 10 * time.Second, ok: true},
+		{class: lib.ErrorClassUpstream5xx, retry: 3, expected: 40 * time.Second, ok: true},
+		{class: lib.ErrorClassOOM, retry: 1, expected: 10 * time.Second, ok: true},
+		{class: lib.ErrorClassOOM, retry: 2, ok: false},
+		{class: lib.ErrorClassRateLimit, output: "no reset info", retry: 2, expected: 20 * time.Second, ok: true},
+		{class: lib.ErrorClassRateLimit, output: "X-RateLimit-Reset: 1600000100", retry: 1, expected: 105 * time.Second, ok: true},
+		{class: lib.ErrorClassRateLimit, output: "Retry-After: 30", retry: 1, expected: 35 * time.Second, ok: true},
+		{class: lib.ErrorClassRateLimit, output: "rate limit exceeded, waiting for reset in 2 minutes", retry: 1, expected: 125 * time.Second, ok: true},
+		{class: lib.ErrorClassRateLimit, output: "X-RateLimit-Reset: 1600090000", retry: 1, expected: time.Hour, ok: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got, ok := lib.RetryWait(&ctx, test.class, test.output, test.retry, now)
+		if ok != test.ok || got != test.expected {
+			t.Errorf("test number %d, expected (%v, %v), got (%v, %v)", index+1, test.expected, test.ok, got, ok)
+		}
+	}
+	// Exponential backoff is capped
+	ctx.MaxRetry = 20
+	got, _ := lib.RetryWait(&ctx, lib.ErrorClassESBulkRejection, "", 20, now)
+	if got != ctx.RetryMaxDelay {
+		t.Errorf("expected exponential backoff to be capped at %v, got %v", ctx.RetryMaxDelay, got)
+	}
+}
@@ -12,8 +12,12 @@ func FatalOnError(err error) string {
 	if err != nil {
 		tm := time.Now()
 		msg := FilterRedacted(fmt.Sprintf("Error(time=%+v):\nError: '%s'\nStacktrace:\n%s\n", tm, err.Error(), string(debug.Stack())))
-		Printf("%s", msg)
+		_, _ = logf(nil, LogLevelFatal, true, "%s", msg)
 		fmt.Fprintf(os.Stderr, "%s", msg)
+		if logCtx != nil {
+			notifyFatal(logCtx, err, msg)
+		}
+		FlushLogs()
 		panic("stacktrace")
 	}
 	return OK
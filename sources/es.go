@@ -3,6 +3,7 @@ package syncdatasources
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -53,6 +54,7 @@ type EsSearchResultSource struct {
 	MDEnrichedOn         time.Time `json:"metadata__enriched_on"`
 	MDUpdatedOn          time.Time `json:"metadata__updated_on"`
 	GrimoireCreationDate time.Time `json:"grimoire_creation_date"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
 }
 
 // EsSearchResultHit - search result single hit
@@ -100,21 +102,31 @@ type EsLastRunPayload struct {
 
 // EsSyncInfoPayload - sync info support
 type EsSyncInfoPayload struct {
-	Index             string     `json:"index"`
-	Endpoint          string     `json:"endpoint"`
-	Dt                time.Time  `json:"dt"`
-	DataSyncAttemptDt *time.Time `json:"data_sync_attempt_dt"`
-	DataSyncSuccessDt *time.Time `json:"data_sync_success_dt"`
-	DataSyncErrorDt   *time.Time `json:"data_sync_error_dt"`
-	DataSyncError     *string    `json:"data_sync_error"`
-	DataSyncCL        *string    `json:"data_sync_command_line"`
-	DataSyncRCL       *string    `json:"data_sync_redacted_command_line"`
-	EnrichAttemptDt   *time.Time `json:"enrich_attempt_dt"`
-	EnrichSuccessDt   *time.Time `json:"enrich_success_dt"`
-	EnrichErrorDt     *time.Time `json:"enrich_error_dt"`
-	EnrichError       *string    `json:"enrich_error"`
-	EnrichCL          *string    `json:"enrich_command_line"`
-	EnrichRCL         *string    `json:"enrich_redacted_command_line"`
+	Index               string     `json:"index"`
+	Endpoint            string     `json:"endpoint"`
+	Dt                  time.Time  `json:"dt"`
+	DataSyncAttemptDt   *time.Time `json:"data_sync_attempt_dt"`
+	DataSyncSuccessDt   *time.Time `json:"data_sync_success_dt"`
+	DataSyncErrorDt     *time.Time `json:"data_sync_error_dt"`
+	DataSyncError       *string    `json:"data_sync_error"`
+	DataSyncErrClass    *string    `json:"data_sync_error_class"`
+	DataSyncCL          *string    `json:"data_sync_command_line"`
+	DataSyncRCL         *string    `json:"data_sync_redacted_command_line"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	QuarantinedUntil    *time.Time `json:"quarantined_until"`
+	EnrichAttemptDt     *time.Time `json:"enrich_attempt_dt"`
+	EnrichSuccessDt     *time.Time `json:"enrich_success_dt"`
+	EnrichErrorDt       *time.Time `json:"enrich_error_dt"`
+	EnrichError         *string    `json:"enrich_error"`
+	EnrichErrClass      *string    `json:"enrich_error_class"`
+	EnrichCL            *string    `json:"enrich_command_line"`
+	EnrichRCL           *string    `json:"enrich_redacted_command_line"`
+	VerifyDt            *time.Time `json:"verify_dt"`
+	VerifyUpstream      *int64     `json:"verify_upstream"`
+	VerifyIndexed       *int64     `json:"verify_indexed"`
+	VerifyDiffPct       *float64   `json:"verify_diff_pct"`
+	VerifyOK            *bool      `json:"verify_ok"`
+	VerifyError         *string    `json:"verify_error"`
 }
 
 // EsMtxPayload - ES mutex support (for locking concurrent nodes)
@@ -125,8 +137,16 @@ type EsMtxPayload struct {
 
 // EsLogPayload - ES log single document
 type EsLogPayload struct {
-	Msg string    `json:"msg"`
-	Dt  time.Time `json:"dt"`
+	Msg        string    `json:"msg"`
+	Dt         time.Time `json:"dt"`
+	Level      string    `json:"level,omitempty"`
+	NodeIdx    int       `json:"node_idx"`
+	RunID      string    `json:"run_id,omitempty"`
+	Phase      string    `json:"phase,omitempty"`
+	Fixture    string    `json:"fixture,omitempty"`
+	DataSource string    `json:"data_source,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"`
+	TaskIdx    *int      `json:"task_idx,omitempty"`
 }
 
 // EsIndexSettings - index settings
@@ -155,13 +175,130 @@ type EsBulkResult struct {
 	Items []EsBulkResultItem `json:"items"`
 }
 
+// SDSMappings - explicit mappings of SDS-owned indexes, used instead of dynamic mapping when creating them
+// Keyword fields support exact term queries, date fields support date sorting and range queries
+var SDSMappings = map[string]string{
+	SDSLog: `{"properties":{` +
+		`"msg":{"type":"text"},"dt":{"type":"date"},"level":{"type":"keyword"},"node_idx":{"type":"integer"},` +
+		`"run_id":{"type":"keyword"},"phase":{"type":"keyword"},"fixture":{"type":"keyword"},` +
+		`"data_source":{"type":"keyword"},"endpoint":{"type":"keyword"},"task_idx":{"type":"integer"}}}`,
+	SDSData: `{"properties":{` +
+		`"index":{"type":"keyword"},"endpoint":{"type":"keyword"},"type":{"type":"keyword"},"dt":{"type":"date"},` +
+		`"hash":{"type":"keyword"},"indices":{"type":"keyword"},"fields":{"type":"keyword"},` +
+		`"origin_field":{"type":"keyword"},"origins":{"type":"keyword"}}}`,
+	SDSMtx: `{"properties":{"mtx":{"type":"keyword"},"dt":{"type":"date"}}}`,
+	SDSSyncInfo: `{"properties":{` +
+		`"index":{"type":"keyword"},"endpoint":{"type":"keyword"},"dt":{"type":"date"},` +
+		`"data_sync_attempt_dt":{"type":"date"},"data_sync_success_dt":{"type":"date"},"data_sync_error_dt":{"type":"date"},` +
+		`"data_sync_error":{"type":"text"},"data_sync_error_class":{"type":"keyword"},` +
+		`"data_sync_command_line":{"type":"text"},"data_sync_redacted_command_line":{"type":"text"},` +
+		`"consecutive_failures":{"type":"integer"},"quarantined_until":{"type":"date"},` +
+		`"enrich_attempt_dt":{"type":"date"},"enrich_success_dt":{"type":"date"},"enrich_error_dt":{"type":"date"},` +
+		`"enrich_error":{"type":"text"},"enrich_error_class":{"type":"keyword"},` +
+		`"enrich_command_line":{"type":"text"},"enrich_redacted_command_line":{"type":"text"},` +
+		`"verify_dt":{"type":"date"},"verify_upstream":{"type":"long"},"verify_indexed":{"type":"long"},` +
+		`"verify_diff_pct":{"type":"float"},"verify_ok":{"type":"boolean"},"verify_error":{"type":"text"}}}`,
+	SDSRuns: `{"properties":{` +
+		`"dt":{"type":"date"},"when":{"type":"keyword"},"run_id":{"type":"keyword"},"host":{"type":"keyword"},` +
+		`"node_idx":{"type":"integer"},"node_num":{"type":"integer"},"dry_run":{"type":"boolean"},"started":{"type":"date"},` +
+		`"duration_seconds":{"type":"float"},"phase":{"type":"keyword"},` +
+		`"all":{"type":"integer"},"processed":{"type":"integer"},"failed":{"type":"integer"},` +
+		`"tasks":{"properties":{"idx":{"type":"integer"},"fixture":{"type":"keyword"},"fixture_file":{"type":"keyword"},` +
+		`"data_source":{"type":"keyword"},"full_data_source":{"type":"keyword"},"project":{"type":"keyword"},` +
+		`"endpoint":{"type":"keyword"},"command_line":{"type":"text"},"data":` + reportPhaseMapping + `,"affs":` + reportPhaseMapping + `}},` +
+		`"data_sources":` + reportSummaryMapping + `,"fixtures":` + reportSummaryMapping + `,` +
+		`"changes":{"properties":{"dt":{"type":"date"},"type":{"type":"keyword"},"action":{"type":"keyword"},` +
+		`"name":{"type":"keyword"},"target":{"type":"keyword"}}}}}`,
+}
+
+// esRequest - executes ES request (with optional JSON payload), returns response status code and body
+// printf is used to report errors, EnsureIndex must not use syncdatasources.Printf when called from logging
+func esRequest(ctx *Ctx, printf func(string, ...interface{}) (int, error), method, path, data string) (status int, body []byte, err error) {
+	var payloadBody io.Reader
+	if data != "" {
+		payloadBody = bytes.NewReader([]byte(data))
+	}
+	url := fmt.Sprintf("%s%s", ctx.ElasticURL, path)
+	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
+	if err != nil {
+		printf("New request error: %+v for %s url: %s\n", err, method, path)
+		return
+	}
+	if data != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		printf("Do request error: %+v for %s url: %s\n", err, method, path)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		printf("ReadAll request error: %+v for %s url: %s\n", err, method, path)
+		return
+	}
+	status = resp.StatusCode
+	return
+}
+
+// EsBulkIndex - indexes already marshalled documents with given IDs into index using ES bulk API
+// Returns error when bulk request fails or when any of the documents was rejected
+func EsBulkIndex(ctx *Ctx, index string, ids []string, docs [][]byte) (err error) {
+	if len(docs) == 0 {
+		return
+	}
+	var payload bytes.Buffer
+	for i, doc := range docs {
+		payload.WriteString(`{"index":{"_id":"` + ids[i] + `"}}` + "\n")
+		payload.Write(doc)
+		payload.WriteString("\n")
+	}
+	path := "/" + index + "/_bulk"
+	status, body, err := esRequest(ctx, Printf, Post, path, payload.String())
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+		return
+	}
+	esResult := EsBulkResult{}
+	err = jsoniter.Unmarshal(body, &esResult)
+	if err != nil {
+		return
+	}
+	rejected := 0
+	var firstError interface{}
+	for _, item := range esResult.Items {
+		if item.Index.Status >= 300 {
+			if rejected == 0 {
+				firstError = item.Index.Error
+			}
+			rejected++
+		}
+	}
+	if rejected > 0 {
+		err = fmt.Errorf("%d/%d documents rejected by %s url: %s, first error: %+v", rejected, len(docs), Post, path, firstError)
+	}
+	return
+}
+
 // EnsureIndex - ensure that given index exists in ES
+// SDS-owned indexes are created with explicit mappings (see SDSMappings), their index templates are installed on the first call only
+// When SDS_LOG_ROLLOVER is set, "sdslog" is created as a dated index behind "sdslog" write alias
 // init: when this flag is set, do not use syncdatasources.Printf which would cause infinite recurence
 func EnsureIndex(ctx *Ctx, index string, init bool) {
 	printf := Printf
 	if init {
 		printf = PrintfRedacted
 	}
+	// Templates make sure that explicit mappings are also used when indexes are created implicitly by writing to them
+	gTemplatesOnce.Do(func() {
+		PutIndexTemplates(ctx, printf)
+	})
 	method := Head
 	url := fmt.Sprintf("%s/%s", ctx.ElasticURL, index)
 	rurl := fmt.Sprintf("/%s", index)
@@ -189,12 +326,24 @@ func EnsureIndex(ctx *Ctx, index string, init bool) {
 			return
 		}
 		printf("Missing %s index, creating\n", index)
+		if index == SDSLog && ctx.LogRollover {
+			EnsureLogRollover(ctx, printf)
+			return
+		}
+		var payloadBody io.Reader
+		mapping, ok := SDSMappings[index]
+		if ok {
+			payloadBody = bytes.NewReader([]byte(`{"mappings":` + mapping + `}`))
+		}
 		method = Put
-		req, err := http.NewRequest(method, os.ExpandEnv(url), nil)
+		req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
 		if err != nil {
 			printf("New request error: %+v for %s url: %s\n", err, method, rurl)
 			return
 		}
+		if ok {
+			req.Header.Set("Content-Type", "application/json")
+		}
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			printf("Do request error: %+v for %s url: %s\n", err, method, rurl)
@@ -218,7 +367,11 @@ func EnsureIndex(ctx *Ctx, index string, init bool) {
 
 // EsLog - log data into ES "sdslog" index
 func EsLog(ctx *Ctx, msg string, dt time.Time) error {
-	data := EsLogPayload{Msg: msg, Dt: dt}
+	return EsLogEntry(ctx, EsLogPayload{Msg: msg, Dt: dt})
+}
+
+// EsLogEntry - log structured entry into ES "sdslog" index
+func EsLogEntry(ctx *Ctx, data EsLogPayload) error {
 	index := "sdslog"
 	payloadBytes, err := jsoniter.Marshal(data)
 	if err != nil {
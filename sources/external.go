@@ -0,0 +1,633 @@
+package syncdatasources
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ExternalDedupDelete - delete documents with origins shared with SDS index from external index
+const ExternalDedupDelete string = "delete"
+
+// ExternalDedupFlag - mark documents with origins shared with SDS index by setting duplicate flag field
+const ExternalDedupFlag string = "flag"
+
+// ExternalDedupAlias - exclude origins shared with SDS index via filters on all aliases pointing to external index, nothing is deleted
+const ExternalDedupAlias string = "alias"
+
+// ExternalDedupNone - only report overlap with SDS index, never modify external data
+const ExternalDedupNone string = "none"
+
+// ExternalEnrichAuto - enrich external index using the same command as SDS tasks of that data source (dads or p2o.py)
+const ExternalEnrichAuto string = "auto"
+
+// ExternalEnrichP2O - always enrich external index using p2o.py
+const ExternalEnrichP2O string = "p2o"
+
+// ExternalEnrichDADS - always enrich external index using dads
+const ExternalEnrichDADS string = "dads"
+
+// ExternalEnrichNone - never enrich external index (only dedup)
+const ExternalEnrichNone string = "none"
+
+// ExternalOriginField - default origin field of external index documents
+const ExternalOriginField string = "origin"
+
+// ExternalDuplicateField - default field set to true on duplicated documents by ExternalDedupFlag policy
+const ExternalDuplicateField string = "sds_duplicate"
+
+// ExternalDedupStateType - "sdsdata" document type storing origins excluded from external index aliases
+const ExternalDedupStateType string = "dedup"
+
+// externalOriginsBucket - maximum number of origins deleted by a single delete by query
+const externalOriginsBucket int = 500
+
+// ExternalPrefixes - fixture aliases 'from' with those prefixes are external indices (not prefixed with "sds-"), updated by LoadExternalConfig
+var ExternalPrefixes = []string{"bitergia-"}
+
+// ExternalSource - declaration of external (not synced by SDS) indices
+// Prefix - index name prefix (fixture alias 'from'), OriginField - field that holds origin in external documents
+// DataSource - data source type of all indices, empty means guess from index name
+// Enrich - enrichment command (auto, p2o, dads, none), Dedup - dedup policy (delete, flag, alias, none)
+// DuplicateField is used by flag policy
+type ExternalSource struct {
+	Name           string `yaml:"name"`
+	Prefix         string `yaml:"prefix"`
+	OriginField    string `yaml:"origin_field"`
+	DataSource     string `yaml:"data_source"`
+	Enrich         string `yaml:"enrich"`
+	Dedup          string `yaml:"dedup"`
+	DuplicateField string `yaml:"duplicate_field"`
+}
+
+// ExternalConfig - external indices configuration (from SDS_EXTERNAL_CONFIG YAML file)
+type ExternalConfig struct {
+	Sources []ExternalSource `yaml:"sources"`
+}
+
+// ExternalOverlap - origins of external index compared with origins of SDS index it is deduplicated against
+// Shared contains origins from both indices that overlap, Only - external origins not present in SDS index
+// Docs is the number of external documents with shared origins
+type ExternalOverlap struct {
+	Index    string
+	SDSIndex string
+	Field    string
+	Policy   string
+	External []string
+	SDS      []string
+	Shared   []string
+	Only     []string
+	Docs     int64
+}
+
+// DefaultExternalConfig - configuration used when SDS_EXTERNAL_CONFIG is not set (Bitergia indices)
+func DefaultExternalConfig() ExternalConfig {
+	return ExternalConfig{
+		Sources: []ExternalSource{
+			{
+				Name:           Bitergia,
+				Prefix:         "bitergia-",
+				OriginField:    ExternalOriginField,
+				Enrich:         ExternalEnrichAuto,
+				Dedup:          ExternalDedupDelete,
+				DuplicateField: ExternalDuplicateField,
+			},
+		},
+	}
+}
+
+// LoadExternalConfig - reads external indices configuration from SDS_EXTERNAL_CONFIG, not specified options get default values
+// It also sets ExternalPrefixes, so fixture aliases from configured external indices are recognized
+func LoadExternalConfig(ctx *Ctx) (cfg ExternalConfig, err error) {
+	cfg = DefaultExternalConfig()
+	if ctx.ExternalConfig != "" {
+		var data []byte
+		data, err = ioutil.ReadFile(ctx.ExternalConfig)
+		if err != nil {
+			return
+		}
+		var file ExternalConfig
+		err = yaml.Unmarshal(data, &file)
+		if err != nil {
+			err = fmt.Errorf("%s: %+v", ctx.ExternalConfig, err)
+			return
+		}
+		cfg.Sources = file.Sources
+	}
+	seen := make(map[string]struct{})
+	prefixes := []string{}
+	for i := range cfg.Sources {
+		src := &cfg.Sources[i]
+		if src.Prefix == "" {
+			err = fmt.Errorf("%s: external source #%d has no prefix", ctx.ExternalConfig, i+1)
+			return
+		}
+		if strings.HasPrefix(src.Prefix, "sds-") {
+			err = fmt.Errorf("%s: external source prefix '%s' cannot be an SDS index prefix", ctx.ExternalConfig, src.Prefix)
+			return
+		}
+		_, dup := seen[src.Prefix]
+		if dup {
+			err = fmt.Errorf("%s: external source prefix '%s' is configured more than once", ctx.ExternalConfig, src.Prefix)
+			return
+		}
+		seen[src.Prefix] = struct{}{}
+		prefixes = append(prefixes, src.Prefix)
+		if src.Name == "" {
+			src.Name = strings.TrimSuffix(src.Prefix, "-")
+		}
+		if src.OriginField == "" {
+			src.OriginField = ExternalOriginField
+		}
+		if src.Enrich == "" {
+			src.Enrich = ExternalEnrichAuto
+		}
+		if src.Dedup == "" {
+			src.Dedup = ExternalDedupDelete
+		}
+		if src.DuplicateField == "" {
+			src.DuplicateField = ExternalDuplicateField
+		}
+		switch src.Enrich {
+		case ExternalEnrichAuto, ExternalEnrichP2O, ExternalEnrichDADS, ExternalEnrichNone:
+		default:
+			err = fmt.Errorf("%s: external source '%s': unknown enrich command '%s'", ctx.ExternalConfig, src.Name, src.Enrich)
+			return
+		}
+		switch src.Dedup {
+		case ExternalDedupDelete, ExternalDedupFlag, ExternalDedupAlias, ExternalDedupNone:
+		default:
+			err = fmt.Errorf("%s: external source '%s': unknown dedup policy '%s'", ctx.ExternalConfig, src.Name, src.Dedup)
+			return
+		}
+	}
+	ExternalPrefixes = prefixes
+	return
+}
+
+// IsExternalIndex - true when index (or fixture alias 'from') belongs to one of external sources
+func IsExternalIndex(index string) bool {
+	for _, prefix := range ExternalPrefixes {
+		if strings.HasPrefix(index, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Source - returns external source of a given index (the longest matching prefix), nil when index is not external
+func (cfg *ExternalConfig) Source(index string) (src *ExternalSource) {
+	for i := range cfg.Sources {
+		if !strings.HasPrefix(index, cfg.Sources[i].Prefix) {
+			continue
+		}
+		if src == nil || len(cfg.Sources[i].Prefix) > len(src.Prefix) {
+			src = &cfg.Sources[i]
+		}
+	}
+	return
+}
+
+// DedupPolicy - effective dedup policy, with SDS_DEDUP_NON_DESTRUCTIVE delete policy is replaced by alias policy
+func (src *ExternalSource) DedupPolicy(ctx *Ctx) string {
+	if ctx.DedupNonDestructive && src.Dedup == ExternalDedupDelete {
+		return ExternalDedupAlias
+	}
+	return src.Dedup
+}
+
+// DataSourceFor - data source type of a given external index, configured or guessed from index name
+func (src *ExternalSource) DataSourceFor(index string) string {
+	if src.DataSource != "" {
+		return src.DataSource
+	}
+	return DataSourceFromIndexName(index)
+}
+
+// DataSourceFromIndexName - guesses data source type from index name, returns "" when it cannot be guessed
+func DataSourceFromIndexName(index string) (dataSource string) {
+	index = strings.ToLower(index)
+	known := []string{
+		Git,
+		GitHub,
+		Confluence,
+		Gerrit,
+		Jira,
+		Slack,
+		GroupsIO,
+		Pipermail,
+		Discourse,
+		Jenkins,
+		DockerHub,
+		Bugzilla,
+		BugzillaRest,
+		MeetUp,
+		RocketChat,
+	}
+	sort.SliceStable(known, func(i, j int) bool {
+		return len(known[i]) > len(known[j])
+	})
+	for _, ds := range known {
+		if strings.Contains(index, strings.ToLower(ds)) {
+			return ds
+		}
+	}
+	return
+}
+
+// normalizeOrigin - origin without trailing "/" and ".git", so "https://github.com/org/repo.git" and "https://github.com/org/repo/" are the same
+func normalizeOrigin(origin string) string {
+	origin = strings.TrimSuffix(origin, "/")
+	origin = strings.TrimSuffix(origin, ".git")
+	return strings.TrimSuffix(origin, "/")
+}
+
+// SharedOrigins - compares external and SDS origins, origins are shared when they are equal after normalization (see normalizeOrigin)
+// shared contains external origins (as stored in external index) with SDS counterpart, onlyExternal - external origins without it
+func SharedOrigins(external, sds []string) (shared, onlyExternal []string) {
+	sdsMap := make(map[string]struct{})
+	for _, s := range sds {
+		sdsMap[normalizeOrigin(s)] = struct{}{}
+	}
+	for _, e := range external {
+		_, ok := sdsMap[normalizeOrigin(e)]
+		if ok {
+			shared = append(shared, e)
+			continue
+		}
+		onlyExternal = append(onlyExternal, e)
+	}
+	sort.Strings(shared)
+	sort.Strings(onlyExternal)
+	return
+}
+
+// OriginsQuery - ES query matching documents with any of origins in a given field
+func OriginsQuery(field string, origins []string) string {
+	quoted := []string{}
+	for _, origin := range origins {
+		quoted = append(quoted, `"`+jsonEscape(origin)+`"`)
+	}
+	return `{"terms":{"` + jsonEscape(field) + `":[` + strings.Join(quoted, ",") + `]}}`
+}
+
+// ExternalAliasFilter - filter of alias exposing external index without shared origins, "" when nothing is shared
+func ExternalAliasFilter(field string, shared []string) string {
+	if len(shared) == 0 {
+		return ""
+	}
+	return `{"bool":{"must_not":[` + OriginsQuery(field, shared) + `]}}`
+}
+
+// IndexOrigins - returns all distinct values of origin field in a given index
+func IndexOrigins(ctx *Ctx, index, field string) (origins []string, err error) {
+	path := "/" + index + "/_search"
+	data := `{"size":0,"aggs":{"origins":{"terms":{"field":"` + jsonEscape(field) + `","size":2147483647}}}}`
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	var payload esOriginBuckets
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		return
+	}
+	for _, bucket := range payload.Aggregations.Origins.Buckets {
+		origins = append(origins, bucket.Key)
+	}
+	sort.Strings(origins)
+	return
+}
+
+// ExternalIndexOverlap - computes overlap of external index with SDS index, counts external documents that would be deduplicated
+func ExternalIndexOverlap(ctx *Ctx, src *ExternalSource, index, sdsIndex string) (overlap ExternalOverlap, err error) {
+	overlap = ExternalOverlap{Index: index, SDSIndex: sdsIndex, Field: src.OriginField, Policy: src.DedupPolicy(ctx)}
+	overlap.External, err = IndexOrigins(ctx, index, src.OriginField)
+	if err != nil {
+		return
+	}
+	overlap.SDS, err = IndexOrigins(ctx, sdsIndex, ExternalOriginField)
+	if err != nil {
+		return
+	}
+	overlap.Shared, overlap.Only = SharedOrigins(overlap.External, overlap.SDS)
+	if len(overlap.Shared) == 0 {
+		return
+	}
+	overlap.Docs, err = countDocs(ctx, index, OriginsQuery(src.OriginField, overlap.Shared))
+	return
+}
+
+// ExternalOverlapReport - human readable overlap report, printed before any external data is deduplicated
+func ExternalOverlapReport(overlaps []ExternalOverlap) string {
+	shared := 0
+	for _, overlap := range overlaps {
+		if len(overlap.Shared) > 0 {
+			shared++
+		}
+	}
+	s := fmt.Sprintf("External indices overlap: %d pairs checked, %d with shared origins\n", len(overlaps), shared)
+	for _, overlap := range overlaps {
+		if len(overlap.Shared) == 0 {
+			continue
+		}
+		s += fmt.Sprintf(
+			"  %s vs. %s (%s, policy %s): %d external origins, %d SDS origins, %d shared origins (%d documents), %d only external\n",
+			overlap.Index,
+			overlap.SDSIndex,
+			overlap.Field,
+			overlap.Policy,
+			len(overlap.External),
+			len(overlap.SDS),
+			len(overlap.Shared),
+			overlap.Docs,
+			len(overlap.Only),
+		)
+		if len(overlap.Only) == 0 {
+			s += fmt.Sprintf("  NOTICE: %s is fully duplicated in %s, so it basically can be removed from config fixtures\n", overlap.Index, overlap.SDSIndex)
+		}
+	}
+	return s
+}
+
+// deleteExternalOrigins - deletes documents with given origins from external index, retries up to SDS_MAX_DELETE_TRIALS times
+func deleteExternalOrigins(ctx *Ctx, index, field string, origins []string) (deleted int64, err error) {
+	query := OriginsQuery(field, origins)
+	for trials := 1; ; trials++ {
+		deleted, err = deleteByQuery(ctx, index, query)
+		if err == nil {
+			if trials > 1 {
+				Printf("Deleted %d documents from %s after %d/%d trials\n", deleted, index, trials, ctx.MaxDeleteTrials)
+			}
+			return
+		}
+		if trials >= ctx.MaxDeleteTrials {
+			err = fmt.Errorf("failed to delete %d origins from %s, tried %d times: %+v", len(origins), index, trials, err)
+			return
+		}
+		time.Sleep(time.Duration(10*trials) * time.Millisecond)
+	}
+}
+
+// flagExternalOrigins - sets duplicate flag on documents with shared origins and clears it on documents no longer shared
+func flagExternalOrigins(ctx *Ctx, src *ExternalSource, overlap *ExternalOverlap) (updated int64, err error) {
+	field := jsonEscape(src.DuplicateField)
+	script := func(value string) string {
+		return `{"script":{"source":"ctx._source['` + field + `']=` + value + `","lang":"painless"},"query":`
+	}
+	unset := `{"bool":{"must":[{"term":{"` + field + `":true}}]}}`
+	if len(overlap.Shared) > 0 {
+		shared := OriginsQuery(src.OriginField, overlap.Shared)
+		updated, err = UpdateByQueryTask(ctx, overlap.Index, script("true")+shared+`}`)
+		if err != nil {
+			return
+		}
+		unset = `{"bool":{"must":[{"term":{"` + field + `":true}}],"must_not":[` + shared + `]}}`
+	}
+	cleared, err := UpdateByQueryTask(ctx, overlap.Index, script("false")+unset+`}`)
+	updated += cleared
+	return
+}
+
+// DedupExternalIndex - applies overlap's dedup policy (alias policy is applied for all overlaps at once by SyncExternalDedupStates)
+// With SDS_DRY_RUN only reports what would be done (unless SDS_DRY_RUN_ALLOW_DEDUP is set), returns number of deleted or flagged documents
+func DedupExternalIndex(ctx *Ctx, src *ExternalSource, overlap *ExternalOverlap) (affected int64, err error) {
+	if overlap.Policy == ExternalDedupNone || overlap.Policy == ExternalDedupAlias {
+		return
+	}
+	if len(overlap.Shared) == 0 && overlap.Policy == ExternalDedupDelete {
+		return
+	}
+	if ctx.DryRun && !ctx.DryRunAllowDedup {
+		Printf("Would dedup %s external index %s via %s: %d shared origins (%d documents)\n", src.Name, overlap.Index, overlap.Policy, len(overlap.Shared), overlap.Docs)
+		return
+	}
+	switch overlap.Policy {
+	case ExternalDedupDelete:
+		nOrigins := len(overlap.Shared)
+		if ctx.DedupMaxDelete > 0 && nOrigins > ctx.DedupMaxDelete {
+			err = fmt.Errorf("%s: too many shared origins to delete: %d, maximum is %d (SDS_DEDUP_MAX_DELETE), not deleting anything", overlap.Index, nOrigins, ctx.DedupMaxDelete)
+			return
+		}
+		// We don't do this in multiple threads because deleting data from ES is a very heavy operation and doing that in multiple threads
+		// will not make it any faster. It will only result in more parallel timeouts.
+		for from := 0; from < nOrigins; from += externalOriginsBucket {
+			to := from + externalOriginsBucket
+			if to > nOrigins {
+				to = nOrigins
+			}
+			var deleted int64
+			deleted, err = deleteExternalOrigins(ctx, overlap.Index, src.OriginField, overlap.Shared[from:to])
+			affected += deleted
+			if err != nil {
+				err = fmt.Errorf("%s: origins bucket %d-%d failed, remaining origins not deleted: %+v", overlap.Index, from, to, err)
+				return
+			}
+		}
+	case ExternalDedupFlag:
+		affected, err = flagExternalOrigins(ctx, src, overlap)
+	}
+	return
+}
+
+// ExternalDedupState - origins excluded by alias filters from external index, stored in "sdsdata": index is external index name
+// Origins are shared with any of SDS indices external index is deduplicated against, Field is external index origin field
+type ExternalDedupState struct {
+	Index   string    `json:"index"`
+	Type    string    `json:"type"`
+	Dt      time.Time `json:"dt"`
+	Field   string    `json:"origin_field"`
+	Origins []string  `json:"origins"`
+}
+
+// externalDedupStateID - "sdsdata" document ID of external index dedup state
+func externalDedupStateID(index string) string {
+	hash := sha1.Sum([]byte(index))
+	return ExternalDedupStateType + "-" + hex.EncodeToString(hash[:])
+}
+
+// ExternalDedupStates - returns all external indices dedup states stored in "sdsdata" (none when SDS_SKIP_ES_DATA is set)
+func ExternalDedupStates(ctx *Ctx) (states []ExternalDedupState, err error) {
+	if ctx.SkipEsData {
+		return
+	}
+	path := "/" + SDSData + "/_search?size=10000"
+	data := fmt.Sprintf(`{"query":{"term":{"type":"%s"}}}`, ExternalDedupStateType)
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil || status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	var payload struct {
+		Hits struct {
+			Hits []struct {
+				Source ExternalDedupState `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+		return
+	}
+	for _, hit := range payload.Hits.Hits {
+		states = append(states, hit.Source)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Index < states[j].Index
+	})
+	return
+}
+
+// saveExternalDedupState - stores external index dedup state in "sdsdata"
+func saveExternalDedupState(ctx *Ctx, state *ExternalDedupState) (err error) {
+	data, err := jsoniter.Marshal(state)
+	if err != nil {
+		return
+	}
+	path := "/" + SDSData + "/_doc/" + externalDedupStateID(state.Index) + "?refresh=true"
+	status, body, err := esRequest(ctx, Printf, Put, path, string(data))
+	if err != nil {
+		return
+	}
+	if status != 200 && status != 201 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Put, path, status, data, body)
+	}
+	return
+}
+
+// deleteExternalDedupState - removes external index dedup state from "sdsdata"
+func deleteExternalDedupState(ctx *Ctx, index string) (err error) {
+	path := "/" + SDSData + "/_doc/" + externalDedupStateID(index) + "?refresh=true"
+	status, body, err := esRequest(ctx, Printf, Delete, path, "")
+	if err != nil {
+		return
+	}
+	if status != 200 && status != 404 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Delete, path, status, body)
+	}
+	return
+}
+
+// DesiredExternalDedupStates - merges shared origins of all alias policy overlaps of each external index
+// External index without shared origins gets a state without origins, so filter is removed from its aliases
+func DesiredExternalDedupStates(overlaps []ExternalOverlap) (states []ExternalDedupState) {
+	origins := make(map[string]map[string]struct{})
+	fields := make(map[string]string)
+	for _, overlap := range overlaps {
+		if overlap.Policy != ExternalDedupAlias {
+			continue
+		}
+		_, ok := origins[overlap.Index]
+		if !ok {
+			origins[overlap.Index] = make(map[string]struct{})
+		}
+		fields[overlap.Index] = overlap.Field
+		for _, origin := range overlap.Shared {
+			origins[overlap.Index][origin] = struct{}{}
+		}
+	}
+	for index, shared := range origins {
+		state := ExternalDedupState{Index: index, Type: ExternalDedupStateType, Field: fields[index], Origins: []string{}}
+		for origin := range shared {
+			state.Origins = append(state.Origins, origin)
+		}
+		sort.Strings(state.Origins)
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Index < states[j].Index
+	})
+	return
+}
+
+// SyncExternalDedupStates - stores desired alias policy states that differ from current ones
+// With all set (full, not partial run) states of external indices not in desired and not in configured are removed
+// Returns number of changed states, aliases must be reconciled after any change
+func SyncExternalDedupStates(ctx *Ctx, desired, current []ExternalDedupState, configured []string, all bool) (changed int, err error) {
+	got := make(map[string]ExternalDedupState)
+	for _, state := range current {
+		got[state.Index] = state
+	}
+	keep := make(map[string]struct{})
+	for _, index := range configured {
+		keep[index] = struct{}{}
+	}
+	dry := ctx.DryRun && !ctx.DryRunAllowDedup
+	for i, state := range desired {
+		keep[state.Index] = struct{}{}
+		prev, ok := got[state.Index]
+		if ok && prev.Field == state.Field && reflect.DeepEqual(prev.Origins, state.Origins) {
+			continue
+		}
+		changed++
+		if dry {
+			Printf("Would exclude %d shared origins from %s aliases\n", len(state.Origins), state.Index)
+			continue
+		}
+		desired[i].Dt = time.Now()
+		err = saveExternalDedupState(ctx, &desired[i])
+		if err != nil {
+			return
+		}
+		Printf("%s aliases exclude %d shared origins\n", state.Index, len(state.Origins))
+	}
+	if !all {
+		return
+	}
+	for _, state := range current {
+		_, ok := keep[state.Index]
+		if ok {
+			continue
+		}
+		changed++
+		if dry {
+			Printf("Would remove %s aliases dedup filter\n", state.Index)
+			continue
+		}
+		err = deleteExternalDedupState(ctx, state.Index)
+		if err != nil {
+			return
+		}
+		Printf("Removed %s aliases dedup filter\n", state.Index)
+	}
+	return
+}
+
+// FilterExternalAliases - adds dedup filters from states to desired aliases pointing to external indices
+// Views already having a filter get a combined one (view filter and shared origins exclusion)
+func FilterExternalAliases(desired []AliasState, states []ExternalDedupState) []AliasState {
+	excluded := make(map[string]ExternalDedupState)
+	for _, state := range states {
+		if len(state.Origins) > 0 {
+			excluded[state.Index] = state
+		}
+	}
+	for i, state := range desired {
+		dedup, ok := excluded[state.Index]
+		if !ok {
+			continue
+		}
+		if state.Filter == "" {
+			desired[i].Filter = ExternalAliasFilter(dedup.Field, dedup.Origins)
+			continue
+		}
+		desired[i].Filter = `{"bool":{"must":[` + state.Filter + `],"must_not":[` + OriginsQuery(dedup.Field, dedup.Origins) + `]}}`
+	}
+	return desired
+}
@@ -0,0 +1,424 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestLoadExternalConfig(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	dir, err := ioutil.TempDir("", "sds-external")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+		_, _ = lib.LoadExternalConfig(&lib.Ctx{})
+	}()
+	write := func(name, data string) string {
+		fn := filepath.Join(dir, name)
+		err := ioutil.WriteFile(fn, []byte(data), 0644)
+		if err != nil {
+			t.Fatalf("write file error: %+v", err)
+		}
+		return fn
+	}
+
+	// Defaults
+	cfg, err := lib.LoadExternalConfig(&lib.Ctx{})
+	if err != nil || !reflect.DeepEqual(cfg, lib.DefaultExternalConfig()) || !lib.IsExternalIndex("bitergia-git_x") || lib.IsExternalIndex("sds-x-git") {
+		t.Fatalf("unexpected default config %+v: %+v", cfg, err)
+	}
+
+	// Configured sources
+	ctx := lib.Ctx{
+		ExternalConfig: write(
+			"external.yaml",
+			`sources:
+- prefix: ext-
+  origin_field: repo_url
+  data_source: git
+  enrich: p2o
+  dedup: flag
+- prefix: ext-gh-
+  enrich: none
+  dedup: alias
+`,
+		),
+	}
+	cfg, err = lib.LoadExternalConfig(&ctx)
+	if err != nil || len(cfg.Sources) != 2 {
+		t.Fatalf("unexpected config %+v: %+v", cfg, err)
+	}
+	if lib.IsExternalIndex("bitergia-git_x") || !lib.IsExternalIndex("ext-gh-issues") {
+		t.Errorf("unexpected external prefixes %+v", lib.ExternalPrefixes)
+	}
+	src := cfg.Source("ext-gh-issues")
+	if src == nil || src.Name != "ext-gh" || src.OriginField != "origin" || src.DuplicateField != "sds_duplicate" || src.DataSourceFor("ext-gh-issues") != "" {
+		t.Errorf("unexpected source %+v", src)
+	}
+	src = cfg.Source("ext-jira")
+	if src == nil || src.OriginField != "repo_url" || src.DedupPolicy(&lib.Ctx{DedupNonDestructive: true}) != "flag" || src.DataSourceFor("ext-jira") != "git" {
+		t.Errorf("unexpected source %+v", src)
+	}
+	if cfg.Source("sds-x-git") != nil {
+		t.Errorf("SDS index should not have external source")
+	}
+
+	// Test cases
+	var testCases = []struct {
+		config string
+		err    bool
+	}{
+		{config: "", err: false},
+		{config: "sources:\n- dedup: flag\n", err: true},
+		{config: "sources:\n- prefix: sds-x-\n", err: true},
+		{config: "sources:\n- prefix: x-\n- prefix: x-\n", err: true},
+		{config: "sources:\n- prefix: x-\n  dedup: drop\n", err: true},
+		{config: "sources:\n- prefix: x-\n  enrich: perceval\n", err: true},
+		{config: "sources: [", err: true},
+		{config: "-", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx.ExternalConfig = filepath.Join(dir, "missing.yaml")
+		if test.config != "-" {
+			ctx.ExternalConfig = write("test.yaml", test.config)
+		}
+		_, err := lib.LoadExternalConfig(&ctx)
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %+v", index+1, test.err, err)
+		}
+	}
+}
+
+func TestDataSourceFromIndexName(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		index    string
+		expected string
+	}{
+		{index: "bitergia-git_onap_190625", expected: "git"},
+		{index: "bitergia-github_onap", expected: "github"},
+		{index: "bitergia-bugzillarest_opnfv", expected: "bugzillarest"},
+		{index: "bitergia-GroupsIO_x", expected: "groupsio"},
+		{index: "bitergia-mbox", expected: ""},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.DataSourceFromIndexName(test.index)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %s, got %s", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSharedOrigins(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		external []string
+		sds      []string
+		shared   []string
+		only     []string
+	}{
+		{external: []string{"a", "b"}, only: []string{"a", "b"}},
+		{sds: []string{"a"}},
+		{external: []string{"a", "b"}, sds: []string{"c"}, only: []string{"a", "b"}},
+		{
+			external: []string{"https://github.com/o/r.git", "https://github.com/o/x"},
+			sds:      []string{"https://github.com/o/r"},
+			shared:   []string{"https://github.com/o/r.git"},
+			only:     []string{"https://github.com/o/x"},
+		},
+		{
+			external: []string{"https://github.com/o/r/", "https://github.com/o/r-extra", "https://github.com/o"},
+			sds:      []string{"https://github.com/o/r.git"},
+			shared:   []string{"https://github.com/o/r/"},
+			only:     []string{"https://github.com/o", "https://github.com/o/r-extra"},
+		},
+		{external: []string{"b", "a"}, sds: []string{"a", "b"}, shared: []string{"a", "b"}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		shared, only := lib.SharedOrigins(test.external, test.sds)
+		if !reflect.DeepEqual(shared, test.shared) || !reflect.DeepEqual(only, test.only) {
+			t.Errorf("test number %d, expected %+v/%+v, got %+v/%+v", index+1, test.shared, test.only, shared, only)
+		}
+	}
+}
+
+func TestExternalAliasFilter(t *testing.T) {
+	if lib.ExternalAliasFilter("origin", nil) != "" {
+		t.Errorf("no filter expected without shared origins")
+	}
+	expected := `{"bool":{"must_not":[{"terms":{"repo":["a","b\""]}}]}}`
+	got := lib.ExternalAliasFilter("repo", []string{"a", `b"`})
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestExternalOverlapReport(t *testing.T) {
+	overlaps := []lib.ExternalOverlap{
+		{Index: "bitergia-git", SDSIndex: "sds-a-git", Field: "origin", Policy: "delete", External: []string{"a", "b"}, SDS: []string{"a"}, Shared: []string{"a"}, Only: []string{"b"}, Docs: 10},
+		{Index: "bitergia-jira", SDSIndex: "sds-a-jira", Field: "origin", Policy: "flag", External: []string{"c"}, SDS: []string{"d"}, Only: []string{"c"}},
+		{Index: "bitergia-gerrit", SDSIndex: "sds-a-gerrit", Field: "origin", Policy: "alias", External: []string{"e"}, SDS: []string{"e"}, Shared: []string{"e"}, Docs: 3},
+	}
+	expected := "External indices overlap: 3 pairs checked, 2 with shared origins\n" +
+		"  bitergia-git vs. sds-a-git (origin, policy delete): 2 external origins, 1 SDS origins, 1 shared origins (10 documents), 1 only external\n" +
+		"  bitergia-gerrit vs. sds-a-gerrit (origin, policy alias): 1 external origins, 1 SDS origins, 1 shared origins (3 documents), 0 only external\n" +
+		"  NOTICE: bitergia-gerrit is fully duplicated in sds-a-gerrit, so it basically can be removed from config fixtures\n"
+	got := lib.ExternalOverlapReport(overlaps)
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestDedupExternalIndex(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/_search"):
+			if strings.HasPrefix(req.URL.Path, "/sds-") {
+				fmt.Fprintf(w, `{"aggregations":{"origins":{"buckets":[{"key":"a","doc_count":2}]}}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"aggregations":{"origins":{"buckets":[{"key":"a.git","doc_count":3},{"key":"b","doc_count":1}]}}}`)
+		case strings.HasSuffix(req.URL.Path, "/_count"):
+			fmt.Fprintf(w, `{"count":3}`)
+		case strings.HasSuffix(req.URL.Path, "/_delete_by_query"):
+			requests = append(requests, req.URL.Path+" "+string(body))
+			if strings.Contains(string(body), `"fail"`) {
+				w.WriteHeader(500)
+				return
+			}
+			fmt.Fprintf(w, `{"deleted":3}`)
+		case strings.HasSuffix(req.URL.Path, "/_update_by_query"):
+			requests = append(requests, req.URL.Path+" "+string(body))
+			fmt.Fprintf(w, `{"task":"node:1"}`)
+		case strings.HasPrefix(req.URL.Path, "/_tasks/"):
+			fmt.Fprintf(w, `{"completed":true,"response":{"updated":3}}`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL, MaxDeleteTrials: 3, ProjectSlices: "auto"}
+	src := lib.DefaultExternalConfig().Sources[0]
+	overlap, err := lib.ExternalIndexOverlap(&ctx, &src, "bitergia-git", "sds-a-git")
+	expected := lib.ExternalOverlap{
+		Index:    "bitergia-git",
+		SDSIndex: "sds-a-git",
+		Field:    "origin",
+		Policy:   "delete",
+		External: []string{"a.git", "b"},
+		SDS:      []string{"a"},
+		Shared:   []string{"a.git"},
+		Only:     []string{"b"},
+		Docs:     3,
+	}
+	if err != nil || !reflect.DeepEqual(overlap, expected) {
+		t.Fatalf("expected %+v, got %+v: %+v", expected, overlap, err)
+	}
+	ctx.DedupNonDestructive = true
+	nonDestructive, err := lib.ExternalIndexOverlap(&ctx, &src, "bitergia-git", "sds-a-git")
+	if err != nil || nonDestructive.Policy != "alias" {
+		t.Errorf("expected alias policy in non-destructive mode, got %+v: %+v", nonDestructive, err)
+	}
+	ctx.DedupNonDestructive = false
+
+	// Test cases
+	var testCases = []struct {
+		policy   string
+		dryRun   bool
+		shared   []string
+		affected int64
+		requests []string
+	}{
+		{policy: "delete", shared: overlap.Shared, affected: 3, requests: []string{`/bitergia-git/_delete_by_query {"query":{"terms":{"origin":["a.git"]}}}`}},
+		{policy: "delete", dryRun: true, shared: overlap.Shared, requests: []string{}},
+		{policy: "delete", requests: []string{}},
+		{policy: "none", shared: overlap.Shared, requests: []string{}},
+		{
+			policy:   "flag",
+			shared:   overlap.Shared,
+			affected: 6,
+			requests: []string{
+				`/bitergia-git/_update_by_query {"script":{"source":"ctx._source['sds_duplicate']=true","lang":"painless"},"query":{"terms":{"origin":["a.git"]}}}`,
+				`/bitergia-git/_update_by_query {"script":{"source":"ctx._source['sds_duplicate']=false","lang":"painless"},"query":{"bool":{"must":[{"term":{"sds_duplicate":true}}],"must_not":[{"terms":{"origin":["a.git"]}}]}}}`,
+			},
+		},
+		{
+			policy:   "flag",
+			affected: 3,
+			requests: []string{
+				`/bitergia-git/_update_by_query {"script":{"source":"ctx._source['sds_duplicate']=false","lang":"painless"},"query":{"bool":{"must":[{"term":{"sds_duplicate":true}}]}}}`,
+			},
+		},
+		{policy: "alias", shared: overlap.Shared, requests: []string{}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		requests = []string{}
+		ctx.DryRun = test.dryRun
+		ov := overlap
+		ov.Policy = test.policy
+		ov.Shared = test.shared
+		affected, err := lib.DedupExternalIndex(&ctx, &src, &ov)
+		if err != nil || affected != test.affected || !reflect.DeepEqual(requests, test.requests) {
+			t.Errorf("test number %d, expected %d %+v, got %d %+v: %+v", index+1, test.affected, test.requests, affected, requests, err)
+		}
+	}
+
+	// Too many shared origins: nothing is deleted
+	requests = []string{}
+	ctx.DryRun = false
+	ctx.DedupMaxDelete = 1
+	ov := overlap
+	ov.Shared = []string{"a", "a.git"}
+	_, err = lib.DedupExternalIndex(&ctx, &src, &ov)
+	if err == nil || !strings.Contains(err.Error(), "too many shared origins") || len(requests) != 0 {
+		t.Errorf("expected refusal to delete %+v, got %+v: %+v", ov.Shared, requests, err)
+	}
+
+	// Failed bucket stops deleting remaining buckets
+	ctx.DedupMaxDelete = 0
+	ov.Shared = []string{"fail"}
+	for i := 0; i < 600; i++ {
+		ov.Shared = append(ov.Shared, fmt.Sprintf("o%d", i))
+	}
+	_, err = lib.DedupExternalIndex(&ctx, &src, &ov)
+	if err == nil || len(requests) != ctx.MaxDeleteTrials {
+		t.Errorf("expected only first bucket to be tried %d times, got %d requests: %+v", ctx.MaxDeleteTrials, len(requests), err)
+	}
+}
+
+func TestDesiredExternalDedupStates(t *testing.T) {
+	overlaps := []lib.ExternalOverlap{
+		{Index: "bitergia-git", SDSIndex: "sds-b-git", Field: "origin", Policy: "alias", Shared: []string{"c", "a"}},
+		{Index: "bitergia-git", SDSIndex: "sds-a-git", Field: "origin", Policy: "alias", Shared: []string{"a", "b"}},
+		{Index: "bitergia-jira", SDSIndex: "sds-a-jira", Field: "url", Policy: "alias"},
+		{Index: "bitergia-gerrit", SDSIndex: "sds-a-gerrit", Field: "origin", Policy: "delete", Shared: []string{"x"}},
+	}
+	expected := []lib.ExternalDedupState{
+		{Index: "bitergia-git", Type: "dedup", Field: "origin", Origins: []string{"a", "b", "c"}},
+		{Index: "bitergia-jira", Type: "dedup", Field: "url", Origins: []string{}},
+	}
+	got := lib.DesiredExternalDedupStates(overlaps)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestFilterExternalAliases(t *testing.T) {
+	states := []lib.ExternalDedupState{
+		{Index: "bitergia-git", Field: "origin", Origins: []string{"a"}},
+		{Index: "bitergia-jira", Field: "origin", Origins: []string{}},
+	}
+	desired := []lib.AliasState{
+		{Index: "bitergia-git", Alias: "sds-a-git"},
+		{Index: "bitergia-git", Alias: "sds-v", Filter: `{"term":{"project":"X"}}`},
+		{Index: "bitergia-jira", Alias: "sds-a-jira"},
+		{Index: "sds-a-git", Alias: "sds-a-git-all"},
+	}
+	expected := []lib.AliasState{
+		{Index: "bitergia-git", Alias: "sds-a-git", Filter: `{"bool":{"must_not":[{"terms":{"origin":["a"]}}]}}`},
+		{Index: "bitergia-git", Alias: "sds-v", Filter: `{"bool":{"must":[{"term":{"project":"X"}}],"must_not":[{"terms":{"origin":["a"]}}]}}`},
+		{Index: "bitergia-jira", Alias: "sds-a-jira"},
+		{Index: "sds-a-git", Alias: "sds-a-git-all"},
+	}
+	got := lib.FilterExternalAliases(desired, states)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestSyncExternalDedupStates(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+	current := []lib.ExternalDedupState{
+		{Index: "bitergia-git", Field: "origin", Origins: []string{"a"}},
+		{Index: "bitergia-jira", Field: "origin", Origins: []string{"b"}},
+		{Index: "bitergia-gerrit", Field: "origin", Origins: []string{"c"}},
+		{Index: "bitergia-slack", Field: "origin", Origins: []string{"d"}},
+	}
+	desired := func() []lib.ExternalDedupState {
+		return []lib.ExternalDedupState{
+			{Index: "bitergia-git", Field: "origin", Origins: []string{"a"}},
+			{Index: "bitergia-jira", Field: "origin", Origins: []string{}},
+		}
+	}
+
+	// Test cases
+	var testCases = []struct {
+		all      bool
+		dryRun   bool
+		changed  int
+		requests int
+	}{
+		{all: false, changed: 1, requests: 1},
+		{all: true, changed: 2, requests: 2},
+		{all: true, dryRun: true, changed: 2, requests: 0},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		requests = []string{}
+		ctx.DryRun = test.dryRun
+		changed, err := lib.SyncExternalDedupStates(&ctx, desired(), current, []string{"bitergia-gerrit"}, test.all)
+		if err != nil || changed != test.changed || len(requests) != test.requests {
+			t.Errorf("test number %d, expected %d changes and %d requests, got %d %+v: %+v", index+1, test.changed, test.requests, changed, requests, err)
+			continue
+		}
+		if test.requests > 0 && !strings.HasPrefix(requests[0], "PUT /sdsdata/_doc/dedup-") {
+			t.Errorf("test number %d, expected state saved, got %+v", index+1, requests)
+		}
+		if test.requests > 1 && !strings.HasPrefix(requests[1], "DELETE /sdsdata/_doc/dedup-") {
+			t.Errorf("test number %d, expected stale state deleted, got %+v", index+1, requests)
+		}
+	}
+}
+
+func TestReconcileExternalAliases(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	posted := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case req.URL.Path == "/_cat/indices":
+			fmt.Fprintf(w, `[{"index":"bitergia-git"}]`)
+		case req.URL.Path == "/_alias":
+			fmt.Fprintf(w, `{"bitergia-git":{"aliases":{"sds-a-git":{}}}}`)
+		case req.URL.Path == "/sdsdata/_search":
+			fmt.Fprintf(w, `{"hits":{"hits":[{"_source":{"index":"bitergia-git","type":"dedup","origin_field":"origin","origins":["a"]}}]}}`)
+		case req.URL.Path == "/_aliases":
+			posted = append(posted, string(body))
+			fmt.Fprintf(w, `{"acknowledged":true}`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	fixtures := []lib.Fixture{{Aliases: []lib.Alias{{From: "bitergia-git", To: []string{"sds-a-git"}}}}}
+	_, err := lib.ReconcileAliases(&lib.Ctx{ElasticURL: srv.URL}, fixtures, false)
+	expected := []string{`{"actions":[{"add":{"index":"bitergia-git","alias":"sds-a-git","filter":{"bool":{"must_not":[{"terms":{"origin":["a"]}}]}}}}]}`}
+	if err != nil || !reflect.DeepEqual(posted, expected) {
+		t.Errorf("expected %+v, got %+v: %+v", expected, posted, err)
+	}
+}
@@ -0,0 +1,328 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FFLinuxFoundation - foundation slug used for fixtures without foundation part in their slug (The Linux Foundation)
+const FFLinuxFoundation string = "lf"
+
+// FFPostprocessPrefix - DockerHub postprocessed index prefix (possibly others in the future)
+const FFPostprocessPrefix string = "postprocess-"
+
+// FFAliasPrefix - foundation-f aliases look like aliasprefix-foundation-f-datasource
+const FFAliasPrefix string = "sds-"
+
+// FFDataPrefix - foundation-f aliases point to dataprefix-foundation-project-datasource-index-suffix indices
+const FFDataPrefix string = "sds-"
+
+// FFAliasTemplate - default foundation-f alias name template
+const FFAliasTemplate string = "{{prefix}}{{foundation}}-f-{{data_source}}"
+
+// FFDataTemplate - default template of index (project's data source) that foundation-f alias points to
+const FFDataTemplate string = "{{prefix}}{{fixture}}-{{data_source}}"
+
+// FFMaxThreads - default number of foundation-f aliases processed in parallel
+const FFMaxThreads int = 12
+
+// FAliasesFoundation - explicitly configured foundation (or foundation group)
+// Members are fixture slug prefixes included in this foundation (for example "lfai" or "lfn/onap"), default is foundation name
+// DataSources optionally limits data sources (after remapping, with '/' replaced by '-') that get aliases
+type FAliasesFoundation struct {
+	Name        string   `yaml:"name"`
+	Members     []string `yaml:"members"`
+	DataSources []string `yaml:"data_sources"`
+}
+
+// FAliasesConfig - foundation-f aliases configuration (from SDS_FALIASES_CONFIG YAML file)
+// Templates can use {{prefix}}, {{foundation}} (alias template) or {{fixture}} (data template) and {{data_source}}
+// Remaps merge data sources into other ones, Postprocess lists data sources that also get postprocessed indices aliases
+// Nested creates aliases for every level of fixture slug, so "lfn/onap/oom" belongs to "lfn" and "lfn-onap" foundations
+type FAliasesConfig struct {
+	DefaultFoundation string               `yaml:"default_foundation"`
+	PostprocessPrefix string               `yaml:"postprocess_prefix"`
+	AliasPrefix       string               `yaml:"alias_prefix"`
+	DataPrefix        string               `yaml:"data_prefix"`
+	AliasTemplate     string               `yaml:"alias_template"`
+	DataTemplate      string               `yaml:"data_template"`
+	MaxThreads        int                  `yaml:"max_threads"`
+	Nested            bool                 `yaml:"nested"`
+	Remaps            map[string]string    `yaml:"remaps"`
+	Postprocess       []string             `yaml:"postprocess"`
+	Foundations       []FAliasesFoundation `yaml:"foundations"`
+}
+
+// DefaultFAliasesConfig - configuration used when SDS_FALIASES_CONFIG is not set
+func DefaultFAliasesConfig() FAliasesConfig {
+	return FAliasesConfig{
+		DefaultFoundation: FFLinuxFoundation,
+		PostprocessPrefix: FFPostprocessPrefix,
+		AliasPrefix:       FFAliasPrefix,
+		DataPrefix:        FFDataPrefix,
+		AliasTemplate:     FFAliasTemplate,
+		DataTemplate:      FFDataTemplate,
+		MaxThreads:        FFMaxThreads,
+		Remaps:            map[string]string{"github-pull_request": "github-issue"},
+		Postprocess:       []string{"dockerhub"},
+	}
+}
+
+// LoadFAliasesConfig - reads foundation-f aliases configuration from SDS_FALIASES_CONFIG, not specified options get default values
+func LoadFAliasesConfig(ctx *Ctx) (cfg FAliasesConfig, err error) {
+	cfg = DefaultFAliasesConfig()
+	if ctx.FAliasesConfig == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(ctx.FAliasesConfig)
+	if err != nil {
+		return
+	}
+	var file FAliasesConfig
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		err = fmt.Errorf("%s: %+v", ctx.FAliasesConfig, err)
+		return
+	}
+	if file.DefaultFoundation != "" {
+		cfg.DefaultFoundation = file.DefaultFoundation
+	}
+	if file.PostprocessPrefix != "" {
+		cfg.PostprocessPrefix = file.PostprocessPrefix
+	}
+	if file.AliasPrefix != "" {
+		cfg.AliasPrefix = file.AliasPrefix
+	}
+	if file.DataPrefix != "" {
+		cfg.DataPrefix = file.DataPrefix
+	}
+	if file.AliasTemplate != "" {
+		cfg.AliasTemplate = file.AliasTemplate
+	}
+	if file.DataTemplate != "" {
+		cfg.DataTemplate = file.DataTemplate
+	}
+	if file.MaxThreads > 0 {
+		cfg.MaxThreads = file.MaxThreads
+	}
+	if file.Remaps != nil {
+		cfg.Remaps = file.Remaps
+	}
+	if file.Postprocess != nil {
+		cfg.Postprocess = file.Postprocess
+	}
+	cfg.Nested = file.Nested
+	cfg.Foundations = file.Foundations
+	for i, foundation := range cfg.Foundations {
+		if foundation.Name == "" {
+			err = fmt.Errorf("%s: foundation #%d has no name", ctx.FAliasesConfig, i+1)
+			return
+		}
+		if len(foundation.Members) == 0 {
+			cfg.Foundations[i].Members = []string{foundation.Name}
+		}
+	}
+	if !strings.Contains(cfg.AliasTemplate, "{{foundation}}") || !strings.Contains(cfg.AliasTemplate, "{{data_source}}") {
+		err = fmt.Errorf("%s: alias template '%s' must contain {{foundation}} and {{data_source}}", ctx.FAliasesConfig, cfg.AliasTemplate)
+		return
+	}
+	if !strings.Contains(cfg.DataTemplate, "{{fixture}}") || !strings.Contains(cfg.DataTemplate, "{{data_source}}") {
+		err = fmt.Errorf("%s: data template '%s' must contain {{fixture}} and {{data_source}}", ctx.FAliasesConfig, cfg.DataTemplate)
+	}
+	return
+}
+
+// FAliasPattern - matches names generated from alias template (any foundation and data source), including postprocessed aliases
+// Such aliases are maintained by foundation-f aliases generation, so they are never dropped as unused fixtures aliases
+func (cfg *FAliasesConfig) FAliasPattern() *regexp.Regexp {
+	re := regexp.QuoteMeta(cfg.AliasTemplate)
+	re = strings.Replace(re, regexp.QuoteMeta("{{prefix}}"), regexp.QuoteMeta(cfg.AliasPrefix), -1)
+	re = strings.Replace(re, regexp.QuoteMeta("{{foundation}}"), ".+", -1)
+	re = strings.Replace(re, regexp.QuoteMeta("{{data_source}}"), ".+", -1)
+	return regexp.MustCompile("^(" + regexp.QuoteMeta(cfg.PostprocessPrefix) + ")?" + re + "$")
+}
+
+// fillTemplate - replaces {{name}} placeholders in foundation-f template
+func fillTemplate(tmpl string, args ...string) string {
+	for i := 0; i+1 < len(args); i += 2 {
+		tmpl = strings.Replace(tmpl, "{{"+args[i]+"}}", args[i+1], -1)
+	}
+	return tmpl
+}
+
+// fixtureFoundations - returns foundations fixture belongs to (top level first) and fixture part of its data indices names
+func (cfg *FAliasesConfig) fixtureFoundations(slug string) (foundations []string, fixture string) {
+	ary := strings.Split(slug, "/")
+	for i := range ary {
+		ary[i] = strings.TrimSpace(ary[i])
+	}
+	if len(ary) < 2 {
+		foundations = []string{cfg.DefaultFoundation}
+		fixture = ary[0]
+	} else {
+		foundations = []string{ary[0]}
+		if cfg.Nested {
+			for i := 2; i < len(ary); i++ {
+				foundations = append(foundations, strings.Join(ary[:i], "-"))
+			}
+		}
+		if ary[0] == cfg.DefaultFoundation {
+			fixture = strings.Join(ary[1:], "-")
+		} else {
+			fixture = strings.Join(ary, "-")
+		}
+	}
+	for _, foundation := range cfg.Foundations {
+		for _, member := range foundation.Members {
+			if slug == member || strings.HasPrefix(slug, member+"/") || (member == cfg.DefaultFoundation && len(ary) < 2) {
+				foundations = append(foundations, foundation.Name)
+				break
+			}
+		}
+	}
+	return
+}
+
+// FoundationFAliases - returns foundation-f aliases configuration: alias name -> sorted list of indices (or aliases) it should point to
+// Project's data source index is deduced from fixture's aliases when possible, data sources are remapped as configured
+// Expects fixtures after postprocessing (with aliases names normalized and data sources endpoints and full slugs set)
+func FoundationFAliases(ctx *Ctx, cfg *FAliasesConfig, fixtures []Fixture) (config map[string][]string) {
+	// m[fixture][ds] = full_ds or !alias
+	m := map[string]map[string]string{}
+	// fm[foundation] = fixtures
+	fm := map[string][]string{}
+	names := map[string]string{}
+	adsm := map[string]struct{}{}
+	for _, fixture := range fixtures {
+		foundations, name := cfg.fixtureFoundations(fixture.Slug)
+		names[fixture.Slug] = name
+		for _, f := range foundations {
+			fm[f] = append(fm[f], fixture.Slug)
+		}
+		_, ok := m[fixture.Slug]
+		if !ok {
+			m[fixture.Slug] = map[string]string{}
+		}
+		for _, ds := range fixture.DataSources {
+			s := strings.Replace(ds.Slug, "/", "-", -1)
+			fs := ds.FullSlug
+			remap, ok := cfg.Remaps[s]
+			if ok {
+				fs = strings.Replace(fs, s, remap, -1)
+				s = remap
+			}
+			if len(ds.Endpoints) > 0 {
+				m[fixture.Slug][s] = fs
+				adsm[s] = struct{}{}
+			}
+		}
+	}
+	ads := []string{}
+	for ds := range adsm {
+		ads = append(ads, ds)
+	}
+	sort.Slice(ads, func(i, j int) bool {
+		return len(ads[i]) > len(ads[j])
+	})
+	Printf("Foundation-f all data source types: %+v\n", ads)
+	for _, fixture := range fixtures {
+		foundations, _ := cfg.fixtureFoundations(fixture.Slug)
+		f := foundations[0]
+		for _, alias := range fixture.Aliases {
+			for _, to := range alias.To {
+				if to == "" || strings.HasSuffix(to, "-raw") {
+					continue
+				}
+				an := strings.Replace(to, "/", "-", -1)
+				found := false
+				for _, ds := range ads {
+					if strings.Contains(an, ds) && (f == cfg.DefaultFoundation || strings.Contains(an, f)) {
+						m[fixture.Slug][ds] = "!" + an
+						if ctx.Debug > 0 {
+							Printf("Foundation-f deduced %s,%s,%s -> %s from %s\n", f, fixture.Slug, ds, an, to)
+						}
+						found = true
+						break
+					}
+				}
+				if !found {
+					Printf("Foundation-f cannot deduce data source type from alias name %s in %s, skipping\n", to, fixture.Slug)
+				}
+			}
+		}
+	}
+	allowed := map[string]map[string]struct{}{}
+	for _, foundation := range cfg.Foundations {
+		if len(foundation.DataSources) == 0 {
+			continue
+		}
+		allowed[foundation.Name] = map[string]struct{}{}
+		for _, ds := range foundation.DataSources {
+			allowed[foundation.Name][strings.Replace(ds, "/", "-", -1)] = struct{}{}
+		}
+	}
+	postprocess := map[string]struct{}{}
+	for _, ds := range cfg.Postprocess {
+		postprocess[strings.Replace(ds, "/", "-", -1)] = struct{}{}
+	}
+	config = map[string][]string{}
+	for f, slugs := range fm {
+		dss := map[string]struct{}{}
+		for _, slug := range slugs {
+			for s := range m[slug] {
+				dss[s] = struct{}{}
+			}
+		}
+		if len(dss) == 0 {
+			Printf("foundation: %s has no data sources\n", f)
+			continue
+		}
+		for ds := range dss {
+			only, ok := allowed[f]
+			if ok {
+				_, ok = only[ds]
+				if !ok {
+					continue
+				}
+			}
+			aliases := []string{}
+			ppAliases := []string{}
+			for _, slug := range slugs {
+				fs, ok := m[slug][ds]
+				if !ok {
+					continue
+				}
+				var fpds string
+				if strings.HasPrefix(fs, "!") {
+					fs = fs[1:]
+					if strings.HasPrefix(fs, cfg.DataPrefix) {
+						fpds = fs
+					} else {
+						fpds = cfg.DataPrefix + fs
+					}
+				} else {
+					fpds = fillTemplate(cfg.DataTemplate, "prefix", cfg.DataPrefix, "fixture", names[slug], "data_source", fs)
+				}
+				aliases = append(aliases, fpds)
+				_, ok = postprocess[ds]
+				if ok {
+					ppAliases = append(ppAliases, cfg.PostprocessPrefix+fpds)
+				}
+			}
+			sort.Strings(aliases)
+			k := fillTemplate(cfg.AliasTemplate, "prefix", cfg.AliasPrefix, "foundation", f, "data_source", ds)
+			config[k] = aliases
+			if len(ppAliases) == 0 {
+				continue
+			}
+			sort.Strings(ppAliases)
+			config[cfg.PostprocessPrefix+k] = ppAliases
+		}
+	}
+	return
+}
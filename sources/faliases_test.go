@@ -0,0 +1,153 @@
+package syncdatasources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestFoundationFAliases(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	endpoints := []lib.Endpoint{{Name: "https://github.com/a/b"}}
+	fixtures := []lib.Fixture{
+		{
+			Slug: "cncf/devstats",
+			DataSources: []lib.DataSource{
+				{Slug: "git", FullSlug: "git", Endpoints: endpoints},
+				{Slug: "github/pull_request", FullSlug: "github-pull_request", Endpoints: endpoints},
+				{Slug: "jira", FullSlug: "jira"},
+			},
+		},
+		{
+			Slug: "cncf/k8s",
+			DataSources: []lib.DataSource{
+				{Slug: "git", FullSlug: "git-for-merge", Endpoints: endpoints},
+				{Slug: "dockerhub", FullSlug: "dockerhub", Endpoints: endpoints},
+			},
+			Aliases: []lib.Alias{{From: "sds-cncf-k8s-git-for-merge", To: []string{"sds-cncf-k8s-git"}}},
+		},
+		{
+			Slug:        "odpi",
+			DataSources: []lib.DataSource{{Slug: "git", FullSlug: "git", Endpoints: endpoints}},
+		},
+	}
+	cfg := lib.DefaultFAliasesConfig()
+	config := lib.FoundationFAliases(&lib.Ctx{}, &cfg, fixtures)
+	expected := map[string][]string{
+		"sds-cncf-f-git":                   {"sds-cncf-devstats-git", "sds-cncf-k8s-git"},
+		"sds-cncf-f-github-issue":          {"sds-cncf-devstats-github-issue"},
+		"sds-cncf-f-dockerhub":             {"sds-cncf-k8s-dockerhub"},
+		"postprocess-sds-cncf-f-dockerhub": {"postprocess-sds-cncf-k8s-dockerhub"},
+		"sds-lf-f-git":                     {"sds-odpi-git"},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected foundation-f aliases %+v, got %+v", expected, config)
+	}
+}
+
+func TestFoundationFAliasesConfig(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	dir, err := ioutil.TempDir("", "sds-faliases")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	write := func(name, data string) string {
+		fn := filepath.Join(dir, name)
+		err := ioutil.WriteFile(fn, []byte(data), 0644)
+		if err != nil {
+			t.Fatalf("write file error: %+v", err)
+		}
+		return fn
+	}
+	ctx := lib.Ctx{
+		FAliasesConfig: write(
+			"faliases.yaml",
+			`alias_prefix: all-
+alias_template: "{{prefix}}{{foundation}}-{{data_source}}"
+max_threads: 4
+nested: true
+remaps: {}
+postprocess: []
+foundations:
+- name: lf-ai-data
+  members: [lfai, lfdata]
+  data_sources: [git]
+`,
+		),
+	}
+	cfg, err := lib.LoadFAliasesConfig(&ctx)
+	if err != nil || cfg.MaxThreads != 4 || cfg.DataPrefix != "sds-" || cfg.PostprocessPrefix != "postprocess-" || len(cfg.Remaps) != 0 {
+		t.Fatalf("unexpected config %+v: %+v", cfg, err)
+	}
+	endpoints := []lib.Endpoint{{Name: "https://github.com/a/b"}}
+	git := lib.DataSource{Slug: "git", FullSlug: "git", Endpoints: endpoints}
+	fixtures := []lib.Fixture{
+		{Slug: "lfai/angel", DataSources: []lib.DataSource{git, {Slug: "github/pull_request", FullSlug: "github-pull_request", Endpoints: endpoints}}},
+		{Slug: "lfdata/egeria", DataSources: []lib.DataSource{git}},
+		{Slug: "lfn/onap/oom", DataSources: []lib.DataSource{git}},
+		{Slug: "odpi", DataSources: []lib.DataSource{git}},
+	}
+	config := lib.FoundationFAliases(&ctx, &cfg, fixtures)
+	expected := map[string][]string{
+		"all-lfai-git":                 {"sds-lfai-angel-git"},
+		"all-lfai-github-pull_request": {"sds-lfai-angel-github-pull_request"},
+		"all-lfdata-git":               {"sds-lfdata-egeria-git"},
+		"all-lf-ai-data-git":           {"sds-lfai-angel-git", "sds-lfdata-egeria-git"},
+		"all-lfn-git":                  {"sds-lfn-onap-oom-git"},
+		"all-lfn-onap-git":             {"sds-lfn-onap-oom-git"},
+		"all-lf-git":                   {"sds-odpi-git"},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected foundation-f aliases %+v, got %+v", expected, config)
+	}
+	def := lib.DefaultFAliasesConfig()
+	for index, test := range []struct {
+		cfg   *lib.FAliasesConfig
+		alias string
+		match bool
+	}{
+		{cfg: &cfg, alias: "all-lf-ai-data-git", match: true},
+		{cfg: &cfg, alias: "postprocess-all-lf-dockerhub", match: true},
+		{cfg: &cfg, alias: "sds-lf-f-git", match: false},
+		{cfg: &cfg, alias: "all-git", match: false},
+		{cfg: &def, alias: "sds-lf-f-git", match: true},
+		{cfg: &def, alias: "postprocess-sds-lfn-f-dockerhub", match: true},
+		{cfg: &def, alias: "sds-lfai-angel-git", match: false},
+		{cfg: &def, alias: "bitergia-lf-f-git", match: false},
+	} {
+		if test.cfg.FAliasPattern().MatchString(test.alias) != test.match {
+			t.Errorf("pattern test number %d, expected %s match %v", index+1, test.alias, test.match)
+		}
+	}
+
+	// Test cases
+	var testCases = []struct {
+		config string
+		err    bool
+	}{
+		{config: "", err: false},
+		{config: "foundations:\n- members: [lfai]\n", err: true},
+		{config: "alias_template: \"{{prefix}}-f-{{data_source}}\"\n", err: true},
+		{config: "data_template: \"{{prefix}}{{data_source}}\"\n", err: true},
+		{config: "nested: [", err: true},
+		{config: "-", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx.FAliasesConfig = filepath.Join(dir, "missing.yaml")
+		if test.config != "-" {
+			ctx.FAliasesConfig = write("test.yaml", test.config)
+		}
+		_, err := lib.LoadFAliasesConfig(&ctx)
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %+v", index+1, test.err, err)
+		}
+	}
+}
@@ -133,6 +133,8 @@ type Endpoint struct {
 	PairProgramming   bool
 	Dummy             bool // used to mark that there is endpoint, but nothing should be done for it
 	Groups            []GroupConfig
+	Owner             bool   // fixture wants to fetch this endpoint when it is shared with other fixtures
+	SharedFrom        string // owner's index when endpoint is shared and fetched by another fixture (see SDS_SHARED_ENDPOINTS)
 }
 
 // RawEndpoint holds data source endpoint with possible flags how to generate the final endpoints
@@ -151,10 +153,25 @@ type RawEndpoint struct {
 	AffiliationSource string            `yaml:"affiliation_source"`
 	PairProgramming   bool              `yaml:"pair_programming"`
 	Groups            []GroupConfig     `yaml:"groups"`
+	Owner             bool              `yaml:"owner"`
 	SkipREs           []*regexp.Regexp  `yaml:"-"`
 	OnlyREs           []*regexp.Regexp  `yaml:"-"`
 }
 
+// MapOrigin - maps endpoint name into the origin stored in data source indices
+func MapOrigin(origin, ds string) string {
+	switch ds {
+	case RocketChat:
+		return strings.Replace(strings.Replace(strings.TrimSpace(origin), "  ", " ", -1), " ", "/", -1)
+	case DockerHub:
+		return "https://hub.docker.com/" + strings.Replace(strings.Replace(strings.TrimSpace(origin), "  ", " ", -1), " ", "/", -1)
+	case GroupsIO:
+		return "https://groups.io/g/" + origin
+	default:
+		return origin
+	}
+}
+
 // EndpointIncluded - checks if given endpoint's origin should be included or excluded based on endpoint's skip/only regular expressions lists
 // First return value specifies if endpoint is included or not
 // Second value specifies: 1 - included by 'only' condition, 2 - skipped by 'skip' condition
@@ -258,7 +275,8 @@ type Fixture struct {
 	Slug        string
 }
 
-// Metadata - keeps special data settings, currently this is used by FINOS
+// Metadata - keeps special data settings (working groups metadata applied to data sources indices)
+// Applied incrementally, state of each working group is stored in "sdsdata" (see MetadataState)
 type Metadata struct {
 	DataSources   []MetaDataSource   `yaml:"datasources"`
 	WorkingGroups []MetaWorkingGroup `yaml:"workinggroups"`
@@ -269,6 +287,10 @@ type MetaDataSource struct {
 	Name      string   `yaml:"name"`      // can be git, github/pull_request etc
 	Slugs     []string `yaml:"slugs"`     // list of indices like 'finos/open-developer-platform/jira-for-merge', can start with 'pattern:', 'pattern:sds-finos-*-git-for-merge'
 	Externals []string `yaml:"externals"` // external indices, for example 'bitergia-git-dump'
+	// Field working group origins are matched against, default "origin" ("group_name" for mbox)
+	OriginField string `yaml:"origin_field"`
+	// Prefix added to working group origins before matching, for example 'finos.org/' (default for mbox without origin_field)
+	OriginPrefix string `yaml:"origin_prefix"`
 }
 
 // MetaWorkingGroup - information about working groups configured in a fixture (metadata section)
@@ -290,9 +312,15 @@ type WGDataSource struct {
 
 // AliasView - allows creating "filtered aliases"/"views"
 // API: POST /_aliases '{"actions":[{"add":{"index":"sds-lfn-onap-git-for-merge","alias":"test-lg","filter":{"term":{"project":"CLI"}}}}]}'
+// With ForEach set (projects, groups, workinggroups) view is generated for each value, name and filter can use {{value}} placeholder
+// Role creates ES security role (named as the view) with read access to view's documents only (view filter is document level security query
+// on indices the view points to), Fields limits fields visible via that role
 type AliasView struct {
-	Name   string      `yaml:"name"`
-	Filter interface{} `yaml:"filter"`
+	Name    string      `yaml:"name"`
+	Filter  interface{} `yaml:"filter"`
+	ForEach string      `yaml:"for_each"`
+	Role    bool        `yaml:"role"`
+	Fields  []string    `yaml:"fields"`
 }
 
 // Alias conatin indexing aliases data, single index from (source) and list of aliases that should point to that index
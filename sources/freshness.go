@@ -0,0 +1,425 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// FreshnessText - plain text freshness report format (only stale endpoints are listed)
+const FreshnessText string = "text"
+
+// FreshnessJSON - JSON freshness report format (only stale endpoints are listed)
+const FreshnessJSON string = "json"
+
+// FreshnessPrometheus - Prometheus textfile collector freshness report format (all endpoints are listed)
+const FreshnessPrometheus string = "prometheus"
+
+// MetricEndpointStale - 1 when endpoint's last success is older than its SLA, 0 otherwise
+const MetricEndpointStale string = "sds_endpoint_stale"
+
+// MetricEndpointStaleSeconds - how long endpoint is stale (time since last success minus SLA), 0 when endpoint is fresh
+const MetricEndpointStaleSeconds string = "sds_endpoint_stale_seconds"
+
+// MetricEndpointLastSuccess - unix timestamp of endpoint's last successful sync
+const MetricEndpointLastSuccess string = "sds_endpoint_last_success_timestamp_seconds"
+
+// MetricEndpointSLA - endpoint freshness SLA in seconds
+const MetricEndpointSLA string = "sds_endpoint_sla_seconds"
+
+// FreshnessSLA - freshness SLA for a data source (for example "git" or "github/issue")
+type FreshnessSLA struct {
+	DataSource string
+	SLA        time.Duration
+}
+
+// FreshnessEndpoint - endpoint expected to be synced by a fixture's data source with its freshness SLA
+// Dynamic is set for endpoints expanded at sync time (like all repositories of a GitHub organization), they cannot be listed
+// without calling external APIs, so all sync info records of their index are checked instead
+type FreshnessEndpoint struct {
+	Index      string
+	Endpoint   string
+	Fixture    string
+	DataSource string
+	SLA        time.Duration
+	Dynamic    bool
+}
+
+// FreshnessItem - freshness state of a single index/endpoint
+// StaleSeconds is time since last success minus SLA (0 when fresh), Never is set when endpoint never succeeded
+type FreshnessItem struct {
+	Index        string     `json:"index"`
+	Endpoint     string     `json:"endpoint"`
+	Fixture      string     `json:"fixture"`
+	DataSource   string     `json:"data_source"`
+	SLASeconds   float64    `json:"sla_seconds"`
+	LastSuccess  *time.Time `json:"last_success"`
+	Stale        bool       `json:"stale"`
+	Never        bool       `json:"never"`
+	StaleSeconds float64    `json:"stale_seconds"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// freshnessReport - JSON freshness report
+type freshnessReport struct {
+	Dt      time.Time       `json:"dt"`
+	Checked int             `json:"checked"`
+	Stale   int             `json:"stale"`
+	Items   []FreshnessItem `json:"items"`
+}
+
+// ParseFreshnessSLA - parses per data source freshness SLA (as specified in SDS_FRESHNESS_SLA)
+// Format is: 'data_source1=duration1;data_source2=duration2;...', for example: 'git=12h;github/issue=48h;jira=3d'
+func ParseFreshnessSLA(str string) (slas []FreshnessSLA, err error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return
+	}
+	seen := make(map[string]struct{})
+	for _, item := range strings.Split(str, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		ary := strings.Split(item, "=")
+		if len(ary) != 2 || strings.TrimSpace(ary[0]) == "" {
+			err = fmt.Errorf("freshness SLA '%s' must be in 'data_source=duration' format", item)
+			return
+		}
+		ds := strings.TrimSpace(ary[0])
+		_, dup := seen[ds]
+		if dup {
+			err = fmt.Errorf("freshness SLA for '%s' specified more than once", ds)
+			return
+		}
+		seen[ds] = struct{}{}
+		var sla time.Duration
+		sla, err = parseAge(strings.TrimSpace(ary[1]))
+		if err != nil {
+			return
+		}
+		if sla <= 0 {
+			err = fmt.Errorf("freshness SLA '%s' must be positive", item)
+			return
+		}
+		slas = append(slas, FreshnessSLA{DataSource: ds, SLA: sla})
+	}
+	return
+}
+
+// FreshnessEndpoints - returns endpoints expected to be synced by given fixtures with their SLA
+// SLA is taken from SDS_FRESHNESS_SLA, then from data source's max_frequency, then SDS_FRESHNESS_DEFAULT is used
+// Index names are the same as used by sync tasks, consumers of endpoints shared in alias mode are not synced, so they are skipped
+func FreshnessEndpoints(ctx *Ctx, fixtures []Fixture) (endpoints []FreshnessEndpoint, err error) {
+	slas := make(map[string]time.Duration)
+	for _, sla := range ctx.FreshnessSLA {
+		slas[sla.DataSource] = sla.SLA
+	}
+	// Shared endpoints are computed from endpoints known without expanding them
+	prepared := []Fixture{}
+	for _, fixture := range fixtures {
+		if fixture.Disabled {
+			continue
+		}
+		fixture.Slug = fixture.Native.Slug
+		dss := []DataSource{}
+		for _, ds := range fixture.DataSources {
+			ds.FullSlug = strings.Replace(ds.Slug+ds.IndexSuffix, "/", "-", -1)
+			ds.Endpoints = []Endpoint{}
+			for _, rawEndpoint := range ds.RawEndpoints {
+				if rawEndpoint.Flags["type"] != "" {
+					continue
+				}
+				ds.Endpoints = append(ds.Endpoints, freshnessEndpoint(&rawEndpoint, rawEndpoint.Project))
+			}
+			for _, project := range ds.Projects {
+				for _, rawEndpoint := range project.RawEndpoints {
+					if rawEndpoint.Flags["type"] != "" {
+						continue
+					}
+					proj := project.Name
+					if rawEndpoint.Project != "" {
+						proj = rawEndpoint.Project
+					}
+					ds.Endpoints = append(ds.Endpoints, freshnessEndpoint(&rawEndpoint, proj))
+				}
+			}
+			dss = append(dss, ds)
+		}
+		fixture.DataSources = dss
+		prepared = append(prepared, fixture)
+	}
+	AssignSharedEndpoints(ctx, prepared, FindSharedEndpoints(prepared))
+	seen := make(map[[2]string]struct{})
+	for fi, fixture := range prepared {
+		for di, ds := range fixture.DataSources {
+			sla, ok := slas[ds.Slug]
+			if !ok {
+				sla = ctx.FreshnessDefault
+				if ds.MaxFrequency != "" {
+					sla, err = time.ParseDuration(ds.MaxFrequency)
+					if err != nil {
+						err = fmt.Errorf("fixture %s data source %s: cannot parse max_frequency '%s': %+v", fixture.Slug, ds.Slug, ds.MaxFrequency, err)
+						return
+					}
+				}
+			}
+			// GitHub data sources are always synced by da-ds
+			index := TaskIndex(fixture.Slug, ds.FullSlug, strings.Split(ds.Slug, "/")[0] == GitHub)
+			add := func(endpoint string, dynamic bool) {
+				key := [2]string{index, endpoint}
+				_, ok := seen[key]
+				if ok {
+					return
+				}
+				seen[key] = struct{}{}
+				endpoints = append(
+					endpoints,
+					FreshnessEndpoint{Index: index, Endpoint: endpoint, Fixture: fixture.Slug, DataSource: ds.Slug, SLA: sla, Dynamic: dynamic},
+				)
+			}
+			for _, ep := range prepared[fi].DataSources[di].Endpoints {
+				if ep.SharedFrom != "" && ctx.SharedEndpoints == SharedEndpointsAlias {
+					continue
+				}
+				add(ep.Name, false)
+			}
+			dynamic := false
+			for _, rawEndpoint := range ds.RawEndpoints {
+				if rawEndpoint.Flags["type"] != "" {
+					dynamic = true
+				}
+			}
+			for _, project := range ds.Projects {
+				for _, rawEndpoint := range project.RawEndpoints {
+					if rawEndpoint.Flags["type"] != "" {
+						dynamic = true
+					}
+				}
+			}
+			if dynamic {
+				add("", true)
+			}
+		}
+	}
+	return
+}
+
+// freshnessEndpoint - endpoint as generated from a raw endpoint by fixture postprocessing (only fields used by shared endpoints)
+// Sync info records endpoints without project suffix added for p2o projects
+func freshnessEndpoint(rawEndpoint *RawEndpoint, project string) Endpoint {
+	ep := Endpoint{
+		Name:              rawEndpoint.Name,
+		Project:           project,
+		Projects:          rawEndpoint.Projects,
+		CopyFrom:          rawEndpoint.CopyFrom,
+		AffiliationSource: rawEndpoint.AffiliationSource,
+		Groups:            rawEndpoint.Groups,
+		Owner:             rawEndpoint.Owner,
+	}
+	if rawEndpoint.ProjectP2O != nil {
+		ep.ProjectP2O = *rawEndpoint.ProjectP2O
+	}
+	if rawEndpoint.ProjectNoOrigin != nil {
+		ep.ProjectNoOrigin = *rawEndpoint.ProjectNoOrigin
+	}
+	return ep
+}
+
+// GetSyncInfos - returns all sync info records from "sdssyncinfo" index (using scroll API)
+func GetSyncInfos(ctx *Ctx) (infos []EsSyncInfoPayload, err error) {
+	type syncInfoSearchResult struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			Hits []struct {
+				Source EsSyncInfoPayload `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	path := "/" + SDSSyncInfo + "/_search?scroll=5m&size=1000"
+	data := `{"query":{"match_all":{}}}`
+	scrollID := ""
+	defer func() {
+		if scrollID != "" {
+			_, _, _ = esRequest(ctx, Printf, Delete, "/_search/scroll", `{"scroll_id":"`+scrollID+`"}`)
+		}
+	}()
+	for {
+		status, body, e := esRequest(ctx, Printf, Post, path, data)
+		if e != nil {
+			err = e
+			return
+		}
+		// No sync info index yet means that nothing was synced
+		if status == 404 && scrollID == "" {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+			return
+		}
+		var result syncInfoSearchResult
+		err = jsoniter.Unmarshal(body, &result)
+		if err != nil {
+			return
+		}
+		scrollID = result.ScrollID
+		if len(result.Hits.Hits) == 0 {
+			break
+		}
+		for _, hit := range result.Hits.Hits {
+			infos = append(infos, hit.Source)
+		}
+		path = "/_search/scroll"
+		data = `{"scroll":"5m","scroll_id":"` + scrollID + `"}`
+	}
+	return
+}
+
+// CheckFreshness - returns freshness state of all expected endpoints (sync info records are joined to them)
+// Endpoints without sync info record were never synced, records of endpoints not expected anymore are ignored
+// Last success is data sync success (or enrichment success when data sync was never run)
+// Items are sorted by staleness descending, never synced endpoints first
+func CheckFreshness(endpoints []FreshnessEndpoint, infos []EsSyncInfoPayload, now time.Time) (items []FreshnessItem) {
+	items = []FreshnessItem{}
+	byKey := make(map[[2]string]*EsSyncInfoPayload)
+	byIndex := make(map[string][]*EsSyncInfoPayload)
+	for i := range infos {
+		info := &infos[i]
+		byKey[[2]string{info.Index, info.Endpoint}] = info
+		byIndex[info.Index] = append(byIndex[info.Index], info)
+	}
+	checked := make(map[[2]string]struct{})
+	for _, ep := range endpoints {
+		if ep.Dynamic {
+			continue
+		}
+		checked[[2]string{ep.Index, ep.Endpoint}] = struct{}{}
+		items = append(items, freshnessItem(&ep, ep.Endpoint, byKey[[2]string{ep.Index, ep.Endpoint}], now))
+	}
+	for _, ep := range endpoints {
+		if !ep.Dynamic {
+			continue
+		}
+		for _, info := range byIndex[ep.Index] {
+			key := [2]string{info.Index, info.Endpoint}
+			_, ok := checked[key]
+			if ok {
+				continue
+			}
+			checked[key] = struct{}{}
+			items = append(items, freshnessItem(&ep, info.Endpoint, info, now))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Never != b.Never {
+			return a.Never
+		}
+		if a.StaleSeconds != b.StaleSeconds {
+			return a.StaleSeconds > b.StaleSeconds
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return
+}
+
+// freshnessItem - freshness state of an expected endpoint, info is nil when endpoint has no sync info record
+func freshnessItem(ep *FreshnessEndpoint, endpoint string, info *EsSyncInfoPayload, now time.Time) (item FreshnessItem) {
+	item = FreshnessItem{
+		Index:      ep.Index,
+		Endpoint:   endpoint,
+		Fixture:    ep.Fixture,
+		DataSource: ep.DataSource,
+		SLASeconds: ep.SLA.Seconds(),
+	}
+	if info != nil {
+		item.LastSuccess = info.DataSyncSuccessDt
+		if item.LastSuccess == nil && info.DataSyncAttemptDt == nil {
+			item.LastSuccess = info.EnrichSuccessDt
+		}
+		if info.DataSyncError != nil {
+			item.LastError = *info.DataSyncError
+		} else if info.EnrichError != nil {
+			item.LastError = *info.EnrichError
+		}
+	}
+	if item.LastSuccess == nil {
+		item.Stale = true
+		item.Never = true
+		return
+	}
+	age := now.Sub(*item.LastSuccess)
+	if age > ep.SLA {
+		item.Stale = true
+		item.StaleSeconds = (age - ep.SLA).Seconds()
+	}
+	return
+}
+
+// FormatFreshness - formats freshness items using given format (text, json or prometheus)
+func FormatFreshness(items []FreshnessItem, format string, now time.Time) (out []byte, err error) {
+	stale := []FreshnessItem{}
+	for _, item := range items {
+		if item.Stale {
+			stale = append(stale, item)
+		}
+	}
+	switch format {
+	case FreshnessText:
+		var buf bytes.Buffer
+		for _, item := range stale {
+			sla := time.Duration(item.SLASeconds * float64(time.Second))
+			if item.Never {
+				fmt.Fprintf(&buf, "%s %s: never synced (SLA %v)", item.Index, item.Endpoint, sla)
+			} else {
+				staleFor := time.Duration(item.StaleSeconds * float64(time.Second)).Truncate(time.Second)
+				fmt.Fprintf(&buf, "%s %s: stale for %v, last success %s (SLA %v)", item.Index, item.Endpoint, staleFor, ToYMDHMSDate(*item.LastSuccess), sla)
+			}
+			if item.LastError != "" {
+				fmt.Fprintf(&buf, ", last error: %s", strings.Split(item.LastError, "\n")[0])
+			}
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "%d/%d endpoints stale\n", len(stale), len(items))
+		out = buf.Bytes()
+	case FreshnessJSON:
+		out, err = jsoniter.MarshalIndent(freshnessReport{Dt: now, Checked: len(items), Stale: len(stale), Items: stale}, "", "  ")
+		if err == nil {
+			out = append(out, '\n')
+		}
+	case FreshnessPrometheus:
+		m := newMetrics()
+		labels := []string{"index", "endpoint", "fixture", "ds"}
+		m.define(MetricEndpointStale, "1 when endpoint's last success is older than its SLA.", "gauge", nil, labels...)
+		m.define(MetricEndpointStaleSeconds, "How long endpoint is stale in seconds (time since last success minus SLA).", "gauge", nil, labels...)
+		m.define(MetricEndpointLastSuccess, "Unix timestamp of endpoint's last successful sync.", "gauge", nil, labels...)
+		m.define(MetricEndpointSLA, "Endpoint freshness SLA in seconds.", "gauge", nil, labels...)
+		for _, item := range items {
+			values := []string{item.Index, item.Endpoint, item.Fixture, item.DataSource}
+			isStale := 0.0
+			if item.Stale {
+				isStale = 1.0
+			}
+			m.Set(MetricEndpointStale, isStale, values...)
+			m.Set(MetricEndpointSLA, item.SLASeconds, values...)
+			if !item.Never {
+				m.Set(MetricEndpointStaleSeconds, item.StaleSeconds, values...)
+				m.Set(MetricEndpointLastSuccess, float64(item.LastSuccess.Unix()), values...)
+			}
+		}
+		var buf bytes.Buffer
+		m.Write(&buf)
+		out = buf.Bytes()
+	default:
+		err = fmt.Errorf("unknown freshness report format '%s', allowed: %s, %s, %s", format, FreshnessText, FreshnessJSON, FreshnessPrometheus)
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestParseFreshnessSLA(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		str      string
+		expected string
+		err      bool
+	}{
+		{str: "", expected: "[]"},
+		{str: "git=12h", expected: "[{DataSource:git SLA:12h0m0s}]"},
+		{str: " github/issue=3d ; jira=90m;", expected: "[{DataSource:github/issue SLA:72h0m0s} {DataSource:jira SLA:1h30m0s}]"},
+		{str: "git", err: true},
+		{str: "=12h", err: true},
+		{str: "git=x", err: true},
+		{str: "git=0", err: true},
+		{str: "git=12h;git=1d", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		slas, err := lib.ParseFreshnessSLA(test.str)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error for '%s', got %+v", index+1, test.str, slas)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error for '%s': %+v", index+1, test.str, err)
+			continue
+		}
+		got := fmt.Sprintf("%+v", slas)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestCheckFreshness(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		dt := now.Add(-d)
+		return &dt
+	}
+	errStr := "p2o.py error\ndetails"
+	ctx := lib.Ctx{
+		FreshnessSLA:     []lib.FreshnessSLA{{DataSource: "jira", SLA: time.Duration(2) * time.Hour}},
+		FreshnessDefault: time.Duration(24) * time.Hour,
+	}
+	raw := func(names ...string) (eps []lib.RawEndpoint) {
+		for _, name := range names {
+			eps = append(eps, lib.RawEndpoint{Name: name})
+		}
+		return
+	}
+	fixtures := []lib.Fixture{
+		{
+			Native: lib.Native{Slug: "lfn/onap"},
+			DataSources: []lib.DataSource{
+				{Slug: "git", RawEndpoints: raw("https://git/fresh", "https://git/stale", "https://git/missing")},
+				{Slug: "jira", MaxFrequency: "48h", RawEndpoints: raw("https://jira")},
+				{Slug: "github/issue", MaxFrequency: "6h", IndexSuffix: "-raw", RawEndpoints: raw("https://github/never", "https://github/affs")},
+				{Slug: "github/pull_request", Projects: []lib.Project{{Name: "ONAP", RawEndpoints: raw("https://github/pr")}}},
+				{Slug: "github/repository", RawEndpoints: []lib.RawEndpoint{{Name: "onap", Flags: map[string]string{"type": "github_org"}}}},
+			},
+		},
+		{Native: lib.Native{Slug: "cncf/k8s"}, Disabled: true, DataSources: []lib.DataSource{{Slug: "git", RawEndpoints: raw("https://git/disabled")}}},
+	}
+	endpoints, err := lib.FreshnessEndpoints(&ctx, fixtures)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(endpoints) != 8 || endpoints[3].SLA != time.Duration(2)*time.Hour || endpoints[4].SLA != time.Duration(6)*time.Hour {
+		t.Errorf("unexpected freshness endpoints: %+v", endpoints)
+	}
+	infos := []lib.EsSyncInfoPayload{
+		{Index: "sds-lfn-onap-git", Endpoint: "https://git/fresh", DataSyncAttemptDt: ago(time.Hour), DataSyncSuccessDt: ago(time.Hour)},
+		{Index: "sds-lfn-onap-git", Endpoint: "https://git/stale", DataSyncAttemptDt: ago(time.Hour), DataSyncSuccessDt: ago(time.Duration(30) * time.Hour), DataSyncError: &errStr},
+		{Index: "sds-lfn-onap-git", Endpoint: "https://git/removed", DataSyncSuccessDt: ago(time.Duration(300) * time.Hour)},
+		{Index: "sds-lfn-onap-jira", Endpoint: "https://jira", DataSyncAttemptDt: ago(time.Hour), DataSyncSuccessDt: ago(time.Duration(3) * time.Hour)},
+		{Index: "sds-lfn-onap-github-issue-raw", Endpoint: "https://github/never", DataSyncAttemptDt: ago(time.Hour)},
+		{Index: "sds-lfn-onap-github-issue-raw", Endpoint: "https://github/affs", EnrichSuccessDt: ago(time.Hour)},
+		{Index: "sds-lfn-onap-github-issue", Endpoint: "https://github/pr", DataSyncAttemptDt: ago(time.Hour), DataSyncSuccessDt: ago(time.Hour)},
+		{Index: "sds-lfn-onap-github-repository", Endpoint: "https://github/onap/repo", DataSyncAttemptDt: ago(time.Hour), DataSyncSuccessDt: ago(time.Duration(26) * time.Hour)},
+		{Index: "sds-cncf-k8s-git", Endpoint: "https://git/disabled"},
+	}
+	items := lib.CheckFreshness(endpoints, infos, now)
+
+	// Test cases
+	var testCases = []struct {
+		endpoint string
+		stale    bool
+		never    bool
+		seconds  float64
+	}{
+		{endpoint: "https://git/missing", stale: true, never: true},
+		{endpoint: "https://github/never", stale: true, never: true},
+		{endpoint: "https://git/stale", stale: true, seconds: 6 * 3600},
+		{endpoint: "https://github/onap/repo", stale: true, seconds: 2 * 3600},
+		{endpoint: "https://jira", stale: true, seconds: 3600},
+		{endpoint: "https://git/fresh"},
+		{endpoint: "https://github/pr"},
+		{endpoint: "https://github/affs"},
+	}
+	if len(items) != len(testCases) {
+		t.Fatalf("expected %d items, got %+v", len(testCases), items)
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		item := items[index]
+		if item.Endpoint != test.endpoint || item.Stale != test.stale || item.Never != test.never || item.StaleSeconds != test.seconds {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test, item)
+		}
+	}
+
+	// Consumer of an endpoint shared in alias mode is not synced, owner's record is checked
+	shared := []lib.Fixture{
+		{Native: lib.Native{Slug: "a", AffiliationSource: "lf"}, DataSources: []lib.DataSource{{Slug: "git", RawEndpoints: raw("https://git/shared")}}},
+		{Native: lib.Native{Slug: "b", AffiliationSource: "lf"}, DataSources: []lib.DataSource{{Slug: "git", RawEndpoints: raw("https://git/shared")}}},
+	}
+	ctx.SharedEndpoints = lib.SharedEndpointsAlias
+	sharedEndpoints, err := lib.FreshnessEndpoints(&ctx, shared)
+	ctx.SharedEndpoints = ""
+	if err != nil || len(sharedEndpoints) != 1 || sharedEndpoints[0].Index != "sds-a-git" {
+		t.Errorf("expected only owner's shared endpoint, got %+v (%+v)", sharedEndpoints, err)
+	}
+
+	// Output formats
+	text, err := lib.FormatFreshness(items, lib.FreshnessText, now)
+	if err != nil || !strings.Contains(string(text), "sds-lfn-onap-git https://git/stale: stale for 6h0m0s") || !strings.Contains(string(text), "last error: p2o.py error\n") || !strings.HasSuffix(string(text), "5/8 endpoints stale\n") {
+		t.Errorf("unexpected text output (%+v):\n%s", err, text)
+	}
+	json, err := lib.FormatFreshness(items, lib.FreshnessJSON, now)
+	if err != nil || !strings.Contains(string(json), `"stale": 5`) || strings.Contains(string(json), "https://git/fresh") {
+		t.Errorf("unexpected JSON output (%+v):\n%s", err, json)
+	}
+	prom, err := lib.FormatFreshness(items, lib.FreshnessPrometheus, now)
+	expected := []string{
+		`sds_endpoint_stale{index="sds-lfn-onap-git",endpoint="https://git/fresh",fixture="lfn/onap",ds="git"} 0`,
+		`sds_endpoint_stale{index="sds-lfn-onap-github-issue-raw",endpoint="https://github/never",fixture="lfn/onap",ds="github/issue"} 1`,
+		`sds_endpoint_stale_seconds{index="sds-lfn-onap-git",endpoint="https://git/stale",fixture="lfn/onap",ds="git"} 21600`,
+		`sds_endpoint_sla_seconds{index="sds-lfn-onap-jira",endpoint="https://jira",fixture="lfn/onap",ds="jira"} 7200`,
+	}
+	for _, line := range expected {
+		if err != nil || !strings.Contains(string(prom), line+"\n") {
+			t.Errorf("Prometheus output (%+v) misses '%s':\n%s", err, line, prom)
+		}
+	}
+	if strings.Contains(string(prom), `sds_endpoint_last_success_timestamp_seconds{index="sds-lfn-onap-github-issue-raw",endpoint="https://github/never"`) {
+		t.Errorf("Prometheus output should not have last success for never synced endpoint:\n%s", prom)
+	}
+	_, err = lib.FormatFreshness(items, "csv", now)
+	if err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
@@ -0,0 +1,749 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LF-Engineering/dev-analytics-libraries/affiliation"
+	"github.com/LF-Engineering/dev-analytics-libraries/uuid"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// GitBackendVersion - version reported in raw documents produced by the built-in git collector
+const GitBackendVersion string = "sds-git-0.1.0"
+
+// gitDateFormat - git default date format (as used by perceval's git backend)
+const gitDateFormat string = "Mon Jan 2 15:04:05 2006 -0700"
+
+// gitFetchRefSpec - all branches of a remote repository are fetched into local branches of a bare clone
+const gitFetchRefSpec config.RefSpec = "+refs/heads/*:refs/heads/*"
+
+// gitIdentitySource - SortingHat source of git identities
+const gitIdentitySource string = "git"
+
+// gitUnknownOrg - organization name used when identity has no enrollment for a given date (the same as p2o.py)
+const gitUnknownOrg string = "Unknown"
+
+// GitCollectConfig - built-in git collector configuration (sds-git command gets it from SDS_GIT_* environment variables)
+// NoRaw - do not fetch and do not write raw index, only regenerate rich documents (used by affiliations refresh)
+// ForceFull - process all commits instead of commits newer than the last one in raw index
+// Mirror - already updated bare mirror to use instead of own clone (see GitMirror)
+// Affiliations - SortingHat profiles source, when nil identities are not merged and have no enrollments
+// identities - resolved identities cache, keyed by git 'Name <email>' string
+type GitCollectConfig struct {
+	URL          string
+	Mirror       string
+	RawIndex     string
+	RichIndex    string
+	Project      string
+	ProjectSlug  string
+	NoRaw        bool
+	ForceFull    bool
+	BulkSize     int
+	Affiliations GitAffiliations
+	identities   map[string]*GitIdentity
+}
+
+// GitAffiliations - SortingHat identities and profiles source (implemented by DA affiliations API client, see NewAffiliationsClient)
+type GitAffiliations interface {
+	GetIdentity(uuid string) *affiliation.Identity
+	AddIdentity(identity *affiliation.Identity) bool
+	GetProfile(uuid, projectSlug string) *affiliation.ProfileResponse
+}
+
+// GitIdentity - SortingHat identity of a commit author or committer
+// Rich documents get its fields with role prefixes, organizations are taken from enrollments valid at the commit date (as p2o.py does)
+type GitIdentity struct {
+	ID          string
+	UUID        string
+	Name        string
+	Domain      string
+	Gender      *string
+	GenderAcc   *int64
+	Bot         bool
+	Enrollments []affiliation.Enrollment
+}
+
+// GitFile - file changed in a commit
+type GitFile struct {
+	File    string   `json:"file"`
+	Added   string   `json:"added,omitempty"`
+	Removed string   `json:"removed,omitempty"`
+	Action  string   `json:"action,omitempty"`
+	Modes   []string `json:"modes,omitempty"`
+	Indexes []string `json:"indexes,omitempty"`
+}
+
+// GitCommit - single commit data (the same shape as perceval's git backend "data")
+type GitCommit struct {
+	Commit     string    `json:"commit"`
+	Parents    []string  `json:"parents"`
+	Refs       []string  `json:"refs"`
+	Author     string    `json:"Author"`
+	AuthorDate string    `json:"AuthorDate"`
+	Committer  string    `json:"Commit"`
+	CommitDate string    `json:"CommitDate"`
+	Message    string    `json:"message"`
+	Files      []GitFile `json:"files"`
+}
+
+// GitRawItem - raw index document (compatible with p2o.py/dads git raw indexes)
+type GitRawItem struct {
+	BackendName       string          `json:"backend_name"`
+	BackendVersion    string          `json:"backend_version"`
+	PercevalVersion   string          `json:"perceval_version"`
+	Timestamp         float64         `json:"timestamp"`
+	Origin            string          `json:"origin"`
+	UUID              string          `json:"uuid"`
+	UpdatedOn         float64         `json:"updated_on"`
+	Category          string          `json:"category"`
+	SearchFields      gitSearchFields `json:"search_fields"`
+	Tag               string          `json:"tag"`
+	Data              GitCommit       `json:"data"`
+	MetadataUpdatedOn time.Time       `json:"metadata__updated_on"`
+	MetadataTimestamp time.Time       `json:"metadata__timestamp"`
+	ClassifiedFields  *bool           `json:"classified_fields_filtered"`
+}
+
+// gitSearchFields - raw document search fields
+type gitSearchFields struct {
+	ItemID string `json:"item_id"`
+}
+
+// GitRichItem - rich index document (compatible with p2o.py/dads git rich indexes)
+// Identities are keyed by role prefix: "author" and "Author" (commit author), "Commit" (committer), they also give author_name and author_domain
+type GitRichItem struct {
+	UUID              string                  `json:"uuid"`
+	Origin            string                  `json:"origin"`
+	RepoName          string                  `json:"repo_name"`
+	Hash              string                  `json:"hash"`
+	HashShort         string                  `json:"hash_short"`
+	CommitURL         string                  `json:"commit_url,omitempty"`
+	Title             string                  `json:"title"`
+	Message           string                  `json:"message"`
+	MessageAnalyzed   string                  `json:"message_analyzed"`
+	CommitterName     string                  `json:"committer_name"`
+	CommitterDomain   string                  `json:"committer_domain"`
+	AuthorDate        time.Time               `json:"author_date"`
+	CommitDate        time.Time               `json:"commit_date"`
+	UTCAuthor         time.Time               `json:"utc_author"`
+	UTCCommit         time.Time               `json:"utc_commit"`
+	AuthorDateWeekday int                     `json:"author_date_weekday"`
+	AuthorDateHour    int                     `json:"author_date_hour"`
+	CommitDateWeekday int                     `json:"commit_date_weekday"`
+	CommitDateHour    int                     `json:"commit_date_hour"`
+	TZ                int                     `json:"tz"`
+	Files             int                     `json:"files"`
+	LinesAdded        int                     `json:"lines_added"`
+	LinesRemoved      int                     `json:"lines_removed"`
+	LinesChanged      int                     `json:"lines_changed"`
+	IsMerge           int                     `json:"is_merge"`
+	IsGitCommit       int                     `json:"is_git_commit"`
+	Project           string                  `json:"project"`
+	ProjectSlug       string                  `json:"project_slug"`
+	CreationDate      time.Time               `json:"grimoire_creation_date"`
+	MetadataUpdatedOn time.Time               `json:"metadata__updated_on"`
+	MetadataTimestamp time.Time               `json:"metadata__timestamp"`
+	MetadataEnrichOn  time.Time               `json:"metadata__enriched_on"`
+	Identities        map[string]*GitIdentity `json:"-"`
+}
+
+// MarshalJSON - rich document with identities fields of all roles
+func (item GitRichItem) MarshalJSON() ([]byte, error) {
+	type plain GitRichItem
+	data, err := jsoniter.Marshal(plain(item))
+	if err != nil || len(item.Identities) == 0 {
+		return data, err
+	}
+	roles := []string{}
+	for role := range item.Identities {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	buf := bytes.NewBuffer(bytes.TrimSuffix(data, []byte("}")))
+	for _, role := range roles {
+		err = item.Identities[role].writeFields(buf, role, item.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// Orgs - names of organizations identity was enrolled in at a given date, oldest enrollment first
+func (identity *GitIdentity) Orgs(dt time.Time) (orgs []string) {
+	enrollments := []affiliation.Enrollment{}
+	for _, enrollment := range identity.Enrollments {
+		if !enrollment.Start.After(dt) && (enrollment.End.IsZero() || !enrollment.End.Before(dt)) {
+			enrollments = append(enrollments, enrollment)
+		}
+	}
+	sort.SliceStable(enrollments, func(i, j int) bool {
+		return enrollments[i].Start.Before(enrollments[j].Start)
+	})
+	seen := make(map[string]struct{})
+	for _, enrollment := range enrollments {
+		name := enrollment.Organization.Name
+		_, ok := seen[name]
+		if ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		orgs = append(orgs, name)
+	}
+	if len(orgs) == 0 {
+		orgs = []string{gitUnknownOrg}
+	}
+	return
+}
+
+// writeFields - appends identity fields with a given role prefix to JSON object being written (after its last field)
+func (identity *GitIdentity) writeFields(buf *bytes.Buffer, role string, dt time.Time) error {
+	orgs := identity.Orgs(dt)
+	gender := gitUnknownOrg
+	if identity.Gender != nil {
+		gender = *identity.Gender
+	}
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "id", value: identity.ID},
+		{name: "uuid", value: identity.UUID},
+		{name: "name", value: identity.Name},
+		{name: "user_name", value: ""},
+		{name: "domain", value: identity.Domain},
+		{name: "gender", value: gender},
+		{name: "gender_acc", value: identity.GenderAcc},
+		{name: "org_name", value: orgs[0]},
+		{name: "multi_org_names", value: orgs},
+		{name: "bot", value: identity.Bot},
+	}
+	for _, field := range fields {
+		value, err := jsoniter.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`,"` + role + "_" + field.name + `":`)
+		buf.Write(value)
+	}
+	return nil
+}
+
+// identity - returns (cached) SortingHat identity of 'Name <email>' git author/committer
+// Identity unknown to SortingHat is added, its UUID is the same as its ID then
+func (cfg *GitCollectConfig) identity(str string) *GitIdentity {
+	if cfg.identities == nil {
+		cfg.identities = make(map[string]*GitIdentity)
+	}
+	identity, ok := cfg.identities[str]
+	if ok {
+		return identity
+	}
+	name, email := gitNameEmail(str)
+	source := gitIdentitySource
+	id, err := uuid.GenerateIdentity(&source, &email, &name, nil)
+	if err != nil {
+		id = ""
+	}
+	identity = &GitIdentity{ID: id, UUID: id, Name: name}
+	_, identity.Domain = gitNameDomain(str)
+	if cfg.Affiliations != nil && id != "" {
+		known := cfg.Affiliations.GetIdentity(id)
+		if known != nil && known.UUID != "" {
+			identity.UUID = known.UUID
+		} else {
+			cfg.Affiliations.AddIdentity(&affiliation.Identity{ID: id, UUID: id, Source: source, Name: name, Email: email})
+		}
+		profile := cfg.Affiliations.GetProfile(identity.UUID, cfg.ProjectSlug)
+		if profile != nil {
+			identity.Enrollments = profile.Enrollments
+			if profile.Profile.Name != nil && *profile.Profile.Name != "" {
+				identity.Name = *profile.Profile.Name
+			}
+			identity.Gender = profile.Profile.Gender
+			identity.GenderAcc = profile.Profile.GenderAcc
+			identity.Bot = profile.Profile.IsBot != nil && *profile.Profile.IsBot != 0
+		}
+	}
+	cfg.identities[str] = identity
+	return identity
+}
+
+// GitUUID - item UUID (the same as perceval's: sha1 of 'origin:hash')
+func GitUUID(origin, hash string) string {
+	sum := sha1.Sum([]byte(origin + ":" + hash))
+	return hex.EncodeToString(sum[:])
+}
+
+// gitCommand - runs git with given arguments, returns its standard output or error with standard error included
+func gitCommand(args ...string) (out []byte, err error) {
+	cmd := exec.Command("git", append([]string{"-c", "core.quotepath=off"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err = cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("git %s: %+v: %s", strings.Join(args, " "), err, FilterRedacted(stderr.String()))
+	}
+	return
+}
+
+// GitSync - creates or updates local bare clone of a git repository (perceval layout, see GitClonePath)
+// All branches are fetched into local branches of the clone (tags are not fetched)
+func GitSync(ctx *Ctx, url string) (path string, err error) {
+	path = GitClonePath(ctx, url)
+	var repo *git.Repository
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return
+		}
+		repo, err = git.PlainInit(path, true)
+		if err != nil {
+			return
+		}
+		_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}, Fetch: []config.RefSpec{gitFetchRefSpec}})
+	} else if err == nil {
+		repo, err = git.PlainOpen(path)
+	}
+	if err != nil {
+		return
+	}
+	err = repo.Fetch(&git.FetchOptions{RemoteName: "origin", RefSpecs: []config.RefSpec{gitFetchRefSpec}, Tags: git.NoTags, Force: true})
+	if err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("git fetch %s: %s", url, FilterRedacted(err.Error()))
+	}
+	return
+}
+
+// GitWalkCommits - streams commits of a local clone (all refs), oldest first (by commit date), to a given callback
+// since: only commits committed after this date are walked (nil means all commits), walking stops on the first callback error
+// Only commit hashes and dates are kept in memory, commits are read again when passed to the callback
+func GitWalkCommits(path string, since *time.Time, fn func(commit *GitCommit) error) (err error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return
+	}
+	refs, heads, err := gitRefs(repo)
+	if err != nil {
+		return
+	}
+	type walked struct {
+		hash plumbing.Hash
+		dt   time.Time
+	}
+	commits := []walked{}
+	seen := make(map[plumbing.Hash]bool)
+	for _, head := range heads {
+		var commit *object.Commit
+		commit, err = repo.CommitObject(head)
+		if err != nil {
+			return
+		}
+		// Commits seen from other refs are skipped together with their history
+		err = object.NewCommitPreorderIter(commit, seen, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			if since == nil || !c.Committer.When.Before(*since) {
+				commits = append(commits, walked{hash: c.Hash, dt: c.Committer.When})
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].dt.Before(commits[j].dt)
+	})
+	for _, w := range commits {
+		var c *object.Commit
+		c, err = repo.CommitObject(w.hash)
+		if err != nil {
+			return
+		}
+		var commit GitCommit
+		commit, err = gitCommit(c, refs[c.Hash])
+		if err == nil {
+			err = fn(&commit)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// gitRefs - returns refs decorations of commits (as 'git log --decorate=full' shows them) and commits pointed by refs (sorted)
+func gitRefs(repo *git.Repository) (refs map[plumbing.Hash][]string, heads []plumbing.Hash, err error) {
+	refs = make(map[plumbing.Hash][]string)
+	head := ""
+	headRef, e := repo.Reference(plumbing.HEAD, false)
+	if e == nil && headRef.Type() == plumbing.SymbolicReference {
+		head = headRef.Target().String()
+	}
+	iter, err := repo.References()
+	if err != nil {
+		return
+	}
+	names := make(map[plumbing.Hash][]string)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		name := ref.Name().String()
+		hash := ref.Hash()
+		if ref.Name().IsTag() {
+			name = "tag: " + name
+			tag, e := repo.TagObject(hash)
+			if e == nil {
+				commit, e := tag.Commit()
+				if e != nil {
+					return nil
+				}
+				hash = commit.Hash
+			}
+		}
+		if name == head {
+			name = "HEAD -> " + name
+		}
+		names[hash] = append(names[hash], name)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for hash, ary := range names {
+		sort.Slice(ary, func(i, j int) bool {
+			if strings.HasPrefix(ary[i], "HEAD -> ") != strings.HasPrefix(ary[j], "HEAD -> ") {
+				return strings.HasPrefix(ary[i], "HEAD -> ")
+			}
+			return ary[i] < ary[j]
+		})
+		refs[hash] = ary
+		heads = append(heads, hash)
+	}
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].String() < heads[j].String()
+	})
+	return
+}
+
+// gitCommit - returns commit data (the same as perceval's git backend) for a given commit and its refs decorations
+func gitCommit(c *object.Commit, refs []string) (commit GitCommit, err error) {
+	commit = GitCommit{
+		Commit:     c.Hash.String(),
+		Parents:    []string{},
+		Refs:       []string{},
+		Author:     c.Author.Name + " <" + c.Author.Email + ">",
+		AuthorDate: c.Author.When.Format(gitDateFormat),
+		Committer:  c.Committer.Name + " <" + c.Committer.Email + ">",
+		CommitDate: c.Committer.When.Format(gitDateFormat),
+		Message:    strings.TrimRight(c.Message, "\n"),
+	}
+	for _, parent := range c.ParentHashes {
+		commit.Parents = append(commit.Parents, parent.String())
+	}
+	commit.Refs = append(commit.Refs, refs...)
+	commit.Files, err = gitCommitFiles(c)
+	return
+}
+
+// gitCommitFiles - files changed by a commit (like 'git log --raw --numstat --no-renames'), merge commits have no files listed
+func gitCommitFiles(c *object.Commit) (files []GitFile, err error) {
+	files = []GitFile{}
+	if c.NumParents() > 1 {
+		return
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return
+	}
+	var parentTree *object.Tree
+	if c.NumParents() == 1 {
+		var parent *object.Commit
+		parent, err = c.Parent(0)
+		if err != nil {
+			return
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return
+	}
+	for _, change := range changes {
+		var action merkletrie.Action
+		action, err = change.Action()
+		if err != nil {
+			return
+		}
+		file := GitFile{
+			File:    change.To.Name,
+			Modes:   []string{fmt.Sprintf("%06o", uint32(change.From.TreeEntry.Mode)), fmt.Sprintf("%06o", uint32(change.To.TreeEntry.Mode))},
+			Indexes: []string{change.From.TreeEntry.Hash.String()[:7], change.To.TreeEntry.Hash.String()[:7]},
+		}
+		switch action {
+		case merkletrie.Insert:
+			file.Action = "A"
+		case merkletrie.Delete:
+			file.Action = "D"
+			file.File = change.From.Name
+		default:
+			file.Action = "M"
+		}
+		var patch *object.Patch
+		patch, err = change.Patch()
+		if err != nil {
+			return
+		}
+		filePatches := patch.FilePatches()
+		if len(filePatches) > 0 && filePatches[0].IsBinary() {
+			file.Added, file.Removed = "-", "-"
+		} else {
+			added, removed := 0, 0
+			for _, stat := range patch.Stats() {
+				added += stat.Addition
+				removed += stat.Deletion
+			}
+			file.Added, file.Removed = strconv.Itoa(added), strconv.Itoa(removed)
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+// parseGitDate - parses git default date format, returns zero time for unparsable dates
+func parseGitDate(str string) time.Time {
+	dt, err := time.Parse(gitDateFormat, str)
+	if err != nil {
+		return time.Time{}
+	}
+	return dt
+}
+
+// gitNameEmail - returns name and email from 'Name <email>' string
+func gitNameEmail(str string) (name, email string) {
+	name = str
+	i := strings.LastIndex(str, " <")
+	if i < 0 {
+		return
+	}
+	name = str[:i]
+	email = strings.TrimSuffix(str[i+2:], ">")
+	return
+}
+
+// gitNameDomain - returns name and email domain from 'Name <email>' string
+func gitNameDomain(str string) (name, domain string) {
+	name, email := gitNameEmail(str)
+	j := strings.LastIndex(email, "@")
+	if j >= 0 {
+		domain = email[j+1:]
+	}
+	return
+}
+
+// GitRawDocument - returns raw document for a given commit
+func GitRawDocument(origin string, commit *GitCommit, now time.Time) (item GitRawItem) {
+	updatedOn := parseGitDate(commit.CommitDate)
+	item = GitRawItem{
+		BackendName:       "Git",
+		BackendVersion:    GitBackendVersion,
+		PercevalVersion:   GitBackendVersion,
+		Timestamp:         float64(now.UnixNano()) / 1e9,
+		Origin:            origin,
+		UUID:              GitUUID(origin, commit.Commit),
+		UpdatedOn:         float64(updatedOn.Unix()),
+		Category:          "commit",
+		SearchFields:      gitSearchFields{ItemID: commit.Commit},
+		Tag:               origin,
+		Data:              *commit,
+		MetadataUpdatedOn: updatedOn.UTC(),
+		MetadataTimestamp: now.UTC(),
+	}
+	return
+}
+
+// GitRichDocument - returns rich document for a given commit
+func GitRichDocument(cfg *GitCollectConfig, commit *GitCommit, now time.Time) (item GitRichItem) {
+	authorDate := parseGitDate(commit.AuthorDate)
+	commitDate := parseGitDate(commit.CommitDate)
+	title := strings.SplitN(commit.Message, "\n", 2)[0]
+	item = GitRichItem{
+		UUID:              GitUUID(cfg.URL, commit.Commit),
+		Origin:            cfg.URL,
+		RepoName:          cfg.URL,
+		Hash:              commit.Commit,
+		Title:             title,
+		Message:           commit.Message,
+		MessageAnalyzed:   commit.Message,
+		AuthorDate:        authorDate,
+		CommitDate:        commitDate,
+		UTCAuthor:         authorDate.UTC(),
+		UTCCommit:         commitDate.UTC(),
+		AuthorDateWeekday: int(authorDate.Weekday()),
+		AuthorDateHour:    authorDate.Hour(),
+		CommitDateWeekday: int(commitDate.Weekday()),
+		CommitDateHour:    commitDate.Hour(),
+		Files:             len(commit.Files),
+		IsGitCommit:       1,
+		Project:           cfg.Project,
+		ProjectSlug:       cfg.ProjectSlug,
+		CreationDate:      authorDate,
+		MetadataUpdatedOn: commitDate.UTC(),
+		MetadataTimestamp: now.UTC(),
+		MetadataEnrichOn:  now.UTC(),
+	}
+	if len(commit.Commit) >= 7 {
+		item.HashShort = commit.Commit[:7]
+	}
+	if strings.HasPrefix(cfg.URL, "https://github.com/") {
+		item.CommitURL = strings.TrimSuffix(cfg.URL, ".git") + "/commit/" + commit.Commit
+	}
+	item.CommitterName, item.CommitterDomain = gitNameDomain(commit.Committer)
+	_, offset := authorDate.Zone()
+	item.TZ = offset / 3600
+	if len(commit.Parents) > 1 {
+		item.IsMerge = 1
+	}
+	for _, file := range commit.Files {
+		added, _ := strconv.Atoi(file.Added)
+		removed, _ := strconv.Atoi(file.Removed)
+		item.LinesAdded += added
+		item.LinesRemoved += removed
+	}
+	item.LinesChanged = item.LinesAdded + item.LinesRemoved
+	author := cfg.identity(commit.Author)
+	item.Identities = map[string]*GitIdentity{"author": author, "Author": author, "Commit": cfg.identity(commit.Committer)}
+	return
+}
+
+// gitLastUpdate - returns date of the newest commit for a given origin in raw index, nil when there is none
+func gitLastUpdate(ctx *Ctx, index, origin string) (last *time.Time, err error) {
+	path := "/" + index + "/_search"
+	data := `{"size":0,"query":{"term":{"origin":"` + jsonEscape(origin) + `"}},"aggs":{"last":{"max":{"field":"metadata__updated_on"}}}}`
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+		return
+	}
+	var result struct {
+		Aggs struct {
+			Last struct {
+				Value *float64 `json:"value"`
+			} `json:"last"`
+		} `json:"aggregations"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil || result.Aggs.Last.Value == nil {
+		return
+	}
+	dt := time.Unix(0, int64(*result.Aggs.Last.Value)*int64(time.Millisecond)).UTC()
+	last = &dt
+	return
+}
+
+// GitCollect - built-in git data source: syncs local bare clone, walks new commits and writes raw and rich documents
+// Returns number of commits processed
+func GitCollect(ctx *Ctx, cfg *GitCollectConfig) (n int, err error) {
+	var path string
+	if cfg.Mirror != "" {
+		path = cfg.Mirror
+	} else if cfg.NoRaw {
+		path = GitClonePath(ctx, cfg.URL)
+	} else {
+		path, err = GitSync(ctx, cfg.URL)
+		if err != nil {
+			return
+		}
+	}
+	var since *time.Time
+	if !cfg.ForceFull && !cfg.NoRaw {
+		since, err = gitLastUpdate(ctx, cfg.RawIndex, cfg.URL)
+		if err != nil {
+			return
+		}
+	}
+	if ctx.Debug > 0 {
+		Printf("git %s: clone %s, since %v\n", cfg.URL, path, since)
+	}
+	bulkSize := cfg.BulkSize
+	if bulkSize <= 0 {
+		bulkSize = 1000
+	}
+	now := time.Now()
+	ids := []string{}
+	raw := [][]byte{}
+	rich := [][]byte{}
+	flush := func() (err error) {
+		if len(ids) == 0 {
+			return
+		}
+		if !cfg.NoRaw {
+			err = EsBulkIndex(ctx, cfg.RawIndex, ids, raw)
+			if err != nil {
+				return
+			}
+		}
+		err = EsBulkIndex(ctx, cfg.RichIndex, ids, rich)
+		if err != nil {
+			return
+		}
+		n += len(ids)
+		ids, raw, rich = []string{}, [][]byte{}, [][]byte{}
+		return
+	}
+	err = GitWalkCommits(path, since, func(commit *GitCommit) (err error) {
+		ids = append(ids, GitUUID(cfg.URL, commit.Commit))
+		var data []byte
+		if !cfg.NoRaw {
+			data, err = jsoniter.Marshal(GitRawDocument(cfg.URL, commit, now))
+			if err != nil {
+				return
+			}
+			raw = append(raw, data)
+		}
+		data, err = jsoniter.Marshal(GitRichDocument(cfg, commit, now))
+		if err != nil {
+			return
+		}
+		rich = append(rich, data)
+		if len(ids) >= bulkSize {
+			err = flush()
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = flush()
+	return
+}
@@ -0,0 +1,219 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LF-Engineering/dev-analytics-libraries/affiliation"
+	"github.com/LF-Engineering/dev-analytics-libraries/uuid"
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// gitTestCommit - commits a file in a local test repository with a given date
+func gitTestCommit(t *testing.T, repo, file, content, msg, date string) {
+	err := ioutil.WriteFile(filepath.Join(repo, file), []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("write file error: %+v", err)
+	}
+	for _, args := range [][]string{{"add", file}, {"commit", "-q", "-m", msg}} {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(
+			os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com", "GIT_AUTHOR_DATE="+date,
+			"GIT_COMMITTER_NAME=John Roe", "GIT_COMMITTER_EMAIL=john@lf.org", "GIT_COMMITTER_DATE="+date,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Skipf("git not available: %+v: %s", err, out)
+		}
+	}
+}
+
+// gitTestAffiliations - SortingHat mock: known identities (id -> uuid), jane-uuid is enrolled in LF in January 2021, other identities are added
+type gitTestAffiliations struct {
+	known map[string]string
+	added []string
+}
+
+func (a *gitTestAffiliations) GetIdentity(id string) *affiliation.Identity {
+	return &affiliation.Identity{ID: id, UUID: a.known[id]}
+}
+
+func (a *gitTestAffiliations) AddIdentity(identity *affiliation.Identity) bool {
+	a.added = append(a.added, identity.Email)
+	return true
+}
+
+func (a *gitTestAffiliations) GetProfile(uuid, projectSlug string) *affiliation.ProfileResponse {
+	if uuid != "jane-uuid" || projectSlug != "lf" {
+		return nil
+	}
+	bot := int64(0)
+	name := "Jane Profile"
+	enrollment := affiliation.Enrollment{
+		Start: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	enrollment.Organization.Name = "LF"
+	return &affiliation.ProfileResponse{Enrollments: []affiliation.Enrollment{enrollment}, Profile: affiliation.Profile{Name: &name, IsBot: &bot}}
+}
+
+func TestGitCollect(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	lib.AddRedacted("git-s3cr3t", true)
+	dir, err := ioutil.TempDir("", "sds-git")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	repo := filepath.Join(dir, "src")
+	out, err := exec.Command("git", "init", "-q", repo).CombinedOutput()
+	if err != nil {
+		t.Skipf("git not available: %+v: %s", err, out)
+	}
+	gitTestCommit(t, repo, "a.txt", "1\n2\n3\n", "Add a\n\nLonger description", "2021-01-04T10:00:00+02:00")
+	gitTestCommit(t, repo, "a.txt", "1\n3\n", "Remove line", "2021-01-05T11:00:00+02:00")
+
+	// ES mock: records bulk payloads, returns last update in raw index
+	docs := make(map[string][]string)
+	lastUpdate := "null"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/_bulk"):
+			index := strings.Split(req.URL.Path, "/")[1]
+			lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+			items := []string{}
+			for i := 1; i < len(lines); i += 2 {
+				docs[index] = append(docs[index], lines[i])
+				items = append(items, `{"index":{"status":201}}`)
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case strings.HasSuffix(req.URL.Path, "/_search"):
+			fmt.Fprintf(w, `{"aggregations":{"last":{"value":%s}}}`, lastUpdate)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL, VerifyGitPath: filepath.Join(dir, "clones")}
+	cfg := lib.GitCollectConfig{URL: repo, RawIndex: "sds-lf-git-raw", RichIndex: "sds-lf-git", Project: "LF", ProjectSlug: "lf"}
+
+	// Initial full sync
+	n, err := lib.GitCollect(&ctx, &cfg)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 commits, got %d: %+v", n, err)
+	}
+	if len(docs["sds-lf-git-raw"]) != 2 || len(docs["sds-lf-git"]) != 2 {
+		t.Fatalf("expected 2 raw and 2 rich documents, got %+v", docs)
+	}
+	var raw lib.GitRawItem
+	err = jsoniter.Unmarshal([]byte(docs["sds-lf-git-raw"][0]), &raw)
+	if err != nil {
+		t.Fatalf("raw document unmarshal error: %+v", err)
+	}
+	if raw.BackendName != "Git" || raw.Origin != repo || raw.UUID != lib.GitUUID(repo, raw.Data.Commit) || raw.Data.Author != "Jane Doe <jane@example.com>" ||
+		raw.Data.Message != "Add a\n\nLonger description" || len(raw.Data.Files) != 1 || raw.Data.Files[0].Added != "3" || raw.Data.Files[0].Action != "A" ||
+		raw.Data.CommitDate != "Mon Jan 4 10:00:00 2021 +0200" || raw.MetadataUpdatedOn.Format("2006-01-02T15:04:05Z") != "2021-01-04T08:00:00Z" {
+		t.Errorf("unexpected raw document: %+v", raw)
+	}
+
+	var second lib.GitRawItem
+	err = jsoniter.Unmarshal([]byte(docs["sds-lf-git-raw"][1]), &second)
+	if err != nil {
+		t.Fatalf("raw document unmarshal error: %+v", err)
+	}
+	if len(second.Data.Parents) != 1 || second.Data.Parents[0] != raw.Data.Commit || len(second.Data.Refs) != 1 || !strings.Contains(second.Data.Refs[0], "refs/heads/") ||
+		len(second.Data.Files) != 1 || second.Data.Files[0].Action != "M" || second.Data.Files[0].Removed != "1" || strings.Join(second.Data.Files[0].Modes, " ") != "100644 100644" {
+		t.Errorf("unexpected second raw document: %+v", second)
+	}
+
+	// Test cases
+	var testCases = []struct {
+		field string
+	}{
+		{field: `"title":"Add a"`},
+		{field: `"author_name":"Jane Doe"`},
+		{field: `"author_domain":"example.com"`},
+		{field: `"committer_domain":"lf.org"`},
+		{field: `"lines_added":3`},
+		{field: `"tz":2`},
+		{field: `"author_date_hour":10`},
+		{field: `"is_git_commit":1`},
+		{field: `"project":"LF"`},
+		{field: `"project_slug":"lf"`},
+		{field: `"origin":"` + repo + `"`},
+		{field: `"uuid":"` + raw.UUID + `"`},
+		{field: `"author_uuid":"`},
+		{field: `"author_org_name":"Unknown"`},
+		{field: `"Author_multi_org_names":["Unknown"]`},
+		{field: `"Commit_name":"John Roe"`},
+		{field: `"Commit_domain":"lf.org"`},
+		{field: `"author_bot":false`},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		if !strings.Contains(docs["sds-lf-git"][0], test.field) {
+			t.Errorf("test number %d, expected %s in rich document %s", index+1, test.field, docs["sds-lf-git"][0])
+		}
+	}
+	if !strings.Contains(docs["sds-lf-git"][1], `"lines_removed":1`) || !strings.Contains(docs["sds-lf-git"][1], `"lines_changed":1`) {
+		t.Errorf("unexpected second rich document %s", docs["sds-lf-git"][1])
+	}
+
+	// Incremental sync fetches the new commit and processes commits since the last one in raw index
+	gitTestCommit(t, repo, "b.txt", "b\n", "Add b", "2021-02-01T12:00:00Z")
+	lastUpdate = "1609837200000"
+	docs = make(map[string][]string)
+	n, err = lib.GitCollect(&ctx, &cfg)
+	if err != nil || n != 2 || len(docs["sds-lf-git-raw"]) != 2 || !strings.Contains(docs["sds-lf-git"][1], `"title":"Add b"`) {
+		t.Errorf("incremental sync: expected 2 commits, got %d (%+v): %+v", n, err, docs)
+	}
+
+	// Affiliations refresh: no fetch, no raw documents, all commits
+	docs = make(map[string][]string)
+	cfg.NoRaw = true
+	n, err = lib.GitCollect(&ctx, &cfg)
+	if err != nil || n != 3 || len(docs["sds-lf-git-raw"]) != 0 || len(docs["sds-lf-git"]) != 3 {
+		t.Errorf("no raw sync: expected 3 rich only commits, got %d (%+v): %+v", n, err, docs)
+	}
+
+	// SortingHat identities and enrollments valid at the commit date, documents are sent in batches of a given size
+	docs = make(map[string][]string)
+	source, email, name := "git", "jane@example.com", "Jane Doe"
+	janeID, _ := uuid.GenerateIdentity(&source, &email, &name, nil)
+	affs := &gitTestAffiliations{known: map[string]string{janeID: "jane-uuid"}}
+	cfg = lib.GitCollectConfig{URL: repo, RichIndex: "sds-lf-git", ProjectSlug: "lf", NoRaw: true, ForceFull: true, BulkSize: 2, Affiliations: affs}
+	n, err = lib.GitCollect(&ctx, &cfg)
+	if err != nil || n != 3 || len(docs["sds-lf-git"]) != 3 {
+		t.Fatalf("affiliations: expected 3 rich commits, got %d (%+v): %+v", n, err, docs)
+	}
+	if len(affs.added) != 1 || affs.added[0] != "john@lf.org" {
+		t.Errorf("expected only committer to be added, got %+v", affs.added)
+	}
+	for i, field := range []string{`"author_uuid":"jane-uuid"`, `"author_name":"Jane Profile"`, `"author_org_name":"LF"`, `"Commit_org_name":"Unknown"`} {
+		if !strings.Contains(docs["sds-lf-git"][0], field) {
+			t.Errorf("affiliations field %d: expected %s in %s", i+1, field, docs["sds-lf-git"][0])
+		}
+	}
+	if !strings.Contains(docs["sds-lf-git"][2], `"author_org_name":"Unknown"`) {
+		t.Errorf("expected no enrollment after January 2021 in %s", docs["sds-lf-git"][2])
+	}
+
+	// Unreachable repository
+	_, err = lib.GitCollect(&ctx, &lib.GitCollectConfig{URL: filepath.Join(dir, "missing"), RawIndex: "r", RichIndex: "i"})
+	if err == nil {
+		t.Errorf("expected error for missing repository")
+	}
+}
@@ -3,6 +3,7 @@ package syncdatasources
 import (
 	"context"
 	"io/ioutil"
+	"strconv"
 	"strings"
 	"time"
 
@@ -85,11 +86,13 @@ func GetRateLimits(gctx context.Context, ctx *Ctx, gcs []*github.Client, core bo
 			continue
 		}
 		if core {
+			MetricsSet(MetricGitHubRemaining, float64(rl.Core.Remaining), strconv.Itoa(idx), "core")
 			limits = append(limits, rl.Core.Limit)
 			remainings = append(remainings, rl.Core.Remaining)
 			durations = append(durations, rl.Core.Reset.Time.Sub(time.Now())+time.Duration(1)*time.Second)
 			continue
 		}
+		MetricsSet(MetricGitHubRemaining, float64(rl.Search.Remaining), strconv.Itoa(idx), "search")
 		limits = append(limits, rl.Search.Limit)
 		remainings = append(remainings, rl.Search.Remaining)
 		durations = append(durations, rl.Search.Reset.Time.Sub(time.Now())+time.Duration(1)*time.Second)
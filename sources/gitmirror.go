@@ -0,0 +1,266 @@
+package syncdatasources
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// GitMirrorEnv - environment variable with mirror path passed to git tasks when SDS_GIT_MIRROR_PATH is set
+const GitMirrorEnv string = "SDS_GIT_MIRROR"
+
+// gitMirrorSuffix - mirror directories suffix (lock files use the same name with ".lock" suffix)
+const gitMirrorSuffix string = ".git"
+
+// gitMirrorViewPrefix - prefix of temporary directories with per task views of mirrors
+const gitMirrorViewPrefix string = "view-"
+
+// gitMirrorFetched - file in mirror directory, its modification time is the last time mirror was cloned or fetched
+const gitMirrorFetched string = "sds-fetched"
+
+// GitMirrorInfo - single mirror in the cache, LastUsed is the last time mirror was locked by a task
+type GitMirrorInfo struct {
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// GitMirrorDir - returns mirror directory of a git origin in SDS_GIT_MIRROR_PATH
+// Name is origin with non alphanumeric characters replaced by '_' and a short hash to avoid collisions
+func GitMirrorDir(ctx *Ctx, origin string) string {
+	sum := sha1.Sum([]byte(origin))
+	name := strings.Map(
+		func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '.' {
+				return r
+			}
+			return '_'
+		},
+		strings.TrimSuffix(origin, gitMirrorSuffix),
+	)
+	if len(name) > 160 {
+		name = name[len(name)-160:]
+	}
+	return filepath.Join(ctx.GitMirrorPath, name+"-"+hex.EncodeToString(sum[:4])+gitMirrorSuffix)
+}
+
+// lockMirror - takes exclusive or shared (how is syscall.LOCK_EX or syscall.LOCK_SH) lock on mirror's lock file (shared by all processes and nodes using the same directory)
+// Waits up to a given timeout for other lock holders (0 means don't wait, syscall.EWOULDBLOCK is returned then)
+// Returned share function downgrades exclusive lock to a shared lock
+func lockMirror(path string, how int, timeout time.Duration) (unlock func(), share func() error, err error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(time.Duration(100) * time.Millisecond)
+	}
+	if err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK && timeout > 0 {
+			err = fmt.Errorf("%s is locked for longer than %v", path, timeout)
+		}
+		return
+	}
+	unlock = func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}
+	share = func() error {
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_SH)
+	}
+	return
+}
+
+// GitMirror - returns a read-only view of bare mirror of a git origin for a single task, creates or incrementally updates the mirror
+// Mirror is cloned or fetched only when no other task uses it (exclusive lock is taken without waiting) and it was not fetched within
+// SDS_GIT_MIRROR_FETCH_INTERVAL, otherwise it is used as it is (waiting up to SDS_GIT_MIRROR_LOCK_TIMEOUT for a task cloning or fetching it)
+// Mirror is kept with a shared lock (so it cannot be fetched or evicted) until returned unlock function is called, which also removes the view
+// View is a '--shared' clone of the mirror (it uses mirror's objects), so tasks can fetch into it without modifying the mirror
+// When refresh is not set mirror is never cloned or fetched, error satisfying os.IsNotExist is returned when there is no mirror
+// Lock file modification time is used as mirror's last use time
+func GitMirror(ctx *Ctx, origin string, refresh bool) (view string, unlock func(), err error) {
+	path := GitMirrorDir(ctx, origin)
+	err = os.MkdirAll(ctx.GitMirrorPath, 0755)
+	if err != nil {
+		return
+	}
+	st := time.Now()
+	if refresh {
+		var share func() error
+		unlock, share, err = lockMirror(path, syscall.LOCK_EX, 0)
+		if err == nil {
+			err = updateMirror(ctx, origin, path)
+			if err == nil {
+				err = share()
+			}
+			if err != nil {
+				unlock()
+				return
+			}
+		} else if err != syscall.EWOULDBLOCK {
+			return
+		}
+	}
+	if unlock == nil {
+		// Other tasks use the mirror (or clone or fetch it)
+		unlock, _, err = lockMirror(path, syscall.LOCK_SH, ctx.GitMirrorLockTimeout)
+		if err != nil {
+			return
+		}
+		_, err = os.Stat(path)
+		if err != nil {
+			unlock()
+			return
+		}
+	}
+	MetricsObserveSince(MetricLockWait, st, "git_mirror")
+	now := time.Now()
+	_ = os.Chtimes(path+".lock", now, now)
+	dir, err := ioutil.TempDir(ctx.GitMirrorPath, gitMirrorViewPrefix)
+	if err == nil {
+		view = filepath.Join(dir, filepath.Base(path))
+		_, err = gitCommand("clone", "--mirror", "--shared", "--quiet", path, view)
+	}
+	release := unlock
+	unlock = func() {
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+		release()
+	}
+	if err != nil {
+		unlock()
+		unlock = nil
+	}
+	return
+}
+
+// updateMirror - clones mirror or fetches it unless it was fetched within SDS_GIT_MIRROR_FETCH_INTERVAL, must be called with exclusive lock
+func updateMirror(ctx *Ctx, origin, path string) (err error) {
+	fetched := filepath.Join(path, gitMirrorFetched)
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		if ctx.Debug > 0 {
+			Printf("git mirror: cloning %s into %s\n", origin, path)
+		}
+		_, err = gitCommand("clone", "--mirror", "--quiet", origin, path)
+		if err != nil {
+			_ = os.RemoveAll(path)
+			return
+		}
+		return ioutil.WriteFile(fetched, []byte{}, 0644)
+	}
+	if err != nil {
+		return
+	}
+	info, e := os.Stat(fetched)
+	if e == nil && time.Since(info.ModTime()) < ctx.GitMirrorFetchInterval {
+		if ctx.Debug > 0 {
+			Printf("git mirror: %s was fetched at %s, using it as it is\n", path, ToYMDHMSDate(info.ModTime()))
+		}
+		return
+	}
+	if ctx.Debug > 0 {
+		Printf("git mirror: fetching %s into %s\n", origin, path)
+	}
+	_, err = gitCommand("-C", path, "fetch", "--quiet", "--prune", "origin")
+	if err != nil {
+		return
+	}
+	// Only packs loose objects when git thinks it is needed
+	_, err = gitCommand("-C", path, "gc", "--auto", "--quiet")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(fetched, []byte{}, 0644)
+}
+
+// dirSize - total size of files in a directory tree
+func dirSize(path string) (size int64) {
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
+
+// GitMirrors - returns all mirrors in SDS_GIT_MIRROR_PATH, least recently used first
+func GitMirrors(ctx *Ctx) (mirrors []GitMirrorInfo, err error) {
+	entries, err := ioutil.ReadDir(ctx.GitMirrorPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), gitMirrorSuffix) {
+			continue
+		}
+		path := filepath.Join(ctx.GitMirrorPath, entry.Name())
+		mirror := GitMirrorInfo{Path: path, Size: dirSize(path), LastUsed: entry.ModTime()}
+		info, e := os.Stat(path + ".lock")
+		if e == nil {
+			mirror.LastUsed = info.ModTime()
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		return mirrors[i].LastUsed.Before(mirrors[j].LastUsed)
+	})
+	return
+}
+
+// EvictGitMirrors - removes mirrors not used for longer than SDS_GIT_MIRROR_MAX_AGE
+// then removes least recently used mirrors until cache fits in SDS_GIT_MIRROR_QUOTA_MB
+// Mirrors locked by running tasks are never removed
+func EvictGitMirrors(ctx *Ctx, now time.Time) (evicted []GitMirrorInfo, err error) {
+	mirrors, err := GitMirrors(ctx)
+	if err != nil {
+		return
+	}
+	total := int64(0)
+	for _, mirror := range mirrors {
+		total += mirror.Size
+	}
+	quota := int64(ctx.GitMirrorQuota) * 1024 * 1024
+	for _, mirror := range mirrors {
+		expired := ctx.GitMirrorMaxAge > 0 && now.Sub(mirror.LastUsed) > ctx.GitMirrorMaxAge
+		overQuota := quota > 0 && total > quota
+		if !expired && !overQuota {
+			continue
+		}
+		unlock, _, e := lockMirror(mirror.Path, syscall.LOCK_EX, 0)
+		if e != nil {
+			if ctx.Debug > 0 {
+				Printf("git mirror: %s is in use, not evicting\n", mirror.Path)
+			}
+			continue
+		}
+		// Lock file is kept, other processes may be already waiting on it
+		e = os.RemoveAll(mirror.Path)
+		unlock()
+		if e != nil {
+			err = fmt.Errorf("cannot evict git mirror %s: %+v", mirror.Path, e)
+			return
+		}
+		total -= mirror.Size
+		evicted = append(evicted, mirror)
+	}
+	return
+}
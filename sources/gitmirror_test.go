@@ -0,0 +1,182 @@
+package syncdatasources
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestGitMirrorDir(t *testing.T) {
+	ctx := lib.Ctx{GitMirrorPath: "/mirrors"}
+	// Test cases
+	var testCases = []struct {
+		origin   string
+		expected string
+	}{
+		{origin: "https://github.com/cncf/devstats", expected: "/mirrors/https___github.com_cncf_devstats-"},
+		{origin: "https://github.com/cncf/devstats.git", expected: "/mirrors/https___github.com_cncf_devstats-"},
+		{origin: "ssh://git@gerrit:29418/a b", expected: "/mirrors/ssh___git_gerrit_29418_a_b-"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.GitMirrorDir(&ctx, test.origin)
+		if !strings.HasPrefix(got, test.expected) || !strings.HasSuffix(got, ".git") || len(got) != len(test.expected)+8+4 {
+			t.Errorf("test number %d, expected '%s<hash>.git', got '%s'", index+1, test.expected, got)
+		}
+	}
+	if lib.GitMirrorDir(&ctx, "https://github.com/a/b") == lib.GitMirrorDir(&ctx, "https://github.com/a_b") {
+		t.Errorf("different origins should have different mirrors")
+	}
+}
+
+func TestGitMirror(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	lib.AddRedacted("mirror-s3cr3t", true)
+	dir, err := ioutil.TempDir("", "sds-mirror")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	repos := []string{filepath.Join(dir, "src1"), filepath.Join(dir, "src2")}
+	for _, repo := range repos {
+		out, err := exec.Command("git", "init", "-q", repo).CombinedOutput()
+		if err != nil {
+			t.Skipf("git not available: %+v: %s", err, out)
+		}
+		gitTestCommit(t, repo, "a.txt", "a\n", "Add a", "2021-01-04T10:00:00Z")
+	}
+	ctx := lib.Ctx{GitMirrorPath: filepath.Join(dir, "mirrors")}
+	count := func(path string) string {
+		out, _ := exec.Command("git", "-C", path, "rev-list", "--all", "--count").Output()
+		return strings.TrimSpace(string(out))
+	}
+
+	mirror := lib.GitMirrorDir(&ctx, repos[0])
+	mirror2 := lib.GitMirrorDir(&ctx, repos[1])
+
+	// Clone, then fetch new commits, tasks get views of the mirror which are removed after unlock
+	view, unlock, err := lib.GitMirror(&ctx, repos[0], true)
+	if err != nil || view == mirror || count(view) != "1" || count(mirror) != "1" {
+		t.Fatalf("mirror clone error: %+v, view %s, commits: %s", err, view, count(view))
+	}
+	unlock()
+	if _, err = os.Stat(view); !os.IsNotExist(err) {
+		t.Errorf("view %s should be removed after unlock", view)
+	}
+	gitTestCommit(t, repos[0], "b.txt", "b\n", "Add b", "2021-01-05T10:00:00Z")
+	view, unlock, err = lib.GitMirror(&ctx, repos[0], true)
+	if err != nil || count(view) != "2" {
+		t.Fatalf("mirror fetch error: %+v, commits: %s", err, count(view))
+	}
+	// Mirror used by other task is used as it is
+	gitTestCommit(t, repos[0], "c.txt", "c\n", "Add c", "2021-01-06T10:00:00Z")
+	view2, unlock2, err := lib.GitMirror(&ctx, repos[0], true)
+	if err != nil || view2 == view || count(view2) != "2" {
+		t.Fatalf("expected mirror in use not fetched: %+v, commits: %s", err, count(view2))
+	}
+	unlock2()
+	unlock()
+	// Mirror fetched recently is used as it is
+	ctx.GitMirrorFetchInterval = time.Duration(1) * time.Hour
+	view, unlock, err = lib.GitMirror(&ctx, repos[0], true)
+	if err != nil || count(view) != "2" {
+		t.Fatalf("expected recently fetched mirror not fetched: %+v, commits: %s", err, count(view))
+	}
+	unlock()
+	ctx.GitMirrorFetchInterval = 0
+	view, unlock, err = lib.GitMirror(&ctx, repos[0], true)
+	if err != nil || count(view) != "3" {
+		t.Fatalf("mirror fetch error: %+v, commits: %s", err, count(view))
+	}
+	unlock()
+	// Waiting for other task cloning or fetching the mirror is limited
+	f, err := os.OpenFile(mirror+".lock", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("open lock file error: %+v", err)
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("lock error: %+v", err)
+	}
+	ctx.GitMirrorLockTimeout = time.Duration(300) * time.Millisecond
+	_, _, err = lib.GitMirror(&ctx, repos[0], true)
+	if err == nil || !strings.Contains(err.Error(), "is locked for longer than") {
+		t.Errorf("expected lock timeout error, got %+v", err)
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	_ = f.Close()
+	_, unlock, err = lib.GitMirror(&ctx, repos[0], false)
+	if err != nil {
+		t.Fatalf("mirror use after unlock error: %+v", err)
+	}
+	unlock()
+	// Mirror is not created without refresh, failed clone doesn't leave anything
+	_, _, err = lib.GitMirror(&ctx, repos[1], false)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not exist error without refresh, got %+v", err)
+	}
+	_, _, err = lib.GitMirror(&ctx, filepath.Join(dir, "missing"), true)
+	if err == nil {
+		t.Errorf("expected error for missing repository")
+	}
+	if _, err = os.Stat(lib.GitMirrorDir(&ctx, filepath.Join(dir, "missing"))); !os.IsNotExist(err) {
+		t.Errorf("failed clone should not leave mirror directory")
+	}
+
+	// Second mirror is used later, first one gets big
+	old := time.Now().Add(-time.Duration(48) * time.Hour)
+	_ = os.Chtimes(mirror+".lock", old, old)
+	_, unlock2, err = lib.GitMirror(&ctx, repos[1], true)
+	if err != nil {
+		t.Fatalf("mirror clone error: %+v", err)
+	}
+	unlock2()
+	err = ioutil.WriteFile(filepath.Join(mirror, "filler"), make([]byte, 1536*1024), 0644)
+	if err != nil {
+		t.Fatalf("write file error: %+v", err)
+	}
+	mirrors, err := lib.GitMirrors(&ctx)
+	if err != nil || len(mirrors) != 2 || mirrors[0].Path != mirror || mirrors[1].Path != mirror2 || mirrors[0].Size < 1536*1024 {
+		t.Fatalf("expected 2 mirrors LRU first, got %+v: %+v", mirrors, err)
+	}
+
+	// Nothing to evict without quota and max age, locked mirror is never evicted
+	evicted, err := lib.EvictGitMirrors(&ctx, time.Now())
+	if err != nil || len(evicted) != 0 {
+		t.Errorf("expected no evictions, got %+v: %+v", evicted, err)
+	}
+	ctx.GitMirrorQuota = 1
+	_, unlock, _ = lib.GitMirror(&ctx, repos[0], true)
+	_ = os.Chtimes(mirror+".lock", old, old)
+	evicted, err = lib.EvictGitMirrors(&ctx, time.Now())
+	unlock()
+	if err != nil || len(evicted) != 1 || evicted[0].Path != mirror2 {
+		t.Errorf("expected only unlocked %s to be evicted, got %+v: %+v", mirror2, evicted, err)
+	}
+
+	// Quota evicts least recently used mirror, max age evicts the rest
+	_, unlock2, _ = lib.GitMirror(&ctx, repos[1], true)
+	unlock2()
+	_ = os.Chtimes(mirror+".lock", old, old)
+	evicted, err = lib.EvictGitMirrors(&ctx, time.Now())
+	if err != nil || len(evicted) != 1 || evicted[0].Path != mirror {
+		t.Errorf("expected %s to be evicted by quota, got %+v: %+v", mirror, evicted, err)
+	}
+	ctx.GitMirrorMaxAge = time.Duration(1) * time.Hour
+	evicted, err = lib.EvictGitMirrors(&ctx, time.Now().Add(time.Duration(2)*time.Hour))
+	if err != nil || len(evicted) != 1 || evicted[0].Path != mirror2 {
+		t.Errorf("expected %s to be evicted by age, got %+v: %+v", mirror2, evicted, err)
+	}
+	mirrors, _ = lib.GitMirrors(&ctx)
+	if len(mirrors) != 0 {
+		t.Errorf("expected empty cache, got %+v", mirrors)
+	}
+}
@@ -0,0 +1,155 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// GroupsField - rich index field holding endpoint groups
+const GroupsField string = "groups"
+
+// GroupsTSField - rich index field holding epoch of the last groups update, used to update only newer documents
+const GroupsTSField string = "groups_ts"
+
+// groupsUpdateScript - script setting groups and their timestamp on rich index documents
+type groupsUpdateScript struct {
+	Source string            `json:"source"`
+	Lang   string            `json:"lang"`
+	Params groupsUpdateParam `json:"params"`
+}
+
+// groupsUpdateParam - groups update script params
+type groupsUpdateParam struct {
+	Groups []string `json:"groups"`
+	TS     int64    `json:"ts"`
+}
+
+// NormalizeGroups - returns sorted and deduplicated groups (without empty ones), so they can be compared
+func NormalizeGroups(groups []string) (normalized []string) {
+	m := make(map[string]struct{})
+	for _, group := range groups {
+		if group == "" {
+			continue
+		}
+		m[group] = struct{}{}
+	}
+	normalized = []string{}
+	for group := range m {
+		normalized = append(normalized, group)
+	}
+	sort.Strings(normalized)
+	return
+}
+
+// GroupsUpdateQuery - returns update by query payload setting groups (and groups_ts = epoch) on given origin documents
+// When lastEpoch > 0 only documents not updated since then (new documents) are updated
+func GroupsUpdateQuery(origin string, groups []string, epoch, lastEpoch int64) string {
+	script, _ := jsoniter.Marshal(
+		groupsUpdateScript{
+			Source: fmt.Sprintf("ctx._source.%s=params.groups;ctx._source.%s=params.ts", GroupsField, GroupsTSField),
+			Lang:   "painless",
+			Params: groupsUpdateParam{Groups: NormalizeGroups(groups), TS: epoch},
+		},
+	)
+	mustNot := ""
+	if lastEpoch > 0 {
+		mustNot = fmt.Sprintf(`,"must_not":[{"range":{"%s":{"lte":%d}}}]`, GroupsTSField, lastEpoch)
+	}
+	return fmt.Sprintf(`{"script":%s,"query":{"bool":{"must":[{"term":{"origin":"%s"}}]%s}}}`, script, jsonEscape(origin), mustNot)
+}
+
+// lastGroupsUpdate - returns groups and groups_ts of the most recently updated given origin's document
+// Returns zero epoch when groups were never set or the index does not exist
+func lastGroupsUpdate(ctx *Ctx, index, origin string) (epoch int64, groups []string, err error) {
+	data := fmt.Sprintf(
+		`{"_source":["%s","%s"],"query":{"bool":{"must":[{"exists":{"field":"%s"}},{"term":{"origin":"%s"}}]}},"sort":[{"%s":{"order":"desc","unmapped_type":"long"}}]}`,
+		GroupsField,
+		GroupsTSField,
+		GroupsTSField,
+		jsonEscape(origin),
+		GroupsTSField,
+	)
+	path := "/" + index + "/_search?size=1"
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	var payload struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					Groups []string `json:"groups"`
+					TS     int64    `json:"groups_ts"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+		return
+	}
+	if len(payload.Hits.Hits) == 0 {
+		return
+	}
+	epoch = payload.Hits.Hits[0].Source.TS
+	groups = payload.Hits.Hits[0].Source.Groups
+	return
+}
+
+// SetGroups - writes endpoint groups into given origin's rich index documents, similar to setting project
+// Incremental: only documents added since the last groups update are updated, unless the most recently updated document
+// has different groups (groups configuration changed) or backfill is requested - then all origin's documents are recomputed
+// Origin without groups is only updated when its documents still have groups (they were removed from configuration) or in backfill mode
+func SetGroups(ctx *Ctx, index, origin string, groups []string, backfill bool) (updated int64, full bool, err error) {
+	groups = NormalizeGroups(groups)
+	lastEpoch := int64(0)
+	full = backfill
+	if !full {
+		var last []string
+		lastEpoch, last, err = lastGroupsUpdate(ctx, index, origin)
+		if err != nil {
+			return
+		}
+		if len(groups) == 0 && len(NormalizeGroups(last)) == 0 {
+			return
+		}
+		if lastEpoch > 0 && strings.Join(NormalizeGroups(last), "\n") != strings.Join(groups, "\n") {
+			full = true
+			lastEpoch = 0
+		}
+	}
+	data := GroupsUpdateQuery(origin, groups, time.Now().Unix(), lastEpoch)
+	path := "/" + index + "/_update_by_query?conflicts=proceed&refresh=true&timeout=20m"
+	if ctx.DryRun {
+		Printf("DryRun: Method:%s url:%s data:%s\n", Post, path, data)
+		return
+	}
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	payload := EsUpdateByQueryPayload{}
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+		return
+	}
+	updated = payload.Updated
+	return
+}
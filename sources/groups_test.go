@@ -0,0 +1,124 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestGroupsUpdateQuery(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		origin    string
+		groups    []string
+		lastEpoch int64
+		expected  string
+	}{
+		{
+			origin: "https://github.com/a/b", groups: []string{"z", "a", "", "z"},
+			expected: `{"script":{"source":"ctx._source.groups=params.groups;ctx._source.groups_ts=params.ts","lang":"painless","params":{"groups":["a","z"],"ts":100}},` +
+				`"query":{"bool":{"must":[{"term":{"origin":"https://github.com/a/b"}}]}}}`,
+		},
+		{
+			origin: `o"1`, lastEpoch: 50,
+			expected: `{"script":{"source":"ctx._source.groups=params.groups;ctx._source.groups_ts=params.ts","lang":"painless","params":{"groups":[],"ts":100}},` +
+				`"query":{"bool":{"must":[{"term":{"origin":"o\"1"}}],"must_not":[{"range":{"groups_ts":{"lte":50}}}]}}}`,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.GroupsUpdateQuery(test.origin, test.groups, 100, test.lastEpoch)
+		if got != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSetGroups(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	last := ""
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if strings.HasPrefix(req.URL.Path, "/missing/") {
+			w.WriteHeader(404)
+			return
+		}
+		if strings.HasSuffix(req.URL.Path, "/_search") {
+			fmt.Fprintf(w, `{"hits":{"hits":[%s]}}`, last)
+			return
+		}
+		requests = append(requests, string(body))
+		fmt.Fprintf(w, `{"updated":3}`)
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+
+	// Test cases
+	var testCases = []struct {
+		index    string
+		last     string
+		backfill bool
+		full     bool
+		lastTS   bool
+		err      bool
+	}{
+		{index: "idx", full: false},
+		{index: "idx", last: `{"_source":{"groups":["a","b"],"groups_ts":50}}`, lastTS: true},
+		{index: "idx", last: `{"_source":{"groups":["b","a","a"],"groups_ts":50}}`, lastTS: true},
+		{index: "idx", last: `{"_source":{"groups":["a"],"groups_ts":50}}`, full: true},
+		{index: "idx", last: `{"_source":{"groups":["a","b"],"groups_ts":50}}`, backfill: true, full: true},
+		{index: "missing", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		last = test.last
+		requests = []string{}
+		updated, full, err := lib.SetGroups(&ctx, test.index, "o", []string{"b", "a"}, test.backfill)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error", index+1)
+			}
+			continue
+		}
+		if err != nil || updated != 3 || full != test.full || len(requests) != 1 {
+			t.Errorf("test number %d, expected full %v, got %v, updated %d, requests %+v: %+v", index+1, test.full, full, updated, requests, err)
+			continue
+		}
+		if strings.Contains(requests[0], `"lte":50`) != test.lastTS {
+			t.Errorf("test number %d, expected incremental %v, got %s", index+1, test.lastTS, requests[0])
+		}
+	}
+
+	// Origin without groups: nothing to do unless its documents still have groups from the previous configuration
+	for index, test := range []struct {
+		last     string
+		requests int
+	}{
+		{last: "", requests: 0},
+		{last: `{"_source":{"groups":[],"groups_ts":50}}`, requests: 0},
+		{last: `{"_source":{"groups":["a"],"groups_ts":50}}`, requests: 1},
+	} {
+		last = test.last
+		requests = []string{}
+		_, full, err := lib.SetGroups(&ctx, "idx", "o", nil, false)
+		if err != nil || len(requests) != test.requests || full != (test.requests > 0) {
+			t.Errorf("clear test number %d, expected %d requests, got %+v (full %v): %+v", index+1, test.requests, requests, full, err)
+		}
+	}
+
+	// Dry run
+	requests = []string{}
+	ctx.DryRun = true
+	_, _, err := lib.SetGroups(&ctx, "idx", "o", []string{"a"}, true)
+	if err != nil || !reflect.DeepEqual(requests, []string{}) {
+		t.Errorf("dry run should not update, got %+v: %+v", requests, err)
+	}
+}
@@ -0,0 +1,191 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit - concurrency limit for upstream hosts matching a given pattern
+// MaxRunning - maximum number of tasks running against a single host at the same time, 0 means no limit
+// MinSpacing - minimum time between starting two consecutive tasks on the same host, 0 means no spacing
+type HostLimit struct {
+	Pattern    *regexp.Regexp
+	MaxRunning int
+	MinSpacing time.Duration
+}
+
+// String - default string output for a host limit
+func (hl HostLimit) String() string {
+	return fmt.Sprintf("{Pattern:%v MaxRunning:%d MinSpacing:%v}", hl.Pattern, hl.MaxRunning, hl.MinSpacing)
+}
+
+// HostLimiter - tracks tasks running per upstream host and enforces host limits
+type HostLimiter struct {
+	Limits    []HostLimit
+	running   map[string]int
+	lastStart map[string]time.Time
+	mtx       *sync.Mutex
+}
+
+// ParseHostLimits - parses host limits definition (as specified in SDS_HOST_LIMITS)
+// Format is: 'pattern1=max1[:spacing1];pattern2=max2[:spacing2];...'
+// For example: 'jira\.lfnetworking\.org=2:30s;^gerrit\.=4;confluence=1'
+// First matching pattern wins, so more specific patterns should be specified first
+func ParseHostLimits(str string) (limits []HostLimit, err error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return
+	}
+	for _, item := range strings.Split(str, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i <= 0 {
+			err = fmt.Errorf("host limit '%s' must be in 'pattern=max[:spacing]' format", item)
+			return
+		}
+		var limit HostLimit
+		limit.Pattern, err = regexp.Compile(item[:i])
+		if err != nil {
+			return
+		}
+		value := item[i+1:]
+		spacing := ""
+		j := strings.Index(value, ":")
+		if j >= 0 {
+			spacing = value[j+1:]
+			value = value[:j]
+		}
+		if value != "" {
+			limit.MaxRunning, err = strconv.Atoi(value)
+			if err != nil {
+				return
+			}
+			if limit.MaxRunning < 0 {
+				err = fmt.Errorf("host limit '%s' has negative max running value", item)
+				return
+			}
+		}
+		if spacing != "" {
+			limit.MinSpacing, err = time.ParseDuration(spacing)
+			if err != nil {
+				return
+			}
+		}
+		limits = append(limits, limit)
+	}
+	return
+}
+
+// TaskHost - returns upstream host (lowercase) for a given task endpoint
+// Returns an empty string when endpoint is not a host based one (like slack channel ID or docker hub repo)
+func TaskHost(endpoint string) string {
+	ary := strings.Fields(endpoint)
+	if len(ary) == 0 {
+		return ""
+	}
+	ep := ary[0]
+	if strings.Contains(ep, "://") {
+		u, err := url.Parse(ep)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(u.Hostname())
+	}
+	ep = strings.Split(ep, "/")[0]
+	if !strings.Contains(ep, ".") {
+		return ""
+	}
+	return strings.ToLower(strings.Split(ep, ":")[0])
+}
+
+// NewHostLimiter - creates a host limiter for given limits, returns nil when there are no limits defined
+func NewHostLimiter(limits []HostLimit) *HostLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	return &HostLimiter{
+		Limits:    limits,
+		running:   make(map[string]int),
+		lastStart: make(map[string]time.Time),
+		mtx:       &sync.Mutex{},
+	}
+}
+
+// Limit - returns the first host limit matching a given host or nil
+func (hl *HostLimiter) Limit(host string) *HostLimit {
+	if host == "" {
+		return nil
+	}
+	for i := range hl.Limits {
+		if hl.Limits[i].Pattern.MatchString(host) {
+			return &hl.Limits[i]
+		}
+	}
+	return nil
+}
+
+// TryAcquire - tries to reserve a slot for a task running against a given host
+// Returns true if task can be started now, otherwise returns false and time after which it makes sense to try again
+// (zero wait means that we need to wait for some other task on that host to finish)
+func (hl *HostLimiter) TryAcquire(host string, now time.Time) (bool, time.Duration) {
+	limit := hl.Limit(host)
+	if limit == nil {
+		return true, 0
+	}
+	hl.mtx.Lock()
+	defer func() {
+		hl.mtx.Unlock()
+	}()
+	if limit.MaxRunning > 0 && hl.running[host] >= limit.MaxRunning {
+		return false, 0
+	}
+	if limit.MinSpacing > 0 {
+		last, ok := hl.lastStart[host]
+		if ok {
+			next := last.Add(limit.MinSpacing)
+			if now.Before(next) {
+				return false, next.Sub(now)
+			}
+		}
+	}
+	hl.running[host]++
+	hl.lastStart[host] = now
+	return true, 0
+}
+
+// Release - releases a slot reserved for a given host by TryAcquire
+func (hl *HostLimiter) Release(host string) {
+	if hl.Limit(host) == nil {
+		return
+	}
+	hl.mtx.Lock()
+	defer func() {
+		hl.mtx.Unlock()
+	}()
+	if hl.running[host] > 0 {
+		hl.running[host]--
+	}
+}
+
+// Running - returns number of tasks currently running per host (only hosts with limits defined)
+func (hl *HostLimiter) Running() map[string]int {
+	hl.mtx.Lock()
+	defer func() {
+		hl.mtx.Unlock()
+	}()
+	running := make(map[string]int)
+	for host, n := range hl.running {
+		if n > 0 {
+			running[host] = n
+		}
+	}
+	return running
+}
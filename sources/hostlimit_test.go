@@ -0,0 +1,127 @@
+package syncdatasources
+
+import (
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestTaskHost(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "https://gerrit.onap.org", expected: "gerrit.onap.org"},
+		{endpoint: "https://Jira.LFNetworking.org/projects/ONAP", expected: "jira.lfnetworking.org"},
+		{endpoint: "https://gerrit.fd.io:8443/r", expected: "gerrit.fd.io"},
+		{endpoint: "https://chat.hyperledger.org general", expected: "chat.hyperledger.org"},
+		{endpoint: "git.opendaylight.org", expected: "git.opendaylight.org"},
+		{endpoint: "git.opendaylight.org/gerrit/aaa", expected: "git.opendaylight.org"},
+		{endpoint: "edgexfoundry docker-edgex-mongo", expected: ""},
+		{endpoint: "CE44YG81E", expected: ""},
+		{endpoint: "", expected: ""},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.TaskHost(test.endpoint)
+		if got != test.expected {
+			t.Errorf("test number %d, expected host '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestParseHostLimits(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		str      string
+		expected string
+		err      bool
+	}{
+		{str: "", expected: "[]"},
+		{str: "jira=2", expected: "[{Pattern:jira MaxRunning:2 MinSpacing:0s}]"},
+		{str: `jira\.lfnetworking\.org=2:30s; ^gerrit\.=4 ;`, expected: `[{Pattern:jira\.lfnetworking\.org MaxRunning:2 MinSpacing:30s} {Pattern:^gerrit\. MaxRunning:4 MinSpacing:0s}]`},
+		{str: "confluence=:1m", expected: "[{Pattern:confluence MaxRunning:0 MinSpacing:1m0s}]"},
+		{str: "a=b=3", expected: "[{Pattern:a=b MaxRunning:3 MinSpacing:0s}]"},
+		{str: "jira", err: true},
+		{str: "jira=x", err: true},
+		{str: "jira=-1", err: true},
+		{str: "jira=1:x", err: true},
+		{str: "(=1", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		limits, err := lib.ParseHostLimits(test.str)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error for '%s', got %+v", index+1, test.str, limits)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error for '%s': %+v", index+1, test.str, err)
+			continue
+		}
+		got := "["
+		for i, limit := range limits {
+			if i > 0 {
+				got += " "
+			}
+			got += limit.String()
+		}
+		got += "]"
+		if got != test.expected {
+			t.Errorf("test number %d, expected %s, got %s", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	if lib.NewHostLimiter(nil) != nil {
+		t.Errorf("expected nil host limiter when no limits are defined")
+	}
+	limits, err := lib.ParseHostLimits(`jira=2;gerrit=:10s`)
+	if err != nil {
+		t.Errorf("unexpected error: %+v", err)
+		return
+	}
+	hl := lib.NewHostLimiter(limits)
+	now := time.Now()
+	// Hosts without limits are never blocked
+	for i := 0; i < 5; i++ {
+		ok, _ := hl.TryAcquire("github.com", now)
+		if !ok {
+			t.Errorf("unlimited host blocked on attempt %d", i+1)
+		}
+	}
+	// Max running
+	ok1, _ := hl.TryAcquire("jira.lfnetworking.org", now)
+	ok2, _ := hl.TryAcquire("jira.lfnetworking.org", now)
+	ok3, wait := hl.TryAcquire("jira.lfnetworking.org", now)
+	if !ok1 || !ok2 || ok3 || wait != 0 {
+		t.Errorf("expected two jira slots and a third blocked without wait, got %v %v %v %v", ok1, ok2, ok3, wait)
+	}
+	// Other host matching the same pattern has its own slots
+	ok4, _ := hl.TryAcquire("jira.hyperledger.org", now)
+	if !ok4 {
+		t.Errorf("expected jira.hyperledger.org to have its own slots")
+	}
+	hl.Release("jira.lfnetworking.org")
+	ok5, _ := hl.TryAcquire("jira.lfnetworking.org", now)
+	if !ok5 {
+		t.Errorf("expected jira slot to be available after release")
+	}
+	running := hl.Running()
+	if running["jira.lfnetworking.org"] != 2 || running["jira.hyperledger.org"] != 1 || len(running) != 2 {
+		t.Errorf("unexpected running state: %+v", running)
+	}
+	// Min spacing
+	ok6, _ := hl.TryAcquire("gerrit.onap.org", now)
+	hl.Release("gerrit.onap.org")
+	ok7, wait := hl.TryAcquire("gerrit.onap.org", now.Add(4*time.Second))
+	ok8, _ := hl.TryAcquire("gerrit.onap.org", now.Add(10*time.Second))
+	if !ok6 || ok7 || wait != 6*time.Second || !ok8 {
+		t.Errorf("unexpected spacing results: %v %v %v %v", ok6, ok7, wait, ok8)
+	}
+}
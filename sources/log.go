@@ -3,15 +3,52 @@ package syncdatasources
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
+
+	jsoniter "github.com/json-iterator/go"
 )
 
+// LogFormatText - plain text stdout log format (default)
+const LogFormatText string = "text"
+
+// LogFormatJSON - one JSON object per line stdout log format
+const LogFormatJSON string = "json"
+
+// LogLevelDebug - debug log level
+const LogLevelDebug string = "debug"
+
+// LogLevelInfo - info log level (used by Printf)
+const LogLevelInfo string = "info"
+
+// LogLevelWarning - warning log level
+const LogLevelWarning string = "warning"
+
+// LogLevelError - error log level
+const LogLevelError string = "error"
+
+// LogLevelFatal - fatal error log level (used by FatalOnError/Fatalf)
+const LogLevelFatal string = "fatal"
+
 var (
 	logCtx  *Ctx
 	logOnce sync.Once
 )
 
+// Logger - logs with task correlation fields (fixture, data source, endpoint, task index)
+type Logger struct {
+	Fixture    string
+	DataSource string
+	Endpoint   string
+	TaskIdx    int
+}
+
+// TaskLogger - returns logger that adds given task fields to all structured log entries
+func TaskLogger(idx int, fixture, dataSource, endpoint string) *Logger {
+	return &Logger{Fixture: fixture, DataSource: dataSource, Endpoint: endpoint, TaskIdx: idx}
+}
+
 // Returns new context when not yet created
 func newLogContext() *Ctx {
 	simple := os.Getenv("SDS_SIMPLE_PRINTF")
@@ -33,50 +70,104 @@ func PrintfRedacted(format string, args ...interface{}) (n int, err error) {
 
 // Printf is a wrapper around Printf(...) that supports logging.
 func Printf(format string, args ...interface{}) (n int, err error) {
-	// Initialize context once
-	logOnce.Do(func() { logCtx = newLogContext() })
-	if logCtx == nil {
-		return fmt.Printf(format, args...)
+	return logf(nil, LogLevelInfo, true, format, args...)
+}
+
+// PrintLogf is a wrapper around Printf(...) that supports logging.
+func PrintLogf(format string, args ...interface{}) (err error) {
+	_, err = logf(nil, LogLevelInfo, false, format, args...)
+	return
+}
+
+// Printf - logs message with task fields at info level
+func (l *Logger) Printf(format string, args ...interface{}) (n int, err error) {
+	return logf(l, LogLevelInfo, true, format, args...)
+}
+
+// Debugf - logs message with task fields at debug level
+func (l *Logger) Debugf(format string, args ...interface{}) (n int, err error) {
+	return logf(l, LogLevelDebug, true, format, args...)
+}
+
+// Warnf - logs message with task fields at warning level
+func (l *Logger) Warnf(format string, args ...interface{}) (n int, err error) {
+	return logf(l, LogLevelWarning, true, format, args...)
+}
+
+// Errorf - logs message with task fields at error level
+func (l *Logger) Errorf(format string, args ...interface{}) (n int, err error) {
+	return logf(l, LogLevelError, true, format, args...)
+}
+
+// LogEntry - returns structured log entry for a given message
+func LogEntry(ctx *Ctx, l *Logger, level, msg string, dt time.Time) EsLogPayload {
+	entry := EsLogPayload{
+		Msg:     msg,
+		Dt:      dt,
+		Level:   level,
+		NodeIdx: ctx.NodeIdx,
+		RunID:   ctx.RunID,
+		Phase:   CurrentPhase(),
+	}
+	if l != nil {
+		idx := l.TaskIdx
+		entry.Fixture = l.Fixture
+		entry.DataSource = l.DataSource
+		entry.Endpoint = l.Endpoint
+		entry.TaskIdx = &idx
 	}
+	return entry
+}
 
-	// Actual logging to stdout & DB
-	now := time.Now()
-	var msg string
-	if logCtx.LogTime {
-		msg = fmt.Sprintf("%s: "+format, append([]interface{}{ToYMDHMSDate(now)}, args...)...)
-	} else {
-		msg = fmt.Sprintf(format, args...)
+// LogText - returns text log line for a given structured log entry and message: "[time ]level [run node phase][ fixture/data_source endpoint#task_idx]: msg"
+func LogText(entry EsLogPayload, msg string, logTime bool) string {
+	prefix := ""
+	if logTime {
+		prefix = ToYMDHMSDate(entry.Dt) + " "
 	}
-	msg = FilterRedacted(msg)
-	n, err = fmt.Printf("%s", msg)
-	if logCtx.SkipEsLog {
-		return
+	prefix += fmt.Sprintf("%s [%s %d %s]", entry.Level, entry.RunID, entry.NodeIdx, entry.Phase)
+	if entry.TaskIdx != nil {
+		prefix += fmt.Sprintf(" %s/%s %s#%d", entry.Fixture, entry.DataSource, entry.Endpoint, *entry.TaskIdx)
 	}
-	err = EsLog(logCtx, msg, now)
-	return
+	return prefix + ": " + msg
 }
 
-// PrintLogf is a wrapper around Printf(...) that supports logging.
-func PrintLogf(format string, args ...interface{}) (err error) {
+// logf - logs message to stdout (when stdout is set) and to "sdslog" index (unless SDS_SKIP_ES_LOG is set)
+func logf(l *Logger, level string, stdout bool, format string, args ...interface{}) (n int, err error) {
 	// Initialize context once
 	logOnce.Do(func() { logCtx = newLogContext() })
 	if logCtx == nil {
-		_, err = fmt.Printf(format, args...)
-		return
+		return fmt.Printf(format, args...)
 	}
-	if logCtx.SkipEsLog {
+	if !stdout && logCtx.SkipEsLog {
 		return
 	}
 
 	// Actual logging to stdout & DB
 	now := time.Now()
-	var msg string
+	rawMsg := FilterRedacted(fmt.Sprintf(format, args...))
+	msg := rawMsg
 	if logCtx.LogTime {
-		msg = fmt.Sprintf("%s: "+format, append([]interface{}{ToYMDHMSDate(now)}, args...)...)
-	} else {
-		msg = fmt.Sprintf(format, args...)
+		msg = ToYMDHMSDate(now) + ": " + rawMsg
+	}
+	entry := LogEntry(logCtx, l, level, msg, now)
+	if stdout {
+		if logCtx.LogFormat == LogFormatJSON {
+			jsonEntry := entry
+			jsonEntry.Msg = strings.TrimRight(rawMsg, "\n")
+			data, e := jsoniter.Marshal(jsonEntry)
+			if e != nil {
+				n, err = fmt.Printf("%s", msg)
+			} else {
+				n, err = fmt.Printf("%s\n", data)
+			}
+		} else {
+			n, err = fmt.Printf("%s", LogText(entry, rawMsg, logCtx.LogTime))
+		}
+	}
+	if logCtx.SkipEsLog {
+		return
 	}
-	msg = FilterRedacted(msg)
-	err = EsLog(logCtx, msg, now)
+	shipLog(logCtx, entry)
 	return
 }
@@ -0,0 +1,88 @@
+package syncdatasources
+
+import (
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestLogEntry(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	ctx.NodeIdx = 2
+	ctx.RunID = "20201019120000-2-123"
+	lib.SetPhase(&ctx, lib.PhaseTasks)
+	dt := time.Date(2020, 10, 19, 12, 0, 0, 0, time.UTC)
+	// Test cases
+	var testCases = []struct {
+		logger   *lib.Logger
+		level    string
+		expected string
+	}{
+		{
+			logger:   nil,
+			level:    lib.LogLevelInfo,
+			expected: `{"msg":"hello","dt":"2020-10-19T12:00:00Z","level":"info","node_idx":2,"run_id":"20201019120000-2-123","phase":"tasks"}`,
+		},
+		{
+			logger:   lib.TaskLogger(0, "onap", "git", "https://gerrit.onap.org/r/aai"),
+			level:    lib.LogLevelError,
+			expected: `{"msg":"hello","dt":"2020-10-19T12:00:00Z","level":"error","node_idx":2,"run_id":"20201019120000-2-123","phase":"tasks","fixture":"onap","data_source":"git","endpoint":"https://gerrit.onap.org/r/aai","task_idx":0}`,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		entry := lib.LogEntry(&ctx, test.logger, test.level, "hello", dt)
+		data, err := jsoniter.Marshal(entry)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %+v", index+1, err)
+			continue
+		}
+		if string(data) != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, test.expected, string(data))
+		}
+	}
+	lib.SetPhase(&ctx, lib.PhaseStartup)
+}
+
+func TestLogText(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	ctx.NodeIdx = 1
+	ctx.RunID = "20201019120000-1-123"
+	lib.SetPhase(&ctx, lib.PhaseTasks)
+	dt := time.Date(2020, 10, 19, 12, 0, 0, 0, time.UTC)
+	// Test cases
+	var testCases = []struct {
+		logger   *lib.Logger
+		level    string
+		logTime  bool
+		expected string
+	}{
+		{
+			logger:   nil,
+			level:    lib.LogLevelInfo,
+			logTime:  true,
+			expected: "2020-10-19 12:00:00 info [20201019120000-1-123 1 tasks]: hello\n",
+		},
+		{
+			logger:   lib.TaskLogger(3, "onap", "git", "https://gerrit.onap.org/r/aai"),
+			level:    lib.LogLevelWarning,
+			logTime:  false,
+			expected: "warning [20201019120000-1-123 1 tasks] onap/git https://gerrit.onap.org/r/aai#3: hello\n",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		entry := lib.LogEntry(&ctx, test.logger, test.level, "hello\n", dt)
+		got := lib.LogText(entry, "hello\n", test.logTime)
+		if got != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, test.expected, got)
+		}
+	}
+	lib.SetPhase(&ctx, lib.PhaseStartup)
+}
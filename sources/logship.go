@@ -0,0 +1,306 @@
+package syncdatasources
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// logFlushTimeout - maximum time to wait for buffered logs to be shipped when flushing
+const logFlushTimeout = time.Duration(30) * time.Second
+
+// logShipper - asynchronous, buffered "sdslog" index shipper
+// Log entries are queued on a buffered channel (sending blocks when it is full, which applies backpressure
+// to logging goroutines), and sent in batches using ES bulk API
+// Entries that cannot be sent (ES unavailable, rejected bulk) are appended to a local spill file
+// and reshipped once ES accepts data again
+// When ES is unavailable batches go straight to the spill file, ES is probed (with a short timeout) on every flush interval
+// and bulk requests are only sent again after a successful probe
+type logShipper struct {
+	ctx       *Ctx
+	ch        chan EsLogPayload
+	flush     chan chan struct{}
+	spillFile string
+	esOK      bool
+}
+
+var (
+	gLogShipper     *logShipper
+	gLogShipperOnce sync.Once
+	// logShipClient - bulk requests to a hung ES fail after timeout, so entries are spilled instead of blocking the shipper
+	logShipClient = &http.Client{Timeout: time.Duration(60) * time.Second}
+	// logProbeClient - checks if ES is available again, must not stall the shipper for long
+	logProbeClient = &http.Client{Timeout: time.Duration(5) * time.Second}
+)
+
+// LogSpillFile - returns file used to spill logs that cannot be shipped to ES
+func LogSpillFile(ctx *Ctx) string {
+	if ctx.LogSpillFile != "" {
+		return ctx.LogSpillFile
+	}
+	return fmt.Sprintf("%s_sdslog_%d_%d.ndjson", ctx.CSVPrefix, ctx.NodeIdx, ctx.NodeNum)
+}
+
+// shipLog - queues log entry for shipping to "sdslog" index, starts the shipper on first call
+func shipLog(ctx *Ctx, entry EsLogPayload) {
+	gLogShipperOnce.Do(func() {
+		gLogShipper = &logShipper{
+			ctx:       ctx,
+			ch:        make(chan EsLogPayload, ctx.LogBufferSize),
+			flush:     make(chan chan struct{}),
+			spillFile: LogSpillFile(ctx),
+			esOK:      true,
+		}
+		go gLogShipper.run()
+	})
+	gLogShipper.ch <- entry
+}
+
+// FlushLogs - ships all buffered log entries to ES (or spill file), waits up to 30s
+// Should be called before exiting the program
+func FlushLogs() {
+	if gLogShipper == nil {
+		return
+	}
+	ack := make(chan struct{})
+	select {
+	case gLogShipper.flush <- ack:
+	case <-time.After(logFlushTimeout):
+		PrintfRedacted("Timeout waiting for log shipper to accept flush request\n")
+		return
+	}
+	select {
+	case <-ack:
+	case <-time.After(logFlushTimeout):
+		PrintfRedacted("Timeout waiting for log shipper to flush logs\n")
+	}
+}
+
+func (s *logShipper) run() {
+	batch := []EsLogPayload{}
+	ticker := time.NewTicker(s.ctx.LogFlushInterval)
+	defer func() {
+		ticker.Stop()
+	}()
+	add := func(entry EsLogPayload) {
+		batch = append(batch, entry)
+		if len(batch) >= s.ctx.LogBatchSize {
+			s.ship(batch)
+			batch = []EsLogPayload{}
+		}
+	}
+	send := func() {
+		if !s.esOK {
+			s.esOK = EsLogProbe(s.ctx)
+		}
+		if len(batch) > 0 {
+			s.ship(batch)
+			batch = []EsLogPayload{}
+		}
+		s.reship()
+	}
+	for {
+		select {
+		case entry := <-s.ch:
+			add(entry)
+		case <-ticker.C:
+			send()
+		case ack := <-s.flush:
+			drained := false
+			for !drained {
+				select {
+				case entry := <-s.ch:
+					add(entry)
+				default:
+					drained = true
+				}
+			}
+			send()
+			close(ack)
+		}
+	}
+}
+
+// ship - sends batch to ES, spills entries that can be retried later
+// When ES is known to be unavailable, batch is spilled without trying to send it
+func (s *logShipper) ship(batch []EsLogPayload) {
+	if !s.esOK {
+		s.spill(batch)
+		return
+	}
+	failed, err := EsBulkLog(s.ctx, batch)
+	if err != nil && len(failed) > 0 {
+		// ES is unavailable, stop sending until it is probed successfully
+		s.esOK = false
+	}
+	if len(failed) > 0 {
+		s.spill(failed)
+	}
+}
+
+// spill - appends entries to the spill file
+func (s *logShipper) spill(entries []EsLogPayload) {
+	file, err := os.OpenFile(s.spillFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		PrintfRedacted("Cannot open log spill file %s: %+v, %d log entries lost\n", s.spillFile, err, len(entries))
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	w := bufio.NewWriter(file)
+	for _, entry := range entries {
+		data, err := jsoniter.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		_, _ = w.Write(append(data, '\n'))
+	}
+	err = w.Flush()
+	if err != nil {
+		PrintfRedacted("Cannot write log spill file %s: %+v\n", s.spillFile, err)
+	}
+}
+
+// reship - when ES is available, ships entries from the spill file
+func (s *logShipper) reship() {
+	if !s.esOK {
+		return
+	}
+	data, err := ioutil.ReadFile(s.spillFile)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	// Remove spill file first, entries that fail again will be spilled into a new one
+	err = os.Remove(s.spillFile)
+	if err != nil {
+		PrintfRedacted("Cannot remove log spill file %s: %+v\n", s.spillFile, err)
+		return
+	}
+	entries := []EsLogPayload{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry EsLogPayload
+		if jsoniter.Unmarshal(line, &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	for from := 0; from < len(entries); from += s.ctx.LogBatchSize {
+		to := from + s.ctx.LogBatchSize
+		if to > len(entries) {
+			to = len(entries)
+		}
+		failed, err := EsBulkLog(s.ctx, entries[from:to])
+		if err != nil {
+			// ES is unavailable again, spill all remaining entries
+			s.esOK = false
+			s.spill(append(failed, entries[to:]...))
+			return
+		}
+		if len(failed) > 0 {
+			s.spill(failed)
+		}
+	}
+}
+
+// EsLogProbe - checks if "sdslog" index is available (uses short timeout)
+func EsLogProbe(ctx *Ctx) bool {
+	url := fmt.Sprintf("%s/sdslog", ctx.ElasticURL)
+	req, err := http.NewRequest(Head, os.ExpandEnv(url), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := logProbeClient.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == 200
+}
+
+// EsBulkLog - sends log entries to "sdslog" index using ES bulk API
+// Returns entries that failed and can be retried later (ES unavailable, 429 or 5xx statuses)
+// Entries rejected for other reasons (like mapping errors) are dropped
+func EsBulkLog(ctx *Ctx, entries []EsLogPayload) (failed []EsLogPayload, err error) {
+	index := "sdslog"
+	sent := []EsLogPayload{}
+	payload := []byte{}
+	for _, entry := range entries {
+		data, e := jsoniter.Marshal(entry)
+		if e != nil {
+			PrintfRedacted("JSON marshall error: %+v for index: %s, data: %+v\n", e, index, entry)
+			continue
+		}
+		payload = append(payload, []byte("{\"index\":{}}\n")...)
+		payload = append(payload, data...)
+		payload = append(payload, '\n')
+		sent = append(sent, entry)
+	}
+	if len(sent) == 0 {
+		return
+	}
+	method := Post
+	url := fmt.Sprintf("%s/%s/_bulk", ctx.ElasticURL, index)
+	rurl := fmt.Sprintf("/%s/_bulk", index)
+	req, err := http.NewRequest(method, os.ExpandEnv(url), bytes.NewReader(payload))
+	if err != nil {
+		PrintfRedacted("New request error: %+v for %s url: %s\n", err, method, rurl)
+		failed = sent
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := logShipClient.Do(req)
+	if err != nil {
+		PrintfRedacted("Do request error: %+v for %s url: %s\n", err, method, rurl)
+		failed = sent
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		PrintfRedacted("ReadAll request error: %+v for %s url: %s\n", err, method, rurl)
+		failed = sent
+		return
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", method, rurl, resp.StatusCode, body)
+		PrintfRedacted("%s\n", err.Error())
+		if resp.StatusCode == 429 || resp.StatusCode >= 500 {
+			failed = sent
+		}
+		return
+	}
+	esResult := EsBulkResult{}
+	err = jsoniter.Unmarshal(body, &esResult)
+	if err != nil {
+		PrintfRedacted("Bulk result unmarshal error: %+v for %s url: %s\n", err, method, rurl)
+		return
+	}
+	dropped := 0
+	for i, item := range esResult.Items {
+		if i >= len(sent) {
+			break
+		}
+		status := item.Index.Status
+		if status == 429 || status >= 500 {
+			failed = append(failed, sent[i])
+		} else if status >= 300 {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		PrintfRedacted("%d log entries rejected by %s url: %s\n", dropped, method, rurl)
+	}
+	return
+}
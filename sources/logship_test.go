@@ -0,0 +1,124 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestEsBulkLog(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	entries := []lib.EsLogPayload{
+		{Msg: "first", Dt: time.Now()},
+		{Msg: "second", Dt: time.Now()},
+		{Msg: "third", Dt: time.Now()},
+	}
+	// Test cases
+	var testCases = []struct {
+		status   int
+		response string
+		failed   []string
+		err      bool
+	}{
+		{status: 200, response: `{"items":[{"index":{"status":201}},{"index":{"status":201}},{"index":{"status":201}}]}`, failed: []string{}},
+		{status: 200, response: `{"items":[{"index":{"status":201}},{"index":{"status":429}},{"index":{"status":400}}]}`, failed: []string{"second"}},
+		{status: 503, response: `unavailable`, failed: []string{"first", "second", "third"}, err: true},
+		{status: 400, response: `bad request`, failed: []string{}, err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		lines := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			lines = strings.Count(string(body), "\n")
+			if req.URL.Path != "/sdslog/_bulk" {
+				w.WriteHeader(404)
+				return
+			}
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.response)
+		}))
+		ctx.ElasticURL = server.URL
+		failed, err := lib.EsBulkLog(&ctx, entries)
+		server.Close()
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %+v", index+1, test.err, err)
+		}
+		if lines != 2*len(entries) {
+			t.Errorf("test number %d, expected %d bulk lines, got %d", index+1, 2*len(entries), lines)
+		}
+		got := []string{}
+		for _, entry := range failed {
+			got = append(got, entry.Msg)
+		}
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", test.failed) {
+			t.Errorf("test number %d, expected failed %v, got %v", index+1, test.failed, got)
+		}
+	}
+	// ES not available at all
+	ctx.ElasticURL = "http://127.0.0.1:1"
+	failed, err := lib.EsBulkLog(&ctx, entries)
+	if err == nil || len(failed) != len(entries) {
+		t.Errorf("expected all entries to fail when ES is not available, got %d, %+v", len(failed), err)
+	}
+}
+
+func TestEsLogProbe(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	// Test cases
+	var testCases = []struct {
+		status   int
+		expected bool
+	}{
+		{status: 200, expected: true},
+		{status: 404, expected: false},
+		{status: 503, expected: false},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != lib.Head || req.URL.Path != "/sdslog" {
+				w.WriteHeader(400)
+				return
+			}
+			w.WriteHeader(test.status)
+		}))
+		ctx.ElasticURL = server.URL
+		got := lib.EsLogProbe(&ctx)
+		server.Close()
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+	// ES not available at all
+	ctx.ElasticURL = "http://127.0.0.1:1"
+	if lib.EsLogProbe(&ctx) {
+		t.Errorf("expected probe to fail when ES is not available")
+	}
+}
+
+func TestLogSpillFile(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	ctx.CSVPrefix = "/root/jobs/sds-main"
+	ctx.NodeIdx = 1
+	ctx.NodeNum = 2
+	if got := lib.LogSpillFile(&ctx); got != "/root/jobs/sds-main_sdslog_1_2.ndjson" {
+		t.Errorf("unexpected default spill file: %s", got)
+	}
+	ctx.LogSpillFile = "/tmp/spill.ndjson"
+	if got := lib.LogSpillFile(&ctx); got != "/tmp/spill.ndjson" {
+		t.Errorf("unexpected spill file: %s", got)
+	}
+}
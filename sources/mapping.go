@@ -0,0 +1,273 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// migrationSuffix - suffix of a temporary index used when migrating SDS-owned index to its explicit mapping
+const migrationSuffix string = "-sds-migration"
+
+// gTemplatesOnce - index templates are installed once per process, by the first EnsureIndex call
+var gTemplatesOnce sync.Once
+
+// reportPhaseMapping - mapping of a single task phase in "sdsruns" index
+const reportPhaseMapping string = `{"properties":{"outcome":{"type":"keyword"},"code":{"type":"integer"},"error":{"type":"text"},` +
+	`"error_class":{"type":"keyword"},"retries":{"type":"integer"},"duration_seconds":{"type":"float"}}}`
+
+// reportSummaryMapping - mapping of per data source/fixture summaries in "sdsruns" index
+const reportSummaryMapping string = `{"properties":{"name":{"type":"keyword"},"tasks":{"type":"integer"},` +
+	`"processed":{"type":"integer"},"failed":{"type":"integer"}}}`
+
+// esMapping - index mapping properties (only field types are used)
+type esMapping struct {
+	Properties map[string]struct {
+		Type string `json:"type"`
+	} `json:"properties"`
+}
+
+// SDSIndexes - returns names of all SDS-owned indexes that have explicit mappings
+func SDSIndexes() (indexes []string) {
+	for index := range SDSMappings {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	return
+}
+
+// lifecycleSettings - returns dated "sdslog" indexes settings that attach them to the lifecycle policy
+func lifecycleSettings(engine string) string {
+	switch engine {
+	case LifecycleILM:
+		return fmt.Sprintf(`"index.lifecycle.name":"%s","index.lifecycle.rollover_alias":"%s"`, LogLifecyclePolicy, SDSLog)
+	case LifecycleISM:
+		return fmt.Sprintf(`"plugins.index_state_management.rollover_alias":"%s"`, SDSLog)
+	case LifecycleODISM:
+		return fmt.Sprintf(`"opendistro.index_state_management.rollover_alias":"%s"`, SDSLog)
+	}
+	return ""
+}
+
+// PutIndexTemplate - installs index template with explicit mapping for a given SDS-owned index
+// With SDS_LOG_ROLLOVER, "sdslog" template matches dated indexes and attaches them to ILM/ISM policy (when available)
+func PutIndexTemplate(ctx *Ctx, printf func(string, ...interface{}) (int, error), index string) bool {
+	mapping, ok := SDSMappings[index]
+	if !ok {
+		return false
+	}
+	pattern, settings := index, ""
+	if index == SDSLog && ctx.LogRollover {
+		pattern = SDSLog + "-*"
+		engine := LifecycleEngine(ctx, printf)
+		if engine != "" && putLifecyclePolicy(ctx, printf, engine) {
+			settings = lifecycleSettings(engine)
+		}
+	}
+	path := "/_template/" + index
+	data := fmt.Sprintf(`{"index_patterns":["%s"],"settings":{%s},"mappings":%s}`, pattern, settings, mapping)
+	status, body, err := esRequest(ctx, printf, Put, path, data)
+	if err != nil {
+		return false
+	}
+	if status != 200 {
+		printf("Method:%s url:%s status:%d\n%s\n", Put, path, status, body)
+		return false
+	}
+	return true
+}
+
+// PutIndexTemplates - installs index templates of all SDS-owned indexes, returns false when any of them failed
+func PutIndexTemplates(ctx *Ctx, printf func(string, ...interface{}) (int, error)) bool {
+	ok := true
+	for _, index := range SDSIndexes() {
+		if !PutIndexTemplate(ctx, printf, index) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// MappingMismatches - returns fields of a given SDS-owned index whose actual type differs from its explicit mapping
+// Fields that are not mapped yet are not reported, exists is false when there is no such index
+func MappingMismatches(ctx *Ctx, index string) (mismatches []string, exists bool, err error) {
+	var expected esMapping
+	err = jsoniter.Unmarshal([]byte(SDSMappings[index]), &expected)
+	if err != nil {
+		return
+	}
+	path := "/" + index + "/_mapping"
+	status, body, err := esRequest(ctx, Printf, Get, path, "")
+	if err != nil || status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, path, status, body)
+		return
+	}
+	exists = true
+	var actual map[string]struct {
+		Mappings esMapping `json:"mappings"`
+	}
+	err = jsoniter.Unmarshal(body, &actual)
+	if err != nil {
+		return
+	}
+	for concrete, mapping := range actual {
+		for field, prop := range expected.Properties {
+			act, ok := mapping.Mappings.Properties[field]
+			if ok && act.Type != prop.Type {
+				mismatches = append(mismatches, fmt.Sprintf("%s: %s should be %s, is '%s'", concrete, field, prop.Type, act.Type))
+			}
+		}
+	}
+	sort.Strings(mismatches)
+	return
+}
+
+// indexExists - checks if given index (or alias) exists
+func indexExists(ctx *Ctx, index string) (bool, error) {
+	status, body, err := esRequest(ctx, Printf, Head, "/"+index, "")
+	if err != nil {
+		return false, err
+	}
+	if status != 200 && status != 404 {
+		return false, fmt.Errorf("Method:%s url:/%s status:%d\n%s", Head, index, status, body)
+	}
+	return status == 200, nil
+}
+
+// deleteIndex - deletes given index
+func deleteIndex(ctx *Ctx, index string) error {
+	status, body, err := esRequest(ctx, Printf, Delete, "/"+index, "")
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("Method:%s url:/%s status:%d\n%s", Delete, index, status, body)
+	}
+	return nil
+}
+
+// reindex - copies all documents from one index to another and checks that none were lost
+func reindex(ctx *Ctx, from, to string) error {
+	total, err := countDocs(ctx, from, `{"match_all":{}}`)
+	if err != nil {
+		return err
+	}
+	path := "/_reindex?refresh=true&wait_for_completion=true"
+	data := fmt.Sprintf(`{"source":{"index":"%s"},"dest":{"index":"%s"}}`, from, to)
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+	}
+	var result struct {
+		Failures []interface{} `json:"failures"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		return err
+	}
+	if len(result.Failures) > 0 {
+		return fmt.Errorf("reindexing %s into %s failed: %+v", from, to, result.Failures)
+	}
+	copied, err := countDocs(ctx, to, `{"match_all":{}}`)
+	if err != nil {
+		return err
+	}
+	if copied != total {
+		return fmt.Errorf("reindexing %s into %s copied %d out of %d documents", from, to, copied, total)
+	}
+	return nil
+}
+
+// MigrateIndex - reindexes existing SDS-owned index into its explicit mapping
+// Documents are copied into a temporary index, then the index is recreated (with explicit mapping or as dated indexes
+// behind "sdslog" alias when SDS_LOG_ROLLOVER is set) and documents are copied back
+// Temporary index is only removed when all documents were copied back, so it keeps data when migration fails
+// Should be run when SDS is not running, otherwise it can create or write to the index while it is being migrated
+func MigrateIndex(ctx *Ctx, index string) (migrated bool, err error) {
+	_, ok := SDSMappings[index]
+	if !ok {
+		err = fmt.Errorf("%s is not an SDS-owned index, known indexes are: %v", index, SDSIndexes())
+		return
+	}
+	if isAlias(ctx, index) {
+		// Dated indexes get explicit mapping from index template, older ones are removed by retention
+		Printf("%s is an alias, nothing to migrate\n", index)
+		return
+	}
+	mismatches, exists, err := MappingMismatches(ctx, index)
+	if err != nil || !exists {
+		return
+	}
+	toRollover := index == SDSLog && ctx.LogRollover
+	if len(mismatches) == 0 && !toRollover {
+		Printf("%s mapping is up to date\n", index)
+		return
+	}
+	for _, mismatch := range mismatches {
+		Printf("%s mapping mismatch: %s\n", index, mismatch)
+	}
+	if toRollover {
+		Printf("%s will be migrated to dated indexes behind %s write alias\n", index, index)
+	}
+	if ctx.DryRun {
+		Printf("Would migrate %s (dry run)\n", index)
+		return
+	}
+	tmp := index + migrationSuffix
+	tmpExists, err := indexExists(ctx, tmp)
+	if err != nil {
+		return
+	}
+	if tmpExists {
+		err = fmt.Errorf("temporary index %s already exists, previous migration may have failed, check its data and delete it", tmp)
+		return
+	}
+	path := "/" + tmp
+	status, body, err := esRequest(ctx, Printf, Put, path, `{"mappings":`+SDSMappings[index]+`}`)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Put, path, status, body)
+		return
+	}
+	start := time.Now()
+	err = reindex(ctx, index, tmp)
+	if err != nil {
+		return
+	}
+	err = deleteIndex(ctx, index)
+	if err != nil {
+		return
+	}
+	EnsureIndex(ctx, index, false)
+	recreated, err := indexExists(ctx, index)
+	if err != nil {
+		return
+	}
+	if !recreated {
+		err = fmt.Errorf("cannot recreate %s index, its data is kept in %s", index, tmp)
+		return
+	}
+	err = reindex(ctx, tmp, index)
+	if err != nil {
+		err = fmt.Errorf("%v, %s data is kept in %s", err, index, tmp)
+		return
+	}
+	err = deleteIndex(ctx, tmp)
+	if err != nil {
+		return
+	}
+	migrated = true
+	Printf("%s migrated in %v\n", index, time.Since(start))
+	return
+}
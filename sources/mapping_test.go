@@ -0,0 +1,91 @@
+package syncdatasources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestSDSMappings(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		index   string
+		payload interface{}
+	}{
+		{index: lib.SDSLog, payload: lib.EsLogPayload{}},
+		{index: lib.SDSData, payload: lib.EsLastRunPayload{}},
+		{index: lib.SDSMtx, payload: lib.EsMtxPayload{}},
+		{index: lib.SDSSyncInfo, payload: lib.EsSyncInfoPayload{}},
+		{index: lib.SDSRuns, payload: lib.RunReport{}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var mapping struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+		}
+		err := jsoniter.Unmarshal([]byte(lib.SDSMappings[test.index]), &mapping)
+		if err != nil {
+			t.Errorf("test number %d, invalid %s mapping: %+v", index+1, test.index, err)
+			continue
+		}
+		// Every payload field must have explicit mapping
+		typ := reflect.TypeOf(test.payload)
+		for i := 0; i < typ.NumField(); i++ {
+			field := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			_, ok := mapping.Properties[field]
+			if !ok {
+				t.Errorf("test number %d, %s mapping has no '%s' field", index+1, test.index, field)
+			}
+		}
+	}
+	if len(lib.SDSIndexes()) != len(testCases) {
+		t.Errorf("expected %d SDS indexes, got %v", len(testCases), lib.SDSIndexes())
+	}
+}
+
+func TestMappingMismatches(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		status     int
+		response   string
+		mismatches []string
+		exists     bool
+	}{
+		{status: 404, response: `{}`, exists: false},
+		{
+			status:   200,
+			response: `{"sdsdata":{"mappings":{"properties":{"index":{"type":"keyword"},"dt":{"type":"date"}}}}}`,
+			exists:   true,
+		},
+		{
+			status:     200,
+			response:   `{"sdsdata":{"mappings":{"properties":{"index":{"type":"text","fields":{"keyword":{"type":"keyword"}}},"dt":{"type":"date"},"type":{"type":"text"}}}}}`,
+			mismatches: []string{"sdsdata: index should be keyword, is 'text'", "sdsdata: type should be keyword, is 'text'"},
+			exists:     true,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(test.status)
+			_, _ = w.Write([]byte(test.response))
+		}))
+		ctx := lib.Ctx{ElasticURL: srv.URL}
+		mismatches, exists, err := lib.MappingMismatches(&ctx, lib.SDSData)
+		srv.Close()
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %+v", index+1, err)
+			continue
+		}
+		if exists != test.exists || !reflect.DeepEqual(mismatches, test.mismatches) {
+			t.Errorf("test number %d, expected %v/%v, got %v/%v", index+1, test.mismatches, test.exists, mismatches, exists)
+		}
+	}
+}
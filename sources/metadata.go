@@ -0,0 +1,517 @@
+package syncdatasources
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// MetadataStateType - "type" of working group metadata state documents in "sdsdata" index
+const MetadataStateType string = "metadata"
+
+// MetadataSinceField - when working group config and matched indices did not change, only documents enriched since the last apply are updated
+const MetadataSinceField string = "metadata__enriched_on"
+
+// MetadataFormedField - documents older than working group formed/contributed date (compared using this field) are deleted
+const MetadataFormedField string = "metadata__updated_on"
+
+// WorkingGroupField - document field holding working group name
+const WorkingGroupField string = "workinggroup"
+
+// metadataCleanupChunk - number of indices cleaned up in a single request
+const metadataCleanupChunk int = 50
+
+// metadataScript - sets working group fields, removes fields working group no longer sets first
+const metadataScript string = "for (f in params.remove) {ctx._source.remove(f)} " +
+	"for (e in params.fields.entrySet()) {ctx._source[e.getKey()]=e.getValue()}"
+
+// metadataNoOverwriteScript - sets working group fields only when document has no such fields yet
+const metadataNoOverwriteScript string = "for (f in params.remove) {ctx._source.remove(f)} " +
+	"for (e in params.fields.entrySet()) {if (!ctx._source.containsKey(e.getKey())) {ctx._source[e.getKey()]=e.getValue()}}"
+
+// metadataCleanupScript - removes working group fields from documents of that working group
+const metadataCleanupScript string = "if (ctx._source.workinggroup == params.name) {for (f in params.fields) {ctx._source.remove(f)}} else {ctx.op='noop'}"
+
+// MetadataState - state of working group metadata stored in "sdsdata" index: index is fixture slug, endpoint is working group name
+// Hash covers working group config and indices it matched, Fields and Indices allow cleaning up when config changes
+type MetadataState struct {
+	Index    string    `json:"index"`
+	Endpoint string    `json:"endpoint"`
+	Type     string    `json:"type"`
+	Dt       time.Time `json:"dt"`
+	Hash     string    `json:"hash"`
+	Indices  []string  `json:"indices"`
+	Fields   []string  `json:"fields"`
+}
+
+// MetadataQuery - single working group metadata operation (_update_by_query or _delete_by_query) on comma separated indices/patterns
+type MetadataQuery struct {
+	Op      string
+	Indices string
+	Query   string
+}
+
+// metadataTarget - indices/patterns and origin matching configured for a metadata data source
+type metadataTarget struct {
+	dest   []string
+	field  string
+	prefix string
+}
+
+// metadataCond - documents working group metadata applies to in given indices (origins and/or filter)
+type metadataCond struct {
+	dest   []string
+	should []string
+	filter string
+}
+
+// MetadataGroup - working group metadata to apply: fields to set and where
+type MetadataGroup struct {
+	Fixture     string
+	Name        string
+	NoOverwrite bool
+	Values      [][2]string
+	Formed      string
+	conds       []metadataCond
+}
+
+// metadataTargets - returns indices/patterns (data and external) and origin matching for metadata data sources
+func metadataTargets(m *Metadata) (targets map[string]metadataTarget) {
+	targets = make(map[string]metadataTarget)
+	for _, ds := range m.DataSources {
+		target := metadataTarget{field: ds.OriginField, prefix: ds.OriginPrefix}
+		if target.field == "" {
+			target.field = "origin"
+			if ds.Name == "mbox" {
+				target.field = "group_name"
+				if target.prefix == "" {
+					target.prefix = "finos.org/"
+				}
+			}
+		}
+		valid := true
+		for i, items := range [][]string{ds.Slugs, ds.Externals} {
+			hasIndices := false
+			hasPatterns := false
+			dest := []string{}
+			for _, item := range items {
+				if strings.HasPrefix(item, "pattern:") {
+					dest = append(dest, item[8:])
+					hasPatterns = true
+					continue
+				}
+				if i == 0 {
+					item = "sds-" + item
+				}
+				dest = append(dest, strings.Replace(item, "/", "-", -1))
+				hasIndices = true
+			}
+			if hasIndices && hasPatterns {
+				Printf("WARNING: incorrect metadata datasources '%s' section, you cannot have both index names and patterns: %+v\n", ds.Name, ds)
+				valid = false
+				break
+			}
+			if len(dest) > 0 {
+				target.dest = append(target.dest, strings.Join(dest, ","))
+			}
+		}
+		if valid {
+			targets[ds.Name] = target
+		}
+	}
+	return
+}
+
+// FixtureMetadataGroups - returns working groups metadata configured in fixture
+func FixtureMetadataGroups(fixture *Fixture) (groups []MetadataGroup) {
+	m := &fixture.Metadata
+	if len(m.DataSources) == 0 || len(m.WorkingGroups) == 0 {
+		return
+	}
+	targets := metadataTargets(m)
+	for _, wg := range m.WorkingGroups {
+		if len(wg.DataSources) == 0 {
+			continue
+		}
+		group := MetadataGroup{Fixture: fixture.Slug, Name: wg.Name, NoOverwrite: wg.NoOverwrite}
+		values := map[string]string{WorkingGroupField: wg.Name}
+		formed := ""
+		for k, v := range wg.Meta {
+			values["meta_"+k] = v
+			lk := strings.ToLower(k)
+			if formed == "" && (lk == "formed" || lk == "contributed") {
+				formed = v
+			}
+		}
+		if formed != "" {
+			_, err := time.Parse("2006-01-02", formed)
+			if err != nil {
+				Printf("cannot parse formed/contributed date: '%s': %v, from %+v\n", formed, err, wg.Meta)
+			} else {
+				group.Formed = formed
+			}
+		}
+		for k, v := range values {
+			group.Values = append(group.Values, [2]string{k, v})
+		}
+		sort.Slice(group.Values, func(i, j int) bool {
+			return group.Values[i][0] < group.Values[j][0]
+		})
+		for _, ds := range wg.DataSources {
+			target, ok := targets[ds.Name]
+			if !ok {
+				Printf("WARNING: working group data source '%s' not found in metadata data sources: '%+v'\n", ds.Name, wg)
+				continue
+			}
+			if len(ds.Filter) == 0 && len(ds.Origins) == 0 {
+				Printf("WARNING: working group data source '%s' has no origins and no filter, skipping: '%+v'\n", ds.Name, wg)
+				continue
+			}
+			cond := metadataCond{dest: target.dest}
+			for _, origin := range ds.Origins {
+				cond.should = append(cond.should, fmt.Sprintf(`{"term":{"%s":"%s"}}`, jsonEscape(target.field), jsonEscape(target.prefix+origin)))
+			}
+			if len(ds.Filter) > 0 {
+				cond.filter = canonicalJSON(ds.Filter)
+			}
+			group.conds = append(group.conds, cond)
+		}
+		if len(group.conds) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return
+}
+
+// Fields - returns fields set by working group
+func (g *MetadataGroup) Fields() (fields []string) {
+	for _, value := range g.Values {
+		fields = append(fields, value[0])
+	}
+	return
+}
+
+// Targets - returns all indices/patterns working group metadata is applied to
+func (g *MetadataGroup) Targets() (targets []string) {
+	m := make(map[string]struct{})
+	for _, cond := range g.conds {
+		for _, dest := range cond.dest {
+			for _, target := range strings.Split(dest, ",") {
+				m[target] = struct{}{}
+			}
+		}
+	}
+	for target := range m {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return
+}
+
+// stringsJSON - returns JSON array of strings
+func stringsJSON(items []string) string {
+	quoted := []string{}
+	for _, item := range items {
+		quoted = append(quoted, `"`+jsonEscape(item)+`"`)
+	}
+	return "[" + strings.Join(quoted, ",") + "]"
+}
+
+// Queries - returns working group metadata operations, since limits them to documents enriched since then
+// Fields from remove are removed from working group documents (fields that working group no longer sets)
+func (g *MetadataGroup) Queries(since time.Time, remove []string) (queries []MetadataQuery) {
+	fields := []string{}
+	for _, value := range g.Values {
+		v := "null"
+		if value[1] != Null {
+			v = `"` + jsonEscape(value[1]) + `"`
+		}
+		fields = append(fields, `"`+jsonEscape(value[0])+`":`+v)
+	}
+	script := metadataScript
+	if g.NoOverwrite {
+		script = metadataNoOverwriteScript
+	}
+	update := fmt.Sprintf(
+		`{"script":{"source":"%s","lang":"painless","params":{"fields":{%s},"remove":%s}},"query":`,
+		jsonEscape(script),
+		strings.Join(fields, ","),
+		stringsJSON(remove),
+	)
+	for _, cond := range g.conds {
+		query := func(must []string) string {
+			if !since.IsZero() {
+				must = append(must, fmt.Sprintf(`{"range":{"%s":{"gte":"%s"}}}`, MetadataSinceField, since.UTC().Format(time.RFC3339)))
+			}
+			parts := []string{}
+			if len(must) > 0 {
+				parts = append(parts, `"must":[`+strings.Join(must, ",")+`]`)
+			}
+			if len(cond.should) > 0 {
+				parts = append(parts, `"should":[`+strings.Join(cond.should, ",")+`],"minimum_should_match":1`)
+			}
+			if cond.filter != "" {
+				parts = append(parts, `"filter":`+cond.filter)
+			}
+			return `{"bool":{` + strings.Join(parts, ",") + `}}`
+		}
+		for _, dest := range cond.dest {
+			queries = append(queries, MetadataQuery{Op: "_update_by_query", Indices: dest, Query: update + query(nil) + "}"})
+		}
+		if g.Formed == "" {
+			continue
+		}
+		formed := fmt.Sprintf(`{"range":{"%s":{"lt":"%s"}}}`, MetadataFormedField, g.Formed)
+		for _, dest := range cond.dest {
+			queries = append(queries, MetadataQuery{Op: "_delete_by_query", Indices: dest, Query: `{"query":` + query([]string{formed}) + "}"})
+		}
+	}
+	return
+}
+
+// Hash - returns hash of working group metadata config (as generated queries) and indices it matched
+func (g *MetadataGroup) Hash(matched []string) string {
+	hash := sha1.New()
+	for _, query := range g.Queries(time.Time{}, nil) {
+		_, _ = hash.Write([]byte(query.Op + " " + query.Indices + " " + query.Query + "\n"))
+	}
+	_, _ = hash.Write([]byte(strings.Join(matched, ",")))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// MatchIndices - returns sorted indices that given index names, aliases or patterns resolve to
+func MatchIndices(targets, indices []string, aliases []AliasState) (matched []string) {
+	m := make(map[string]struct{})
+	for _, target := range targets {
+		re := indexPatternRE(target)
+		for _, index := range indices {
+			if re.MatchString(index) {
+				m[index] = struct{}{}
+			}
+		}
+		for _, alias := range aliases {
+			if re.MatchString(alias.Alias) {
+				m[alias.Index] = struct{}{}
+			}
+		}
+	}
+	for index := range m {
+		matched = append(matched, index)
+	}
+	sort.Strings(matched)
+	return
+}
+
+// RunMetadataQuery - runs working group metadata operation, missing indices are ignored
+func RunMetadataQuery(ctx *Ctx, query *MetadataQuery) (updated, deleted int64, err error) {
+	path := fmt.Sprintf("/%s/%s?conflicts=proceed&refresh=true&timeout=20m&ignore_unavailable=true&allow_no_indices=true", query.Indices, query.Op)
+	if ctx.Debug > 0 {
+		Printf("Metadata %s %s\n", path, query.Query)
+	}
+	status, body, err := esRequest(ctx, Printf, Post, path, query.Query)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, query.Query, body)
+		return
+	}
+	payload := EsByQueryPayload{}
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+		return
+	}
+	updated, deleted = payload.Updated, payload.Deleted
+	return
+}
+
+// metadataStateID - "sdsdata" document ID of working group metadata state
+func metadataStateID(fixture, name string) string {
+	hash := sha1.Sum([]byte(fixture + "\n" + name))
+	return MetadataStateType + "-" + hex.EncodeToString(hash[:])
+}
+
+// MetadataStates - returns all working groups metadata states stored in "sdsdata" (none when SDS_SKIP_ES_DATA is set)
+func MetadataStates(ctx *Ctx) (states []MetadataState, err error) {
+	if ctx.SkipEsData {
+		return
+	}
+	path := "/" + SDSData + "/_search?size=10000"
+	data := fmt.Sprintf(`{"query":{"term":{"type":"%s"}}}`, MetadataStateType)
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil || status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	var payload struct {
+		Hits struct {
+			Hits []struct {
+				Source MetadataState `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = jsoniter.Unmarshal(body, &payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+		return
+	}
+	for _, hit := range payload.Hits.Hits {
+		states = append(states, hit.Source)
+	}
+	return
+}
+
+// saveMetadataState - stores working group metadata state in "sdsdata"
+func saveMetadataState(ctx *Ctx, state *MetadataState) (err error) {
+	if ctx.SkipEsData {
+		return
+	}
+	data, err := jsoniter.Marshal(state)
+	if err != nil {
+		return
+	}
+	path := "/" + SDSData + "/_doc/" + metadataStateID(state.Index, state.Endpoint) + "?refresh=true"
+	status, body, err := esRequest(ctx, Printf, Put, path, string(data))
+	if err != nil {
+		return
+	}
+	if status != 200 && status != 201 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Put, path, status, data, body)
+	}
+	return
+}
+
+// cleanupMetadata - removes working group fields from its documents in given indices
+func cleanupMetadata(ctx *Ctx, name string, fields, indices []string) (updated int64, err error) {
+	data := fmt.Sprintf(
+		`{"script":{"source":"%s","lang":"painless","params":{"name":"%s","fields":%s}},"query":{"match_phrase":{"%s":"%s"}}}`,
+		jsonEscape(metadataCleanupScript),
+		jsonEscape(name),
+		stringsJSON(fields),
+		WorkingGroupField,
+		jsonEscape(name),
+	)
+	for i := 0; i < len(indices); i += metadataCleanupChunk {
+		j := i + metadataCleanupChunk
+		if j > len(indices) {
+			j = len(indices)
+		}
+		var n int64
+		n, _, err = RunMetadataQuery(ctx, &MetadataQuery{Op: "_update_by_query", Indices: strings.Join(indices[i:j], ","), Query: data})
+		if err != nil {
+			return
+		}
+		updated += n
+	}
+	return
+}
+
+// difference - returns items from a that are not in b
+func difference(a, b []string) (diff []string) {
+	m := make(map[string]struct{})
+	for _, item := range b {
+		m[item] = struct{}{}
+	}
+	diff = []string{}
+	for _, item := range a {
+		_, ok := m[item]
+		if !ok {
+			diff = append(diff, item)
+		}
+	}
+	return
+}
+
+// ApplyMetadataGroup - applies working group metadata and stores its state
+// When previous state has the same hash (config and matched indices did not change) and full is not requested, only documents
+// enriched since the previous apply are updated, otherwise metadata is applied to all documents and fields that are no longer set
+// are removed; when config changed working group fields are first cleaned up from all previously matched indices, so documents
+// of origins removed from the working group lose them (also in indices that are still matched), full apply sets them back on the rest
+func ApplyMetadataGroup(ctx *Ctx, group *MetadataGroup, prev *MetadataState, matched []string, full bool) (updated, deleted int64, incremental bool, err error) {
+	state := MetadataState{
+		Index:    group.Fixture,
+		Endpoint: group.Name,
+		Type:     MetadataStateType,
+		Dt:       time.Now(),
+		Hash:     group.Hash(matched),
+		Indices:  matched,
+		Fields:   group.Fields(),
+	}
+	var since time.Time
+	remove := []string{}
+	if prev != nil {
+		if prev.Hash == state.Hash && !full {
+			since = prev.Dt
+			incremental = true
+		} else if prev.Hash != state.Hash {
+			remove = difference(prev.Fields, state.Fields)
+			var n int64
+			n, err = cleanupMetadata(ctx, group.Name, prev.Fields, prev.Indices)
+			if err != nil {
+				return
+			}
+			updated += n
+		}
+	}
+	for _, query := range group.Queries(since, remove) {
+		var u, d int64
+		u, d, err = RunMetadataQuery(ctx, &query)
+		if err != nil {
+			return
+		}
+		updated += u
+		deleted += d
+	}
+	err = saveMetadataState(ctx, &state)
+	return
+}
+
+// StaleMetadataStates - returns states of working groups that are no longer configured
+// States of fixtures that are not processed are only returned when all is set (full run, not filtered)
+func StaleMetadataStates(states []MetadataState, groups []MetadataGroup, fixtures []string, all bool) (stale []MetadataState) {
+	configured := make(map[[2]string]struct{})
+	for _, group := range groups {
+		configured[[2]string{group.Fixture, group.Name}] = struct{}{}
+	}
+	processed := make(map[string]struct{})
+	for _, fixture := range fixtures {
+		processed[fixture] = struct{}{}
+	}
+	for _, state := range states {
+		_, ok := configured[[2]string{state.Index, state.Endpoint}]
+		if ok {
+			continue
+		}
+		_, ok = processed[state.Index]
+		if ok || all {
+			stale = append(stale, state)
+		}
+	}
+	return
+}
+
+// CleanupMetadataGroup - removes working group fields from all indices it was applied to and deletes its state
+func CleanupMetadataGroup(ctx *Ctx, state *MetadataState) (updated int64, err error) {
+	updated, err = cleanupMetadata(ctx, state.Endpoint, state.Fields, state.Indices)
+	if err != nil {
+		return
+	}
+	path := "/" + SDSData + "/_doc/" + metadataStateID(state.Index, state.Endpoint) + "?refresh=true"
+	status, body, err := esRequest(ctx, Printf, Delete, path, "")
+	if err != nil {
+		return
+	}
+	if status != 200 && status != 404 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Delete, path, status, body)
+	}
+	return
+}
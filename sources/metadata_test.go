@@ -0,0 +1,233 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func metadataFixture() lib.Fixture {
+	return lib.Fixture{
+		Slug: "finos/odp",
+		Metadata: lib.Metadata{
+			DataSources: []lib.MetaDataSource{
+				{Name: "git", Slugs: []string{"finos/odp/git"}, Externals: []string{"bitergia-git"}},
+				{Name: "mbox", Slugs: []string{"pattern:sds-finos-*-mbox"}},
+				{Name: "slack", Slugs: []string{"finos/slack"}, OriginField: "channel_name", OriginPrefix: "#"},
+				{Name: "bad", Slugs: []string{"a", "pattern:b-*"}},
+			},
+			WorkingGroups: []lib.MetaWorkingGroup{
+				{
+					Name: "Security WG",
+					Meta: map[string]string{"formed": "2020-01-02", "chair": lib.Null},
+					DataSources: []lib.WGDataSource{
+						{Name: "git", Origins: []string{"https://github.com/finos/a"}},
+						{Name: "mbox", Origins: []string{"security"}},
+						{Name: "slack", Origins: []string{"sec"}, Filter: map[string]interface{}{"term": map[interface{}]interface{}{"b": 1, "a": "x"}}},
+						{Name: "bad", Origins: []string{"x"}},
+						{Name: "git"},
+					},
+				},
+				{Name: "Empty WG"},
+				{Name: "Keep WG", NoOverwrite: true, DataSources: []lib.WGDataSource{{Name: "slack", Filter: map[string]interface{}{"exists": map[string]interface{}{"field": "x"}}}}},
+			},
+		},
+	}
+}
+
+func TestFixtureMetadataGroups(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	fixture := metadataFixture()
+	groups := lib.FixtureMetadataGroups(&fixture)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 working groups, got %+v", groups)
+	}
+	group := groups[0]
+	if group.Fixture != "finos/odp" || group.Name != "Security WG" || group.Formed != "2020-01-02" ||
+		!reflect.DeepEqual(group.Fields(), []string{"meta_chair", "meta_formed", "workinggroup"}) {
+		t.Errorf("unexpected working group %+v", group)
+	}
+	if !reflect.DeepEqual(group.Targets(), []string{"bitergia-git", "sds-finos-*-mbox", "sds-finos-odp-git", "sds-finos-slack"}) {
+		t.Errorf("unexpected targets %+v", group.Targets())
+	}
+	script := `"script":{"source":"for (f in params.remove) {ctx._source.remove(f)} for (e in params.fields.entrySet()) {ctx._source[e.getKey()]=e.getValue()}","lang":"painless",`
+	fields := `"params":{"fields":{"meta_chair":null,"meta_formed":"2020-01-02","workinggroup":"Security WG"},`
+
+	// Test cases
+	var testCases = []struct {
+		since    time.Time
+		remove   []string
+		expected []lib.MetadataQuery
+	}{
+		{
+			expected: []lib.MetadataQuery{
+				{Op: "_update_by_query", Indices: "sds-finos-odp-git", Query: `{` + script + fields + `"remove":[]}},"query":{"bool":{"should":[{"term":{"origin":"https://github.com/finos/a"}}],"minimum_should_match":1}}}`},
+				{Op: "_update_by_query", Indices: "bitergia-git", Query: `{` + script + fields + `"remove":[]}},"query":{"bool":{"should":[{"term":{"origin":"https://github.com/finos/a"}}],"minimum_should_match":1}}}`},
+				{Op: "_delete_by_query", Indices: "sds-finos-odp-git", Query: `{"query":{"bool":{"must":[{"range":{"metadata__updated_on":{"lt":"2020-01-02"}}}],"should":[{"term":{"origin":"https://github.com/finos/a"}}],"minimum_should_match":1}}}`},
+				{Op: "_delete_by_query", Indices: "bitergia-git", Query: `{"query":{"bool":{"must":[{"range":{"metadata__updated_on":{"lt":"2020-01-02"}}}],"should":[{"term":{"origin":"https://github.com/finos/a"}}],"minimum_should_match":1}}}`},
+				{Op: "_update_by_query", Indices: "sds-finos-*-mbox", Query: `{` + script + fields + `"remove":[]}},"query":{"bool":{"should":[{"term":{"group_name":"finos.org/security"}}],"minimum_should_match":1}}}`},
+				{Op: "_delete_by_query", Indices: "sds-finos-*-mbox", Query: `{"query":{"bool":{"must":[{"range":{"metadata__updated_on":{"lt":"2020-01-02"}}}],"should":[{"term":{"group_name":"finos.org/security"}}],"minimum_should_match":1}}}`},
+				{Op: "_update_by_query", Indices: "sds-finos-slack", Query: `{` + script + fields + `"remove":[]}},"query":{"bool":{"should":[{"term":{"channel_name":"#sec"}}],"minimum_should_match":1,"filter":{"term":{"a":"x","b":1}}}}}`},
+				{Op: "_delete_by_query", Indices: "sds-finos-slack", Query: `{"query":{"bool":{"must":[{"range":{"metadata__updated_on":{"lt":"2020-01-02"}}}],"should":[{"term":{"channel_name":"#sec"}}],"minimum_should_match":1,"filter":{"term":{"a":"x","b":1}}}}}`},
+			},
+		},
+		{
+			since:  time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+			remove: []string{"meta_old"},
+			expected: []lib.MetadataQuery{
+				{Op: "_update_by_query", Indices: "sds-finos-odp-git", Query: `{` + script + fields + `"remove":["meta_old"]}},"query":{"bool":{"must":[{"range":{"metadata__enriched_on":{"gte":"2021-03-04T05:06:07Z"}}}],"should":[{"term":{"origin":"https://github.com/finos/a"}}],"minimum_should_match":1}}}`},
+			},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := group.Queries(test.since, test.remove)
+		if len(got) < len(test.expected) {
+			t.Errorf("test number %d, expected at least %d queries, got %+v", index+1, len(test.expected), got)
+			continue
+		}
+		for i, expected := range test.expected {
+			if got[i] != expected {
+				t.Errorf("test number %d, query %d, expected:\n%+v\ngot:\n%+v", index+1, i+1, expected, got[i])
+			}
+		}
+	}
+	got := groups[1].Queries(time.Time{}, nil)
+	if len(got) != 1 || !strings.Contains(got[0].Query, `{if (!ctx._source.containsKey(e.getKey()))`) || !strings.HasSuffix(got[0].Query, `"query":{"bool":{"filter":{"exists":{"field":"x"}}}}}`) {
+		t.Errorf("unexpected no overwrite queries %+v", got)
+	}
+
+	// Hash changes with config and matched indices only
+	hash := group.Hash([]string{"sds-finos-odp-git"})
+	if hash != lib.FixtureMetadataGroups(&fixture)[0].Hash([]string{"sds-finos-odp-git"}) || hash == group.Hash([]string{"sds-finos-odp-git", "sds-finos-x-mbox"}) {
+		t.Errorf("unexpected hash behavior")
+	}
+	fixture.Metadata.WorkingGroups[0].Meta["chair"] = "Jane"
+	if hash == lib.FixtureMetadataGroups(&fixture)[0].Hash([]string{"sds-finos-odp-git"}) {
+		t.Errorf("hash should change when working group config changes")
+	}
+}
+
+func TestMatchIndices(t *testing.T) {
+	indices := []string{"bitergia-git", "sds-finos-a-mbox", "sds-finos-b-mbox", "sds-finos-odp-git-raw", "sds-finos-odp-git-1"}
+	aliases := []lib.AliasState{{Index: "sds-finos-odp-git-1", Alias: "sds-finos-odp-git"}}
+	got := lib.MatchIndices([]string{"sds-finos-*-mbox", "sds-finos-odp-git", "bitergia-git", "missing"}, indices, aliases)
+	expected := []string{"bitergia-git", "sds-finos-a-mbox", "sds-finos-b-mbox", "sds-finos-odp-git-1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestStaleMetadataStates(t *testing.T) {
+	fixture := metadataFixture()
+	groups := lib.FixtureMetadataGroups(&fixture)
+	states := []lib.MetadataState{
+		{Index: "finos/odp", Endpoint: "Security WG"},
+		{Index: "finos/odp", Endpoint: "Old WG"},
+		{Index: "finos/other", Endpoint: "Other WG"},
+	}
+
+	// Test cases
+	var testCases = []struct {
+		all      bool
+		expected []string
+	}{
+		{all: false, expected: []string{"Old WG"}},
+		{all: true, expected: []string{"Old WG", "Other WG"}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := []string{}
+		for _, state := range lib.StaleMetadataStates(states, groups, []string{"finos/odp"}, test.all) {
+			got = append(got, state.Endpoint)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestApplyMetadataGroup(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	requests := []string{}
+	var saved lib.MetadataState
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, "/sdsdata/_doc/metadata-"):
+			_ = jsoniter.Unmarshal(body, &saved)
+			requests = append(requests, "save")
+			w.WriteHeader(201)
+			fmt.Fprintf(w, `{}`)
+		case req.Method == http.MethodDelete:
+			requests = append(requests, "delete state")
+			fmt.Fprintf(w, `{}`)
+		default:
+			requests = append(requests, req.URL.Path+" "+string(body))
+			fmt.Fprintf(w, `{"updated":2,"deleted":1}`)
+		}
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+	fixture := lib.Fixture{
+		Slug: "finos/odp",
+		Metadata: lib.Metadata{
+			DataSources:   []lib.MetaDataSource{{Name: "git", Slugs: []string{"finos/odp/git"}}},
+			WorkingGroups: []lib.MetaWorkingGroup{{Name: "WG", Meta: map[string]string{"a": "1"}, DataSources: []lib.WGDataSource{{Name: "git", Origins: []string{"o"}}}}},
+		},
+	}
+	group := lib.FixtureMetadataGroups(&fixture)[0]
+	matched := []string{"sds-finos-odp-git"}
+
+	// First run - full apply and state saved
+	updated, deleted, incremental, err := lib.ApplyMetadataGroup(&ctx, &group, nil, matched, false)
+	if err != nil || updated != 2 || deleted != 1 || incremental || len(requests) != 2 || requests[1] != "save" ||
+		saved.Index != "finos/odp" || saved.Endpoint != "WG" || saved.Type != lib.MetadataStateType || saved.Hash != group.Hash(matched) ||
+		!reflect.DeepEqual(saved.Fields, []string{"meta_a", "workinggroup"}) || !reflect.DeepEqual(saved.Indices, matched) {
+		t.Errorf("unexpected first run %d/%d/%v %+v %+v: %+v", updated, deleted, incremental, requests, saved, err)
+	}
+
+	// Nothing changed - incremental
+	prev := saved
+	requests = []string{}
+	_, _, incremental, err = lib.ApplyMetadataGroup(&ctx, &group, &prev, matched, false)
+	if err != nil || !incremental || len(requests) != 2 || !strings.Contains(requests[0], `"metadata__enriched_on":{"gte":"`+prev.Dt.UTC().Format(time.RFC3339)+`"}`) {
+		t.Errorf("expected incremental run, got %v %+v: %+v", incremental, requests, err)
+	}
+
+	// Full requested
+	requests = []string{}
+	_, _, incremental, err = lib.ApplyMetadataGroup(&ctx, &group, &prev, matched, true)
+	if err != nil || incremental || strings.Contains(requests[0], "metadata__enriched_on") {
+		t.Errorf("expected full run, got %v %+v: %+v", incremental, requests, err)
+	}
+
+	// Config changed: old fields removed and working group cleaned up from all previously matched indices (removed origins)
+	requests = []string{}
+	prev.Fields = []string{"meta_a", "meta_old", "workinggroup"}
+	prev.Indices = []string{"sds-finos-odp-git", "sds-finos-old-git"}
+	prev.Hash = "x"
+	updated, _, incremental, err = lib.ApplyMetadataGroup(&ctx, &group, &prev, matched, false)
+	if err != nil || incremental || updated != 4 || len(requests) != 3 ||
+		!strings.HasPrefix(requests[0], `/sds-finos-odp-git,sds-finos-old-git/_update_by_query {"script":{"source":"if (ctx._source.workinggroup == params.name)`) ||
+		!strings.Contains(requests[0], `"params":{"name":"WG","fields":["meta_a","meta_old","workinggroup"]}},"query":{"match_phrase":{"workinggroup":"WG"}}}`) ||
+		!strings.Contains(requests[1], `"remove":["meta_old"]`) {
+		t.Errorf("unexpected changed config run %d %v %+v: %+v", updated, incremental, requests, err)
+	}
+
+	// Removed working group
+	requests = []string{}
+	updated, err = lib.CleanupMetadataGroup(&ctx, &prev)
+	if err != nil || updated != 2 || len(requests) != 2 || !strings.HasPrefix(requests[0], "/sds-finos-odp-git,sds-finos-old-git/_update_by_query ") || requests[1] != "delete state" {
+		t.Errorf("unexpected cleanup %d %+v: %+v", updated, requests, err)
+	}
+}
@@ -0,0 +1,336 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricTasks - number of configured tasks by data source and fixture
+const MetricTasks string = "sds_tasks"
+
+// MetricTasksRunning - number of tasks currently running by data source, fixture and phase (data/affs)
+const MetricTasksRunning string = "sds_tasks_running"
+
+// MetricTasksFinished - number of finished tasks by data source, fixture, phase and result (ok/failed/skipped)
+const MetricTasksFinished string = "sds_tasks_finished_total"
+
+// MetricTasksFailed - number of failed tasks by data source, fixture, phase and error class
+const MetricTasksFailed string = "sds_tasks_failed_total"
+
+// MetricTaskDuration - task duration histogram by data source and phase
+const MetricTaskDuration string = "sds_task_duration_seconds"
+
+// MetricTaskRetries - number of task retries by data source and error class
+const MetricTaskRetries string = "sds_task_retries_total"
+
+// MetricLastTaskFinished - unix timestamp of the most recently finished task (use it to alert on stalls)
+const MetricLastTaskFinished string = "sds_last_task_finished_timestamp_seconds"
+
+// MetricStartTime - unix timestamp when SDS started
+const MetricStartTime string = "sds_start_timestamp_seconds"
+
+// MetricESRequestDuration - ElasticSearch request latency histogram by HTTP method and ES operation
+const MetricESRequestDuration string = "sds_es_request_duration_seconds"
+
+// MetricESRequestErrors - number of failed ElasticSearch requests by HTTP method, ES operation and status code
+const MetricESRequestErrors string = "sds_es_request_errors_total"
+
+// MetricGitHubRemaining - remaining GitHub API points by token index and resource (core/search)
+const MetricGitHubRemaining string = "sds_github_token_remaining"
+
+// MetricLockWait - lock wait time histogram by lock name
+const MetricLockWait string = "sds_lock_wait_seconds"
+
+// metricDef - single metric definition
+type metricDef struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+}
+
+// histogramValue - single histogram time series
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics - minimal Prometheus metrics registry (counters, gauges and histograms with labels)
+type Metrics struct {
+	mtx        *sync.Mutex
+	defs       map[string]*metricDef
+	values     map[string]map[string]float64
+	histograms map[string]map[string]*histogramValue
+}
+
+// gMetrics - global metrics registry, nil when metrics are disabled (SDS_METRICS_ADDR not set)
+var gMetrics *Metrics
+
+// newMetrics - creates an empty metrics registry
+func newMetrics() *Metrics {
+	return &Metrics{
+		mtx:        &sync.Mutex{},
+		defs:       make(map[string]*metricDef),
+		values:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogramValue),
+	}
+}
+
+// NewMetrics - creates a metrics registry with all SDS metrics defined
+func NewMetrics() *Metrics {
+	m := newMetrics()
+	taskBuckets := []float64{1, 10, 60, 300, 900, 1800, 3600, 7200, 14400, 28800, 43200, 86400}
+	esBuckets := []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+	lockBuckets := []float64{0.001, 0.01, 0.1, 1, 10, 60, 300, 900, 3600, 14400, 43200}
+	m.define(MetricTasks, "Number of configured tasks.", "gauge", nil, "ds", "fixture")
+	m.define(MetricTasksRunning, "Number of tasks currently running.", "gauge", nil, "ds", "fixture", "phase")
+	m.define(MetricTasksFinished, "Number of finished tasks.", "counter", nil, "ds", "fixture", "phase", "result")
+	m.define(MetricTasksFailed, "Number of failed tasks.", "counter", nil, "ds", "fixture", "phase", "error_class")
+	m.define(MetricTaskDuration, "Task duration in seconds.", "histogram", taskBuckets, "ds", "phase")
+	m.define(MetricTaskRetries, "Number of task retries.", "counter", nil, "ds", "error_class")
+	m.define(MetricLastTaskFinished, "Unix timestamp of the most recently finished task.", "gauge", nil)
+	m.define(MetricStartTime, "Unix timestamp when SDS started.", "gauge", nil)
+	m.define(MetricESRequestDuration, "ElasticSearch request duration in seconds.", "histogram", esBuckets, "method", "op")
+	m.define(MetricESRequestErrors, "Number of failed ElasticSearch requests.", "counter", nil, "method", "op", "code")
+	m.define(MetricGitHubRemaining, "Remaining GitHub API points.", "gauge", nil, "token", "resource")
+	m.define(MetricLockWait, "Time spent waiting for locks in seconds.", "histogram", lockBuckets, "lock")
+	return m
+}
+
+func (m *Metrics) define(name, help, typ string, buckets []float64, labels ...string) {
+	m.defs[name] = &metricDef{name: name, help: help, typ: typ, labels: labels, buckets: buckets}
+	if typ == "histogram" {
+		m.histograms[name] = make(map[string]*histogramValue)
+		return
+	}
+	m.values[name] = make(map[string]float64)
+}
+
+// labelsKey - encodes label values as a map key, unknown metric or wrong number of label values returns false
+func (m *Metrics) labelsKey(name string, labels []string) (*metricDef, string, bool) {
+	def, ok := m.defs[name]
+	if !ok || len(labels) != len(def.labels) {
+		return nil, "", false
+	}
+	return def, strings.Join(labels, "\xff"), true
+}
+
+// Add - adds value to a counter or a gauge
+func (m *Metrics) Add(name string, value float64, labels ...string) {
+	_, key, ok := m.labelsKey(name, labels)
+	if !ok {
+		return
+	}
+	m.mtx.Lock()
+	m.values[name][key] += value
+	m.mtx.Unlock()
+}
+
+// Set - sets gauge value
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	_, key, ok := m.labelsKey(name, labels)
+	if !ok {
+		return
+	}
+	m.mtx.Lock()
+	m.values[name][key] = value
+	m.mtx.Unlock()
+}
+
+// Observe - adds an observation to a histogram
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	def, key, ok := m.labelsKey(name, labels)
+	if !ok || def.typ != "histogram" {
+		return
+	}
+	m.mtx.Lock()
+	defer func() {
+		m.mtx.Unlock()
+	}()
+	h, ok := m.histograms[name][key]
+	if !ok {
+		h = &histogramValue{counts: make([]uint64, len(def.buckets))}
+		m.histograms[name][key] = h
+	}
+	for i, bound := range def.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func formatLabels(names []string, key string, extra ...string) string {
+	pairs := []string{}
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Write - writes all metrics in Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) {
+	m.mtx.Lock()
+	defer func() {
+		m.mtx.Unlock()
+	}()
+	names := []string{}
+	for name := range m.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := m.defs[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, def.help, name, def.typ)
+		if def.typ == "histogram" {
+			keys := []string{}
+			for key := range m.histograms[name] {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				h := m.histograms[name][key]
+				for i, bound := range def.buckets {
+					fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(def.labels, key, "le", formatFloat(bound)), h.counts[i])
+				}
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(def.labels, key, "le", "+Inf"), h.count)
+				fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(def.labels, key), formatFloat(h.sum))
+				fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(def.labels, key), h.count)
+			}
+			continue
+		}
+		keys := []string{}
+		for key := range m.values[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(def.labels, key), formatFloat(m.values[name][key]))
+		}
+	}
+}
+
+// MetricsAdd - adds value to a counter or a gauge, no-op when metrics are disabled
+func MetricsAdd(name string, value float64, labels ...string) {
+	if gMetrics != nil {
+		gMetrics.Add(name, value, labels...)
+	}
+}
+
+// MetricsInc - increments a counter or a gauge, no-op when metrics are disabled
+func MetricsInc(name string, labels ...string) {
+	if gMetrics != nil {
+		gMetrics.Add(name, 1, labels...)
+	}
+}
+
+// MetricsSet - sets gauge value, no-op when metrics are disabled
+func MetricsSet(name string, value float64, labels ...string) {
+	if gMetrics != nil {
+		gMetrics.Set(name, value, labels...)
+	}
+}
+
+// MetricsObserve - adds an observation to a histogram, no-op when metrics are disabled
+func MetricsObserve(name string, value float64, labels ...string) {
+	if gMetrics != nil {
+		gMetrics.Observe(name, value, labels...)
+	}
+}
+
+// MetricsObserveSince - adds time elapsed since a given time (in seconds) to a histogram, no-op when metrics are disabled
+func MetricsObserveSince(name string, since time.Time, labels ...string) {
+	if gMetrics != nil {
+		gMetrics.Observe(name, time.Now().Sub(since).Seconds(), labels...)
+	}
+}
+
+// EsOperation - returns ES operation name for a given request path: '/idx/_doc/_search' -> '_search', '/idx' -> 'index'
+func EsOperation(path string) string {
+	ary := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(ary) - 1; i >= 0; i-- {
+		if strings.HasPrefix(ary[i], "_") {
+			return ary[i]
+		}
+	}
+	return "index"
+}
+
+// esMetricsTransport - HTTP transport that records ElasticSearch request latencies and errors
+type esMetricsTransport struct {
+	base http.RoundTripper
+	host string
+}
+
+// RoundTrip - executes a single HTTP request, recording metrics for requests sent to ElasticSearch
+func (t *esMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	op := EsOperation(req.URL.Path)
+	st := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	MetricsObserveSince(MetricESRequestDuration, st, req.Method, op)
+	if err != nil {
+		MetricsInc(MetricESRequestErrors, req.Method, op, "error")
+	} else if resp.StatusCode >= 400 && !(req.Method == Head && resp.StatusCode == 404) {
+		MetricsInc(MetricESRequestErrors, req.Method, op, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// ServeMetrics - starts Prometheus metrics HTTP listener on SDS_METRICS_ADDR (if set)
+// It also starts recording ElasticSearch requests made via the default HTTP client
+func ServeMetrics(ctx *Ctx) {
+	if ctx.MetricsAddr == "" {
+		return
+	}
+	gMetrics = NewMetrics()
+	gMetrics.Set(MetricStartTime, float64(time.Now().Unix()))
+	u, err := url.Parse(os.ExpandEnv(ctx.ElasticURL))
+	if err == nil && u.Host != "" {
+		base := http.DefaultClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		http.DefaultClient.Transport = &esMetricsTransport{base: base, host: u.Host}
+	}
+	handleHTTP(ctx.MetricsAddr, "/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		gMetrics.Write(w)
+	})
+}
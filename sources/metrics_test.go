@@ -0,0 +1,72 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestEsOperation(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		path     string
+		expected string
+	}{
+		{path: "/sdslog/_doc", expected: "_doc"},
+		{path: "/sds-onap-git/_doc/_search", expected: "_search"},
+		{path: "/sdssyncinfo/_update/abc123", expected: "_update"},
+		{path: "/_aliases", expected: "_aliases"},
+		{path: "/_bulk", expected: "_bulk"},
+		{path: "/sds-onap-git/_delete_by_query", expected: "_delete_by_query"},
+		{path: "/sdsmtx", expected: "index"},
+		{path: "/", expected: "index"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.EsOperation(test.path)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestMetricsWrite(t *testing.T) {
+	m := lib.NewMetrics()
+	m.Add(lib.MetricTasks, 2, "git", "onap")
+	m.Add(lib.MetricTasksRunning, 1, "git", "onap", "data")
+	m.Add(lib.MetricTasksRunning, -1, "git", "onap", "data")
+	m.Add(lib.MetricTasksFailed, 1, "jira", `a"b`, "data", lib.ErrorClassAuth)
+	m.Set(lib.MetricGitHubRemaining, 4321, "0", "core")
+	m.Observe(lib.MetricTaskDuration, 5, "git", "data")
+	m.Observe(lib.MetricTaskDuration, 120, "git", "data")
+	// Unknown metric or wrong number of labels is ignored
+	m.Add("sds_unknown", 1)
+	m.Add(lib.MetricTasks, 1, "git")
+	var buf bytes.Buffer
+	m.Write(&buf)
+	out := buf.String()
+	expected := []string{
+		"# TYPE sds_tasks gauge\n",
+		`sds_tasks{ds="git",fixture="onap"} 2` + "\n",
+		`sds_tasks_running{ds="git",fixture="onap",phase="data"} 0` + "\n",
+		`sds_tasks_failed_total{ds="jira",fixture="a\"b",phase="data",error_class="auth"} 1` + "\n",
+		`sds_github_token_remaining{token="0",resource="core"} 4321` + "\n",
+		"# TYPE sds_task_duration_seconds histogram\n",
+		`sds_task_duration_seconds_bucket{ds="git",phase="data",le="1"} 0` + "\n",
+		`sds_task_duration_seconds_bucket{ds="git",phase="data",le="10"} 1` + "\n",
+		`sds_task_duration_seconds_bucket{ds="git",phase="data",le="300"} 2` + "\n",
+		`sds_task_duration_seconds_bucket{ds="git",phase="data",le="+Inf"} 2` + "\n",
+		`sds_task_duration_seconds_sum{ds="git",phase="data"} 125` + "\n",
+		`sds_task_duration_seconds_count{ds="git",phase="data"} 2` + "\n",
+	}
+	for index, exp := range expected {
+		if !strings.Contains(out, exp) {
+			t.Errorf("test number %d, expected output to contain '%s', got:\n%s", index+1, strings.TrimSpace(exp), out)
+		}
+	}
+	if strings.Contains(out, "sds_unknown") || strings.Contains(out, `sds_tasks{ds="git"} `) {
+		t.Errorf("unexpected metrics in output:\n%s", out)
+	}
+}
@@ -0,0 +1,375 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// NotifySlack - Slack incoming webhook notification sink
+const NotifySlack string = "slack"
+
+// NotifyEmail - SMTP email notification sink
+const NotifyEmail string = "email"
+
+// NotifyWebhook - generic webhook notification sink (notification is POSTed as JSON)
+const NotifyWebhook string = "webhook"
+
+// NotifyFile - file notification sink (notifications are appended as JSON lines, mostly for tests)
+const NotifyFile string = "file"
+
+// NotifyRunFinished - run finished notification event
+const NotifyRunFinished string = "run_finished"
+
+// NotifyFailureRate - failure rate threshold exceeded notification event
+const NotifyFailureRate string = "failure_rate"
+
+// NotifyFatal - fatal error notification event
+const NotifyFatal string = "fatal"
+
+// NotifyLockTimeout - ES mutex wait timeout notification event
+const NotifyLockTimeout string = "lock_timeout"
+
+// NotifyQuarantine - endpoint quarantined notification event
+const NotifyQuarantine string = "quarantine"
+
+// NotifySink - notification sink definition
+// Route - if set, sink only receives notifications for foundations matching this regexp, otherwise it receives all run level notifications
+type NotifySink struct {
+	Route  *regexp.Regexp
+	Type   string
+	Target string
+}
+
+// String - default string output for a notification sink (target is not displayed because it can contain secrets)
+func (ns NotifySink) String() string {
+	return fmt.Sprintf("{Route:%v Type:%s}", ns.Route, ns.Type)
+}
+
+// Notification - single notification sent to sinks
+// Foundation is the first element of fixture slug (for example "lfn" for "lfn/onap") or empty for run level notifications
+type Notification struct {
+	Dt         time.Time `json:"dt"`
+	Event      string    `json:"event"`
+	Level      string    `json:"level"`
+	Foundation string    `json:"foundation,omitempty"`
+	Title      string    `json:"title"`
+	Text       string    `json:"text"`
+	RunID      string    `json:"run_id"`
+	Host       string    `json:"host"`
+	NodeIdx    int       `json:"node_idx"`
+	NodeNum    int       `json:"node_num"`
+}
+
+// slackMessage - Slack incoming webhook payload
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+var (
+	notifyClient = &http.Client{Timeout: time.Duration(30) * time.Second}
+	notifyMtx    = &sync.Mutex{}
+)
+
+// ParseNotifySinks - parses notification sinks definition (as specified in SDS_NOTIFY)
+// Format is: '[foundation_regexp@]type[:target];...', type is one of: slack, email, webhook, file
+// For example: 'slack:https://hooks.slack.com/services/X/Y/Z;^lfn$@email:ops@lfnetworking.org,dev@lfnetworking.org;file:/tmp/notify.json'
+// Email target defaults to LE_TOADDRS, other sinks require target
+func ParseNotifySinks(str string) (sinks []NotifySink, err error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return
+	}
+	for _, item := range strings.Split(str, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var sink NotifySink
+		// Target can contain ':' (URLs), so only the first one separates it from the sink type
+		parts := strings.SplitN(item, ":", 2)
+		spec := parts[0]
+		if len(parts) == 2 {
+			sink.Target = strings.TrimSpace(parts[1])
+			if sink.Target == "" {
+				err = fmt.Errorf("notification sink '%s' has empty target", item)
+				return
+			}
+		}
+		j := strings.LastIndex(spec, "@")
+		if j >= 0 {
+			sink.Route, err = regexp.Compile(spec[:j])
+			if err != nil {
+				return
+			}
+			spec = spec[j+1:]
+		}
+		sink.Type = strings.TrimSpace(spec)
+		switch sink.Type {
+		case NotifySlack, NotifyWebhook, NotifyFile:
+			if sink.Target == "" {
+				err = fmt.Errorf("notification sink '%s' requires target", item)
+				return
+			}
+		case NotifyEmail:
+		default:
+			err = fmt.Errorf("notification sink '%s' has unknown type '%s'", item, sink.Type)
+			return
+		}
+		if sink.Type == NotifySlack || sink.Type == NotifyWebhook {
+			AddRedacted(sink.Target, false)
+		}
+		sinks = append(sinks, sink)
+	}
+	return
+}
+
+// Foundation - returns foundation for a given fixture slug ("lfn/onap" -> "lfn")
+func Foundation(fixtureSlug string) string {
+	return strings.Split(fixtureSlug, "/")[0]
+}
+
+// Notify - sends notification to all sinks without route and to sinks with route matching notification's foundation
+func Notify(ctx *Ctx, n Notification) {
+	notify(ctx, n, false)
+}
+
+// notify - sends notification to matching sinks, routedOnly means that sinks without route are skipped
+func notify(ctx *Ctx, n Notification, routedOnly bool) {
+	if len(ctx.NotifySinks) == 0 {
+		return
+	}
+	if n.Dt.IsZero() {
+		n.Dt = time.Now()
+	}
+	if n.Level == "" {
+		n.Level = LogLevelInfo
+	}
+	n.RunID = ctx.RunID
+	n.Host, _ = os.Hostname()
+	n.NodeIdx = ctx.NodeIdx
+	n.NodeNum = ctx.NodeNum
+	n.Title = FilterRedacted(n.Title)
+	n.Text = FilterRedacted(n.Text)
+	for _, sink := range ctx.NotifySinks {
+		if sink.Route == nil && routedOnly {
+			continue
+		}
+		if sink.Route != nil && (n.Foundation == "" || !sink.Route.MatchString(n.Foundation)) {
+			continue
+		}
+		if ctx.DryRun && sink.Type != NotifyFile {
+			PrintfRedacted("DryRun: %s notification %s: %s\n", sink.Type, n.Event, n.Title)
+			continue
+		}
+		err := sendNotification(ctx, sink, n)
+		if err != nil {
+			// Use PrintfRedacted, because this can be called from FatalOnError
+			PrintfRedacted("Error sending %s notification %s: %+v\n", sink.Type, n.Event, err)
+		}
+	}
+}
+
+// sendNotification - sends notification to a single sink
+func sendNotification(ctx *Ctx, sink NotifySink, n Notification) (err error) {
+	switch sink.Type {
+	case NotifySlack:
+		var data []byte
+		data, err = jsoniter.Marshal(slackMessage{Text: fmt.Sprintf("*[%s] %s*\n%s", n.Level, n.Title, n.Text)})
+		if err != nil {
+			return
+		}
+		err = notifyPost(sink.Target, data)
+	case NotifyWebhook:
+		var data []byte
+		data, err = jsoniter.Marshal(n)
+		if err != nil {
+			return
+		}
+		err = notifyPost(sink.Target, data)
+	case NotifyFile:
+		var data []byte
+		data, err = jsoniter.Marshal(n)
+		if err != nil {
+			return
+		}
+		notifyMtx.Lock()
+		defer func() {
+			notifyMtx.Unlock()
+		}()
+		var f *os.File
+		f, err = os.OpenFile(sink.Target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		_, err = f.Write(append(data, '\n'))
+		_ = f.Close()
+	case NotifyEmail:
+		err = notifyEmail(ctx, sink.Target, n)
+	}
+	return
+}
+
+// notifyPost - POSTs JSON payload to a webhook URL
+func notifyPost(url string, data []byte) (err error) {
+	req, err := http.NewRequest(Post, os.ExpandEnv(url), bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = fmt.Errorf("webhook status:%d\n%s", resp.StatusCode, body)
+	}
+	return
+}
+
+// notifyEmail - sends notification email using SDS_NOTIFY_SMTP server, LE_FROMADDR sender (and LE_PASSWORD if set)
+// to given comma separated recipients (LE_TOADDRS when empty)
+func notifyEmail(ctx *Ctx, target string, n Notification) (err error) {
+	if target == "" {
+		target = ctx.LeToAddrs
+	}
+	to := []string{}
+	for _, addr := range strings.Split(target, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 || ctx.LeFromAddr == "" {
+		err = fmt.Errorf("email notification requires LE_FROMADDR and recipients (sink target or LE_TOADDRS)")
+		return
+	}
+	var auth smtp.Auth
+	if ctx.LePassword != "" {
+		host, _, e := net.SplitHostPort(ctx.NotifySMTP)
+		if e != nil {
+			err = e
+			return
+		}
+		auth = smtp.PlainAuth("", ctx.LeFromAddr, ctx.LePassword, host)
+	}
+	msg := "From: " + ctx.LeFromAddr + "\r\n" +
+		"To: " + strings.Join(to, ", ") + "\r\n" +
+		"Subject: [SDS " + n.Level + "] " + n.Title + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + n.Text + "\r\n"
+	err = smtp.SendMail(ctx.NotifySMTP, auth, ctx.LeFromAddr, to, []byte(msg))
+	return
+}
+
+// notifyFatal - sends fatal error notification (called from FatalOnError), msg contains error and stacktrace
+func notifyFatal(ctx *Ctx, err error, msg string) {
+	title := strings.Split(err.Error(), "\n")[0]
+	notify(ctx, Notification{Event: NotifyFatal, Level: LogLevelFatal, Title: "fatal error: " + title, Text: msg}, false)
+}
+
+// NotifyRunReport - sends run finished notification for a final run report, and failure rate notifications
+// when failure rate (overall or per foundation) exceeds SDS_NOTIFY_FAILURE_RATE
+// Sinks with foundation route also receive per foundation run summary
+func NotifyRunReport(ctx *Ctx, report RunReport) {
+	if len(ctx.NotifySinks) == 0 {
+		return
+	}
+	// [phases run, phases failed] per foundation
+	counts := make(map[string][2]int)
+	failures := make(map[string][]string)
+	for _, task := range report.Tasks {
+		foundation := Foundation(task.Fixture)
+		for _, phase := range []*ReportPhase{task.Data, task.Affs} {
+			if phase == nil || phase.Outcome == ReportOutcomeSkipped {
+				continue
+			}
+			data := counts[foundation]
+			data[0]++
+			if phase.Outcome == ReportOutcomeFailed {
+				data[1]++
+				failures[foundation] = append(failures[foundation], fmt.Sprintf("%s %s %s: %s", task.Fixture, task.FullDataSource, task.Endpoint, phase.Error))
+			}
+			counts[foundation] = data
+		}
+	}
+	rate := func(data [2]int) float64 {
+		if data[0] == 0 {
+			return 0.0
+		}
+		return float64(data[1]) * 100.0 / float64(data[0])
+	}
+	foundations := []string{}
+	all := [2]int{}
+	for foundation, data := range counts {
+		foundations = append(foundations, foundation)
+		all[0] += data[0]
+		all[1] += data[1]
+	}
+	sort.Strings(foundations)
+	level := LogLevelInfo
+	if all[1] > 0 {
+		level = LogLevelWarning
+	}
+	text := fmt.Sprintf("Run %s finished in %s: %d tasks, %d phases run, %d failed (%.2f%%)\n", report.RunID, time.Duration(report.DurationSeconds*float64(time.Second)).Truncate(time.Second), len(report.Tasks), all[0], all[1], rate(all))
+	for _, foundation := range foundations {
+		data := counts[foundation]
+		if data[1] > 0 {
+			text += fmt.Sprintf("%s: %d/%d failed (%.2f%%)\n", foundation, data[1], data[0], rate(data))
+		}
+	}
+	if len(report.Changes) > 0 {
+		text += fmt.Sprintf("%d index/alias changes\n", len(report.Changes))
+	}
+	Notify(ctx, Notification{Event: NotifyRunFinished, Level: level, Title: fmt.Sprintf("run %s finished, %d failures", report.RunID, all[1]), Text: text})
+	for _, foundation := range foundations {
+		data := counts[foundation]
+		text := fmt.Sprintf("Run %s: %d phases run, %d failed (%.2f%%)\n", report.RunID, data[0], data[1], rate(data))
+		if len(failures[foundation]) > 0 {
+			text += strings.Join(failures[foundation], "\n") + "\n"
+		}
+		level := LogLevelInfo
+		if data[1] > 0 {
+			level = LogLevelWarning
+		}
+		notify(ctx, Notification{Event: NotifyRunFinished, Level: level, Foundation: foundation, Title: fmt.Sprintf("%s: run %s finished, %d failures", foundation, report.RunID, data[1]), Text: text}, true)
+	}
+	if ctx.NotifyFailureRate <= 0.0 {
+		return
+	}
+	if rate(all) > ctx.NotifyFailureRate {
+		Notify(ctx, Notification{Event: NotifyFailureRate, Level: LogLevelError, Title: fmt.Sprintf("run %s failure rate %.2f%% exceeds %.2f%%", report.RunID, rate(all), ctx.NotifyFailureRate), Text: text})
+	}
+	for _, foundation := range foundations {
+		data := counts[foundation]
+		if rate(data) <= ctx.NotifyFailureRate {
+			continue
+		}
+		Notify(
+			ctx,
+			Notification{
+				Event:      NotifyFailureRate,
+				Level:      LogLevelError,
+				Foundation: foundation,
+				Title:      fmt.Sprintf("%s: failure rate %.2f%% exceeds %.2f%%", foundation, rate(data), ctx.NotifyFailureRate),
+				Text:       strings.Join(failures[foundation], "\n"),
+			},
+		)
+	}
+}
@@ -0,0 +1,183 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestParseNotifySinks(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		str      string
+		expected string
+		targets  []string
+		err      bool
+	}{
+		{str: "", expected: "[]", targets: []string{}},
+		{str: "file:/tmp/n.json", expected: "[{Route:<nil> Type:file}]", targets: []string{"/tmp/n.json"}},
+		{
+			str:      " slack:https://hooks.slack.com/services/X/Y ; ^lfn$@email:a@lfn.org,b@lfn.org;cncf@email",
+			expected: "[{Route:<nil> Type:slack} {Route:^lfn$ Type:email} {Route:cncf Type:email}]",
+			targets:  []string{"https://hooks.slack.com/services/X/Y", "a@lfn.org,b@lfn.org", ""},
+		},
+		{str: "webhook:http://127.0.0.1:8080/notify", expected: "[{Route:<nil> Type:webhook}]", targets: []string{"http://127.0.0.1:8080/notify"}},
+		{str: "slack", err: true},
+		{str: "webhook:", err: true},
+		{str: "email: ", err: true},
+		{str: "^lfn$@file:/tmp/a:b.json", expected: "[{Route:^lfn$ Type:file}]", targets: []string{"/tmp/a:b.json"}},
+		{str: "sms:123", err: true},
+		{str: "(lfn@file:/tmp/n.json", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		sinks, err := lib.ParseNotifySinks(test.str)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error for '%s', got %+v", index+1, test.str, sinks)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error for '%s': %+v", index+1, test.str, err)
+			continue
+		}
+		got := fmt.Sprintf("%v", sinks)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+		targets := []string{}
+		for _, sink := range sinks {
+			targets = append(targets, sink.Target)
+		}
+		if strings.Join(targets, "|") != strings.Join(test.targets, "|") {
+			t.Errorf("test number %d, expected targets %v, got %v", index+1, test.targets, targets)
+		}
+	}
+}
+
+// readNotifications - reads notifications written by file sink
+func readNotifications(t *testing.T, fn string) (notifications []lib.Notification) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			t.Errorf("cannot read %s: %+v", fn, err)
+		}
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var n lib.Notification
+		err = jsoniter.Unmarshal([]byte(line), &n)
+		if err != nil {
+			t.Errorf("invalid notification '%s': %+v", line, err)
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	return
+}
+
+func TestNotifyRouting(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	dir, err := ioutil.TempDir("", "sds-notify")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	all := filepath.Join(dir, "all.json")
+	lfn := filepath.Join(dir, "lfn.json")
+	sinks, err := lib.ParseNotifySinks("file:" + all + ";^lfn$@file:" + lfn)
+	if err != nil {
+		t.Fatalf("parse error: %+v", err)
+	}
+	ctx := lib.Ctx{NotifySinks: sinks, NotifyFailureRate: 40.0, RunID: "run-1"}
+	lib.Notify(&ctx, lib.Notification{Event: lib.NotifyLockTimeout, Title: "lock"})
+	lib.Notify(&ctx, lib.Notification{Event: lib.NotifyQuarantine, Foundation: "lfn", Title: "lfn quarantine"})
+	lib.Notify(&ctx, lib.Notification{Event: lib.NotifyQuarantine, Foundation: "cncf", Title: "cncf quarantine"})
+	report := lib.RunReport{
+		RunID: "run-1",
+		Tasks: []lib.ReportTask{
+			{Fixture: "lfn/onap", Endpoint: "e1", Data: &lib.ReportPhase{Outcome: lib.ReportOutcomeFailed, Error: "p2o.py error"}},
+			{Fixture: "lfn/onap", Endpoint: "e2", Data: &lib.ReportPhase{Outcome: lib.ReportOutcomeOK}},
+			{Fixture: "cncf/k8s", Endpoint: "e3", Data: &lib.ReportPhase{Outcome: lib.ReportOutcomeOK}, Affs: &lib.ReportPhase{Outcome: lib.ReportOutcomeOK}},
+			{Fixture: "cncf/k8s", Endpoint: "e4", Data: &lib.ReportPhase{Outcome: lib.ReportOutcomeSkipped}},
+		},
+	}
+	lib.NotifyRunReport(&ctx, report)
+
+	// Test cases
+	var testCases = []struct {
+		fn     string
+		events []string
+	}{
+		{
+			fn: all,
+			events: []string{
+				lib.NotifyLockTimeout + "::lock",
+				lib.NotifyQuarantine + ":lfn:lfn quarantine",
+				lib.NotifyQuarantine + ":cncf:cncf quarantine",
+				lib.NotifyRunFinished + "::run run-1 finished, 1 failures",
+				lib.NotifyFailureRate + ":lfn:lfn: failure rate 50.00% exceeds 40.00%",
+			},
+		},
+		{
+			fn: lfn,
+			events: []string{
+				lib.NotifyQuarantine + ":lfn:lfn quarantine",
+				lib.NotifyRunFinished + ":lfn:lfn: run run-1 finished, 1 failures",
+				lib.NotifyFailureRate + ":lfn:lfn: failure rate 50.00% exceeds 40.00%",
+			},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := []string{}
+		for _, n := range readNotifications(t, test.fn) {
+			got = append(got, n.Event+":"+n.Foundation+":"+n.Title)
+			if n.RunID != "run-1" {
+				t.Errorf("test number %d, expected run ID in notification %+v", index+1, n)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(test.events, "\n") {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, strings.Join(test.events, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	bodies := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies[req.URL.Path] = string(body)
+	}))
+	defer srv.Close()
+	sinks, err := lib.ParseNotifySinks("slack:" + srv.URL + "/slack;webhook:" + srv.URL + "/hook")
+	if err != nil {
+		t.Fatalf("parse error: %+v", err)
+	}
+	ctx := lib.Ctx{NotifySinks: sinks}
+	lib.Notify(&ctx, lib.Notification{Event: lib.NotifyFatal, Level: lib.LogLevelFatal, Title: "fatal error", Text: "details"})
+	var slack struct {
+		Text string `json:"text"`
+	}
+	err = jsoniter.Unmarshal([]byte(bodies["/slack"]), &slack)
+	if err != nil || slack.Text != "*[fatal] fatal error*\ndetails" {
+		t.Errorf("unexpected Slack payload: %s", bodies["/slack"])
+	}
+	var n lib.Notification
+	err = jsoniter.Unmarshal([]byte(bodies["/hook"]), &n)
+	if err != nil || n.Event != lib.NotifyFatal || n.Text != "details" {
+		t.Errorf("unexpected webhook payload: %s", bodies["/hook"])
+	}
+}
@@ -0,0 +1,347 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// projectBatchScript - sets project of documents whose origin is in params.projects map (origin -> project)
+const projectBatchScript string = "if (params.projects.containsKey(ctx._source.origin)) " +
+	"{ctx._source.project=params.projects[ctx._source.origin];ctx._source.project_ts=params.ts} else {ctx.op='noop'}"
+
+// projectAllScript - sets project of all documents
+const projectAllScript string = "ctx._source.project=params.project;ctx._source.project_ts=params.ts"
+
+// ProjectUpdate - project to set on documents of a given origin (or on all documents when origin is ProjectNoOrigin)
+// Must and MustNot are optional additional ES query conditions (comma separated JSON objects)
+type ProjectUpdate struct {
+	Origin  string
+	Project string
+	Must    string
+	MustNot string
+}
+
+// ProjectResult - number of documents that got project set for a given origin
+type ProjectResult struct {
+	Origin  string
+	Project string
+	Updated int64
+}
+
+// esTaskStatus - ES task status (GET /_tasks/id), response is only set when task is completed
+type esTaskStatus struct {
+	Completed bool `json:"completed"`
+	Response  struct {
+		Updated  int64         `json:"updated"`
+		Failures []interface{} `json:"failures"`
+	} `json:"response"`
+	Error interface{} `json:"error"`
+}
+
+// esOriginBuckets - terms aggregation by origin (with optional max project_ts)
+type esOriginBuckets struct {
+	Aggregations struct {
+		Origins struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int64  `json:"doc_count"`
+				TS       struct {
+					Value *float64 `json:"value"`
+				} `json:"ts"`
+			} `json:"buckets"`
+		} `json:"origins"`
+	} `json:"aggregations"`
+}
+
+// batchable - updates without extra conditions can share a single update script
+func (u *ProjectUpdate) batchable() bool {
+	return u.Origin != ProjectNoOrigin && u.Must == "" && u.MustNot == ""
+}
+
+// ProjectBatches - splits project updates into batches of at most size origins updated by a single script
+// Updates with extra conditions or without origin are always updated alone, the same origin never repeats in a batch
+func ProjectBatches(updates []ProjectUpdate, size int) (batches [][]ProjectUpdate) {
+	if size < 1 {
+		size = 1
+	}
+	batch := []ProjectUpdate{}
+	origins := make(map[string]struct{})
+	flush := func() {
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+		batch = []ProjectUpdate{}
+		origins = make(map[string]struct{})
+	}
+	for _, update := range updates {
+		if !update.batchable() {
+			batches = append(batches, []ProjectUpdate{update})
+			continue
+		}
+		_, ok := origins[update.Origin]
+		if ok || len(batch) >= size {
+			flush()
+		}
+		batch = append(batch, update)
+		origins[update.Origin] = struct{}{}
+	}
+	flush()
+	return
+}
+
+// projectValue - JSON value of project (Null means null project)
+func projectValue(project string) string {
+	if project == Null {
+		return "null"
+	}
+	return `"` + jsonEscape(project) + `"`
+}
+
+// projectQuery - ES query selecting batch documents, for origins with epoch > 0 only documents not updated since then
+func projectQuery(batch []ProjectUpdate, epochs map[string]int64) string {
+	if len(batch) == 1 && batch[0].Origin == ProjectNoOrigin {
+		return `{"match_all":{}}`
+	}
+	fresh := []string{}
+	clauses := []string{}
+	for _, update := range batch {
+		epoch := epochs[update.Origin]
+		if epoch == 0 && update.batchable() {
+			fresh = append(fresh, `"`+jsonEscape(update.Origin)+`"`)
+			continue
+		}
+		must := fmt.Sprintf(`{"term":{"origin":"%s"}}`, jsonEscape(update.Origin))
+		if update.Must != "" {
+			must += "," + update.Must
+		}
+		mustNot := []string{}
+		if epoch > 0 {
+			mustNot = append(mustNot, fmt.Sprintf(`{"range":{"project_ts":{"lte":%d}}}`, epoch))
+		}
+		if update.MustNot != "" {
+			mustNot = append(mustNot, update.MustNot)
+		}
+		clause := `{"bool":{"must":[` + must + `]`
+		if len(mustNot) > 0 {
+			clause += `,"must_not":[` + strings.Join(mustNot, ",") + `]`
+		}
+		clauses = append(clauses, clause+`}}`)
+	}
+	if len(fresh) > 0 {
+		clauses = append([]string{`{"terms":{"origin":[` + strings.Join(fresh, ",") + `]}}`}, clauses...)
+	}
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	return `{"bool":{"should":[` + strings.Join(clauses, ",") + `],"minimum_should_match":1}}`
+}
+
+// ProjectUpdateQuery - returns update by query payload setting projects (and project_ts = ts) of a batch in a single painless script
+func ProjectUpdateQuery(batch []ProjectUpdate, epochs map[string]int64, ts int64) string {
+	query := projectQuery(batch, epochs)
+	if len(batch) == 1 && batch[0].Origin == ProjectNoOrigin {
+		return fmt.Sprintf(
+			`{"script":{"source":"%s","lang":"painless","params":{"project":%s,"ts":%d}},"query":%s}`,
+			jsonEscape(projectAllScript),
+			projectValue(batch[0].Project),
+			ts,
+			query,
+		)
+	}
+	projects := []string{}
+	for _, update := range batch {
+		projects = append(projects, `"`+jsonEscape(update.Origin)+`":`+projectValue(update.Project))
+	}
+	return fmt.Sprintf(
+		`{"script":{"source":"%s","lang":"painless","params":{"projects":{%s},"ts":%d}},"query":%s}`,
+		jsonEscape(projectBatchScript),
+		strings.Join(projects, ","),
+		ts,
+		query,
+	)
+}
+
+// originBuckets - runs search with terms aggregation by origin, returns nil when index does not exist
+func originBuckets(ctx *Ctx, index, data string) (payload *esOriginBuckets, err error) {
+	path := "/" + index + "/_search"
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil || status == 404 {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	payload = &esOriginBuckets{}
+	err = jsoniter.Unmarshal(body, payload)
+	if err != nil {
+		err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Post, path, err, body)
+	}
+	return
+}
+
+// lastProjectEpochs - returns the most recent project_ts of batch origins (all origins in a single query)
+func lastProjectEpochs(ctx *Ctx, index string, batch []ProjectUpdate) (epochs map[string]int64, err error) {
+	epochs = make(map[string]int64)
+	if len(batch) == 1 && batch[0].Origin == ProjectNoOrigin {
+		return
+	}
+	data := fmt.Sprintf(
+		`{"size":0,"query":{"bool":{"must":[%s,{"exists":{"field":"project_ts"}}]}},"aggs":{"origins":{"terms":{"field":"origin","size":%d},"aggs":{"ts":{"max":{"field":"project_ts"}}}}}}`,
+		projectQuery(batch, nil),
+		len(batch),
+	)
+	payload, err := originBuckets(ctx, index, data)
+	if err != nil || payload == nil {
+		return
+	}
+	for _, bucket := range payload.Aggregations.Origins.Buckets {
+		if bucket.TS.Value != nil {
+			epochs[bucket.Key] = int64(*bucket.TS.Value)
+		}
+	}
+	return
+}
+
+// projectCounts - returns number of batch documents per origin that got project set with a given ts
+func projectCounts(ctx *Ctx, index string, batch []ProjectUpdate, ts int64) (counts map[string]int64, err error) {
+	counts = make(map[string]int64)
+	data := fmt.Sprintf(
+		`{"size":0,"query":{"bool":{"must":[%s,{"term":{"project_ts":%d}}]}},"aggs":{"origins":{"terms":{"field":"origin","size":%d}}}}`,
+		projectQuery(batch, nil),
+		ts,
+		len(batch),
+	)
+	payload, err := originBuckets(ctx, index, data)
+	if err != nil || payload == nil {
+		return
+	}
+	for _, bucket := range payload.Aggregations.Origins.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	return
+}
+
+// UpdateByQueryTask - runs sliced and throttled (SDS_PROJECT_SLICES, SDS_PROJECT_RPS) update by query as an ES task
+// Task status is polled every SDS_PROJECT_POLL, task is cancelled when not finished within SDS_PROJECT_TIMEOUT
+func UpdateByQueryTask(ctx *Ctx, index, data string) (updated int64, err error) {
+	slices := ctx.ProjectSlices
+	if slices == "" {
+		slices = "auto"
+	}
+	rps := "-1"
+	if ctx.ProjectRPS > 0 {
+		rps = strconv.FormatFloat(ctx.ProjectRPS, 'f', -1, 64)
+	}
+	path := fmt.Sprintf("/%s/_update_by_query?conflicts=proceed&refresh=true&slices=%s&requests_per_second=%s&wait_for_completion=false", index, slices, rps)
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		return
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	err = jsoniter.Unmarshal(body, &started)
+	if err != nil || started.Task == "" {
+		err = fmt.Errorf("Method:%s url:%s no task started (%+v)\n%s", Post, path, err, body)
+		return
+	}
+	poll := ctx.ProjectPoll
+	if poll <= 0 {
+		poll = time.Duration(5) * time.Second
+	}
+	taskPath := "/_tasks/" + started.Task
+	dtStart := time.Now()
+	for {
+		time.Sleep(poll)
+		status, body, err = esRequest(ctx, Printf, Get, taskPath, "")
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, taskPath, status, body)
+			return
+		}
+		var task esTaskStatus
+		err = jsoniter.Unmarshal(body, &task)
+		if err != nil {
+			err = fmt.Errorf("Method:%s url:%s JSON decode error: %+v\n%s", Get, taskPath, err, body)
+			return
+		}
+		if task.Completed {
+			updated = task.Response.Updated
+			if task.Error != nil {
+				err = fmt.Errorf("task %s (index %s) failed: %+v", started.Task, index, task.Error)
+			} else if len(task.Response.Failures) > 0 {
+				err = fmt.Errorf("task %s (index %s) finished with %d failures: %+v", started.Task, index, len(task.Response.Failures), task.Response.Failures[0])
+			}
+			return
+		}
+		if ctx.ProjectTimeout > 0 && time.Since(dtStart) > ctx.ProjectTimeout {
+			_, _, _ = esRequest(ctx, Printf, Post, taskPath+"/_cancel", "")
+			err = fmt.Errorf("task %s (index %s) not finished after %v, cancelled", started.Task, index, ctx.ProjectTimeout)
+			return
+		}
+		if ctx.Debug > 0 {
+			Printf("Waiting for task %s (index %s), running for %v\n", started.Task, index, time.Since(dtStart))
+		}
+	}
+}
+
+// SetProjects - sets project on documents of given origins, origins are batched into single scripts (up to SDS_PROJECT_BATCH)
+// When incremental, only documents newer than the last project_ts of each origin are updated
+// Returns number of updated documents per origin, processing continues after a failed batch and the first error is returned
+func SetProjects(ctx *Ctx, index string, updates []ProjectUpdate, incremental bool) (results []ProjectResult, err error) {
+	for _, batch := range ProjectBatches(updates, ctx.ProjectBatch) {
+		var (
+			epochs  map[string]int64
+			counts  map[string]int64
+			updated int64
+			e       error
+		)
+		if incremental {
+			epochs, e = lastProjectEpochs(ctx, index, batch)
+			if e != nil {
+				if err == nil {
+					err = e
+				}
+				continue
+			}
+		}
+		ts := time.Now().Unix()
+		data := ProjectUpdateQuery(batch, epochs, ts)
+		if ctx.Debug > 1 {
+			Printf("Set projects query (index '%s'): %s\n", index, data)
+		}
+		updated, e = UpdateByQueryTask(ctx, index, data)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		if len(batch) == 1 {
+			results = append(results, ProjectResult{Origin: batch[0].Origin, Project: batch[0].Project, Updated: updated})
+			continue
+		}
+		counts, e = projectCounts(ctx, index, batch, ts)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		for _, update := range batch {
+			results = append(results, ProjectResult{Origin: update.Origin, Project: update.Project, Updated: counts[update.Origin]})
+		}
+	}
+	return
+}
@@ -0,0 +1,166 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestProjectBatches(t *testing.T) {
+	a := lib.ProjectUpdate{Origin: "a", Project: "A"}
+	b := lib.ProjectUpdate{Origin: "b", Project: "B"}
+	c := lib.ProjectUpdate{Origin: "c", Project: "C"}
+	cond := lib.ProjectUpdate{Origin: "a", Project: "X", Must: `{"term":{"x":"y"}}`}
+	all := lib.ProjectUpdate{Origin: lib.ProjectNoOrigin, Project: "All"}
+	a2 := lib.ProjectUpdate{Origin: "a", Project: "A2"}
+
+	// Test cases
+	var testCases = []struct {
+		updates  []lib.ProjectUpdate
+		size     int
+		expected [][]lib.ProjectUpdate
+	}{
+		{updates: []lib.ProjectUpdate{}, size: 2},
+		{updates: []lib.ProjectUpdate{a, b, c}, size: 500, expected: [][]lib.ProjectUpdate{{a, b, c}}},
+		{updates: []lib.ProjectUpdate{a, b, c}, size: 2, expected: [][]lib.ProjectUpdate{{a, b}, {c}}},
+		{updates: []lib.ProjectUpdate{a, b, c}, size: 0, expected: [][]lib.ProjectUpdate{{a}, {b}, {c}}},
+		{updates: []lib.ProjectUpdate{a, cond, b, all, c}, size: 10, expected: [][]lib.ProjectUpdate{{cond}, {all}, {a, b, c}}},
+		{updates: []lib.ProjectUpdate{a, b, a2, c}, size: 10, expected: [][]lib.ProjectUpdate{{a, b}, {a2, c}}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.ProjectBatches(test.updates, test.size)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestProjectUpdateQuery(t *testing.T) {
+	batchScript := `"script":{"source":"if (params.projects.containsKey(ctx._source.origin)) {ctx._source.project=params.projects[ctx._source.origin];ctx._source.project_ts=params.ts} else {ctx.op='noop'}","lang":"painless",`
+
+	// Test cases
+	var testCases = []struct {
+		batch    []lib.ProjectUpdate
+		epochs   map[string]int64
+		expected string
+	}{
+		{
+			batch: []lib.ProjectUpdate{{Origin: lib.ProjectNoOrigin, Project: lib.Null}},
+			expected: `{"script":{"source":"ctx._source.project=params.project;ctx._source.project_ts=params.ts","lang":"painless","params":{"project":null,"ts":100}},` +
+				`"query":{"match_all":{}}}`,
+		},
+		{
+			batch:    []lib.ProjectUpdate{{Origin: "a", Project: "A"}, {Origin: `b"`, Project: lib.Null}},
+			expected: `{` + batchScript + `"params":{"projects":{"a":"A","b\"":null},"ts":100}},"query":{"terms":{"origin":["a","b\""]}}}`,
+		},
+		{
+			batch:  []lib.ProjectUpdate{{Origin: "a", Project: "A"}, {Origin: "b", Project: "B"}},
+			epochs: map[string]int64{"b": 50},
+			expected: `{` + batchScript + `"params":{"projects":{"a":"A","b":"B"},"ts":100}},"query":{"bool":{"should":[` +
+				`{"terms":{"origin":["a"]}},{"bool":{"must":[{"term":{"origin":"b"}}],"must_not":[{"range":{"project_ts":{"lte":50}}}]}}],"minimum_should_match":1}}}`,
+		},
+		{
+			batch:  []lib.ProjectUpdate{{Origin: "a", Project: "A", Must: `{"m":1}`, MustNot: `{"n":1}`}},
+			epochs: map[string]int64{"a": 50},
+			expected: `{` + batchScript + `"params":{"projects":{"a":"A"},"ts":100}},` +
+				`"query":{"bool":{"must":[{"term":{"origin":"a"}},{"m":1}],"must_not":[{"range":{"project_ts":{"lte":50}}},{"n":1}]}}}`,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.ProjectUpdateQuery(test.batch, test.epochs, 100)
+		if got != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSetProjects(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	var (
+		polls    int
+		updates  []string
+		running  int
+		failures string
+		cancels  int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/_update_by_query"):
+			if req.URL.Query().Get("wait_for_completion") != "false" || req.URL.Query().Get("slices") != "2" || req.URL.Query().Get("requests_per_second") != "10.5" {
+				w.WriteHeader(400)
+				return
+			}
+			updates = append(updates, string(body))
+			fmt.Fprintf(w, `{"task":"node:%d"}`, len(updates))
+		case strings.HasSuffix(req.URL.Path, "/_cancel"):
+			cancels++
+			fmt.Fprintf(w, `{}`)
+		case strings.HasPrefix(req.URL.Path, "/_tasks/"):
+			polls++
+			if polls <= running {
+				fmt.Fprintf(w, `{"completed":false,"task":{}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"completed":true,"response":{"updated":7,"failures":[%s]}}`, failures)
+		case strings.HasSuffix(req.URL.Path, "/_search"):
+			if strings.Contains(string(body), `"max"`) {
+				fmt.Fprintf(w, `{"aggregations":{"origins":{"buckets":[{"key":"b","doc_count":3,"ts":{"value":50}},{"key":"a","doc_count":0,"ts":{"value":null}}]}}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"aggregations":{"origins":{"buckets":[{"key":"a","doc_count":4},{"key":"b","doc_count":3}]}}}`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL, ProjectBatch: 10, ProjectSlices: "2", ProjectRPS: 10.5, ProjectPoll: time.Millisecond}
+	projects := []lib.ProjectUpdate{
+		{Origin: "a", Project: "A"},
+		{Origin: "b", Project: "B"},
+		{Origin: "c", Project: "C", Must: `{"term":{"x":"y"}}`},
+	}
+
+	// Incremental: single script for a and b (only b has project_ts), separate one for c
+	running = 2
+	results, err := lib.SetProjects(&ctx, "idx", projects, true)
+	expected := []lib.ProjectResult{{Origin: "c", Project: "C", Updated: 7}, {Origin: "a", Project: "A", Updated: 4}, {Origin: "b", Project: "B", Updated: 3}}
+	if err != nil || !reflect.DeepEqual(results, expected) || len(updates) != 2 || polls != 4 {
+		t.Errorf("expected %+v, got %+v (updates %d, polls %d): %+v", expected, results, len(updates), polls, err)
+	}
+	if len(updates) > 1 && !strings.Contains(updates[1], `{"terms":{"origin":["a"]}},{"bool":{"must":[{"term":{"origin":"b"}}],"must_not":[{"range":{"project_ts":{"lte":50}}}]}}`) {
+		t.Errorf("unexpected incremental query %s", updates[1])
+	}
+
+	// Full update
+	updates, polls, running = nil, 0, 0
+	_, err = lib.SetProjects(&ctx, "idx", projects[:2], false)
+	if err != nil || len(updates) != 1 || !strings.Contains(updates[0], `"query":{"terms":{"origin":["a","b"]}}`) {
+		t.Errorf("unexpected full update %+v: %+v", updates, err)
+	}
+
+	// Task failures are reported, other batches are still processed
+	updates, polls, failures = nil, 0, `{"cause":"x"}`
+	results, err = lib.SetProjects(&ctx, "idx", projects, false)
+	if err == nil || len(updates) != 2 || len(results) != 0 {
+		t.Errorf("expected failures error and 2 updates, got %+v %+v: %+v", updates, results, err)
+	}
+
+	// Timeout cancels the task
+	updates, polls, failures, running = nil, 0, "", 1000
+	ctx.ProjectTimeout = time.Duration(5) * time.Millisecond
+	_, err = lib.SetProjects(&ctx, "idx", projects[2:], false)
+	if err == nil || cancels != 1 {
+		t.Errorf("expected cancelled task, got %d cancels: %+v", cancels, err)
+	}
+}
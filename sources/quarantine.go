@@ -0,0 +1,202 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// QuarantineInfo - quarantine state of a single index/endpoint (as stored in "sdssyncinfo" index)
+type QuarantineInfo struct {
+	Index               string     `json:"index"`
+	Endpoint            string     `json:"endpoint"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	QuarantinedUntil    *time.Time `json:"quarantined_until"`
+	DataSyncError       *string    `json:"data_sync_error"`
+	DataSyncErrClass    *string    `json:"data_sync_error_class"`
+	DataSyncErrorDt     *time.Time `json:"data_sync_error_dt"`
+}
+
+// Key - index/endpoint key used to lookup quarantine state of a task
+func (qi QuarantineInfo) Key() [2]string {
+	return [2]string{qi.Index, qi.Endpoint}
+}
+
+// Active - is endpoint still quarantined at a given time
+func (qi QuarantineInfo) Active(now time.Time) bool {
+	return qi.QuarantinedUntil != nil && now.Before(*qi.QuarantinedUntil)
+}
+
+// QuarantinePeriod - returns quarantine period for a given number of consecutive failures
+// Returns 0 when quarantine is disabled or when the number of failures is below SDS_QUARANTINE_AFTER
+// Each next failure doubles the quarantine period, capped by SDS_QUARANTINE_MAX
+func QuarantinePeriod(ctx *Ctx, failures int) time.Duration {
+	if ctx.QuarantineAfter <= 0 || failures < ctx.QuarantineAfter {
+		return 0
+	}
+	period := float64(ctx.QuarantineBase) * math.Pow(2.0, float64(failures-ctx.QuarantineAfter))
+	if period > float64(ctx.QuarantineMax) {
+		return ctx.QuarantineMax
+	}
+	return time.Duration(period)
+}
+
+// esQuarantineSearchResult - search result containing quarantine states
+type esQuarantineSearchResult struct {
+	Hits struct {
+		Hits []struct {
+			Source QuarantineInfo `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// GetQuarantined - returns all index/endpoints that have quarantine date set (including already expired ones)
+func GetQuarantined(ctx *Ctx) (items []QuarantineInfo, err error) {
+	index := "sdssyncinfo"
+	data := `{"query":{"exists":{"field":"quarantined_until"}}}`
+	payloadBody := bytes.NewReader([]byte(data))
+	method := Post
+	url := fmt.Sprintf("%s/%s/_search?size=10000", ctx.ElasticURL, index)
+	rurl := fmt.Sprintf("/%s/_search?size=10000", index)
+	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
+	if err != nil {
+		Printf("New request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		Printf("Do request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != 200 {
+		body, e := ioutil.ReadAll(resp.Body)
+		if e != nil {
+			err = e
+			Printf("ReadAll request error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+			return
+		}
+		// No sync info index yet means that nothing is quarantined
+		if resp.StatusCode == 404 {
+			return
+		}
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", method, rurl, resp.StatusCode, data, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var payload esQuarantineSearchResult
+	err = jsoniter.NewDecoder(resp.Body).Decode(&payload)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s, data: %s\n", err, method, rurl, data)
+		return
+	}
+	for _, hit := range payload.Hits.Hits {
+		items = append(items, hit.Source)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Index == items[j].Index {
+			return items[i].Endpoint < items[j].Endpoint
+		}
+		return items[i].Index < items[j].Index
+	})
+	return
+}
+
+// ReleaseQuarantine - releases given index/endpoint from quarantine and resets its consecutive failures counter
+// When endpoint is empty, all quarantined endpoints of the given index are released
+func ReleaseQuarantine(ctx *Ctx, index, endpoint string) (released int, err error) {
+	esIndex := "sdssyncinfo"
+	// index and endpoint are keyword fields, term queries match them exactly (endpoints are URLs, they must not be parsed as Lucene syntax)
+	must := []string{fmt.Sprintf(`{"term":{"index":"%s"}}`, jsonEscape(index))}
+	if endpoint != "" {
+		must = append(must, fmt.Sprintf(`{"term":{"endpoint":"%s"}}`, jsonEscape(endpoint)))
+	}
+	must = append(must, `{"exists":{"field":"quarantined_until"}}`)
+	esQuery := strings.Join(must, ",")
+	data := fmt.Sprintf(
+		`{"script":{"source":"ctx._source.consecutive_failures=0;ctx._source.quarantined_until=null","lang":"painless"},`+
+			`"query":{"bool":{"must":[%s]}}}`,
+		esQuery,
+	)
+	payloadBody := bytes.NewReader([]byte(data))
+	method := Post
+	url := fmt.Sprintf("%s/%s/_update_by_query?conflicts=proceed&refresh=true", ctx.ElasticURL, esIndex)
+	rurl := fmt.Sprintf("/%s/_update_by_query?conflicts=proceed&refresh=true", esIndex)
+	req, err := http.NewRequest(method, os.ExpandEnv(url), payloadBody)
+	if err != nil {
+		Printf("New request error: %+v for %s url: %s, query: %s\n", err, method, rurl, esQuery)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		Printf("Do request error: %+v for %s url: %s, query: %s\n", err, method, rurl, esQuery)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != 200 {
+		body, e := ioutil.ReadAll(resp.Body)
+		if e != nil {
+			err = e
+			Printf("ReadAll request error: %+v for %s url: %s, query: %s\n", err, method, rurl, esQuery)
+			return
+		}
+		err = fmt.Errorf("Method:%s url:%s status:%d query:%s\n%s", method, rurl, resp.StatusCode, esQuery, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var result struct {
+		Updated int `json:"updated"`
+	}
+	err = jsoniter.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s, query: %s\n", err, method, rurl, esQuery)
+		return
+	}
+	released = result.Updated
+	return
+}
+
+// PrintQuarantineReport - prints currently quarantined endpoints together with their last error
+func PrintQuarantineReport(items []QuarantineInfo, now time.Time) {
+	active := []QuarantineInfo{}
+	for _, item := range items {
+		if item.Active(now) {
+			active = append(active, item)
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+	Printf("Quarantined endpoints: %d\n", len(active))
+	for _, item := range active {
+		lastErr, errClass, errDt := "", ErrorClassUnknown, ""
+		if item.DataSyncError != nil {
+			lastErr = *item.DataSyncError
+		}
+		if item.DataSyncErrClass != nil && *item.DataSyncErrClass != "" {
+			errClass = *item.DataSyncErrClass
+		}
+		if item.DataSyncErrorDt != nil {
+			errDt = ToYMDHMSDate(*item.DataSyncErrorDt)
+		}
+		Printf(
+			"Quarantined: %s %s: failures: %d, until: %s (%v left), last error (%s, %s): %s\n",
+			item.Index, item.Endpoint, item.ConsecutiveFailures, ToYMDHMSDate(*item.QuarantinedUntil),
+			item.QuarantinedUntil.Sub(now).Truncate(time.Second), errClass, errDt, FilterRedacted(lastErr),
+		)
+	}
+}
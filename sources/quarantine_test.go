@@ -0,0 +1,89 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestQuarantinePeriod(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	// Quarantine is disabled by default
+	if got := lib.QuarantinePeriod(&ctx, 100); got != 0 {
+		t.Errorf("expected no quarantine when disabled, got %v", got)
+	}
+	ctx.QuarantineAfter = 3
+	ctx.QuarantineBase = time.Duration(24) * time.Hour
+	ctx.QuarantineMax = time.Duration(168) * time.Hour
+	// Test cases
+	var testCases = []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 0},
+		{failures: 2, expected: 0},
+		{failures: 3, expected: 24 * time.Hour},
+		{failures: 4, expected: 48 * time.Hour},
+		{failures: 5, expected: 96 * time.Hour},
+		{failures: 6, expected: 168 * time.Hour},
+		{failures: 60, expected: 168 * time.Hour},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.QuarantinePeriod(&ctx, test.failures)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestQuarantineActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	// Test cases
+	var testCases = []struct {
+		until    *time.Time
+		expected bool
+	}{
+		{until: nil, expected: false},
+		{until: &past, expected: false},
+		{until: &now, expected: false},
+		{until: &future, expected: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		qi := lib.QuarantineInfo{Index: "sds-a-git", Endpoint: "https://github.com/a/b", QuarantinedUntil: test.until}
+		got := qi.Active(now)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestReleaseQuarantine(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body = string(data)
+		fmt.Fprintf(w, `{"updated":1}`)
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+	released, err := lib.ReleaseQuarantine(&ctx, "sds-a-git", "https://github.com/a/b")
+	if err != nil || released != 1 {
+		t.Fatalf("expected 1 released, got %d: %+v", released, err)
+	}
+	expected := `{"script":{"source":"ctx._source.consecutive_failures=0;ctx._source.quarantined_until=null","lang":"painless"},` +
+		`"query":{"bool":{"must":[{"term":{"index":"sds-a-git"}},{"term":{"endpoint":"https://github.com/a/b"}},{"exists":{"field":"quarantined_until"}}]}}}`
+	if body != expected {
+		t.Errorf("expected query %s, got %s", expected, body)
+	}
+}
@@ -0,0 +1,330 @@
+package syncdatasources
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ReportOutcomeOK - task phase succeeded
+const ReportOutcomeOK string = "ok"
+
+// ReportOutcomeFailed - task phase failed
+const ReportOutcomeFailed string = "failed"
+
+// ReportOutcomeSkipped - task phase was not executed (sync frequency, quarantine, dry run etc.)
+const ReportOutcomeSkipped string = "skipped"
+
+// ReportChangeIndex - index change (drop, rename, create)
+const ReportChangeIndex string = "index"
+
+// ReportChangeAlias - alias change (add, remove, view, role)
+const ReportChangeAlias string = "alias"
+
+// ReportPhase - outcome of a single task phase (data or affs)
+type ReportPhase struct {
+	Outcome         string  `json:"outcome"`
+	Code            int     `json:"code"`
+	Error           string  `json:"error,omitempty"`
+	ErrorClass      string  `json:"error_class,omitempty"`
+	Retries         int     `json:"retries"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// ReportTask - single task in a run report, phases that were not run are nil
+type ReportTask struct {
+	Idx            int          `json:"idx"`
+	Fixture        string       `json:"fixture"`
+	FixtureFile    string       `json:"fixture_file"`
+	DataSource     string       `json:"data_source"`
+	FullDataSource string       `json:"full_data_source"`
+	Project        string       `json:"project,omitempty"`
+	Endpoint       string       `json:"endpoint"`
+	CommandLine    string       `json:"command_line,omitempty"`
+	Data           *ReportPhase `json:"data,omitempty"`
+	Affs           *ReportPhase `json:"affs,omitempty"`
+}
+
+// ReportSummary - per data source or per fixture tasks summary
+type ReportSummary struct {
+	Name      string `json:"name"`
+	Tasks     int    `json:"tasks"`
+	Processed int    `json:"processed"`
+	Failed    int    `json:"failed"`
+}
+
+// ReportChange - index or alias change made by the run
+type ReportChange struct {
+	Dt     time.Time `json:"dt"`
+	Type   string    `json:"type"`
+	Action string    `json:"action"`
+	Name   string    `json:"name"`
+	Target string    `json:"target,omitempty"`
+}
+
+// RunReport - structured run report, saved as JSON and HTML files and optionally in "sdsruns" index
+type RunReport struct {
+	Dt              time.Time       `json:"dt"`
+	When            string          `json:"when"`
+	RunID           string          `json:"run_id"`
+	Host            string          `json:"host"`
+	NodeIdx         int             `json:"node_idx"`
+	NodeNum         int             `json:"node_num"`
+	DryRun          bool            `json:"dry_run"`
+	Started         time.Time       `json:"started"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Phase           string          `json:"phase"`
+	All             int             `json:"all"`
+	Processed       int             `json:"processed"`
+	Failed          int             `json:"failed"`
+	Tasks           []ReportTask    `json:"tasks"`
+	DataSources     []ReportSummary `json:"data_sources"`
+	Fixtures        []ReportSummary `json:"fixtures"`
+	Changes         []ReportChange  `json:"changes"`
+}
+
+// runReport - task phases and changes recorded during the run
+type runReport struct {
+	mtx     *sync.Mutex
+	phases  map[int][2]*ReportPhase
+	changes []ReportChange
+}
+
+var gReport = &runReport{
+	mtx:    &sync.Mutex{},
+	phases: make(map[int][2]*ReportPhase),
+}
+
+// RecordTaskResult - records outcome of a finished task phase (task holds retries, error and duration of that phase)
+func RecordTaskResult(idx int, task *Task, affs bool, code int) {
+	phase := &ReportPhase{
+		Outcome:         ReportOutcomeOK,
+		Code:            code,
+		ErrorClass:      task.ErrorClass,
+		Retries:         task.Retries,
+		DurationSeconds: task.Duration.Seconds(),
+	}
+	if code > 0 {
+		phase.Outcome = ReportOutcomeFailed
+		phase.Error = ErrorStrings[code]
+		if task.Err != nil {
+			phase.Error += ": " + FilterRedacted(task.Err.Error())
+		}
+	} else if code < 0 {
+		phase.Outcome = ReportOutcomeSkipped
+		phase.Error = ErrorStrings[code]
+	}
+	gReport.mtx.Lock()
+	phases := gReport.phases[idx]
+	if affs {
+		phases[1] = phase
+	} else {
+		phases[0] = phase
+	}
+	gReport.phases[idx] = phases
+	gReport.mtx.Unlock()
+}
+
+// RecordChange - records index or alias change made by the run
+func RecordChange(typ, action, name, target string) {
+	gReport.mtx.Lock()
+	gReport.changes = append(gReport.changes, ReportChange{Dt: time.Now(), Type: typ, Action: action, Name: name, Target: target})
+	gReport.mtx.Unlock()
+}
+
+// reportSummaries - converts [all, failed, processed] counters into sorted summaries, mul is the number of phases run
+func reportSummaries(counters map[string][3]int, mul int) (summaries []ReportSummary) {
+	summaries = []ReportSummary{}
+	for name, data := range counters {
+		summaries = append(summaries, ReportSummary{Name: name, Tasks: data[0] * mul, Failed: data[1], Processed: data[2]})
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return
+}
+
+// NewRunReport - creates run report from tasks, per data source and per fixture [all, failed, processed] counters
+// and task phases/changes recorded so far, mul is the number of phases run (1 or 2 when both data and affs are run)
+func NewRunReport(ctx *Ctx, when string, tasks []Task, byDs, byFx map[string][3]int, mul int) RunReport {
+	now := time.Now()
+	status := GetRunStatus(ctx)
+	host, _ := os.Hostname()
+	report := RunReport{
+		Dt:              now,
+		When:            when,
+		RunID:           ctx.RunID,
+		Host:            host,
+		NodeIdx:         ctx.NodeIdx,
+		NodeNum:         ctx.NodeNum,
+		DryRun:          ctx.DryRun,
+		Started:         status.Started,
+		DurationSeconds: now.Sub(status.Started).Seconds(),
+		Phase:           status.Phase,
+		All:             len(tasks) * mul,
+		DataSources:     reportSummaries(byDs, mul),
+		Fixtures:        reportSummaries(byFx, mul),
+	}
+	for _, summary := range report.DataSources {
+		report.Processed += summary.Processed
+		report.Failed += summary.Failed
+	}
+	gReport.mtx.Lock()
+	report.Tasks = []ReportTask{}
+	for idx, task := range tasks {
+		phases := gReport.phases[idx]
+		report.Tasks = append(report.Tasks, ReportTask{
+			Idx:            idx,
+			Fixture:        task.FxSlug,
+			FixtureFile:    task.FxFn,
+			DataSource:     task.DsSlug,
+			FullDataSource: task.DsFullSlug,
+			Project:        task.Project,
+			Endpoint:       task.Endpoint,
+			CommandLine:    FilterRedacted(task.RedactedCommandLine),
+			Data:           phases[0],
+			Affs:           phases[1],
+		})
+	}
+	report.Changes = append([]ReportChange{}, gReport.changes...)
+	gReport.mtx.Unlock()
+	sort.SliceStable(report.Tasks, func(i, j int) bool {
+		a, b := report.Tasks[i], report.Tasks[j]
+		if a.Fixture == b.Fixture {
+			if a.FullDataSource == b.FullDataSource {
+				return a.Endpoint < b.Endpoint
+			}
+			return a.FullDataSource < b.FullDataSource
+		}
+		return a.Fixture < b.Fixture
+	})
+	return report
+}
+
+// RunReportFile - returns run report file name (without extension) for a given report point ("init", "final" etc.)
+func RunReportFile(ctx *Ctx, when string) string {
+	return fmt.Sprintf("%s_report_%s_%d_%d", ctx.CSVPrefix, when, ctx.NodeIdx, ctx.NodeNum)
+}
+
+// reportHTML - run report HTML template
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ymdhms": ToYMDHMSDate,
+	"secs": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Truncate(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SDS run report {{.RunID}} ({{.When}})</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 20px; }
+th, td { border: 1px solid #ccc; padding: 3px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.ok { color: #080; }
+.failed { color: #c00; font-weight: bold; }
+.skipped { color: #888; }
+</style>
+</head>
+<body>
+<h1>SDS run report</h1>
+<table>
+<tr><th>Run ID</th><td>{{.RunID}}</td></tr>
+<tr><th>Report point</th><td>{{.When}}</td></tr>
+<tr><th>Host</th><td>{{.Host}}</td></tr>
+<tr><th>Node</th><td>{{.NodeIdx}}/{{.NodeNum}}</td></tr>
+<tr><th>Dry run</th><td>{{.DryRun}}</td></tr>
+<tr><th>Started</th><td>{{ymdhms .Started}}</td></tr>
+<tr><th>Generated</th><td>{{ymdhms .Dt}}</td></tr>
+<tr><th>Duration</th><td>{{secs .DurationSeconds}}</td></tr>
+<tr><th>Phase</th><td>{{.Phase}}</td></tr>
+<tr><th>Processed</th><td>{{.Processed}}/{{.All}}</td></tr>
+<tr><th>Failed</th><td>{{.Failed}}</td></tr>
+</table>
+<h2>Data sources</h2>
+<table>
+<tr><th>Data source</th><th>Tasks</th><th>Processed</th><th>Failed</th></tr>
+{{range .DataSources}}<tr><td>{{.Name}}</td><td>{{.Tasks}}</td><td>{{.Processed}}</td><td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td></tr>
+{{end}}</table>
+<h2>Fixtures</h2>
+<table>
+<tr><th>Fixture</th><th>Tasks</th><th>Processed</th><th>Failed</th></tr>
+{{range .Fixtures}}<tr><td>{{.Name}}</td><td>{{.Tasks}}</td><td>{{.Processed}}</td><td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td></tr>
+{{end}}</table>
+<h2>Index and alias changes</h2>
+<table>
+<tr><th>Time</th><th>Type</th><th>Action</th><th>Name</th><th>Target</th></tr>
+{{range .Changes}}<tr><td>{{ymdhms .Dt}}</td><td>{{.Type}}</td><td>{{.Action}}</td><td>{{.Name}}</td><td>{{.Target}}</td></tr>
+{{end}}</table>
+<h2>Tasks</h2>
+<table>
+<tr><th>Fixture</th><th>Data source</th><th>Project</th><th>Endpoint</th><th>Data</th><th>Affs</th></tr>
+{{range .Tasks}}<tr><td>{{.Fixture}}</td><td>{{.FullDataSource}}</td><td>{{.Project}}</td><td>{{.Endpoint}}</td>
+<td>{{with .Data}}<span class="{{.Outcome}}">{{.Outcome}}</span> {{secs .DurationSeconds}}{{if .Retries}}, retries: {{.Retries}}{{end}}{{if .ErrorClass}}, {{.ErrorClass}}{{end}}{{if .Error}}<br>{{.Error}}{{end}}{{end}}</td>
+<td>{{with .Affs}}<span class="{{.Outcome}}">{{.Outcome}}</span> {{secs .DurationSeconds}}{{if .Retries}}, retries: {{.Retries}}{{end}}{{if .ErrorClass}}, {{.ErrorClass}}{{end}}{{if .Error}}<br>{{.Error}}{{end}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// SaveRunReport - saves run report as JSON and HTML files (see RunReportFile)
+// Final report is also stored in "sdsruns" index when SDS_ES_RUNS is set
+func SaveRunReport(ctx *Ctx, report RunReport) {
+	fn := RunReportFile(ctx, report.When)
+	data, err := jsoniter.MarshalIndent(report, "", "  ")
+	if err != nil {
+		Printf("JSON marshall error: %+v for run report %s\n", err, report.When)
+		return
+	}
+	err = ioutil.WriteFile(fn+".json", data, 0644)
+	if err != nil {
+		Printf("Run report write error: %+v\n", err)
+		return
+	}
+	var buf bytes.Buffer
+	err = reportHTML.Execute(&buf, report)
+	if err != nil {
+		Printf("Run report HTML error: %+v\n", err)
+		return
+	}
+	err = ioutil.WriteFile(fn+".html", buf.Bytes(), 0644)
+	if err != nil {
+		Printf("Run report write error: %+v\n", err)
+		return
+	}
+	Printf("Run report %s.{json,html} written\n", fn)
+	if report.When == "final" && ctx.EsRuns && !ctx.DryRun {
+		EnsureIndex(ctx, SDSRuns, false)
+		err = EsRunReport(ctx, report)
+		if err == nil {
+			Printf("Run report stored in %s index\n", SDSRuns)
+		}
+	}
+}
+
+// EsRunReport - stores run report in "sdsruns" index
+func EsRunReport(ctx *Ctx, report RunReport) (err error) {
+	data, err := jsoniter.Marshal(report)
+	if err != nil {
+		Printf("JSON marshall error: %+v for index: %s\n", err, SDSRuns)
+		return
+	}
+	path := "/" + SDSRuns + "/_doc"
+	status, body, err := esRequest(ctx, Printf, Post, path, string(data))
+	if err != nil {
+		return
+	}
+	if status != 201 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+		Printf("%s\n", err.Error())
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestRunReport(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	dir, err := ioutil.TempDir("", "sds-report")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	ctx := lib.Ctx{CSVPrefix: filepath.Join(dir, "jobs"), NodeIdx: 1, NodeNum: 2, RunID: "run-1"}
+	tasks := []lib.Task{
+		{FxSlug: "b", DsSlug: "git", DsFullSlug: "git", Endpoint: "https://github.com/b/b"},
+		{FxSlug: "a", DsSlug: "git", DsFullSlug: "git", Endpoint: "https://github.com/a/a"},
+		{FxSlug: "a", DsSlug: "jira", DsFullSlug: "jira", Endpoint: "https://jira.a.org"},
+	}
+	tasks[0].Duration = 2 * time.Second
+	lib.RecordTaskResult(0, &tasks[0], false, 0)
+	tasks[1].Err = fmt.Errorf("git clone failed")
+	tasks[1].ErrorClass = "transient"
+	tasks[1].Retries = 2
+	lib.RecordTaskResult(1, &tasks[1], false, 4)
+	lib.RecordTaskResult(2, &tasks[2], false, -3)
+	lib.RecordTaskResult(0, &tasks[0], true, 0)
+	lib.RecordChange(lib.ReportChangeAlias, "add", "sds-a-git", "sds-a-git-raw")
+	byDs := map[string][3]int{"git": {2, 1, 2}, "jira": {1, 0, 1}}
+	byFx := map[string][3]int{"b": {1, 0, 1}, "a": {2, 1, 2}}
+	report := lib.NewRunReport(&ctx, "final", tasks, byDs, byFx, 2)
+
+	// Check counters and summaries
+	if report.All != 6 || report.Processed != 3 || report.Failed != 1 {
+		t.Errorf("expected all/processed/failed 6/3/1, got %d/%d/%d", report.All, report.Processed, report.Failed)
+	}
+	expectedDs := []lib.ReportSummary{{Name: "git", Tasks: 4, Failed: 1, Processed: 2}, {Name: "jira", Tasks: 2, Processed: 1}}
+	if !reflect.DeepEqual(report.DataSources, expectedDs) {
+		t.Errorf("expected data sources %+v, got %+v", expectedDs, report.DataSources)
+	}
+	if len(report.Fixtures) != 2 || report.Fixtures[0].Name != "a" {
+		t.Errorf("expected sorted fixtures summary, got %+v", report.Fixtures)
+	}
+
+	// Check task outcomes (tasks are sorted by fixture, data source and endpoint)
+	var testCases = []struct {
+		endpoint string
+		data     string
+		affs     string
+		err      string
+	}{
+		{endpoint: "https://github.com/a/a", data: lib.ReportOutcomeFailed, err: "p2o.py error: git clone failed"},
+		{endpoint: "https://jira.a.org", data: lib.ReportOutcomeSkipped, err: lib.ErrorStrings[-3]},
+		{endpoint: "https://github.com/b/b", data: lib.ReportOutcomeOK, affs: lib.ReportOutcomeOK},
+	}
+	if len(report.Tasks) != len(testCases) {
+		t.Fatalf("expected %d tasks, got %d", len(testCases), len(report.Tasks))
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		task := report.Tasks[index]
+		if task.Endpoint != test.endpoint || task.Data == nil {
+			t.Errorf("test number %d, expected endpoint %s with data phase, got %+v", index+1, test.endpoint, task)
+			continue
+		}
+		affs := ""
+		if task.Affs != nil {
+			affs = task.Affs.Outcome
+		}
+		if task.Data.Outcome != test.data || affs != test.affs || task.Data.Error != test.err {
+			t.Errorf("test number %d, expected %s/%s/'%s', got %s/%s/'%s'", index+1, test.data, test.affs, test.err, task.Data.Outcome, affs, task.Data.Error)
+		}
+	}
+	found := false
+	for _, change := range report.Changes {
+		if change.Name == "sds-a-git" && change.Target == "sds-a-git-raw" && change.Action == "add" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected alias change to be reported, got %+v", report.Changes)
+	}
+
+	// Check saved files
+	lib.SaveRunReport(&ctx, report)
+	fn := lib.RunReportFile(&ctx, "final")
+	if !strings.HasSuffix(fn, "jobs_report_final_1_2") {
+		t.Errorf("unexpected report file name %s", fn)
+	}
+	data, err := ioutil.ReadFile(fn + ".json")
+	if err != nil {
+		t.Fatalf("report JSON not saved: %+v", err)
+	}
+	var saved lib.RunReport
+	err = jsoniter.Unmarshal(data, &saved)
+	if err != nil || saved.RunID != "run-1" || len(saved.Tasks) != 3 {
+		t.Errorf("invalid saved report JSON: %+v, %s", err, data)
+	}
+	html, err := ioutil.ReadFile(fn + ".html")
+	if err != nil {
+		t.Fatalf("report HTML not saved: %+v", err)
+	}
+	if !strings.Contains(string(html), "git clone failed") || !strings.Contains(string(html), "sds-a-git-raw") {
+		t.Errorf("report HTML misses task error or alias change:\n%s", html)
+	}
+}
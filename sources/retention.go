@@ -0,0 +1,479 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// LifecycleILM - Elasticsearch index lifecycle management
+const LifecycleILM string = "ilm"
+
+// LifecycleISM - OpenSearch index state management
+const LifecycleISM string = "ism"
+
+// LifecycleODISM - Open Distro for Elasticsearch index state management
+const LifecycleODISM string = "opendistro-ism"
+
+// LogLifecyclePolicy - name of the lifecycle policy managing dated "sdslog" indexes
+const LogLifecyclePolicy string = "sds-sdslog"
+
+// logRolloverIndex - first dated "sdslog" index (URL encoded "<sdslog-{now/d}-000001>" date math expression)
+const logRolloverIndex string = "%3Csdslog-%7Bnow%2Fd%7D-000001%3E"
+
+// RetentionIndexes - SDS-owned indexes that support retention
+var RetentionIndexes = []string{SDSLog, SDSData, SDSSyncInfo, SDSRuns}
+
+// Retention - retention of a single SDS-owned index
+// MaxAge - documents older than that (by "dt" field) are removed, 0 means no age limit
+// MaxDocs - only that many newest documents (by "dt" field) are kept, 0 means no doc count limit
+type Retention struct {
+	Index   string
+	MaxAge  time.Duration
+	MaxDocs int64
+}
+
+// String - default string output for an index retention
+func (ir Retention) String() string {
+	return fmt.Sprintf("{Index:%s MaxAge:%v MaxDocs:%d}", ir.Index, ir.MaxAge, ir.MaxDocs)
+}
+
+// parseAge - parses retention age, supports days ("30d") and all Go durations ("720h")
+func parseAge(str string) (time.Duration, error) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(str[:len(str)-1])
+		if err == nil {
+			return time.Duration(days) * time.Duration(24) * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(str)
+}
+
+// ParseRetention - parses retention definition (as specified in SDS_RETENTION)
+// Format is: 'index1=limit1[,limit2];index2=limit1;...'
+// Limit is either age ('30d', '720h') or doc count ('1000000'), for example: 'sdslog=30d,5000000;sdssyncinfo=365d'
+func ParseRetention(str string) (retention []Retention, err error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return
+	}
+	known := make(map[string]struct{})
+	for _, index := range RetentionIndexes {
+		known[index] = struct{}{}
+	}
+	seen := make(map[string]struct{})
+	for _, item := range strings.Split(str, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		ary := strings.Split(item, "=")
+		if len(ary) != 2 || strings.TrimSpace(ary[1]) == "" {
+			err = fmt.Errorf("retention '%s' must be in 'index=limit[,limit]' format", item)
+			return
+		}
+		ret := Retention{Index: strings.TrimSpace(ary[0])}
+		_, ok := known[ret.Index]
+		if !ok {
+			err = fmt.Errorf("retention '%s': unsupported index '%s', supported are: %s", item, ret.Index, strings.Join(RetentionIndexes, ", "))
+			return
+		}
+		_, ok = seen[ret.Index]
+		if ok {
+			err = fmt.Errorf("retention '%s': duplicate index '%s'", item, ret.Index)
+			return
+		}
+		seen[ret.Index] = struct{}{}
+		for _, limit := range strings.Split(ary[1], ",") {
+			limit = strings.TrimSpace(limit)
+			docs, e := strconv.ParseInt(limit, 10, 64)
+			if e == nil {
+				if docs <= 0 {
+					err = fmt.Errorf("retention '%s': doc count must be positive", item)
+					return
+				}
+				ret.MaxDocs = docs
+				continue
+			}
+			age, e := parseAge(limit)
+			if e != nil {
+				err = fmt.Errorf("retention '%s': '%s' is neither age nor doc count: %+v", item, limit, e)
+				return
+			}
+			if age <= 0 {
+				err = fmt.Errorf("retention '%s': age must be positive", item)
+				return
+			}
+			ret.MaxAge = age
+		}
+		retention = append(retention, ret)
+	}
+	sort.SliceStable(retention, func(i, j int) bool {
+		return retention[i].Index < retention[j].Index
+	})
+	return
+}
+
+// GetRetention - returns retention configured for a given index
+func GetRetention(ctx *Ctx, index string) (Retention, bool) {
+	for _, ret := range ctx.Retention {
+		if ret.Index == index {
+			return ret, true
+		}
+	}
+	return Retention{Index: index}, false
+}
+
+// LifecycleEngine - detects index lifecycle engine available in ES: ILM, ISM or none (empty string)
+func LifecycleEngine(ctx *Ctx, printf func(string, ...interface{}) (int, error)) string {
+	probes := []struct {
+		engine string
+		path   string
+	}{
+		{engine: LifecycleILM, path: "/_ilm/status"},
+		{engine: LifecycleISM, path: "/_plugins/_ism/policies"},
+		{engine: LifecycleODISM, path: "/_opendistro/_ism/policies"},
+	}
+	for _, probe := range probes {
+		status, _, err := esRequest(ctx, printf, Get, probe.path, "")
+		if err == nil && status == 200 {
+			return probe.engine
+		}
+	}
+	return ""
+}
+
+// lifecyclePolicy - returns path and payload of the lifecycle policy managing dated "sdslog" indexes
+// Write index is rolled over after SDS_LOG_ROLLOVER_AGE, dated indexes are deleted after "sdslog" retention age (if set)
+func lifecyclePolicy(ctx *Ctx, engine string) (path, data string) {
+	ret, _ := GetRetention(ctx, SDSLog)
+	rolloverAge := int64(ctx.LogRolloverAge.Seconds())
+	maxAge := int64(ret.MaxAge.Seconds())
+	switch engine {
+	case LifecycleILM:
+		path = "/_ilm/policy/" + LogLifecyclePolicy
+		phases := fmt.Sprintf(`"hot":{"actions":{"rollover":{"max_age":"%ds"}}}`, rolloverAge)
+		if maxAge > 0 {
+			phases += fmt.Sprintf(`,"delete":{"min_age":"%ds","actions":{"delete":{}}}`, maxAge)
+		}
+		data = `{"policy":{"phases":{` + phases + `}}}`
+	case LifecycleISM, LifecycleODISM:
+		path = "/_plugins/_ism/policies/" + LogLifecyclePolicy
+		if engine == LifecycleODISM {
+			path = "/_opendistro/_ism/policies/" + LogLifecyclePolicy
+		}
+		transitions := ""
+		deleteState := ""
+		if maxAge > 0 {
+			transitions = fmt.Sprintf(`{"state_name":"delete","conditions":{"min_index_age":"%ds"}}`, maxAge)
+			deleteState = `,{"name":"delete","actions":[{"delete":{}}],"transitions":[]}`
+		}
+		data = fmt.Sprintf(
+			`{"policy":{"description":"SDS sdslog rollover and retention","default_state":"hot","states":[`+
+				`{"name":"hot","actions":[{"rollover":{"min_index_age":"%ds"}}],"transitions":[%s]}%s],`+
+				`"ism_template":{"index_patterns":["%s-*"],"priority":100}}}`,
+			rolloverAge, transitions, deleteState, SDSLog,
+		)
+	}
+	return
+}
+
+// putLifecyclePolicy - installs (or updates when supported) lifecycle policy managing dated "sdslog" indexes
+func putLifecyclePolicy(ctx *Ctx, printf func(string, ...interface{}) (int, error), engine string) bool {
+	path, data := lifecyclePolicy(ctx, engine)
+	if path == "" {
+		return false
+	}
+	status, body, err := esRequest(ctx, printf, Put, path, data)
+	if err != nil {
+		return false
+	}
+	// ISM policies can only be updated by their sequence number, keep an existing policy as it is
+	if status == 409 {
+		printf("%s policy %s already exists, not updating\n", engine, LogLifecyclePolicy)
+		return true
+	}
+	if status != 200 && status != 201 {
+		printf("Method:%s url:%s status:%d data:%s\n%s\n", Put, path, status, data, body)
+		return false
+	}
+	printf("%s policy %s installed\n", engine, LogLifecyclePolicy)
+	return true
+}
+
+// EnsureLogRollover - creates first dated "sdslog" index behind "sdslog" write alias
+// Its mapping and lifecycle settings come from "sdslog" index template (see PutIndexTemplate)
+func EnsureLogRollover(ctx *Ctx, printf func(string, ...interface{}) (int, error)) {
+	path := "/" + logRolloverIndex
+	data := fmt.Sprintf(`{"aliases":{"%s":{"is_write_index":true}}}`, SDSLog)
+	status, body, err := esRequest(ctx, printf, Put, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		printf("Method:%s url:%s status:%d\n%s\n", Put, path, status, body)
+		return
+	}
+	printf("%s dated index and write alias created\n", SDSLog)
+}
+
+// isAlias - checks if given name is an alias
+func isAlias(ctx *Ctx, name string) bool {
+	status, _, err := esRequest(ctx, Printf, Head, "/_alias/"+name, "")
+	return err == nil && status == 200
+}
+
+// RolloverLog - rolls "sdslog" write alias over to a new dated index when current one is older than SDS_LOG_ROLLOVER_AGE
+// Used when there is no ILM/ISM available to do this
+func RolloverLog(ctx *Ctx) (rolled bool, err error) {
+	path := "/" + SDSLog + "/_rollover"
+	data := fmt.Sprintf(`{"conditions":{"max_age":"%ds"}}`, int64(ctx.LogRolloverAge.Seconds()))
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var result struct {
+		RolledOver bool   `json:"rolled_over"`
+		NewIndex   string `json:"new_index"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Post, path)
+		return
+	}
+	rolled = result.RolledOver
+	if rolled {
+		Printf("%s rolled over to %s\n", SDSLog, result.NewIndex)
+	}
+	return
+}
+
+// deleteByQuery - deletes documents matching a given query, returns number of deleted documents
+func deleteByQuery(ctx *Ctx, index, query string) (deleted int64, err error) {
+	path := "/" + index + "/_delete_by_query?conflicts=proceed&refresh=true&timeout=20m"
+	data := `{"query":` + query + `}`
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var result EsByQueryPayload
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Post, path)
+		return
+	}
+	deleted = result.Deleted
+	return
+}
+
+// countDocs - returns number of documents matching a given query
+func countDocs(ctx *Ctx, index, query string) (count int64, err error) {
+	path := "/" + index + "/_count"
+	data := `{"query":` + query + `}`
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var result struct {
+		Count int64 `json:"count"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Post, path)
+		return
+	}
+	count = result.Count
+	return
+}
+
+// dtRange - returns minimum and maximum "dt" (epoch millis) in a given index
+func dtRange(ctx *Ctx, index string) (minDt, maxDt int64, err error) {
+	path := "/" + index + "/_search"
+	data := `{"size":0,"aggs":{"min_dt":{"min":{"field":"dt"}},"max_dt":{"max":{"field":"dt"}}}}`
+	status, body, err := esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d data:%s\n%s", Post, path, status, data, body)
+		Printf("%s\n", err.Error())
+		return
+	}
+	var result struct {
+		Aggregations struct {
+			MinDt struct {
+				Value *float64 `json:"value"`
+			} `json:"min_dt"`
+			MaxDt struct {
+				Value *float64 `json:"value"`
+			} `json:"max_dt"`
+		} `json:"aggregations"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Post, path)
+		return
+	}
+	if result.Aggregations.MinDt.Value == nil || result.Aggregations.MaxDt.Value == nil {
+		err = fmt.Errorf("no dt values in %s index", index)
+		return
+	}
+	minDt = int64(*result.Aggregations.MinDt.Value)
+	maxDt = int64(*result.Aggregations.MaxDt.Value)
+	return
+}
+
+// PruneByAge - deletes documents older than a given age (by "dt" field)
+func PruneByAge(ctx *Ctx, index string, age time.Duration) (int64, error) {
+	return deleteByQuery(ctx, index, fmt.Sprintf(`{"range":{"dt":{"lt":"now-%ds"}}}`, int64(age.Seconds())))
+}
+
+// PruneByDocs - deletes oldest documents (by "dt" field), so at most maxDocs newest documents are left
+// Delete by query cannot be sorted, so cut-off date is found using binary search on documents counts (with 1s precision)
+func PruneByDocs(ctx *Ctx, index string, maxDocs int64) (deleted int64, err error) {
+	total, err := countDocs(ctx, index, `{"match_all":{}}`)
+	if err != nil || total <= maxDocs {
+		return
+	}
+	lo, hi, err := dtRange(ctx, index)
+	if err != nil {
+		return
+	}
+	// count(dt >= lo) > maxDocs and count(dt >= hi) <= maxDocs
+	hi++
+	newer := func(dt int64) string {
+		return fmt.Sprintf(`{"range":{"dt":{"gte":%d,"format":"epoch_millis"}}}`, dt)
+	}
+	for hi-lo > 1000 {
+		mid := lo + (hi-lo)/2
+		count, e := countDocs(ctx, index, newer(mid))
+		if e != nil {
+			err = e
+			return
+		}
+		if count <= maxDocs {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	if ctx.Debug > 0 {
+		Printf("%s: keeping at most %d of %d documents, cut-off date: %s\n", index, maxDocs, total, ToYMDHMSDate(time.Unix(0, hi*int64(time.Millisecond))))
+	}
+	return deleteByQuery(ctx, index, fmt.Sprintf(`{"range":{"dt":{"lt":%d,"format":"epoch_millis"}}}`, hi))
+}
+
+// dropEmptyLogIndexes - deletes dated "sdslog" indexes (other than write index) that have no documents left after pruning
+func dropEmptyLogIndexes(ctx *Ctx) {
+	path := "/_cat/aliases/" + SDSLog + "?format=json&h=index,is_write_index"
+	status, body, err := esRequest(ctx, Printf, Get, path, "")
+	if err != nil || status != 200 {
+		return
+	}
+	var aliases []struct {
+		Index        string `json:"index"`
+		IsWriteIndex string `json:"is_write_index"`
+	}
+	err = jsoniter.Unmarshal(body, &aliases)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Get, path)
+		return
+	}
+	writeIndex := ""
+	for _, alias := range aliases {
+		if alias.IsWriteIndex == "true" {
+			writeIndex = alias.Index
+		}
+	}
+	path = "/_cat/indices/" + SDSLog + "-*?format=json&h=index,docs.count"
+	status, body, err = esRequest(ctx, Printf, Get, path, "")
+	if err != nil || status != 200 {
+		return
+	}
+	var indices []struct {
+		Index string `json:"index"`
+		Count string `json:"docs.count"`
+	}
+	err = jsoniter.Unmarshal(body, &indices)
+	if err != nil {
+		Printf("JSON decode error: %+v for %s url: %s\n", err, Get, path)
+		return
+	}
+	for _, index := range indices {
+		if index.Index == writeIndex || writeIndex == "" || index.Count != "0" {
+			continue
+		}
+		status, body, err = esRequest(ctx, Printf, Delete, "/"+index.Index, "")
+		if err != nil {
+			continue
+		}
+		if status != 200 {
+			Printf("Method:%s url:/%s status:%d\n%s\n", Delete, index.Index, status, body)
+			continue
+		}
+		Printf("Dropped empty %s index %s\n", SDSLog, index.Index)
+	}
+}
+
+// ApplyRetention - applies SDS_RETENTION to SDS-owned indexes
+// Dated "sdslog" indexes (SDS_LOG_ROLLOVER) are rolled over and deleted by ILM/ISM policy when available,
+// otherwise SDS rolls them over itself and drops indexes emptied by pruning
+// All other indexes and limits not handled by a policy are pruned using delete by query
+func ApplyRetention(ctx *Ctx) {
+	rollover, engine := false, ""
+	if ctx.LogRollover && !ctx.SkipEsLog {
+		rollover = isAlias(ctx, SDSLog)
+		if rollover {
+			engine = LifecycleEngine(ctx, Printf)
+			if engine != "" && !putLifecyclePolicy(ctx, Printf, engine) {
+				engine = ""
+			}
+			if engine == "" {
+				_, _ = RolloverLog(ctx)
+			}
+		} else {
+			Printf("%s is a plain index (created before enabling SDS_LOG_ROLLOVER), it must be migrated to use rollover, pruning it instead\n", SDSLog)
+		}
+	}
+	for _, ret := range ctx.Retention {
+		maxAge := ret.MaxAge
+		if ret.Index == SDSLog && engine != "" {
+			// dated indexes older than retention age are deleted by lifecycle policy
+			maxAge = 0
+		}
+		if maxAge > 0 {
+			deleted, err := PruneByAge(ctx, ret.Index, maxAge)
+			if err == nil && deleted > 0 {
+				Printf("%s: pruned %d documents older than %v\n", ret.Index, deleted, maxAge)
+			}
+		}
+		if ret.MaxDocs > 0 {
+			deleted, err := PruneByDocs(ctx, ret.Index, ret.MaxDocs)
+			if err == nil && deleted > 0 {
+				Printf("%s: pruned %d oldest documents above %d documents limit\n", ret.Index, deleted, ret.MaxDocs)
+			}
+		}
+	}
+	if rollover && engine == "" {
+		dropEmptyLogIndexes(ctx)
+	}
+}
@@ -0,0 +1,79 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestParseRetention(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		str      string
+		expected string
+		err      bool
+	}{
+		{str: "", expected: "[]"},
+		{str: "sdslog=30d", expected: "[{Index:sdslog MaxAge:720h0m0s MaxDocs:0}]"},
+		{str: "sdslog=1000", expected: "[{Index:sdslog MaxAge:0s MaxDocs:1000}]"},
+		{str: " sdssyncinfo=90m ; sdslog=2d, 500;", expected: "[{Index:sdslog MaxAge:48h0m0s MaxDocs:500} {Index:sdssyncinfo MaxAge:1h30m0s MaxDocs:0}]"},
+		{str: "sdsdata=1000,168h", expected: "[{Index:sdsdata MaxAge:168h0m0s MaxDocs:1000}]"},
+		{str: "sdslog", err: true},
+		{str: "sdslog=", err: true},
+		{str: "sdslog=x", err: true},
+		{str: "sdslog=0", err: true},
+		{str: "sdslog=-1d", err: true},
+		{str: "sdsmtx=30d", err: true},
+		{str: "sdslog=30d;sdslog=60d", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		retention, err := lib.ParseRetention(test.str)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error for '%s', got %+v", index+1, test.str, retention)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error for '%s': %+v", index+1, test.str, err)
+			continue
+		}
+		got := fmt.Sprintf("%v", retention)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestLifecycleEngine(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		available string
+		expected  string
+	}{
+		{available: "/_ilm/status", expected: lib.LifecycleILM},
+		{available: "/_plugins/_ism/policies", expected: lib.LifecycleISM},
+		{available: "/_opendistro/_ism/policies", expected: lib.LifecycleODISM},
+		{available: "", expected: ""},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != test.available {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		ctx := lib.Ctx{ElasticURL: srv.URL}
+		got := lib.LifecycleEngine(&ctx, lib.PrintfRedacted)
+		srv.Close()
+		if got != test.expected {
+			t.Errorf("test number %d, expected engine '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SharedEndpointsCopyFrom - consumers of a shared endpoint copy its data from owner's index (incremental copy_from by origin)
+const SharedEndpointsCopyFrom = "copy_from"
+
+// SharedEndpointsAlias - consumers of a shared endpoint don't store its data, their aliases point to owner's index filtered by origin
+const SharedEndpointsAlias = "alias"
+
+// SharedEndpoint - endpoint used by more than one fixture with the same data source configuration
+// Owner fixture fetches it into its own index, consumer fixtures get data from owner's index
+type SharedEndpoint struct {
+	DsSlug     string
+	DsFullSlug string
+	Endpoint   string
+	Origin     string
+	Owner      string
+	OwnerIndex string
+	Consumers  []string
+}
+
+// FixtureIndex - SDS index name of a given fixture slug and data source full slug
+func FixtureIndex(fixtureSlug, dsFullSlug string) string {
+	return strings.Replace("sds-"+fixtureSlug+"-"+dsFullSlug, "/", "-", -1)
+}
+
+// TaskIndex - SDS index used by tasks of a given fixture slug and data source full slug
+// da-ds stores GitHub pull requests in GitHub issues index
+func TaskIndex(fixtureSlug, dsFullSlug string, dads bool) string {
+	index := FixtureIndex(fixtureSlug, dsFullSlug)
+	if dads {
+		index = strings.Replace(index, "github-pull_request", "github-issue", -1)
+	}
+	return index
+}
+
+// sharedConfigKey - data source configuration without whitespace and in a stable order, endpoints are shared only when fetched with the same configuration
+func sharedConfigKey(ds *DataSource) string {
+	cfgs := []string{}
+	for _, cfg := range ds.Config {
+		cfgs = append(cfgs, cfg.String())
+	}
+	sort.Strings(cfgs)
+	cfg := strings.Join(cfgs, ",")
+	cfg = strings.Replace(cfg, " ", "", -1)
+	cfg = strings.Replace(cfg, "\t", "", -1)
+	return cfg
+}
+
+// sharedEndpointKey - endpoint's project, groups and affiliation source configuration, consumers get data as fetched and enriched by the owner
+// (with alias mode consumer's endpoints are not processed at all), so endpoints are shared only when these are the same
+func sharedEndpointKey(fixture *Fixture, ep *Endpoint) string {
+	affiliationSource := fixture.Slug
+	if fixture.Native.AffiliationSource != "" {
+		affiliationSource = fixture.Native.AffiliationSource
+	}
+	if ep.AffiliationSource != "" {
+		affiliationSource = ep.AffiliationSource
+	}
+	groups := []string{}
+	for _, group := range ep.Groups {
+		groups = append(groups, fmt.Sprintf("%s:%v:%v:%v:%v", group.Name, group.Skip, group.Only, group.Self, group.Default))
+	}
+	return fmt.Sprintf("%s:%v:%v:%+v:%v:%s", ep.Project, ep.ProjectP2O, ep.ProjectNoOrigin, ep.Projects, groups, affiliationSource)
+}
+
+// FindSharedEndpoints - finds endpoints used by more than one fixture and picks an owner fixture for each of them
+// Endpoints are shared only between fixtures using the same data source configuration, project, groups and affiliation source
+// Dummy endpoints and endpoints copying data from other indices are not fetched, so they are never shared
+// Owner is the first (by slug) fixture that marked the endpoint with 'owner: true', or the first fixture using it when none did
+func FindSharedEndpoints(fixtures []Fixture) (shared []SharedEndpoint) {
+	type usage struct {
+		ds     *DataSource
+		name   string
+		slugs  map[string]struct{}
+		owners map[string]struct{}
+	}
+	eps := make(map[[4]string]*usage)
+	for fi := range fixtures {
+		fixture := &fixtures[fi]
+		for di := range fixture.DataSources {
+			ds := &fixture.DataSources[di]
+			cfg := sharedConfigKey(ds)
+			for _, ep := range ds.Endpoints {
+				if ep.Dummy || (ep.CopyFrom.Pattern != "" && ep.SharedFrom == "") {
+					continue
+				}
+				key := [4]string{ds.FullSlug, ep.Name, cfg, sharedEndpointKey(fixture, &ep)}
+				u, ok := eps[key]
+				if !ok {
+					u = &usage{ds: ds, name: ep.Name, slugs: make(map[string]struct{}), owners: make(map[string]struct{})}
+					eps[key] = u
+				}
+				u.slugs[fixture.Slug] = struct{}{}
+				if ep.Owner {
+					u.owners[fixture.Slug] = struct{}{}
+				}
+			}
+		}
+	}
+	for _, u := range eps {
+		if len(u.slugs) < 2 {
+			continue
+		}
+		slugs := []string{}
+		for slug := range u.slugs {
+			slugs = append(slugs, slug)
+		}
+		sort.Strings(slugs)
+		owner := slugs[0]
+		if len(u.owners) > 0 {
+			owners := []string{}
+			for slug := range u.owners {
+				owners = append(owners, slug)
+			}
+			sort.Strings(owners)
+			owner = owners[0]
+		}
+		ep := SharedEndpoint{
+			DsSlug:     u.ds.Slug,
+			DsFullSlug: u.ds.FullSlug,
+			Endpoint:   u.name,
+			Origin:     MapOrigin(strings.Split(u.name, ":::")[0], u.ds.Slug),
+			Owner:      owner,
+			OwnerIndex: FixtureIndex(owner, u.ds.FullSlug),
+		}
+		for _, slug := range slugs {
+			if slug != owner {
+				ep.Consumers = append(ep.Consumers, slug)
+			}
+		}
+		shared = append(shared, ep)
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].DsFullSlug != shared[j].DsFullSlug {
+			return shared[i].DsFullSlug < shared[j].DsFullSlug
+		}
+		return shared[i].Endpoint < shared[j].Endpoint
+	})
+	return
+}
+
+// AssignSharedEndpoints - marks consumers' endpoints of shared endpoints with owner's index (nothing is done when SDS_SHARED_ENDPOINTS is not set)
+// With copy_from mode consumers' endpoints get incremental copy_from configuration from owner's index, with alias mode they are not fetched at all
+// Consumers get data as fetched and enriched by the owner, so their endpoints are only shared when configured the same way (see FindSharedEndpoints)
+// Returns number of consumers' endpoints
+func AssignSharedEndpoints(ctx *Ctx, fixtures []Fixture, shared []SharedEndpoint) (n int) {
+	if ctx.SharedEndpoints == "" {
+		return
+	}
+	owners := make(map[[3]string]string)
+	for _, ep := range shared {
+		for _, consumer := range ep.Consumers {
+			owners[[3]string{consumer, ep.DsFullSlug, ep.Endpoint}] = ep.OwnerIndex
+		}
+	}
+	for fi, fixture := range fixtures {
+		for di, ds := range fixture.DataSources {
+			for ei, ep := range ds.Endpoints {
+				ownerIndex, ok := owners[[3]string{fixture.Slug, ds.FullSlug, ep.Name}]
+				if !ok {
+					continue
+				}
+				endpoint := &fixtures[fi].DataSources[di].Endpoints[ei]
+				endpoint.SharedFrom = ownerIndex
+				if ctx.SharedEndpoints == SharedEndpointsCopyFrom {
+					endpoint.CopyFrom = CopyConfig{Pattern: ownerIndex, Incremental: true}
+				}
+				n++
+			}
+		}
+	}
+	return
+}
+
+// SharedEndpointsAliases - with alias mode aliases of consumer's index also point to owner's index filtered by shared origins
+// Consumer's index aliases exclude shared origins (it can still have their data fetched before endpoint became shared)
+// When more consumers' indices point the same alias to the owner's index, their shared origins are merged into a single alias filter
+// Only existing owners' indices are aliased, indices is the list of existing ES indices
+func SharedEndpointsAliases(ctx *Ctx, desired []AliasState, fixtures []Fixture, indices []string) []AliasState {
+	if ctx.SharedEndpoints != SharedEndpointsAlias {
+		return desired
+	}
+	exists := make(map[string]struct{})
+	for _, index := range indices {
+		exists[index] = struct{}{}
+	}
+	// consumer's index -> owner's index -> shared origins
+	consumed := make(map[string]map[string][]string)
+	for _, fixture := range fixtures {
+		for _, ds := range fixture.DataSources {
+			for _, ep := range ds.Endpoints {
+				if ep.SharedFrom == "" {
+					continue
+				}
+				index := FixtureIndex(fixture.Slug, ds.FullSlug)
+				_, ok := consumed[index]
+				if !ok {
+					consumed[index] = make(map[string][]string)
+				}
+				origin := MapOrigin(strings.Split(ep.Name, ":::")[0], ds.Slug)
+				consumed[index][ep.SharedFrom] = append(consumed[index][ep.SharedFrom], origin)
+			}
+		}
+	}
+	if len(consumed) == 0 {
+		return desired
+	}
+	seen := make(map[[2]string]struct{})
+	for _, state := range desired {
+		seen[[2]string{state.Index, state.Alias}] = struct{}{}
+	}
+	// Consumer's index may not exist when all its endpoints are shared, its aliases come from fixtures then
+	type target struct {
+		alias  string
+		filter string
+	}
+	targets := make(map[string][]target)
+	for _, fixture := range fixtures {
+		for _, alias := range fixture.Aliases {
+			_, ok := consumed[alias.From]
+			if !ok {
+				continue
+			}
+			for _, to := range alias.To {
+				targets[alias.From] = append(targets[alias.From], target{alias: strings.Replace(to, "/", "-", -1)})
+			}
+			for _, view := range alias.Views {
+				targets[alias.From] = append(targets[alias.From], target{alias: strings.Replace(view.Name, "/", "-", -1), filter: canonicalJSON(view.Filter)})
+			}
+		}
+	}
+	for i, state := range desired {
+		owners, ok := consumed[state.Index]
+		if !ok {
+			continue
+		}
+		all := []string{}
+		for _, origins := range owners {
+			all = append(all, origins...)
+		}
+		sort.Strings(all)
+		exclude := OriginsQuery(ExternalOriginField, all)
+		if state.Filter == "" {
+			desired[i].Filter = `{"bool":{"must_not":[` + exclude + `]}}`
+			continue
+		}
+		desired[i].Filter = `{"bool":{"must":[` + state.Filter + `],"must_not":[` + exclude + `]}}`
+	}
+	// owner's index and alias -> alias filter -> shared origins
+	type aliasKey [2]string
+	keys := []aliasKey{}
+	filters := make(map[aliasKey][]string)
+	merged := make(map[aliasKey]map[string]map[string]struct{})
+	consumers := []string{}
+	for index := range consumed {
+		consumers = append(consumers, index)
+	}
+	sort.Strings(consumers)
+	for _, index := range consumers {
+		for ownerIndex, origins := range consumed[index] {
+			_, ok := exists[ownerIndex]
+			if !ok {
+				continue
+			}
+			for _, t := range targets[index] {
+				key := aliasKey{ownerIndex, t.alias}
+				_, ok := seen[key]
+				if ok {
+					continue
+				}
+				_, ok = merged[key]
+				if !ok {
+					keys = append(keys, key)
+					merged[key] = make(map[string]map[string]struct{})
+				}
+				_, ok = merged[key][t.filter]
+				if !ok {
+					filters[key] = append(filters[key], t.filter)
+					merged[key][t.filter] = make(map[string]struct{})
+				}
+				for _, origin := range origins {
+					merged[key][t.filter][origin] = struct{}{}
+				}
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		sort.Strings(filters[key])
+		clauses := []string{}
+		for _, f := range filters[key] {
+			origins := []string{}
+			for origin := range merged[key][f] {
+				origins = append(origins, origin)
+			}
+			sort.Strings(origins)
+			include := OriginsQuery(ExternalOriginField, origins)
+			clause := `{"bool":{"must":[` + include + `]}}`
+			if f != "" {
+				clause = `{"bool":{"must":[` + f + `,` + include + `]}}`
+			}
+			clauses = append(clauses, clause)
+		}
+		filter := clauses[0]
+		if len(clauses) > 1 {
+			// Keys are in canonicalJSON order, so filter equals the one read back from ES and is not planned again
+			filter = `{"bool":{"minimum_should_match":1,"should":[` + strings.Join(clauses, ",") + `]}}`
+		}
+		desired = append(desired, AliasState{Index: key[0], Alias: key[1], Filter: filter})
+	}
+	return desired
+}
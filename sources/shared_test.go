@@ -0,0 +1,206 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func sharedFixtures() []lib.Fixture {
+	git := func(eps ...lib.Endpoint) []lib.DataSource {
+		return []lib.DataSource{{Slug: "git", FullSlug: "git", Config: []lib.Config{{Name: "api-token", Value: "x"}}, Endpoints: eps}}
+	}
+	native := lib.Native{AffiliationSource: "lf"}
+	return []lib.Fixture{
+		{Slug: "lf", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/big"}, lib.Endpoint{Name: "https://github.com/a/lf"})},
+		{Slug: "cncf", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/big", Owner: true}, lib.Endpoint{Name: "https://github.com/a/small"})},
+		{Slug: "cdf", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/big"}, lib.Endpoint{Name: "https://github.com/a/small"})},
+		{Slug: "other", Native: native, DataSources: []lib.DataSource{{Slug: "git", FullSlug: "git", Endpoints: []lib.Endpoint{{Name: "https://github.com/a/lf"}}}}},
+		{Slug: "dummy", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/lf", Dummy: true}, lib.Endpoint{Name: "https://github.com/a/small", CopyFrom: lib.CopyConfig{Pattern: "sds-x-git"}})},
+		// Not shared: different affiliation source, groups and project
+		{Slug: "own", DataSources: git(lib.Endpoint{Name: "https://github.com/a/big"})},
+		{Slug: "grouped", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/small", Groups: []lib.GroupConfig{{Name: "g"}}})},
+		{Slug: "project", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/small", AffiliationSource: "cdf"}, lib.Endpoint{Name: "https://github.com/a/lf", Project: "p"})},
+	}
+}
+
+func TestFindSharedEndpoints(t *testing.T) {
+	expected := []lib.SharedEndpoint{
+		{
+			DsSlug:     "git",
+			DsFullSlug: "git",
+			Endpoint:   "https://github.com/a/big",
+			Origin:     "https://github.com/a/big",
+			Owner:      "cncf",
+			OwnerIndex: "sds-cncf-git",
+			Consumers:  []string{"cdf", "lf"},
+		},
+		{
+			DsSlug:     "git",
+			DsFullSlug: "git",
+			Endpoint:   "https://github.com/a/small",
+			Origin:     "https://github.com/a/small",
+			Owner:      "cdf",
+			OwnerIndex: "sds-cdf-git",
+			Consumers:  []string{"cncf"},
+		},
+	}
+	got := lib.FindSharedEndpoints(sharedFixtures())
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestAssignSharedEndpoints(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		mode     string
+		n        int
+		copyFrom lib.CopyConfig
+	}{
+		{mode: "", n: 0},
+		{mode: lib.SharedEndpointsAlias, n: 3},
+		{mode: lib.SharedEndpointsCopyFrom, n: 3, copyFrom: lib.CopyConfig{Pattern: "sds-cncf-git", Incremental: true}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		fixtures := sharedFixtures()
+		shared := lib.FindSharedEndpoints(fixtures)
+		n := lib.AssignSharedEndpoints(&lib.Ctx{SharedEndpoints: test.mode}, fixtures, shared)
+		if n != test.n {
+			t.Errorf("test number %d, expected %d consumers, got %d", index+1, test.n, n)
+		}
+		lf := fixtures[0].DataSources[0].Endpoints
+		if test.n > 0 && (lf[0].SharedFrom != "sds-cncf-git" || lf[1].SharedFrom != "") {
+			t.Errorf("test number %d, unexpected lf endpoints %+v", index+1, lf)
+		}
+		if !reflect.DeepEqual(lf[0].CopyFrom, test.copyFrom) {
+			t.Errorf("test number %d, expected copy from %+v, got %+v", index+1, test.copyFrom, lf[0].CopyFrom)
+		}
+		cncf := fixtures[1].DataSources[0].Endpoints
+		if cncf[0].SharedFrom != "" || (test.n > 0 && cncf[1].SharedFrom != "sds-cdf-git") {
+			t.Errorf("test number %d, unexpected cncf endpoints %+v", index+1, cncf)
+		}
+		// Ownership doesn't change when computed again from already assigned fixtures
+		if !reflect.DeepEqual(lib.FindSharedEndpoints(fixtures), shared) {
+			t.Errorf("test number %d, ownership changed after assignment", index+1)
+		}
+	}
+}
+
+func TestSharedEndpointsAliases(t *testing.T) {
+	fixtures := sharedFixtures()
+	fixtures[0].Aliases = []lib.Alias{
+		{
+			From:  "sds-lf-git",
+			To:    []string{"sds-lf-git-all"},
+			Views: []lib.AliasView{{Name: "sds-lf-git-view", Filter: map[string]interface{}{"term": map[string]interface{}{"project": "X"}}}},
+		},
+	}
+	fixtures[2].Aliases = []lib.Alias{{From: "sds-cdf-git", To: []string{"sds-cdf-git-all"}}}
+	indices := []string{"sds-lf-git", "sds-cdf-git", "sds-cncf-git"}
+	desired, _ := lib.DesiredAliases(fixtures, indices)
+	ctx := lib.Ctx{}
+	lib.AssignSharedEndpoints(&ctx, fixtures, lib.FindSharedEndpoints(fixtures))
+	got := lib.SharedEndpointsAliases(&ctx, desired, fixtures, indices)
+	if !reflect.DeepEqual(got, desired) {
+		t.Errorf("expected no changes without alias mode, got %+v", got)
+	}
+	ctx.SharedEndpoints = lib.SharedEndpointsAlias
+	lib.AssignSharedEndpoints(&ctx, fixtures, lib.FindSharedEndpoints(fixtures))
+	expected := []lib.AliasState{
+		{Index: "sds-lf-git", Alias: "sds-lf-git-all", Filter: `{"bool":{"must_not":[{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+		{Index: "sds-lf-git", Alias: "sds-lf-git-view", Filter: `{"bool":{"must":[{"term":{"project":"X"}}],"must_not":[{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+		{Index: "sds-cdf-git", Alias: "sds-cdf-git-all", Filter: `{"bool":{"must_not":[{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+		{Index: "sds-cncf-git", Alias: "sds-cdf-git-all", Filter: `{"bool":{"must":[{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+		{Index: "sds-cncf-git", Alias: "sds-lf-git-all", Filter: `{"bool":{"must":[{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+		{Index: "sds-cncf-git", Alias: "sds-lf-git-view", Filter: `{"bool":{"must":[{"term":{"project":"X"}},{"terms":{"origin":["https://github.com/a/big"]}}]}}`},
+	}
+	got = lib.SharedEndpointsAliases(&ctx, desired, fixtures, indices)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	// Owner's index doesn't exist yet: consumers still exclude shared origins, nothing points to owner's index
+	indices = []string{"sds-lf-git", "sds-cdf-git"}
+	desired, _ = lib.DesiredAliases(fixtures, indices)
+	got = lib.SharedEndpointsAliases(&ctx, desired, fixtures, indices)
+	if len(got) != 3 || got[0].Filter != expected[0].Filter {
+		t.Errorf("expected %+v, got %+v", expected[:3], got)
+	}
+}
+
+func TestSharedEndpointsAliasesMerge(t *testing.T) {
+	git := func(eps ...lib.Endpoint) []lib.DataSource {
+		return []lib.DataSource{{Slug: "git", FullSlug: "git", Endpoints: eps}}
+	}
+	native := lib.Native{AffiliationSource: "lf"}
+	fixtures := []lib.Fixture{
+		{Slug: "a", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/x"}, lib.Endpoint{Name: "https://github.com/a/y"})},
+		{Slug: "b", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/x"}), Aliases: []lib.Alias{{From: "sds-b-git", To: []string{"sds-all-git"}}}},
+		{Slug: "c", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/y"}), Aliases: []lib.Alias{{From: "sds-c-git", To: []string{"sds-all-git"}}}},
+	}
+	indices := []string{"sds-a-git"}
+	desired, _ := lib.DesiredAliases(fixtures, indices)
+	ctx := lib.Ctx{SharedEndpoints: lib.SharedEndpointsAlias}
+	lib.AssignSharedEndpoints(&ctx, fixtures, lib.FindSharedEndpoints(fixtures))
+	// Both consumers' origins are visible via the common alias
+	expected := []lib.AliasState{
+		{Index: "sds-a-git", Alias: "sds-all-git", Filter: `{"bool":{"must":[{"terms":{"origin":["https://github.com/a/x","https://github.com/a/y"]}}]}}`},
+	}
+	got := lib.SharedEndpointsAliases(&ctx, desired, fixtures, indices)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestSharedEndpointsAliasesMergeFilters(t *testing.T) {
+	git := func(eps ...lib.Endpoint) []lib.DataSource {
+		return []lib.DataSource{{Slug: "git", FullSlug: "git", Endpoints: eps}}
+	}
+	view := func(project string) []lib.AliasView {
+		return []lib.AliasView{{Name: "sds-all-git", Filter: map[interface{}]interface{}{"term": map[interface{}]interface{}{"project": project}}}}
+	}
+	native := lib.Native{AffiliationSource: "lf"}
+	fixtures := []lib.Fixture{
+		{Slug: "a", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/x"}, lib.Endpoint{Name: "https://github.com/a/y"})},
+		{Slug: "b", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/x"}), Aliases: []lib.Alias{{From: "sds-b-git", Views: view("B")}}},
+		{Slug: "c", Native: native, DataSources: git(lib.Endpoint{Name: "https://github.com/a/y"}), Aliases: []lib.Alias{{From: "sds-c-git", Views: view("C")}}},
+	}
+	indices := []string{"sds-a-git"}
+	desired, _ := lib.DesiredAliases(fixtures, indices)
+	ctx := lib.Ctx{SharedEndpoints: lib.SharedEndpointsAlias}
+	lib.AssignSharedEndpoints(&ctx, fixtures, lib.FindSharedEndpoints(fixtures))
+	got := lib.SharedEndpointsAliases(&ctx, desired, fixtures, indices)
+	if len(got) != 1 || got[0].Index != "sds-a-git" || got[0].Alias != "sds-all-git" {
+		t.Fatalf("expected single merged alias, got %+v", got)
+	}
+	// ES returns the same filter with keys in any order, already applied alias must not be planned again
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/_alias" {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprintf(
+			w,
+			`{"sds-a-git":{"aliases":{"sds-all-git":{"filter":{"bool":{"should":[`+
+				`{"bool":{"must":[{"term":{"project":"B"}},{"terms":{"origin":["https://github.com/a/x"]}}]}},`+
+				`{"bool":{"must":[{"term":{"project":"C"}},{"terms":{"origin":["https://github.com/a/y"]}}]}}`+
+				`],"minimum_should_match":1}}}}}}`,
+		)
+	}))
+	defer srv.Close()
+	ctx.ElasticURL = srv.URL
+	current, err := lib.EsAliases(&ctx)
+	if err != nil {
+		t.Fatalf("aliases error: %+v", err)
+	}
+	plan := lib.PlanAliases(got, current, true)
+	if len(plan.Add) != 0 || len(plan.Remove) != 0 {
+		t.Errorf("expected empty plan, got %+v, filter %s", plan, got[0].Filter)
+	}
+}
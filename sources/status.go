@@ -0,0 +1,212 @@
+package syncdatasources
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// PhaseStartup - SDS is starting (reading fixtures, checking grimoire stack)
+const PhaseStartup string = "startup"
+
+// PhaseIndexes - dropping unused and renaming indexes
+const PhaseIndexes string = "indexes"
+
+// PhaseTasks - running data sync and enrichment tasks
+const PhaseTasks string = "tasks"
+
+// PhaseAliases - processing index aliases
+const PhaseAliases string = "aliases"
+
+// PhaseFAliases - processing foundation-f aliases
+const PhaseFAliases string = "f-aliases"
+
+// PhaseMetadata - processing fixtures metadata (working groups)
+const PhaseMetadata string = "metadata"
+
+// PhaseDAAPI - calling DA API (hide emails, merge profiles, map org names, affiliations ranges, top contributors)
+const PhaseDAAPI string = "da-api"
+
+// PhaseFinished - all work is done
+const PhaseFinished string = "finished"
+
+// StatusTask - single task as reported by status API
+type StatusTask struct {
+	Idx             int        `json:"idx"`
+	Fixture         string     `json:"fixture"`
+	DataSource      string     `json:"data_source"`
+	Project         string     `json:"project,omitempty"`
+	Endpoint        string     `json:"endpoint"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	CommandLine     string     `json:"command_line,omitempty"`
+	Retries         int        `json:"retries,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	ErrorClass      string     `json:"error_class,omitempty"`
+}
+
+// TasksStatus - tasks processing status (the same data as printed on SIGUSR1)
+type TasksStatus struct {
+	Pass            string       `json:"pass"`
+	All             int          `json:"all"`
+	Processed       int          `json:"processed"`
+	Failed          int          `json:"failed"`
+	Skipped         int          `json:"skipped"`
+	Running         []StatusTask `json:"running"`
+	LongestFinished []StatusTask `json:"longest_finished"`
+	LongestRunning  []StatusTask `json:"longest_running"`
+	FailedTasks     []StatusTask `json:"failed_tasks"`
+}
+
+// RunStatus - current SDS run status as reported by status API
+type RunStatus struct {
+	Started      time.Time    `json:"started"`
+	Phase        string       `json:"phase"`
+	PhaseSince   time.Time    `json:"phase_since"`
+	NodeIdx      int          `json:"node_idx"`
+	NodeNum      int          `json:"node_num"`
+	DryRun       bool         `json:"dry_run"`
+	DurationSecs float64      `json:"duration_seconds"`
+	Tasks        *TasksStatus `json:"tasks,omitempty"`
+}
+
+// runStatus - global in-flight run state
+type runStatus struct {
+	mtx        *sync.Mutex
+	started    time.Time
+	phase      string
+	phaseSince time.Time
+	commands   map[int]string
+	tasksFunc  func() *TasksStatus
+}
+
+var gStatus = &runStatus{
+	mtx:        &sync.Mutex{},
+	started:    time.Now(),
+	phase:      PhaseStartup,
+	phaseSince: time.Now(),
+	commands:   make(map[int]string),
+}
+
+// SetPhase - sets current SDS run phase
+func SetPhase(ctx *Ctx, phase string) {
+	gStatus.mtx.Lock()
+	gStatus.phase = phase
+	gStatus.phaseSince = time.Now()
+	gStatus.mtx.Unlock()
+	if ctx.Debug > 0 {
+		Printf("Phase: %s\n", phase)
+	}
+}
+
+// CurrentPhase - returns current SDS run phase
+func CurrentPhase() string {
+	gStatus.mtx.Lock()
+	defer func() {
+		gStatus.mtx.Unlock()
+	}()
+	return gStatus.phase
+}
+
+// SetTasksStatusFunc - sets function returning current tasks status (provided by tasks processing code)
+func SetTasksStatusFunc(f func() *TasksStatus) {
+	gStatus.mtx.Lock()
+	gStatus.tasksFunc = f
+	gStatus.mtx.Unlock()
+}
+
+// SetTaskCommand - sets command line of a running task, empty command line removes it
+// Command line is redacted before storing
+func SetTaskCommand(idx int, commandLine string) {
+	gStatus.mtx.Lock()
+	defer func() {
+		gStatus.mtx.Unlock()
+	}()
+	if commandLine == "" {
+		delete(gStatus.commands, idx)
+		return
+	}
+	gStatus.commands[idx] = FilterRedacted(commandLine)
+}
+
+// TaskCommand - returns redacted command line of a running task
+func TaskCommand(idx int) string {
+	gStatus.mtx.Lock()
+	defer func() {
+		gStatus.mtx.Unlock()
+	}()
+	return gStatus.commands[idx]
+}
+
+// GetRunStatus - returns current run status
+func GetRunStatus(ctx *Ctx) RunStatus {
+	gStatus.mtx.Lock()
+	status := RunStatus{
+		Started:      gStatus.started,
+		Phase:        gStatus.phase,
+		PhaseSince:   gStatus.phaseSince,
+		NodeIdx:      ctx.NodeIdx,
+		NodeNum:      ctx.NodeNum,
+		DryRun:       ctx.DryRun,
+		DurationSecs: time.Now().Sub(gStatus.started).Seconds(),
+	}
+	tasksFunc := gStatus.tasksFunc
+	gStatus.mtx.Unlock()
+	// tasksFunc uses TaskCommand, so it must be called without holding the status mutex
+	if tasksFunc != nil {
+		status.Tasks = tasksFunc()
+	}
+	return status
+}
+
+// ServeStatus - starts read-only status HTTP API on SDS_STATUS_ADDR (if set)
+// GET /status returns current phase and tasks status as JSON
+func ServeStatus(ctx *Ctx) {
+	if ctx.StatusAddr == "" {
+		return
+	}
+	handleHTTP(ctx.StatusAddr, "/status", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		status := GetRunStatus(ctx)
+		w.Header().Set("Content-Type", "application/json")
+		err := jsoniter.NewEncoder(w).Encode(status)
+		if err != nil {
+			Printf("Status API error: %+v\n", err)
+		}
+	})
+}
+
+var (
+	httpMuxes   = make(map[string]*http.ServeMux)
+	httpMuxesMt = &sync.Mutex{}
+)
+
+// handleHTTP - registers handler on a given address, listener is started once per address
+// so metrics and status API can share the same port
+func handleHTTP(addr, pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	httpMuxesMt.Lock()
+	defer func() {
+		httpMuxesMt.Unlock()
+	}()
+	mux, ok := httpMuxes[addr]
+	if ok {
+		mux.HandleFunc(pattern, handler)
+		Printf("Serving %s on %s\n", pattern, addr)
+		return
+	}
+	mux = http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+	httpMuxes[addr] = mux
+	Printf("Serving %s on %s\n", pattern, addr)
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			Printf("HTTP listener on %s error: %+v\n", addr, err)
+		}
+	}()
+}
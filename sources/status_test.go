@@ -0,0 +1,49 @@
+package syncdatasources
+
+import (
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestRunStatus(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.TestMode = true
+	ctx.Init()
+	ctx.NodeIdx = 1
+	ctx.NodeNum = 3
+	lib.SetPhase(&ctx, lib.PhaseTasks)
+	lib.AddRedacted("s3cr3t-t0ken", true)
+	lib.SetTaskCommand(7, "DA_GIT_TOKEN=s3cr3t-t0ken dads --foo")
+	lib.SetTasksStatusFunc(func() *lib.TasksStatus {
+		return &lib.TasksStatus{
+			Pass:    "data",
+			All:     10,
+			Running: []lib.StatusTask{{Idx: 7, CommandLine: lib.TaskCommand(7)}},
+		}
+	})
+	status := lib.GetRunStatus(&ctx)
+	if status.Phase != lib.PhaseTasks || status.NodeIdx != 1 || status.NodeNum != 3 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if status.Tasks == nil || status.Tasks.All != 10 || len(status.Tasks.Running) != 1 {
+		t.Errorf("unexpected tasks status: %+v", status.Tasks)
+		return
+	}
+	cmd := status.Tasks.Running[0].CommandLine
+	if strings.Contains(cmd, "s3cr3t-t0ken") || !strings.Contains(cmd, "dads --foo") {
+		t.Errorf("expected redacted command line, got '%s'", cmd)
+	}
+	// Removing command line of a finished task
+	lib.SetTaskCommand(7, "")
+	if lib.TaskCommand(7) != "" {
+		t.Errorf("expected no command line for finished task, got '%s'", lib.TaskCommand(7))
+	}
+	lib.SetTasksStatusFunc(nil)
+	lib.SetPhase(&ctx, lib.PhaseFinished)
+	status = lib.GetRunStatus(&ctx)
+	if status.Phase != lib.PhaseFinished || status.Tasks != nil {
+		t.Errorf("unexpected final status: %+v", status)
+	}
+}
@@ -21,6 +21,7 @@ type Task struct {
 	Env                 map[string]string
 	Retries             int
 	Err                 error
+	ErrorClass          string
 	Duration            time.Duration
 	DsFullSlug          string
 	ExternalIndex       string
@@ -95,82 +96,6 @@ func (t Task) ShortStringCmd(ctx *Ctx) string {
 	return s
 }
 
-// CSVHeader - CSV header fields
-func CSVHeader() []string {
-	return []string{"timestamp", "project", "filename", "datasource", "full_datasource", "sub_project", "p2o", "endpoint", "config", "commandline", "duration", "seconds", "retries", "error"}
-}
-
-// ToCSVNotRedacted - outputs array of string for CSV output of this task (without redacting sensitive data)
-func (t Task) ToCSVNotRedacted() []string {
-	confAry := []string{}
-	for _, config := range t.Config {
-		confAry = append(confAry, config.String())
-	}
-	err := ""
-	if t.Err != nil {
-		err = fmt.Sprintf("%+v", t.Err)
-	}
-	envStr := ""
-	ks := []string{}
-	for k := range t.Env {
-		ks = append(ks, k)
-	}
-	sort.Strings(ks)
-	for _, k := range ks {
-		envStr += k + "=" + t.Env[k] + " "
-	}
-	cmdLine := envStr + t.CommandLine
-	return []string{
-		fmt.Sprintf("%+v", time.Now()),
-		t.FxSlug,
-		t.FxFn,
-		t.DsSlug,
-		t.DsFullSlug,
-		t.Project,
-		fmt.Sprintf("%v", t.ProjectP2O),
-		t.Endpoint,
-		"{" + strings.Join(confAry, ", ") + "}",
-		cmdLine,
-		t.Duration.String(),
-		fmt.Sprintf("%.3f", t.Duration.Seconds()),
-		fmt.Sprintf("%d", t.Retries),
-		err,
-	}
-}
-
-// ToCSV - outputs array of string for CSV output of this task
-func (t Task) ToCSV() []string {
-	confAry := []string{}
-	for _, config := range t.Config {
-		confAry = append(confAry, config.RedactedString())
-	}
-	err := ""
-	if t.Err != nil {
-		err = fmt.Sprintf("%+v", t.Err)
-	}
-	envStr := ""
-	for k, v := range t.Env {
-		envStr += k + "=" + FilterRedacted(v) + " "
-	}
-	cmdLine := envStr + t.RedactedCommandLine
-	return []string{
-		fmt.Sprintf("%+v", time.Now()),
-		t.FxSlug,
-		t.FxFn,
-		t.DsSlug,
-		t.DsFullSlug,
-		t.Project,
-		fmt.Sprintf("%v", t.ProjectP2O),
-		t.Endpoint,
-		"{" + strings.Join(confAry, ", ") + "}",
-		cmdLine,
-		t.Duration.String(),
-		fmt.Sprintf("%.3f", t.Duration.Seconds()),
-		fmt.Sprintf("%d", t.Retries),
-		err,
-	}
-}
-
 // TaskResult is a return type from task execution
 // It contains task index Code[0], error code Code[1] and task final commandline
 type TaskResult struct {
@@ -181,11 +106,16 @@ type TaskResult struct {
 	Retries             int
 	Affs                bool
 	Err                 error
+	ErrorClass          string
 	Index               string
 	Endpoint            string
 	Ds                  string
 	Fx                  string
+	FxSlug              string
 	Projects            []EndpointProject
+	Origin              string
+	Groups              []string
+	Verify              *VerifyResult
 }
 
 // TaskMtx - holds are mutexes used in task processing
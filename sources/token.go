@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/LF-Engineering/dev-analytics-libraries/affiliation"
 	"github.com/LF-Engineering/dev-analytics-libraries/auth0"
 	"github.com/LF-Engineering/dev-analytics-libraries/elastic"
 	"github.com/LF-Engineering/dev-analytics-libraries/http"
@@ -14,8 +15,11 @@ import (
 )
 
 var (
-	gAuth0Client *auth0.ClientProvider
-	gTokenEnv    string
+	gAuth0Client   *auth0.ClientProvider
+	gTokenEnv      string
+	gHTTPProvider  *http.ClientProvider
+	gESProvider    *elastic.ClientProvider
+	gSlackProvider *slack.Provider
 )
 
 // InitializeAuth0 - initializes Auth0 client using data stored in AUTH0_DATA
@@ -72,10 +76,24 @@ func InitializeAuth0() error {
 	)
 	if err == nil {
 		gTokenEnv = data["env"]
+		gHTTPProvider = httpClientProvider
+		gESProvider = esCacheClientProvider
+		gSlackProvider = &slackProvider
 	}
 	return err
 }
 
+// NewAffiliationsClient - returns DA affiliations API client for a given project slug, it uses Auth0 client from AUTH0_DATA
+func NewAffiliationsClient(apiURL, projectSlug string) (*affiliation.Affiliation, error) {
+	if gTokenEnv == "" {
+		err := InitializeAuth0()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return affiliation.NewAffiliationsClient(apiURL, projectSlug, gHTTPProvider, gESProvider, gAuth0Client, gSlackProvider)
+}
+
 // GetAPIToken - return an API token to use dev-analytics-api API calls
 // If JWT_TOKEN env is specified - just use the provided token without any checks
 // Else get auth0 data from AUTH0_DATA and generate/reuse a token stored in ES cache
@@ -0,0 +1,375 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// VerifyResult - data completeness verification result of a single task (upstream items count vs. rich index documents count)
+// DiffPct is absolute difference in percent of upstream count, OK is set when it doesn't exceed SDS_VERIFY_THRESHOLD
+// Error is set when verification cannot be done (upstream or index cannot be counted)
+type VerifyResult struct {
+	Dt       time.Time
+	Upstream int64
+	Indexed  int64
+	DiffPct  float64
+	OK       bool
+	Error    string
+}
+
+// verifier - counts upstream items of a given task and specifies rich index query to count matching documents
+type verifier struct {
+	upstream func(ctx *Ctx, task *Task) (int64, error)
+	filter   func(task *Task) string
+	distinct string
+}
+
+// verifiers - supported data sources verification
+var verifiers = map[string]verifier{
+	Git: {
+		upstream: gitUpstreamCount,
+		distinct: "hash",
+	},
+	"github/issue": {
+		upstream: func(ctx *Ctx, task *Task) (int64, error) { return gitHubUpstreamCount(ctx, task.Endpoint, "is:issue") },
+		filter:   func(task *Task) string { return `{"term":{"is_github_issue":1}}` },
+	},
+	"github/pull_request": {
+		upstream: func(ctx *Ctx, task *Task) (int64, error) { return gitHubUpstreamCount(ctx, task.Endpoint, "is:pr") },
+		filter:   func(task *Task) string { return `{"term":{"is_github_pull_request":1}}` },
+	},
+	Gerrit: {
+		upstream: gerritUpstreamCount,
+		filter:   func(task *Task) string { return `{"term":{"type":"changeset"}}` },
+	},
+	Jira: {
+		upstream: jiraUpstreamCount,
+		filter: func(task *Task) string {
+			project := taskConfig(task, "project")
+			if project == "" {
+				return `{"term":{"is_jira_issue":1}}`
+			}
+			return `{"term":{"is_jira_issue":1}},{"term":{"project_key":"` + jsonEscape(project) + `"}}`
+		},
+	},
+}
+
+// gitHubKeyIdx - next GitHub OAuth key to use for upstream counts
+var gitHubKeyIdx uint32
+
+// verifyClient - upstream APIs are called synchronously from task processing, so a stalled upstream must not block the worker
+var verifyClient = &http.Client{Timeout: time.Duration(60) * time.Second}
+
+// VerifySupported - is data completeness verification supported for a given data source slug
+func VerifySupported(dsSlug string) bool {
+	_, ok := verifiers[dsSlug]
+	return ok
+}
+
+// VerifyTask - compares upstream items count with a number of documents for the task's endpoint in rich index
+// Returns nil when verification is not supported for the task's data source
+func VerifyTask(ctx *Ctx, task *Task, index string) *VerifyResult {
+	v, ok := verifiers[task.DsSlug]
+	if !ok {
+		return nil
+	}
+	result := &VerifyResult{Dt: time.Now()}
+	upstream, err := v.upstream(ctx, task)
+	if err != nil {
+		result.Error = fmt.Sprintf("upstream count: %s", FilterRedacted(err.Error()))
+		return result
+	}
+	filter := ""
+	if v.filter != nil {
+		filter = v.filter(task)
+	}
+	indexed, err := indexCount(ctx, index, task.Endpoint, filter, v.distinct)
+	if err != nil {
+		result.Error = fmt.Sprintf("index count: %s", FilterRedacted(err.Error()))
+		return result
+	}
+	result.Upstream = upstream
+	result.Indexed = indexed
+	if upstream > 0 {
+		result.DiffPct = math.Abs(float64(upstream-indexed)) * 100.0 / float64(upstream)
+	} else if indexed > 0 {
+		result.DiffPct = 100.0
+	}
+	result.OK = result.DiffPct <= ctx.VerifyThreshold
+	return result
+}
+
+// String - verification result summary
+func (v *VerifyResult) String() string {
+	if v.Error != "" {
+		return "verification error: " + v.Error
+	}
+	return fmt.Sprintf("upstream %d, indexed %d, difference %.2f%%, ok: %v", v.Upstream, v.Indexed, v.DiffPct, v.OK)
+}
+
+// taskConfig - returns task config value for the first matching config name
+func taskConfig(task *Task, names ...string) string {
+	for _, name := range names {
+		for _, cfg := range task.Config {
+			if cfg.Name == name {
+				return cfg.Value
+			}
+		}
+	}
+	return ""
+}
+
+// jsonEscape - escapes string to be used as JSON string value
+func jsonEscape(str string) string {
+	data, _ := jsoniter.Marshal(str)
+	return string(data[1 : len(data)-1])
+}
+
+// indexCount - number of documents (or distinct values of a given field) in index for a given origin
+func indexCount(ctx *Ctx, index, origin, filter, distinct string) (count int64, err error) {
+	status, body, err := esRequest(ctx, Printf, Post, "/"+index+"/_refresh", "")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:/%s/_refresh status:%d\n%s", Post, index, status, body)
+		return
+	}
+	query := `{"bool":{"filter":[{"term":{"origin":"` + jsonEscape(origin) + `"}}`
+	if filter != "" {
+		query += "," + filter
+	}
+	query += `]}}`
+	if distinct == "" {
+		path := "/" + index + "/_count"
+		status, body, err = esRequest(ctx, Printf, Post, path, `{"query":`+query+`}`)
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+			return
+		}
+		var result struct {
+			Count int64 `json:"count"`
+		}
+		err = jsoniter.Unmarshal(body, &result)
+		count = result.Count
+		return
+	}
+	// Cardinality is exact below precision threshold (40000)
+	path := "/" + index + "/_search"
+	data := `{"size":0,"query":` + query + `,"aggs":{"n":{"cardinality":{"field":"` + distinct + `","precision_threshold":40000}}}}`
+	status, body, err = esRequest(ctx, Printf, Post, path, data)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Post, path, status, body)
+		return
+	}
+	var result struct {
+		Aggs struct {
+			N struct {
+				Value int64 `json:"value"`
+			} `json:"n"`
+		} `json:"aggregations"`
+	}
+	err = jsoniter.Unmarshal(body, &result)
+	count = result.Aggs.N.Value
+	return
+}
+
+// GitClonePath - returns path of a local bare clone of a git endpoint (perceval layout: SDS_VERIFY_GIT_PATH/origin-git)
+func GitClonePath(ctx *Ctx, origin string) string {
+	root := ctx.VerifyGitPath
+	if root == "" {
+		root = filepath.Join(os.Getenv("HOME"), ".perceval", "repositories")
+	}
+	return filepath.Join(root, strings.TrimLeft(origin, "/")+"-git")
+}
+
+// gitUpstreamCount - number of commits reachable from all refs of a local clone
+func gitUpstreamCount(ctx *Ctx, task *Task) (count int64, err error) {
+	path := GitClonePath(ctx, task.Endpoint)
+	if ctx.GitMirrorPath != "" {
+		path = GitMirrorDir(ctx, task.Endpoint)
+	}
+	_, err = os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("no local clone: %+v", err)
+		return
+	}
+	out, err := exec.Command("git", "-C", path, "rev-list", "--all", "--count").Output()
+	if err != nil {
+		err = fmt.Errorf("git rev-list in %s: %+v", path, err)
+		return
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// upstreamGet - GETs upstream JSON API, strips optional XSSI prefix (gerrit) and decodes result
+func upstreamGet(rawURL string, headers map[string]string, result interface{}) (err error) {
+	req, err := http.NewRequest(Get, rawURL, nil)
+	if err != nil {
+		return
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := verifyClient.Do(req)
+	if err != nil {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, rawURL, resp.StatusCode, body)
+		return
+	}
+	i := strings.IndexAny(string(body), "[{")
+	if i < 0 {
+		err = fmt.Errorf("no JSON in response from %s", rawURL)
+		return
+	}
+	return jsoniter.Unmarshal(body[i:], result)
+}
+
+// gitHubUpstreamCount - number of issues or PRs (depending on given search qualifier) in a GitHub repository (uses search API)
+// Endpoint is 'https://github.com/owner/repo', GitHub Enterprise endpoints use 'https://host/api/v3'
+func gitHubUpstreamCount(ctx *Ctx, endpoint, qualifier string) (count int64, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return
+	}
+	repo := strings.Trim(u.Path, "/")
+	if strings.Count(repo, "/") != 1 {
+		err = fmt.Errorf("endpoint %s is not a GitHub repository", endpoint)
+		return
+	}
+	api := u.Scheme + "://" + u.Host + "/api/v3"
+	if u.Host == "github.com" {
+		api = "https://api.github.com"
+	}
+	headers := map[string]string{"Accept": "application/vnd.github.v3+json"}
+	if len(ctx.OAuthKeys) > 0 {
+		idx := int(atomic.AddUint32(&gitHubKeyIdx, 1)) % len(ctx.OAuthKeys)
+		headers["Authorization"] = "token " + ctx.OAuthKeys[idx]
+	}
+	var result struct {
+		Total int64 `json:"total_count"`
+	}
+	err = upstreamGet(api+"/search/issues?per_page=1&q="+url.QueryEscape("repo:"+repo+" "+qualifier), headers, &result)
+	count = result.Total
+	return
+}
+
+// gerritUpstreamCount - number of changes of a gerrit project ('https://host/r/project') or of a whole gerrit server ('https://host/r')
+// Gerrit doesn't return totals, so all changes are paged through, whole server changes are counted per project (listed via projects API)
+func gerritUpstreamCount(ctx *Ctx, task *Task) (count int64, err error) {
+	base := strings.TrimRight(task.Endpoint, "/")
+	for _, partial := range []string{"/r/", "/gerrit/"} {
+		i := strings.Index(base, partial)
+		if i >= 0 {
+			return gerritChangesCount(base[:i+len(partial)-1], base[i+len(partial):])
+		}
+	}
+	projects, err := gerritProjects(base)
+	if err != nil {
+		return
+	}
+	for _, project := range projects {
+		var n int64
+		n, err = gerritChangesCount(base, project)
+		if err != nil {
+			return
+		}
+		count += n
+	}
+	return
+}
+
+// gerritProjects - names of all projects of a gerrit server (sorted)
+func gerritProjects(base string) (projects []string, err error) {
+	pageSize := 500
+	for {
+		page := make(map[string]interface{})
+		err = upstreamGet(fmt.Sprintf("%s/projects/?n=%d&S=%d", base, pageSize, len(projects)), nil, &page)
+		if err != nil {
+			return
+		}
+		names := []string{}
+		for name := range page {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		projects = append(projects, names...)
+		if len(page) < pageSize {
+			break
+		}
+	}
+	return
+}
+
+// gerritChangesCount - number of changes of a given gerrit project (pages through all changes)
+func gerritChangesCount(base, project string) (count int64, err error) {
+	query := "project:" + project
+	pageSize := int64(500)
+	for {
+		var changes []struct {
+			More bool `json:"_more_changes"`
+		}
+		err = upstreamGet(fmt.Sprintf("%s/changes/?n=%d&S=%d&q=%s", base, pageSize, count, url.QueryEscape(query)), nil, &changes)
+		if err != nil {
+			return
+		}
+		count += int64(len(changes))
+		if len(changes) == 0 || !changes[len(changes)-1].More {
+			break
+		}
+	}
+	return
+}
+
+// jiraUpstreamCount - number of issues in Jira (in a given project when task has 'project' config)
+// Uses 'user'/'password' basic auth or 'api-token' bearer auth when configured
+func jiraUpstreamCount(ctx *Ctx, task *Task) (count int64, err error) {
+	jql := ""
+	project := taskConfig(task, "project")
+	if project != "" {
+		jql = `project="` + strings.Replace(strings.Replace(project, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+	}
+	headers := map[string]string{}
+	user := taskConfig(task, "user", "-u")
+	password := taskConfig(task, "password", "-p")
+	token := taskConfig(task, APIToken, "-t")
+	if user != "" && password != "" {
+		req, _ := http.NewRequest(Get, task.Endpoint, nil)
+		req.SetBasicAuth(user, password)
+		headers["Authorization"] = req.Header.Get("Authorization")
+	} else if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	var result struct {
+		Total int64 `json:"total"`
+	}
+	err = upstreamGet(strings.TrimRight(task.Endpoint, "/")+"/rest/api/2/search?maxResults=0&jql="+url.QueryEscape(jql), headers, &result)
+	count = result.Total
+	return
+}
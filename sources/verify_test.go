@@ -0,0 +1,147 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestVerifyTask(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	lib.AddRedacted("verify-s3cr3t", true)
+	queries := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/_refresh"):
+			fmt.Fprintf(w, `{}`)
+		case strings.HasSuffix(req.URL.Path, "/_count"):
+			queries[req.URL.Path] = string(body)
+			fmt.Fprintf(w, `{"count":95}`)
+		case strings.HasSuffix(req.URL.Path, "/_search"):
+			queries[req.URL.Path] = string(body)
+			fmt.Fprintf(w, `{"aggregations":{"n":{"value":3}}}`)
+		case req.URL.Path == "/api/v3/search/issues":
+			queries[req.URL.Path] = req.URL.Query().Get("q") + " " + req.Header.Get("Authorization")
+			fmt.Fprintf(w, `{"total_count":100,"items":[]}`)
+		case req.URL.Path == "/rest/api/2/search":
+			queries[req.URL.Path] = req.URL.Query().Get("jql")
+			fmt.Fprintf(w, `{"total":95}`)
+		case req.URL.Path == "/r/projects/":
+			fmt.Fprintf(w, ")]}'\n{\"onap/so\":{},\"onap/aai\":{}}")
+		case req.URL.Path == "/r/changes/" && req.URL.Query().Get("q") == "project:onap/aai":
+			fmt.Fprintf(w, ")]}'\n[{}]")
+		case req.URL.Path == "/r/changes/":
+			if req.URL.Query().Get("S") == "0" {
+				fmt.Fprintf(w, ")]}'\n[{},{\"_more_changes\":true}]")
+			} else {
+				fmt.Fprintf(w, ")]}'\n[{}]")
+			}
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+
+	// Local git clone with 3 commits
+	dir, err := ioutil.TempDir("", "sds-verify")
+	if err != nil {
+		t.Fatalf("temp dir error: %+v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	ctx := lib.Ctx{ElasticURL: srv.URL, VerifyThreshold: 1.0, VerifyGitPath: dir, OAuthKeys: []string{"key1"}}
+	gitEndpoint := "https://github.com/org/repo"
+	gitPath := lib.GitClonePath(&ctx, gitEndpoint)
+	if gitPath != filepath.Join(dir, "https:/github.com/org/repo-git") {
+		t.Errorf("unexpected git clone path: %s", gitPath)
+	}
+	for _, args := range [][]string{
+		{"init", "-q", gitPath},
+		{"-C", gitPath, "-c", "user.name=sds", "-c", "user.email=sds@lf", "commit", "-q", "--allow-empty", "-m", "1"},
+		{"-C", gitPath, "-c", "user.name=sds", "-c", "user.email=sds@lf", "commit", "-q", "--allow-empty", "-m", "2"},
+		{"-C", gitPath, "-c", "user.name=sds", "-c", "user.email=sds@lf", "commit", "-q", "--allow-empty", "-m", "3"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Skipf("git not available: %+v: %s", err, out)
+		}
+	}
+
+	// Test cases
+	var testCases = []struct {
+		task     lib.Task
+		expected string
+		query    [2]string
+	}{
+		{
+			task:     lib.Task{DsSlug: "git", Endpoint: gitEndpoint},
+			expected: "upstream 3, indexed 3, difference 0.00%, ok: true",
+			query:    [2]string{"/sds-git/_search", `"cardinality":{"field":"hash"`},
+		},
+		{
+			task:     lib.Task{DsSlug: "git", Endpoint: "https://github.com/org/missing"},
+			expected: "verification error: upstream count: no local clone",
+		},
+		{
+			task:     lib.Task{DsSlug: "github/issue", Endpoint: srv.URL + "/org/repo"},
+			expected: "upstream 100, indexed 95, difference 5.00%, ok: false",
+			query:    [2]string{"/api/v3/search/issues", "repo:org/repo is:issue token key1"},
+		},
+		{
+			task:     lib.Task{DsSlug: "github/pull_request", Endpoint: srv.URL + "/org/repo"},
+			expected: "upstream 100, indexed 95, difference 5.00%, ok: false",
+			query:    [2]string{"/sds-github-pull_request/_count", `{"term":{"is_github_pull_request":1}}`},
+		},
+		{
+			task:     lib.Task{DsSlug: "jira", Endpoint: srv.URL, Config: []lib.Config{{Name: "project", Value: "ONAP"}}},
+			expected: "upstream 95, indexed 95, difference 0.00%, ok: true",
+			query:    [2]string{"/rest/api/2/search", `project="ONAP"`},
+		},
+		{
+			task:     lib.Task{DsSlug: "gerrit", Endpoint: srv.URL + "/r/onap/so"},
+			expected: "upstream 3, indexed 95, difference 3066.67%, ok: false",
+			query:    [2]string{"/sds-gerrit/_count", `{"term":{"type":"changeset"}}`},
+		},
+		{
+			task:     lib.Task{DsSlug: "gerrit", Endpoint: srv.URL + "/r"},
+			expected: "upstream 4, indexed 95, difference 2275.00%, ok: false",
+		},
+		{
+			task:     lib.Task{DsSlug: "github/issue", Endpoint: srv.URL + "/org"},
+			expected: "verification error: upstream count: endpoint",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		result := lib.VerifyTask(&ctx, &test.task, "sds-"+strings.Replace(test.task.DsSlug, "/", "-", -1))
+		if result == nil {
+			t.Errorf("test number %d, expected result for %+v", index+1, test.task)
+			continue
+		}
+		got := result.String()
+		if !strings.HasPrefix(got, test.expected) {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+		if test.query[0] != "" && !strings.Contains(queries[test.query[0]], test.query[1]) {
+			t.Errorf("test number %d, expected '%s' in %s query, got '%s'", index+1, test.query[1], test.query[0], queries[test.query[0]])
+		}
+	}
+	// Quotes and backslashes in Jira project are escaped in JQL
+	lib.VerifyTask(&ctx, &lib.Task{DsSlug: "jira", Endpoint: srv.URL, Config: []lib.Config{{Name: "project", Value: `A"B\C`}}}, "sds-jira")
+	if queries["/rest/api/2/search"] != `project="A\"B\\C"` {
+		t.Errorf("unexpected JQL: %s", queries["/rest/api/2/search"])
+	}
+	if lib.VerifySupported("confluence") || lib.VerifyTask(&ctx, &lib.Task{DsSlug: "confluence"}, "sds-confluence") != nil {
+		t.Errorf("confluence verification should not be supported")
+	}
+}
@@ -0,0 +1,358 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ViewForEachProjects - generate a view for every endpoint project of alias source data source(s)
+const ViewForEachProjects string = "projects"
+
+// ViewForEachGroups - generate a view for every endpoint group (GroupConfig name) of alias source data source(s)
+const ViewForEachGroups string = "groups"
+
+// ViewForEachWorkingGroups - generate a view for every working group from fixture's metadata
+const ViewForEachWorkingGroups string = "workinggroups"
+
+// ViewValue - placeholder replaced with project/group/working group in templated view name and filter
+const ViewValue string = "{{value}}"
+
+// ViewRole - ES security role giving read access to view's documents only (optionally limited to some fields)
+// Role has no indices when no index the view points to exists
+type ViewRole struct {
+	Name    string
+	Indices []ViewRoleIndices
+	Fields  []string
+}
+
+// ViewRoleIndices - indices a view points to with the same alias filter, the filter is used as role's document level security query
+type ViewRoleIndices struct {
+	Names []string
+	Query string
+}
+
+// esRoleFieldSecurity - ES role field level security
+type esRoleFieldSecurity struct {
+	Grant []string `json:"grant"`
+}
+
+// esRoleIndices - ES role indices privileges
+type esRoleIndices struct {
+	Names         []string             `json:"names"`
+	Privileges    []string             `json:"privileges"`
+	Query         string               `json:"query,omitempty"`
+	FieldSecurity *esRoleFieldSecurity `json:"field_security,omitempty"`
+}
+
+// esRoleMetadata - ES role metadata, views roles are marked so roles of removed views can be deleted
+type esRoleMetadata struct {
+	SDSViewRole bool `json:"sds_view_role"`
+}
+
+// esRole - ES role definition (PUT /_security/role/name)
+type esRole struct {
+	Indices  []esRoleIndices `json:"indices"`
+	Metadata esRoleMetadata  `json:"metadata"`
+}
+
+// viewSlug - converts project/group name into a part of view (alias) name
+func viewSlug(value string) string {
+	slug := strings.Map(
+		func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+				return r
+			}
+			return '-'
+		},
+		strings.ToLower(strings.TrimSpace(value)),
+	)
+	for strings.Contains(slug, "--") {
+		slug = strings.Replace(slug, "--", "-", -1)
+	}
+	return strings.Trim(slug, "-")
+}
+
+// templateFilter - returns a copy of view filter with ViewValue replaced in all strings (keys and values)
+func templateFilter(filter interface{}, value string) interface{} {
+	switch v := filter.(type) {
+	case string:
+		return strings.Replace(v, ViewValue, value, -1)
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{})
+		for k, item := range v {
+			key, ok := k.(string)
+			if ok {
+				k = strings.Replace(key, ViewValue, value, -1)
+			}
+			m[k] = templateFilter(item, value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, item := range v {
+			m[strings.Replace(k, ViewValue, value, -1)] = templateFilter(item, value)
+		}
+		return m
+	case []interface{}:
+		a := []interface{}{}
+		for _, item := range v {
+			a = append(a, templateFilter(item, value))
+		}
+		return a
+	}
+	return filter
+}
+
+// viewValues - returns sorted distinct values a templated view is generated for
+// Projects and groups are taken from the data source alias points from (all fixture data sources when it is not one of them)
+func viewValues(fixture *Fixture, from, forEach string) (values []string, err error) {
+	m := make(map[string]struct{})
+	if forEach == ViewForEachWorkingGroups {
+		for _, wg := range fixture.Metadata.WorkingGroups {
+			m[wg.Name] = struct{}{}
+		}
+	} else {
+		if forEach != ViewForEachProjects && forEach != ViewForEachGroups {
+			err = fmt.Errorf("unknown view for_each '%s', allowed: %s, %s, %s", forEach, ViewForEachProjects, ViewForEachGroups, ViewForEachWorkingGroups)
+			return
+		}
+		dataSources := []DataSource{}
+		for _, ds := range fixture.DataSources {
+			if strings.Replace("sds-"+from, "/", "-", -1) == strings.Replace("sds-"+fixture.Slug+"-"+ds.FullSlug, "/", "-", -1) {
+				dataSources = []DataSource{ds}
+				break
+			}
+			dataSources = append(dataSources, ds)
+		}
+		for _, ds := range dataSources {
+			for _, endpoint := range ds.Endpoints {
+				if forEach == ViewForEachProjects {
+					m[endpoint.Project] = struct{}{}
+					for _, project := range endpoint.Projects {
+						m[project.Name] = struct{}{}
+					}
+					continue
+				}
+				for _, group := range endpoint.Groups {
+					if group.Self {
+						m[endpoint.Name] = struct{}{}
+						continue
+					}
+					m[group.Name] = struct{}{}
+				}
+			}
+		}
+	}
+	delete(m, "")
+	for value := range m {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return
+}
+
+// ExpandAliasViews - replaces templated views (with for_each set) by one view per project, group or working group
+// View name and filter strings can use {{value}} placeholder, in view name it is replaced by value's slug
+// Must be called before NormalizeAliases (it expects 'from' as specified in the fixture)
+func ExpandAliasViews(fixture *Fixture) (err error) {
+	for ai, alias := range fixture.Aliases {
+		views := []AliasView{}
+		for _, view := range alias.Views {
+			if view.ForEach == "" {
+				views = append(views, view)
+				continue
+			}
+			if !strings.Contains(view.Name, ViewValue) {
+				err = fmt.Errorf("fixture %s: templated view '%s' name must contain %s", fixture.Slug, view.Name, ViewValue)
+				return
+			}
+			var values []string
+			values, err = viewValues(fixture, alias.From, view.ForEach)
+			if err != nil {
+				err = fmt.Errorf("fixture %s: view '%s': %+v", fixture.Slug, view.Name, err)
+				return
+			}
+			for _, value := range values {
+				views = append(
+					views,
+					AliasView{
+						Name:   strings.Replace(view.Name, ViewValue, viewSlug(value), -1),
+						Filter: templateFilter(view.Filter, value),
+						Role:   view.Role,
+						Fields: view.Fields,
+					},
+				)
+			}
+		}
+		fixture.Aliases[ai].Views = views
+	}
+	return
+}
+
+// ViewRoles - returns ES security roles for views with role flag set, role is named as the view
+// (views with the same name in multiple fixtures give a single role, granted fields are merged)
+// Indices and queries are taken from desired aliases state, so they include shared endpoints owners' indices
+func ViewRoles(fixtures []Fixture, desired []AliasState) (roles []ViewRole) {
+	byName := make(map[string]map[string]struct{})
+	for _, fixture := range fixtures {
+		for _, alias := range fixture.Aliases {
+			for _, view := range alias.Views {
+				if !view.Role {
+					continue
+				}
+				name := strings.Replace(view.Name, "/", "-", -1)
+				fields, ok := byName[name]
+				if !ok {
+					fields = make(map[string]struct{})
+					byName[name] = fields
+				}
+				for _, field := range view.Fields {
+					fields[field] = struct{}{}
+				}
+			}
+		}
+	}
+	// view -> filter -> indices
+	queries := make(map[string]map[string][]string)
+	for _, state := range desired {
+		_, ok := byName[state.Alias]
+		if !ok {
+			continue
+		}
+		_, ok = queries[state.Alias]
+		if !ok {
+			queries[state.Alias] = make(map[string][]string)
+		}
+		queries[state.Alias][state.Filter] = append(queries[state.Alias][state.Filter], state.Index)
+	}
+	for name, fields := range byName {
+		role := ViewRole{Name: name}
+		for field := range fields {
+			role.Fields = append(role.Fields, field)
+		}
+		sort.Strings(role.Fields)
+		for query, names := range queries[name] {
+			sort.Strings(names)
+			role.Indices = append(role.Indices, ViewRoleIndices{Names: names, Query: query})
+		}
+		sort.Slice(role.Indices, func(i, j int) bool {
+			return role.Indices[i].Names[0] < role.Indices[j].Names[0]
+		})
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+	return
+}
+
+// ViewRoleDefinition - returns ES role definition (JSON) for PUT /_security/role/name
+func ViewRoleDefinition(role *ViewRole) (data []byte, err error) {
+	def := esRole{Indices: []esRoleIndices{}, Metadata: esRoleMetadata{SDSViewRole: true}}
+	for _, roleIndices := range role.Indices {
+		indices := esRoleIndices{Names: roleIndices.Names, Privileges: []string{"read", "view_index_metadata"}, Query: roleIndices.Query}
+		if len(role.Fields) > 0 {
+			indices.FieldSecurity = &esRoleFieldSecurity{Grant: role.Fields}
+		}
+		def.Indices = append(def.Indices, indices)
+	}
+	return jsoniter.Marshal(def)
+}
+
+// PutViewRoles - creates or updates ES security roles for views (requires ES security features)
+// Roles without indices are not created (a role without indices would give no access anyway)
+func PutViewRoles(ctx *Ctx, roles []ViewRole) (n int, err error) {
+	for i := range roles {
+		role := &roles[i]
+		if len(role.Indices) == 0 {
+			if ctx.Debug > 0 {
+				Printf("View %s points to no indices, not creating its role\n", role.Name)
+			}
+			continue
+		}
+		var data []byte
+		data, err = ViewRoleDefinition(role)
+		if err != nil {
+			return
+		}
+		path := "/_security/role/" + role.Name
+		if ctx.DryRun {
+			Printf("DryRun: Method:%s url:%s data:%s\n", Put, path, data)
+			continue
+		}
+		var (
+			status int
+			body   []byte
+		)
+		status, body, err = esRequest(ctx, Printf, Put, path, string(data))
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Put, path, status, body)
+			return
+		}
+		n++
+		indices := []string{}
+		for _, roleIndices := range role.Indices {
+			indices = append(indices, roleIndices.Names...)
+		}
+		RecordChange(ReportChangeAlias, "role", role.Name, strings.Join(indices, ","))
+	}
+	return
+}
+
+// DeleteStaleViewRoles - deletes views roles (marked by sds_view_role metadata) whose views are no longer defined in fixtures
+// Must only be called when all fixtures are processed
+func DeleteStaleViewRoles(ctx *Ctx, roles []ViewRole) (deleted []string, err error) {
+	path := "/_security/role"
+	status, body, err := esRequest(ctx, Printf, Get, path, "")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Get, path, status, body)
+		return
+	}
+	var current map[string]struct {
+		Metadata esRoleMetadata `json:"metadata"`
+	}
+	err = jsoniter.Unmarshal(body, &current)
+	if err != nil {
+		return
+	}
+	keep := make(map[string]struct{})
+	for _, role := range roles {
+		keep[role.Name] = struct{}{}
+	}
+	stale := []string{}
+	for name, role := range current {
+		_, ok := keep[name]
+		if ok || !role.Metadata.SDSViewRole {
+			continue
+		}
+		stale = append(stale, name)
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		path := "/_security/role/" + name
+		if ctx.DryRun {
+			Printf("DryRun: Method:%s url:%s\n", Delete, path)
+			continue
+		}
+		status, body, err = esRequest(ctx, Printf, Delete, path, "")
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("Method:%s url:%s status:%d\n%s", Delete, path, status, body)
+			return
+		}
+		deleted = append(deleted, name)
+		RecordChange(ReportChangeAlias, "role-remove", name, "")
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package syncdatasources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	lib "github.com/LF-Engineering/sync-data-sources/sources"
+)
+
+func TestExpandAliasViews(t *testing.T) {
+	filter := map[interface{}]interface{}{"term": map[interface{}]interface{}{"{{value}}_field": "{{value}}", "n": 1}}
+	fixture := lib.Fixture{
+		Slug: "finos/odp",
+		DataSources: []lib.DataSource{
+			{
+				Slug:     "git",
+				FullSlug: "git",
+				Endpoints: []lib.Endpoint{
+					{Name: "https://github.com/finos/a", Project: "Project A", Groups: []lib.GroupConfig{{Name: "core"}, {Self: true}}},
+					{Name: "https://github.com/finos/b", Projects: []lib.EndpointProject{{Name: "Project B"}}},
+				},
+			},
+			{Slug: "jira", FullSlug: "jira", Endpoints: []lib.Endpoint{{Name: "https://jira.finos.org", Project: "Project J"}}},
+		},
+		Metadata: lib.Metadata{WorkingGroups: []lib.MetaWorkingGroup{{Name: "Security WG"}}},
+		Aliases: []lib.Alias{
+			{
+				From: "finos/odp-git",
+				Views: []lib.AliasView{
+					{Name: "finos/static", Filter: filter},
+					{Name: "finos/{{value}}-git", Filter: filter, ForEach: lib.ViewForEachProjects, Role: true, Fields: []string{"project"}},
+					{Name: "finos/group-{{value}}", Filter: filter, ForEach: lib.ViewForEachGroups},
+				},
+			},
+			{
+				From:  "pattern:sds-finos-*",
+				Views: []lib.AliasView{{Name: "finos/{{value}}", Filter: filter, ForEach: lib.ViewForEachProjects}},
+			},
+			{
+				From:  "pattern:sds-finos-*",
+				Views: []lib.AliasView{{Name: "finos/wg-{{value}}", Filter: filter, ForEach: lib.ViewForEachWorkingGroups, Role: true}},
+			},
+		},
+	}
+	err := lib.ExpandAliasViews(&fixture)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	lib.NormalizeAliases(&fixture)
+
+	// Test cases
+	var testCases = []struct {
+		alias int
+		names []string
+	}{
+		{alias: 0, names: []string{"sds-finos-static", "sds-finos-project-a-git", "sds-finos-project-b-git", "sds-finos-group-core", "sds-finos-group-https-github-com-finos-a"}},
+		{alias: 1, names: []string{"sds-finos-project-a", "sds-finos-project-b", "sds-finos-project-j"}},
+		{alias: 2, names: []string{"sds-finos-wg-security-wg"}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		names := []string{}
+		for _, view := range fixture.Aliases[test.alias].Views {
+			names = append(names, view.Name)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("test number %d, expected views %+v, got %+v", index+1, test.names, names)
+		}
+	}
+	view := fixture.Aliases[0].Views[1]
+	expectedFilter := map[interface{}]interface{}{"term": map[interface{}]interface{}{"Project A_field": "Project A", "n": 1}}
+	if !reflect.DeepEqual(view.Filter, expectedFilter) || !view.Role || !reflect.DeepEqual(view.Fields, []string{"project"}) {
+		t.Errorf("unexpected expanded view %+v", view)
+	}
+	if !reflect.DeepEqual(fixture.Aliases[0].Views[0].Filter, filter) {
+		t.Errorf("static view filter should not change, got %+v", fixture.Aliases[0].Views[0].Filter)
+	}
+
+	// Roles
+	desired, _ := lib.DesiredAliases([]lib.Fixture{fixture}, []string{"sds-finos-odp-git", "sds-finos-odp-jira", "sds-finos-shared-git"})
+	desired = append(desired, lib.AliasState{Index: "sds-finos-shared-git", Alias: "sds-finos-project-a-git", Filter: `{"terms":{"origin":["x"]}}`})
+	roles := lib.ViewRoles([]lib.Fixture{fixture}, desired)
+	projectA := `{"term":{"Project A_field":"Project A","n":1}}`
+	wg := `{"term":{"Security WG_field":"Security WG","n":1}}`
+	expectedRoles := []lib.ViewRole{
+		{
+			Name: "sds-finos-project-a-git",
+			Indices: []lib.ViewRoleIndices{
+				{Names: []string{"sds-finos-odp-git"}, Query: projectA},
+				{Names: []string{"sds-finos-shared-git"}, Query: `{"terms":{"origin":["x"]}}`},
+			},
+			Fields: []string{"project"},
+		},
+		{Name: "sds-finos-project-b-git", Indices: []lib.ViewRoleIndices{{Names: []string{"sds-finos-odp-git"}, Query: `{"term":{"Project B_field":"Project B","n":1}}`}}, Fields: []string{"project"}},
+		{Name: "sds-finos-wg-security-wg", Indices: []lib.ViewRoleIndices{{Names: []string{"sds-finos-odp-git", "sds-finos-odp-jira", "sds-finos-shared-git"}, Query: wg}}},
+	}
+	if !reflect.DeepEqual(roles, expectedRoles) {
+		t.Errorf("expected roles %+v, got %+v", expectedRoles, roles)
+	}
+	data, err := lib.ViewRoleDefinition(&roles[0])
+	expected := `{"indices":[{"names":["sds-finos-odp-git"],"privileges":["read","view_index_metadata"],"query":"{\"term\":{\"Project A_field\":\"Project A\",\"n\":1}}","field_security":{"grant":["project"]}},` +
+		`{"names":["sds-finos-shared-git"],"privileges":["read","view_index_metadata"],"query":"{\"terms\":{\"origin\":[\"x\"]}}","field_security":{"grant":["project"]}}],"metadata":{"sds_view_role":true}}`
+	if err != nil || string(data) != expected {
+		t.Errorf("expected role definition %s, got %s: %+v", expected, data, err)
+	}
+	roles = lib.ViewRoles([]lib.Fixture{fixture}, nil)
+	if len(roles) != 3 || len(roles[2].Indices) != 0 {
+		t.Errorf("expected roles without indices, got %+v", roles)
+	}
+
+	// Errors
+	bad := lib.Fixture{Aliases: []lib.Alias{{From: "x", Views: []lib.AliasView{{Name: "{{value}}", ForEach: "repos"}}}}}
+	if lib.ExpandAliasViews(&bad) == nil {
+		t.Errorf("expected error for unknown for_each")
+	}
+	bad = lib.Fixture{Aliases: []lib.Alias{{From: "x", Views: []lib.AliasView{{Name: "view", ForEach: lib.ViewForEachProjects}}}}}
+	if lib.ExpandAliasViews(&bad) == nil {
+		t.Errorf("expected error for templated view name without placeholder")
+	}
+}
+
+func TestPutViewRoles(t *testing.T) {
+	_ = os.Setenv("SDS_SIMPLE_PRINTF", "1")
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+string(body))
+		switch {
+		case req.URL.Path == "/_security/role/sds-bad":
+			w.WriteHeader(400)
+		case req.Method == "GET":
+			fmt.Fprintf(w, `{"sds-a":{"metadata":{"sds_view_role":true}},"sds-old":{"metadata":{"sds_view_role":true}},"admin":{"metadata":{}}}`)
+		default:
+			fmt.Fprintf(w, `{"role":{"created":true}}`)
+		}
+	}))
+	defer srv.Close()
+	ctx := lib.Ctx{ElasticURL: srv.URL}
+	roles := []lib.ViewRole{
+		{Name: "sds-a", Indices: []lib.ViewRoleIndices{{Names: []string{"sds-x-git"}, Query: `{"term":{"a":1}}`}}},
+		{Name: "sds-none"},
+	}
+	n, err := lib.PutViewRoles(&ctx, roles)
+	expected := []string{`PUT /_security/role/sds-a {"indices":[{"names":["sds-x-git"],"privileges":["read","view_index_metadata"],"query":"{\"term\":{\"a\":1}}"}],"metadata":{"sds_view_role":true}}`}
+	if err != nil || n != 1 || !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %+v, got %d %+v: %+v", expected, n, requests, err)
+	}
+
+	// Only roles created for views that are no longer defined are deleted
+	requests = []string{}
+	deleted, err := lib.DeleteStaleViewRoles(&ctx, roles)
+	expected = []string{"GET /_security/role ", "DELETE /_security/role/sds-old "}
+	if err != nil || !reflect.DeepEqual(deleted, []string{"sds-old"}) || !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %+v, got %+v %+v: %+v", expected, deleted, requests, err)
+	}
+
+	requests = []string{}
+	ctx.DryRun = true
+	_, err = lib.PutViewRoles(&ctx, roles)
+	if err != nil || len(requests) != 0 {
+		t.Errorf("dry run should not send requests, got %+v: %+v", requests, err)
+	}
+	deleted, err = lib.DeleteStaleViewRoles(&ctx, roles)
+	if err != nil || len(deleted) != 0 || len(requests) != 1 {
+		t.Errorf("dry run should not delete roles, got %+v %+v: %+v", deleted, requests, err)
+	}
+	ctx.DryRun = false
+	_, err = lib.PutViewRoles(&ctx, []lib.ViewRole{{Name: "sds-bad", Indices: roles[0].Indices}})
+	if err == nil {
+		t.Errorf("expected error for rejected role")
+	}
+}